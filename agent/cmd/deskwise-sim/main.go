@@ -0,0 +1,134 @@
+// Command deskwise-sim simulates the agent-facing Deskwise API so the agent can
+// be developed and tested offline, without the Next.js SaaS.
+//
+// It serves /api/agent/enroll, /api/agent/performance, /api/agent/rc/poll,
+// /api/agent/rc/screenshot, /api/agent/rc/power, /api/agent/rc/artifacts, /api/rc/signalling, /api/rc/artifacts and the /api/rc/relay WebSocket from
+// memory, records every request, and injects errors, delays, dropped connections
+// and session requests from a script or through the /sim/ control API:
+//
+//	deskwise-sim -listen 127.0.0.1:9002 -record requests.jsonl -script faults.jsonl
+//	deskwise-agent -server http://127.0.0.1:9002 -enrollment-token anything
+//	curl -X POST localhost:9002/sim/sessions -d '{"sessionId":"demo","token":"secret","iceServers":[]}'
+//	deskwise-viewer -server http://127.0.0.1:9002 -session demo -token secret
+//
+// Agents started with -rfb-interface also pick up VNC one-time passwords:
+//
+//	curl -X POST localhost:9002/sim/rfb -d '{"password":"k3y5ecr7"}'
+//
+// Screenshots requested through /sim/screenshots are uploaded by the next poll:
+//
+//	curl -X POST localhost:9002/sim/screenshots -d '{"ticketId":"T-1","monitor":-1,"format":"jpeg","scale":0.5}'
+//	curl localhost:9002/sim/screenshots
+//
+// Agents started with -power-actions pick up power actions requested through
+// /sim/power the same way, and their reports (including the outcome of a reboot,
+// after it) are listed there:
+//
+//	curl -X POST localhost:9002/sim/power -d '{"action":"lock","delaySeconds":60,"message":"Locking for maintenance"}'
+//	curl localhost:9002/sim/power
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"deskwise-agent/internal/simserver"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:9002", "Address to serve the simulated API on")
+	enrollmentToken := flag.String("enrollment-token", "", "Enrollment token agents must present (default: accept any)")
+	requireEnrollment := flag.Bool("require-enrollment", false, "Reject credentials the simulator did not issue")
+	credentialFile := flag.String("credential-file", "", "Accept an existing agent credential file without re-enrolling")
+	record := flag.String("record", "", "Append every received request to this JSON-lines file")
+	script := flag.String("script", "", "Script of timed faults and session requests (JSON lines)")
+
+	flag.Parse()
+
+	sim, err := simserver.New(simserver.Options{
+		EnrollmentToken:   *enrollmentToken,
+		RequireEnrollment: *requireEnrollment,
+		RecordPath:        *record,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create simulator: %v", err)
+	}
+	defer sim.Close()
+
+	if *credentialFile != "" {
+		if err := registerCredential(sim, *credentialFile); err != nil {
+			log.Fatalf("Failed to load credential file: %v", err)
+		}
+	}
+
+	var steps []simserver.ScriptStep
+	if *script != "" {
+		if steps, err = simserver.LoadScript(*script); err != nil {
+			log.Fatalf("Failed to load script: %v", err)
+		}
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	server := &http.Server{Handler: sim.Handler()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+		<-sigChan
+		log.Printf("Shutting down simulator...")
+		cancel()
+
+		shutdownCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+		defer stop()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if len(steps) > 0 {
+		go sim.RunScript(ctx, steps)
+	}
+
+	log.Printf("Deskwise simulator listening on http://%s", listener.Addr())
+	log.Printf("Point an agent at it with: -server http://%s", listener.Addr())
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Simulator stopped: %v", err)
+	}
+
+	log.Printf("Simulator recorded %d requests from %d agents", len(sim.Requests()), len(sim.Agents()))
+}
+
+// registerCredential accepts the credential an agent saved from a previous enrollment
+func registerCredential(sim *simserver.Server, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var cred struct {
+		AgentID       string `json:"agentId"`
+		AssetID       string `json:"assetId"`
+		CredentialKey string `json:"credentialKey"`
+	}
+	if err := json.Unmarshal(data, &cred); err != nil {
+		return err
+	}
+
+	return sim.RegisterAgent(simserver.Agent{
+		AgentID:       cred.AgentID,
+		AssetID:       cred.AssetID,
+		CredentialKey: cred.CredentialKey,
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4/pkg/media/samplebuilder"
+	"golang.org/x/image/vp8"
+
+	"deskwise-agent/remotecontrol"
+)
+
+// latencyPingInterval matches the agent's ping rate
+const latencyPingInterval = 2 * time.Second
+
+// latencyProbe answers the agent's pings, measures its own round trips and,
+// when frame echo is on, reports the frame ID of every decoded key frame back
+// to the agent. Inter frames cannot be decoded here, so echoes arrive about once
+// per second; the agent only measures glass-to-glass on frames that are echoed.
+type latencyProbe struct {
+	send       func(message interface{}) error
+	echoFrames bool
+
+	mu       sync.Mutex
+	pings    map[uint32]time.Time
+	nextPing uint32
+	rtts     []time.Duration
+	builders map[int]*samplebuilder.SampleBuilder
+	decoder  *vp8.Decoder
+	echoed   int
+}
+
+func newLatencyProbe(echoFrames bool, send func(message interface{}) error) *latencyProbe {
+	return &latencyProbe{
+		send:       send,
+		echoFrames: echoFrames,
+		pings:      make(map[uint32]time.Time),
+		builders:   make(map[int]*samplebuilder.SampleBuilder),
+	}
+}
+
+// Start asks the agent for frame IDs (if enabled) and pings it until ctx ends
+func (p *latencyProbe) Start(ctx context.Context) {
+	if p.echoFrames {
+		if err := p.send(map[string]interface{}{"type": "latency", "frameIds": true}); err != nil {
+			log.Printf("[Viewer] Failed to enable frame echo: %v", err)
+		}
+	}
+
+	ticker := time.NewTicker(latencyPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		p.nextPing++
+		id := p.nextPing
+		p.pings[id] = time.Now()
+		p.mu.Unlock()
+
+		if err := p.send(map[string]interface{}{"type": "ping", "id": id}); err != nil {
+			return
+		}
+	}
+}
+
+// HandleMessage answers agent pings and records pongs; it reports whether the message was handled
+func (p *latencyProbe) HandleMessage(msgType string, data []byte) bool {
+	switch msgType {
+	case "ping":
+		var ping map[string]interface{}
+		if err := json.Unmarshal(data, &ping); err != nil {
+			return true
+		}
+		ping["type"] = "pong"
+		if err := p.send(ping); err != nil {
+			log.Printf("[Viewer] Failed to answer ping: %v", err)
+		}
+		return true
+
+	case "pong":
+		var pong struct {
+			ID uint32 `json:"id"`
+		}
+		if err := json.Unmarshal(data, &pong); err != nil {
+			return true
+		}
+
+		p.mu.Lock()
+		if sent, ok := p.pings[pong.ID]; ok {
+			delete(p.pings, pong.ID)
+			p.rtts = append(p.rtts, time.Since(sent))
+		}
+		p.mu.Unlock()
+		return true
+	}
+	return false
+}
+
+// WriteRTP decodes key frames and echoes the frame ID embedded in them
+func (p *latencyProbe) WriteRTP(track int, packet *rtp.Packet) {
+	if !p.echoFrames {
+		return
+	}
+
+	p.mu.Lock()
+	builder, ok := p.builders[track]
+	if !ok {
+		builder = samplebuilder.New(128, &codecs.VP8Packet{}, 90000)
+		p.builders[track] = builder
+	}
+	if p.decoder == nil {
+		p.decoder = vp8.NewDecoder()
+	}
+
+	var ids []uint32
+	builder.Push(packet)
+	for sample := builder.Pop(); sample != nil; sample = builder.Pop() {
+		if !isKeyFrame(sample.Data) {
+			continue
+		}
+		img, err := decodeKeyFrame(p.decoder, sample.Data)
+		if err != nil {
+			continue
+		}
+		if id, ok := remotecontrol.ReadFrameCounter(img); ok && id != 0 {
+			ids = append(ids, id)
+		}
+	}
+	p.echoed += len(ids)
+	p.mu.Unlock()
+
+	for _, id := range ids {
+		if err := p.send(map[string]interface{}{"type": "frame-rendered", "id": id}); err != nil {
+			log.Printf("[Viewer] Failed to echo frame %d: %v", id, err)
+		}
+	}
+}
+
+// Summary describes the measured round trips and echoed frames
+func (p *latencyProbe) Summary() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.rtts) == 0 {
+		return fmt.Sprintf("no round trips measured, %d frames echoed", p.echoed)
+	}
+
+	sorted := append([]time.Duration(nil), p.rtts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return fmt.Sprintf("rtt p50=%v max=%v (n=%d), %d frames echoed",
+		sorted[len(sorted)/2].Round(100*time.Microsecond),
+		sorted[len(sorted)-1].Round(100*time.Microsecond),
+		len(sorted), p.echoed)
+}
@@ -0,0 +1,186 @@
+// Command deskwise-viewer plays the operator side of a remote control session.
+//
+// It posts an offer through the signalling API, records the agent's VP8 track
+// to an IVF file or to PNG key frames, and can replay a script of input events
+// over the control data channel. With -listen it also runs an in-memory
+// stand-in for the signalling API, so a complete agent<->viewer session can be
+// tested on one machine without the SaaS backend or STUN:
+//
+//	deskwise-viewer -listen 127.0.0.1:9100 -out session.ivf -script input.jsonl
+//	deskwise-agent -server http://127.0.0.1:9100 -credential-file test-credential.json
+//
+// -relay skips WebRTC and receives the session through the server's WebSocket
+// relay; -block-ice withholds ICE candidates so the agent's automatic fallback
+// to the relay can be exercised. -pin answers the agent's unattended-access PIN
+// prompt; a missing or rejected PIN ends the run with an error.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"deskwise-agent/internal/signalserver"
+	"deskwise-agent/remotecontrol"
+)
+
+func main() {
+	serverURL := flag.String("server", "http://localhost:9002", "Deskwise server (or stand-in) URL")
+	listen := flag.String("listen", "", "Run the stand-in signalling server on this address (e.g. 127.0.0.1:9100)")
+	sessionID := flag.String("session", "", "Session ID (default: generated when -listen is set)")
+	token := flag.String("token", "", "Session token (default: generated when -listen is set)")
+	iceURLs := flag.String("ice", "", "Comma-separated STUN/TURN URLs (default: none, host candidates only)")
+	out := flag.String("out", "", "Record video to an .ivf file, or PNG key frames into a directory")
+	format := flag.String("format", "", "Output format: ivf or png (default: from -out)")
+	script := flag.String("script", "", "Input script to send once connected (JSON lines)")
+	tracks := flag.Int("tracks", 1, "Number of video tracks to receive (per-monitor mode)")
+	duration := flag.Duration("duration", 30*time.Second, "How long to stay connected")
+	maxFrames := flag.Int("frames", 0, "Disconnect after this many frames (0 = until -duration)")
+	minFrames := flag.Int("min-frames", 0, "Exit with an error if fewer frames were received")
+	connectTimeout := flag.Duration("connect-timeout", 60*time.Second, "How long to wait for the agent to connect")
+	pollInterval := flag.Duration("poll", 500*time.Millisecond, "Signalling poll interval")
+	frameEcho := flag.Bool("latency", false, "Ask the agent to embed frame IDs and echo decoded key frames for glass-to-glass latency")
+	relay := flag.Bool("relay", false, "Skip WebRTC and use the server's WebSocket relay")
+	blockICE := flag.Bool("block-ice", false, "Withhold ICE candidates, as on a network that blocks UDP, so the agent falls back to the relay")
+	pin := flag.String("pin", "", "Unattended-access PIN to enter when the agent asks for one (default: $DESKWISE_ACCESS_PIN)")
+
+	flag.Parse()
+
+	// The environment keeps the PIN out of the process list
+	if *pin == "" {
+		*pin = os.Getenv("DESKWISE_ACCESS_PIN")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		log.Printf("Interrupted, closing session")
+		cancel()
+	}()
+
+	if *listen != "" {
+		if *sessionID == "" {
+			*sessionID = "local-" + randomHex(4)
+		}
+		if *token == "" {
+			*token = randomHex(16)
+		}
+
+		url, err := startStandIn(*listen, *sessionID, *token, *iceURLs)
+		if err != nil {
+			log.Fatalf("Failed to start stand-in server: %v", err)
+		}
+		*serverURL = url
+	}
+
+	if *sessionID == "" || *token == "" {
+		log.Fatal("-session and -token are required unless -listen is set")
+	}
+
+	recorder, err := newFrameRecorder(*out, *format)
+	if err != nil {
+		log.Fatalf("Failed to create recorder: %v", err)
+	}
+
+	var steps []scriptStep
+	if *script != "" {
+		if steps, err = loadScript(*script); err != nil {
+			log.Fatalf("Failed to load script: %v", err)
+		}
+	}
+
+	v := newViewer(viewerConfig{
+		signal:       remotecontrol.NewSignalClientForRole(*serverURL, *sessionID, *token, "operator"),
+		iceServers:   splitList(*iceURLs),
+		tracks:       *tracks,
+		recorder:     recorder,
+		maxFrames:    *maxFrames,
+		pollInterval: *pollInterval,
+		frameEcho:    *frameEcho,
+		relay:        *relay,
+		blockICE:     *blockICE,
+		pin:          *pin,
+	})
+
+	summary, err := v.Run(ctx, *connectTimeout, *duration, steps)
+	if closeErr := recorder.Close(); closeErr != nil {
+		log.Printf("Failed to finalize recording: %v", closeErr)
+	}
+	log.Printf("Summary: %s", summary)
+
+	if err != nil {
+		log.Fatalf("Session failed: %v", err)
+	}
+	if summary.Frames < *minFrames {
+		log.Fatalf("Received %d frames, expected at least %d", summary.Frames, *minFrames)
+	}
+}
+
+// startStandIn serves the in-memory signalling API and offers one session to agents
+func startStandIn(address, sessionID, token, iceURLs string) (string, error) {
+	server := signalserver.New()
+
+	iceServers := []remotecontrol.ICEServer{}
+	if urls := splitList(iceURLs); len(urls) > 0 {
+		iceServers = append(iceServers, remotecontrol.ICEServer{URLs: urls})
+	}
+
+	if err := server.AddSession(signalserver.Session{
+		ID:      sessionID,
+		Token:   token,
+		AssetID: "local-asset",
+		OrgID:   "local-org",
+		Fields: map[string]interface{}{
+			"iceServers": iceServers,
+		},
+	}); err != nil {
+		return "", err
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return "", err
+	}
+	go func() {
+		if err := http.Serve(listener, server.Handler()); err != nil {
+			log.Printf("Stand-in server stopped: %v", err)
+		}
+	}()
+
+	url := "http://" + listener.Addr().String()
+	log.Printf("Stand-in signalling server on %s offering session %s", url, sessionID)
+	log.Printf("Point an agent at it with: -server %s", url)
+	return url, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	return hex.EncodeToString(buf)
+}
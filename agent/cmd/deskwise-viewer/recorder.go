@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v4/pkg/media/samplebuilder"
+	"golang.org/x/image/vp8"
+)
+
+// frameRecorder stores the received VP8 stream
+type frameRecorder interface {
+	WriteRTP(track int, packet *rtp.Packet) error
+	Close() error
+}
+
+// newFrameRecorder picks the recorder for an output path; an empty path discards frames
+func newFrameRecorder(path, format string) (frameRecorder, error) {
+	if path == "" {
+		return discardRecorder{}, nil
+	}
+
+	if format == "" {
+		format = "png"
+		if strings.EqualFold(filepath.Ext(path), ".ivf") {
+			format = "ivf"
+		}
+	}
+
+	switch format {
+	case "ivf":
+		return &ivfRecorder{path: path, writers: make(map[int]*ivfwriter.IVFWriter)}, nil
+	case "png":
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create output directory: %w", err)
+		}
+		return &pngRecorder{dir: path, builders: make(map[int]*samplebuilder.SampleBuilder)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q (use ivf or png)", format)
+	}
+}
+
+type discardRecorder struct{}
+
+func (discardRecorder) WriteRTP(int, *rtp.Packet) error { return nil }
+func (discardRecorder) Close() error                    { return nil }
+
+// ivfRecorder writes each track to an IVF file (track 0 to path, others to path-N.ivf)
+type ivfRecorder struct {
+	path string
+
+	mu      sync.Mutex
+	writers map[int]*ivfwriter.IVFWriter
+}
+
+func (r *ivfRecorder) WriteRTP(track int, packet *rtp.Packet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	writer, ok := r.writers[track]
+	if !ok {
+		path := r.path
+		if track > 0 {
+			path = fmt.Sprintf("%s-%d.ivf", strings.TrimSuffix(r.path, filepath.Ext(r.path)), track)
+		}
+
+		var err error
+		writer, err = ivfwriter.New(path, ivfwriter.WithCodec(webrtc.MimeTypeVP8))
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		r.writers[track] = writer
+	}
+
+	return writer.WriteRTP(packet)
+}
+
+func (r *ivfRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for _, writer := range r.writers {
+		if err := writer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// pngRecorder decodes VP8 key frames and writes them as PNG files.
+// Inter frames cannot be decoded without a full VP8 decoder and are skipped;
+// the agent's encoder emits a key frame every second.
+type pngRecorder struct {
+	dir string
+
+	mu       sync.Mutex
+	builders map[int]*samplebuilder.SampleBuilder
+	decoder  *vp8.Decoder
+	written  int
+}
+
+func (r *pngRecorder) WriteRTP(track int, packet *rtp.Packet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	builder, ok := r.builders[track]
+	if !ok {
+		builder = samplebuilder.New(128, &codecs.VP8Packet{}, 90000)
+		r.builders[track] = builder
+	}
+
+	builder.Push(packet)
+	for sample := builder.Pop(); sample != nil; sample = builder.Pop() {
+		// Bit 0 of the first byte is the inverse key frame flag
+		if len(sample.Data) == 0 || sample.Data[0]&0x01 != 0 {
+			continue
+		}
+		if err := r.writeKeyFrame(track, sample.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *pngRecorder) writeKeyFrame(track int, data []byte) error {
+	if r.decoder == nil {
+		r.decoder = vp8.NewDecoder()
+	}
+
+	img, err := decodeKeyFrame(r.decoder, data)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(r.dir, fmt.Sprintf("track%d-%06d.png", track, r.written))
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	r.written++
+	return nil
+}
+
+func (r *pngRecorder) Close() error {
+	return nil
+}
+
+// isKeyFrame checks the inverse key frame flag in bit 0 of a VP8 frame
+func isKeyFrame(data []byte) bool {
+	return len(data) > 0 && data[0]&0x01 == 0
+}
+
+// decodeKeyFrame decodes a complete VP8 key frame
+func decodeKeyFrame(decoder *vp8.Decoder, data []byte) (image.Image, error) {
+	decoder.Init(bytes.NewReader(data), len(data))
+	if _, err := decoder.DecodeFrameHeader(); err != nil {
+		return nil, fmt.Errorf("failed to decode VP8 header: %w", err)
+	}
+	img, err := decoder.DecodeFrame()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode VP8 key frame: %w", err)
+	}
+	return img, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media/ivfreader"
+)
+
+// vp8Packet wraps a whole VP8 frame in a single RTP packet
+func vp8Packet(seq uint16, timestamp uint32, frame ...byte) *rtp.Packet {
+	return &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			Marker:         true,
+			SequenceNumber: seq,
+			Timestamp:      timestamp,
+		},
+		// Payload descriptor: start of partition 0
+		Payload: append([]byte{0x10}, frame...),
+	}
+}
+
+func TestNewFrameRecorder(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		path   string
+		format string
+		want   string
+		ok     bool
+	}{
+		{"no output", "", "", "discard", true},
+		{"ivf by extension", filepath.Join(dir, "out.IVF"), "", "ivf", true},
+		{"png by default", filepath.Join(dir, "frames"), "", "png", true},
+		{"explicit ivf", filepath.Join(dir, "out.bin"), "ivf", "ivf", true},
+		{"explicit png", filepath.Join(dir, "out.ivf"), "png", "png", true},
+		{"unknown format", filepath.Join(dir, "out.webm"), "webm", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder, err := newFrameRecorder(tt.path, tt.format)
+			if (err == nil) != tt.ok {
+				t.Fatalf("newFrameRecorder() error = %v, want ok %t", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			defer recorder.Close()
+
+			var got string
+			switch recorder.(type) {
+			case discardRecorder:
+				got = "discard"
+			case *ivfRecorder:
+				got = "ivf"
+			case *pngRecorder:
+				got = "png"
+				if info, err := os.Stat(tt.path); err != nil || !info.IsDir() {
+					t.Errorf("output directory not created: %v", err)
+				}
+			}
+			if got != tt.want {
+				t.Errorf("recorder = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIVFRecorderTracks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.ivf")
+	recorder, err := newFrameRecorder(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFrame := []byte{0x00, 0x01, 0x02, 0x03}
+	for i, track := range []int{0, 2, 0} {
+		if err := recorder.WriteRTP(track, vp8Packet(uint16(i), uint32(i)*3000, keyFrame...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Track 0 is written to the path itself, other tracks next to it
+	for name, frames := range map[string]int{"session.ivf": 2, "session-2.ivf": 1} {
+		file, err := os.Open(filepath.Join(filepath.Dir(path), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		reader, _, err := ivfreader.NewWith(file)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got := 0
+		for {
+			frame, _, err := reader.ParseNextFrame()
+			if err != nil {
+				break
+			}
+			if string(frame) != string(keyFrame) {
+				t.Errorf("%s frame %d = %x, want %x", name, got, frame, keyFrame)
+			}
+			got++
+		}
+		if got != frames {
+			t.Errorf("%s holds %d frames, want %d", name, got, frames)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "session-1.ivf")); !os.IsNotExist(err) {
+		t.Errorf("file written for a track without packets: %v", err)
+	}
+}
+
+func TestPNGRecorderKeyFramesOnly(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := newFrameRecorder(dir, "png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+
+	// Frames are complete once the next timestamp arrives; inter frames are skipped
+	for i := 0; i < 3; i++ {
+		if err := recorder.WriteRTP(0, vp8Packet(uint16(i), uint32(i)*3000, 0x01, 0x00, 0x00)); err != nil {
+			t.Fatalf("inter frame %d: %v", i, err)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files written for inter frames", len(entries))
+	}
+
+	// A key frame that does not decode is reported
+	if err := recorder.WriteRTP(0, vp8Packet(3, 9000, 0x00, 0x00, 0x00)); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.WriteRTP(0, vp8Packet(4, 12000, 0x01, 0x00, 0x00)); err == nil {
+		t.Error("undecodable key frame accepted")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files written for an undecodable key frame", len(entries))
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+
+	"deskwise-agent/remotecontrol"
+)
+
+// relayControl sends control messages over the relay WebSocket
+type relayControl struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+func (c *relayControl) SendText(text string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, []byte(text))
+}
+
+// connectRelay switches the session to the server's WebSocket relay; frames and
+// control messages from then on arrive over it instead of the peer connection
+func (v *viewer) connectRelay(ctx context.Context) error {
+	v.relayOnce.Do(func() {
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, v.config.signal.RelayURL(), nil)
+		if err != nil {
+			v.relayErr = fmt.Errorf("failed to connect to relay: %w", err)
+			return
+		}
+
+		control := &relayControl{conn: conn}
+		v.mu.Lock()
+		v.control = control
+		v.mu.Unlock()
+
+		log.Printf("[Viewer] Connected to the WebSocket relay, waiting for the agent")
+		go v.readRelay(conn)
+	})
+	return v.relayErr
+}
+
+// readRelay hands relayed frames to the same path as RTP and control messages to the handler
+func (v *viewer) readRelay(conn *websocket.Conn) {
+	defer conn.Close()
+
+	// Frames are packetized like the agent's RTP track so the recorders and the
+	// latency probe work unchanged
+	packetizers := make(map[int]rtp.Packetizer)
+	origins := make(map[int]time.Time)
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			log.Printf("[Viewer] Relay closed: %v", err)
+			return
+		}
+
+		if messageType == websocket.TextMessage {
+			var status struct {
+				Type      string `json:"type"`
+				Role      string `json:"role"`
+				Connected bool   `json:"connected"`
+			}
+			if json.Unmarshal(data, &status) == nil && status.Type == "relay-peer" {
+				log.Printf("[Viewer] Relay peer %s connected=%t", status.Role, status.Connected)
+				if status.Role == "agent" && status.Connected {
+					v.closeOnce.Do(func() { close(v.connected) })
+					v.controlOnce.Do(func() { close(v.controlOpen) })
+				}
+				continue
+			}
+			v.handleControlMessage(data)
+			continue
+		}
+
+		frame, err := remotecontrol.ParseRelayFrame(data)
+		if err != nil {
+			log.Printf("[Viewer] Invalid relay frame: %v", err)
+			continue
+		}
+
+		packetizer, ok := packetizers[frame.Stream]
+		if !ok {
+			packetizer = rtp.NewPacketizer(1200, 96, uint32(frame.Stream+1), &codecs.VP8Payloader{},
+				rtp.NewRandomSequencer(), 90000)
+			packetizers[frame.Stream] = packetizer
+			origins[frame.Stream] = frame.Captured
+		}
+
+		// Stamp from the capture time; the packetizer only advances by what it is told
+		ticks := uint32(frame.Captured.Sub(origins[frame.Stream]) * 90000 / time.Second)
+		packets := packetizer.Packetize(frame.Data, 0)
+		for _, packet := range packets {
+			packet.Timestamp += ticks
+			v.handlePacket(frame.Stream, packet)
+		}
+	}
+}
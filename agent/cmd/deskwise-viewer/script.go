@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// scriptStep is one line of an input script: a control message to send, or a pause.
+//
+//	# comments and blank lines are ignored
+//	{"type":"mouse","eventType":"move","x":400,"y":300}
+//	{"sleep":250}
+//	{"type":"keyboard","key":"a","down":true}
+type scriptStep struct {
+	Sleep   time.Duration
+	Message []byte
+}
+
+// loadScript reads a JSON-lines input script
+func loadScript(path string) ([]scriptStep, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var steps []scriptStep
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(text), &fields); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if sleep, ok := fields["sleep"].(float64); ok {
+			steps = append(steps, scriptStep{Sleep: time.Duration(sleep) * time.Millisecond})
+			continue
+		}
+		if _, ok := fields["type"].(string); !ok {
+			return nil, fmt.Errorf("line %d: message needs a type (or use sleep)", line)
+		}
+		steps = append(steps, scriptStep{Message: []byte(text)})
+	}
+
+	return steps, scanner.Err()
+}
+
+// runScript sends the script's messages over the control channel
+func runScript(ctx context.Context, control controlSender, steps []scriptStep) error {
+	for i, step := range steps {
+		if step.Sleep > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(step.Sleep):
+			}
+			continue
+		}
+
+		if err := control.SendText(string(step.Message)); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+
+	log.Printf("[Viewer] Input script finished (%d steps)", len(steps))
+	return nil
+}
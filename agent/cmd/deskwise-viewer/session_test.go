@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4/pkg/media/ivfreader"
+	"golang.org/x/image/vp8"
+
+	"deskwise-agent/internal/signalserver"
+	"deskwise-agent/remotecontrol"
+)
+
+// keyedFrames passes packets on to a recorder and counts the frames from the first
+// key frame on, which is where an IVF recording starts
+type keyedFrames struct {
+	frameRecorder
+
+	mu     sync.Mutex
+	keyed  bool
+	frames int
+}
+
+func (k *keyedFrames) WriteRTP(track int, packet *rtp.Packet) error {
+	k.mu.Lock()
+	var payload codecs.VP8Packet
+	if _, err := payload.Unmarshal(packet.Payload); err == nil && payload.S == 1 && payload.PID == 0 && isKeyFrame(payload.Payload) {
+		k.keyed = true
+	}
+	if k.keyed && packet.Marker {
+		k.frames++
+	}
+	k.mu.Unlock()
+	return k.frameRecorder.WriteRTP(track, packet)
+}
+
+// TestLoopbackSession runs an agent session on the synthetic capturer against this
+// viewer through the stand-in signalling server, recording the stream to IVF
+func TestLoopbackSession(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the agent polls signalling every 5 seconds")
+	}
+
+	server := signalserver.New()
+	if err := server.AddSession(signalserver.Session{
+		ID:      "loopback",
+		Token:   "secret",
+		AssetID: "asset-1",
+		Fields:  map[string]interface{}{"iceServers": []interface{}{}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	web := httptest.NewServer(server.Handler())
+	defer web.Close()
+
+	agent := remotecontrol.NewManager(web.URL, runtime.GOOS, "test")
+	if err := agent.SetSyntheticCapture(&remotecontrol.SyntheticConfig{Width: 640, Height: 360, Counter: true}); err != nil {
+		t.Fatal(err)
+	}
+	// No ICE servers: host candidates on this machine only
+	if err := agent.StartSession("loopback", "secret", "asset-1", "org-1", remotecontrol.SessionOptions{ICEServers: []remotecontrol.ICEServer{}}); err != nil {
+		t.Fatal(err)
+	}
+	defer agent.StopSession("loopback")
+
+	out := filepath.Join(t.TempDir(), "session.ivf")
+	ivf, err := newFrameRecorder(out, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &keyedFrames{frameRecorder: ivf}
+	v := newViewer(viewerConfig{
+		signal:       remotecontrol.NewSignalClientForRole(web.URL, "loopback", "secret", "operator"),
+		recorder:     recorder,
+		maxFrames:    15,
+		pollInterval: 100 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	summary, err := v.Run(ctx, 30*time.Second, 30*time.Second, nil)
+	if closeErr := recorder.Close(); closeErr != nil {
+		t.Errorf("closing the recording: %v", closeErr)
+	}
+	if err != nil {
+		t.Fatalf("session failed: %v (%s)", err, summary)
+	}
+	if summary.Frames < 15 || summary.Packets < int64(summary.Frames) {
+		t.Errorf("received %d frames in %d packets, want at least 15", summary.Frames, summary.Packets)
+	}
+	if summary.Messages["monitors"] == 0 {
+		t.Errorf("no monitors message among %v", summary.Messages)
+	}
+
+	// The recording holds the frames from the first key frame on, in order; key
+	// frames carry the synthetic frame counter
+	file, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, header, err := ivfreader.NewWith(file)
+	if err != nil {
+		t.Fatalf("recording is not IVF: %v", err)
+	}
+	if string(header.FourCC[:]) != "VP80" {
+		t.Errorf("recording codec = %q, want VP80", header.FourCC[:])
+	}
+
+	decoder := vp8.NewDecoder()
+	recorded, lastCounter := 0, -1
+	for {
+		frame, _, err := reader.ParseNextFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("frame %d: %v", recorded, err)
+		}
+		recorded++
+		if !isKeyFrame(frame) {
+			continue
+		}
+		img, err := decodeKeyFrame(decoder, frame)
+		if err != nil {
+			t.Fatalf("frame %d: %v", recorded, err)
+		}
+		counter, ok := remotecontrol.ReadFrameCounter(img)
+		if !ok || int(counter) <= lastCounter {
+			t.Errorf("key frame %d has counter %d, %t after %d", recorded, counter, ok, lastCounter)
+		}
+		lastCounter = int(counter)
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if recorded < recorder.frames-1 {
+		t.Errorf("recorded %d of %d frames since the first key frame", recorded, recorder.frames)
+	}
+	if recorder.frames > 0 && lastCounter < 0 {
+		t.Error("no key frame in the recording")
+	}
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+
+	"deskwise-agent/remotecontrol"
+)
+
+type viewerConfig struct {
+	signal       *remotecontrol.SignalClient
+	iceServers   []string
+	tracks       int
+	recorder     frameRecorder
+	maxFrames    int
+	pollInterval time.Duration
+	frameEcho    bool   // Ask the agent for frame IDs and echo them back
+	relay        bool   // Use the WebSocket relay from the start instead of WebRTC
+	blockICE     bool   // Withhold ICE candidates so WebRTC cannot connect
+	pin          string // Unattended-access PIN to answer "pin-required" with (empty = fail)
+}
+
+// controlSender sends control messages to the agent (the data channel, or the relay)
+type controlSender interface {
+	SendText(text string) error
+}
+
+// viewer is the operator side of a session
+type viewer struct {
+	config viewerConfig
+
+	pc      *webrtc.PeerConnection
+	mu      sync.Mutex
+	control controlSender
+	latency *latencyProbe
+
+	connected   chan struct{}
+	controlOpen chan struct{}
+	unlocked    chan struct{} // Closed when the agent accepts the PIN
+	failed      chan error
+	enough      chan struct{}
+	closeOnce   sync.Once
+	controlOnce sync.Once
+	enoughOnce  sync.Once
+	pinOnce     sync.Once
+	relayOnce   sync.Once
+	relayErr    error
+
+	frames   atomic.Int64
+	packets  atomic.Int64
+	bytes    atomic.Int64
+	messages sync.Map // message type -> *atomic.Int64
+}
+
+// viewerSummary describes what was received during the session
+type viewerSummary struct {
+	Frames   int
+	Packets  int64
+	Bytes    int64
+	Messages map[string]int64
+	Duration time.Duration
+	Latency  string
+}
+
+func (s viewerSummary) String() string {
+	return fmt.Sprintf("%d frames, %d RTP packets, %d bytes in %v, control messages %v, %s",
+		s.Frames, s.Packets, s.Bytes, s.Duration.Round(time.Millisecond), s.Messages, s.Latency)
+}
+
+func newViewer(config viewerConfig) *viewer {
+	if config.tracks < 1 {
+		config.tracks = 1
+	}
+	return &viewer{
+		config:      config,
+		connected:   make(chan struct{}),
+		controlOpen: make(chan struct{}),
+		unlocked:    make(chan struct{}),
+		failed:      make(chan error, 1),
+		enough:      make(chan struct{}),
+	}
+}
+
+// Run negotiates with the agent, receives media for the given duration and plays the input script
+func (v *viewer) Run(ctx context.Context, connectTimeout, duration time.Duration, steps []scriptStep) (viewerSummary, error) {
+	started := time.Now()
+	defer func() {
+		if v.pc != nil {
+			v.pc.Close()
+		}
+	}()
+
+	if err := v.setup(); err != nil {
+		return v.summary(started), err
+	}
+	if v.config.relay {
+		// Ask the agent to skip WebRTC and meet us on the relay
+		if err := v.config.signal.SendSignal("relay", map[string]interface{}{"reason": "requested by the viewer"}); err != nil {
+			return v.summary(started), err
+		}
+		if err := v.connectRelay(ctx); err != nil {
+			return v.summary(started), err
+		}
+	} else if err := v.sendOffer(); err != nil {
+		return v.summary(started), err
+	}
+
+	pollCtx, stopPolling := context.WithCancel(ctx)
+	defer stopPolling()
+	go v.pollSignals(pollCtx)
+
+	log.Printf("[Viewer] Waiting for the agent (timeout %v)", connectTimeout)
+	select {
+	case <-ctx.Done():
+		return v.summary(started), ctx.Err()
+	case err := <-v.failed:
+		return v.summary(started), err
+	case <-time.After(connectTimeout):
+		return v.summary(started), fmt.Errorf("agent did not connect within %v", connectTimeout)
+	case <-v.connected:
+	}
+	log.Printf("[Viewer] Connected after %v", time.Since(started).Round(time.Millisecond))
+
+	// With a PIN the agent refuses everything else until it accepted the PIN
+	ready := v.controlOpen
+	if v.config.pin != "" {
+		ready = v.unlocked
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-ready:
+			v.latency.Start(ctx)
+		}
+	}()
+
+	if len(steps) > 0 {
+		go func() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ready:
+			}
+			if err := runScript(ctx, v.controlSender(), steps); err != nil {
+				log.Printf("[Viewer] Input script stopped: %v", err)
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(duration):
+	case <-v.enough:
+	case err := <-v.failed:
+		return v.summary(started), err
+	}
+
+	return v.summary(started), nil
+}
+
+// setup creates the peer connection with receive-only video and the control channel
+func (v *viewer) setup() error {
+	config := webrtc.Configuration{}
+	if len(v.config.iceServers) > 0 {
+		config.ICEServers = []webrtc.ICEServer{{URLs: v.config.iceServers}}
+	}
+
+	pc, err := webrtc.NewPeerConnection(config)
+	if err != nil {
+		return fmt.Errorf("failed to create peer connection: %w", err)
+	}
+	v.pc = pc
+
+	for i := 0; i < v.config.tracks; i++ {
+		if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		}); err != nil {
+			return fmt.Errorf("failed to add video transceiver: %w", err)
+		}
+	}
+
+	control, err := pc.CreateDataChannel("control", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create control channel: %w", err)
+	}
+	v.control = control
+	v.latency = newLatencyProbe(v.config.frameEcho, func(message interface{}) error {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		return v.controlSender().SendText(string(data))
+	})
+
+	control.OnOpen(func() {
+		log.Printf("[Viewer] Control channel open")
+		v.controlOnce.Do(func() { close(v.controlOpen) })
+	})
+	control.OnMessage(func(msg webrtc.DataChannelMessage) {
+		v.handleControlMessage(msg.Data)
+	})
+
+	var trackCount atomic.Int32
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		index := int(trackCount.Add(1)) - 1
+		log.Printf("[Viewer] Receiving track %d: %s (%s)", index, track.ID(), track.Codec().MimeType)
+		go v.receiveTrack(index, track)
+	})
+
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Printf("[Viewer] Connection state: %s", state)
+		switch state {
+		case webrtc.PeerConnectionStateConnected:
+			v.closeOnce.Do(func() { close(v.connected) })
+		case webrtc.PeerConnectionStateFailed:
+			// Without candidates ICE is expected to fail; the agent moves us to the relay
+			if !v.config.blockICE {
+				v.fail(errors.New("peer connection failed"))
+			}
+		}
+	})
+
+	return nil
+}
+
+// sendOffer gathers all local candidates first so the agent gets a complete offer
+// (the agent cannot add candidates before it has the offer)
+func (v *viewer) sendOffer() error {
+	offer, err := v.pc.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create offer: %w", err)
+	}
+
+	gathered := webrtc.GatheringCompletePromise(v.pc)
+	if err := v.pc.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("failed to set local description: %w", err)
+	}
+	<-gathered
+
+	local := v.pc.LocalDescription()
+	sdp := local.SDP
+	if v.config.blockICE {
+		sdp = stripCandidates(sdp)
+	}
+	return v.config.signal.SendSignal("offer", map[string]interface{}{
+		"type": local.Type.String(),
+		"sdp":  sdp,
+	})
+}
+
+// answerOffer accepts a renegotiation offer from the agent
+func (v *viewer) answerOffer(offer webrtc.SessionDescription) error {
+	if err := v.pc.SetRemoteDescription(offer); err != nil {
+		return fmt.Errorf("failed to set offer: %w", err)
+	}
+	answer, err := v.pc.CreateAnswer(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create answer: %w", err)
+	}
+	if err := v.pc.SetLocalDescription(answer); err != nil {
+		return fmt.Errorf("failed to set local description: %w", err)
+	}
+	log.Printf("[Viewer] Answered the agent's renegotiation offer")
+	return v.config.signal.SendSignal("answer", map[string]interface{}{
+		"type": answer.Type.String(),
+		"sdp":  answer.SDP,
+	})
+}
+
+// stripCandidates removes the ICE candidates from an SDP, as if UDP were blocked
+func stripCandidates(sdp string) string {
+	lines := strings.Split(sdp, "\r\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "a=candidate:") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\r\n")
+}
+
+// controlSender returns the current control channel
+func (v *viewer) controlSender() controlSender {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.control
+}
+
+// pollSignals applies the agent's answer and trickled ICE candidates
+func (v *viewer) pollSignals(ctx context.Context) {
+	ticker := time.NewTicker(v.config.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		signals, err := v.config.signal.PollSignals()
+		if err != nil {
+			log.Printf("[Viewer] Signalling poll failed: %v", err)
+			continue
+		}
+
+		for _, msg := range signals {
+			switch msg.Type {
+			case "answer":
+				var answer webrtc.SessionDescription
+				if err := json.Unmarshal(msg.Data, &answer); err != nil {
+					v.fail(fmt.Errorf("invalid answer: %w", err))
+					return
+				}
+				if err := v.pc.SetRemoteDescription(answer); err != nil {
+					v.fail(fmt.Errorf("failed to set answer: %w", err))
+					return
+				}
+				log.Printf("[Viewer] Answer applied")
+
+			case "offer":
+				// The agent renegotiates when monitors are attached or removed
+				var offer webrtc.SessionDescription
+				if err := json.Unmarshal(msg.Data, &offer); err != nil {
+					log.Printf("[Viewer] Invalid offer: %v", err)
+					continue
+				}
+				if err := v.answerOffer(offer); err != nil {
+					log.Printf("[Viewer] Failed to answer renegotiation: %v", err)
+				}
+
+			case "relay":
+				log.Printf("[Viewer] Agent moved the session to the relay: %s", string(msg.Data))
+				go func() {
+					if err := v.connectRelay(ctx); err != nil {
+						v.fail(err)
+					}
+				}()
+
+			case "ice-candidate":
+				if v.config.blockICE {
+					continue
+				}
+				var candidate webrtc.ICECandidateInit
+				if err := json.Unmarshal(msg.Data, &candidate); err != nil {
+					log.Printf("[Viewer] Invalid ICE candidate: %v", err)
+					continue
+				}
+				if err := v.pc.AddICECandidate(candidate); err != nil {
+					log.Printf("[Viewer] Failed to add ICE candidate: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// receiveTrack reads RTP packets from a track until it ends
+func (v *viewer) receiveTrack(index int, track *webrtc.TrackRemote) {
+	for {
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+		v.handlePacket(index, packet)
+	}
+}
+
+// handlePacket counts frames and hands packets to the recorder and the latency probe
+func (v *viewer) handlePacket(index int, packet *rtp.Packet) {
+	v.packets.Add(1)
+	v.bytes.Add(int64(len(packet.Payload)))
+	if err := v.config.recorder.WriteRTP(index, packet); err != nil {
+		log.Printf("[Viewer] Recording error: %v", err)
+	}
+	v.latency.WriteRTP(index, packet)
+
+	// The marker bit ends a VP8 frame
+	if packet.Marker {
+		frames := v.frames.Add(1)
+		if v.config.maxFrames > 0 && frames >= int64(v.config.maxFrames) {
+			v.enoughOnce.Do(func() { close(v.enough) })
+		}
+	}
+}
+
+// handleControlMessage counts agent messages and logs everything except pings and high-rate cursor updates
+func (v *viewer) handleControlMessage(data []byte) {
+	var message struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		log.Printf("[Viewer] Unparseable control message: %v", err)
+		return
+	}
+
+	counter, _ := v.messages.LoadOrStore(message.Type, new(atomic.Int64))
+	counter.(*atomic.Int64).Add(1)
+
+	if v.latency.HandleMessage(message.Type, data) {
+		return
+	}
+	switch message.Type {
+	case "pin-required", "pin":
+		v.handlePIN(message.Type, data)
+	case "cursor":
+	case "console":
+		// Console grids are large; log their shape rather than their text
+		var update struct {
+			TTY   string            `json:"tty"`
+			Cols  int               `json:"cols"`
+			Rows  int               `json:"rows"`
+			Full  bool              `json:"full"`
+			Lines []json.RawMessage `json:"lines"`
+		}
+		if err := json.Unmarshal(data, &update); err == nil {
+			log.Printf("[Viewer] Console %s %dx%d: %d rows (full=%t)", update.TTY, update.Cols, update.Rows, len(update.Lines), update.Full)
+		}
+	default:
+		log.Printf("[Viewer] Agent message: %s", string(data))
+	}
+}
+
+// handlePIN answers the agent's access PIN prompt and fails the session when the
+// PIN is missing, rejected or locked out
+func (v *viewer) handlePIN(messageType string, data []byte) {
+	log.Printf("[Viewer] Agent message: %s", string(data))
+	var result struct {
+		Status       string `json:"status"`
+		AttemptsLeft int    `json:"attemptsLeft"`
+		LockedUntil  string `json:"lockedUntil"`
+	}
+	json.Unmarshal(data, &result)
+
+	if messageType == "pin-required" {
+		if v.config.pin == "" {
+			v.fail(errors.New("the agent requires an access PIN (pass -pin)"))
+			return
+		}
+		control := v.controlSender()
+		if control == nil {
+			v.fail(errors.New("no control channel to send the access PIN on"))
+			return
+		}
+		answer, _ := json.Marshal(map[string]string{"type": "pin", "pin": v.config.pin})
+		if err := control.SendText(string(answer)); err != nil {
+			v.fail(fmt.Errorf("failed to send the access PIN: %w", err))
+		}
+		return
+	}
+
+	switch result.Status {
+	case "accepted":
+		log.Printf("[Viewer] Access PIN accepted")
+		v.pinOnce.Do(func() { close(v.unlocked) })
+	case "locked":
+		v.fail(fmt.Errorf("access PIN locked until %s", result.LockedUntil))
+	default:
+		if result.LockedUntil != "" {
+			v.fail(fmt.Errorf("access PIN rejected, locked until %s", result.LockedUntil))
+		} else {
+			v.fail(fmt.Errorf("access PIN rejected (%d attempts left)", result.AttemptsLeft))
+		}
+	}
+}
+
+func (v *viewer) fail(err error) {
+	select {
+	case v.failed <- err:
+	default:
+	}
+}
+
+func (v *viewer) summary(started time.Time) viewerSummary {
+	messages := make(map[string]int64)
+	v.messages.Range(func(key, value interface{}) bool {
+		messages[key.(string)] = value.(*atomic.Int64).Load()
+		return true
+	})
+
+	summary := viewerSummary{
+		Frames:   int(v.frames.Load()),
+		Packets:  v.packets.Load(),
+		Bytes:    v.bytes.Load(),
+		Messages: messages,
+		Duration: time.Since(started),
+		Latency:  "no latency measured",
+	}
+	if v.latency != nil {
+		summary.Latency = v.latency.Summary()
+	}
+	return summary
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// sentMessages records the control messages the viewer sends
+type sentMessages []string
+
+func (s *sentMessages) SendText(text string) error {
+	*s = append(*s, text)
+	return nil
+}
+
+func TestViewerAnswersPINPrompt(t *testing.T) {
+	sent := &sentMessages{}
+	v := newViewer(viewerConfig{pin: "2468"})
+	v.control = sent
+
+	v.handleControlMessage([]byte(`{"type":"pin-required","attemptsLeft":5}`))
+	if len(*sent) != 1 || (*sent)[0] != `{"pin":"2468","type":"pin"}` {
+		t.Fatalf("sent %q", *sent)
+	}
+
+	v.handleControlMessage([]byte(`{"type":"pin","status":"accepted"}`))
+	select {
+	case <-v.unlocked:
+	default:
+		t.Error("accepted PIN did not unlock the session")
+	}
+	select {
+	case err := <-v.failed:
+		t.Errorf("unexpected failure: %v", err)
+	default:
+	}
+}
+
+func TestViewerPINFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		pin     string
+		message string
+		want    string
+	}{
+		{"no pin", "", `{"type":"pin-required","attemptsLeft":5}`, "-pin"},
+		{"rejected", "1111", `{"type":"pin","status":"rejected","attemptsLeft":4}`, "4 attempts left"},
+		{"last attempt", "1111", `{"type":"pin","status":"rejected","lockedUntil":"2024-01-01T12:15:00Z"}`, "locked until 2024-01-01T12:15:00Z"},
+		{"locked", "1111", `{"type":"pin","status":"locked","lockedUntil":"2024-01-01T12:15:00Z"}`, "locked until"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := &sentMessages{}
+			v := newViewer(viewerConfig{pin: tt.pin})
+			v.control = sent
+
+			v.handleControlMessage([]byte(tt.message))
+			select {
+			case err := <-v.failed:
+				if !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("error %q does not mention %q", err, tt.want)
+				}
+			default:
+				t.Fatal("session did not fail")
+			}
+			if len(*sent) != 0 {
+				t.Errorf("sent %q", *sent)
+			}
+		})
+	}
+}
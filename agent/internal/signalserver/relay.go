@@ -0,0 +1,132 @@
+package signalserver
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// relayPeer is one side of a relayed session
+type relayPeer struct {
+	role    string
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+func (p *relayPeer) write(messageType int, data []byte) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	return p.conn.WriteMessage(messageType, data)
+}
+
+// notify sends a relay status message (type "relay-peer") about the other side
+func (p *relayPeer) notify(role string, connected bool) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":      "relay-peer",
+		"role":      role,
+		"connected": connected,
+	})
+	p.write(websocket.TextMessage, data)
+}
+
+// relayPair holds the agent and operator connections of a session
+type relayPair struct {
+	mu    sync.Mutex
+	peers map[string]*relayPeer
+}
+
+var relayUpgrader = websocket.Upgrader{
+	// Test viewers and agents are not browsers; there is no origin to check
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// otherRole returns the role at the other end of the relay
+func otherRole(role string) string {
+	if role == "agent" {
+		return "operator"
+	}
+	return "agent"
+}
+
+// handleRelay upgrades to a WebSocket and forwards every message to the other side of the
+// session unchanged: text messages are control-channel JSON, binary messages are video frames.
+// Messages sent while the other side is absent are dropped.
+func (s *Server) handleRelay(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	role := query.Get("role")
+	if role != "agent" && role != "operator" {
+		writeError(w, http.StatusBadRequest, "role (agent or operator) is required")
+		return
+	}
+
+	s.mu.Lock()
+	state, status, message := s.authorize(query.Get("sessionId"), query.Get("token"))
+	if state == nil {
+		s.mu.Unlock()
+		writeError(w, status, message)
+		return
+	}
+	if state.relay == nil {
+		state.relay = &relayPair{peers: make(map[string]*relayPeer)}
+	}
+	pair := state.relay
+	s.mu.Unlock()
+
+	conn, err := relayUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("[SignalServer] Relay upgrade failed: %v", err)
+		return
+	}
+	peer := &relayPeer{role: role, conn: conn}
+
+	// A reconnecting side replaces its previous connection
+	pair.mu.Lock()
+	previous := pair.peers[role]
+	pair.peers[role] = peer
+	other := pair.peers[otherRole(role)]
+	pair.mu.Unlock()
+	if previous != nil {
+		previous.conn.Close()
+	}
+	if other != nil {
+		other.notify(role, true)
+		peer.notify(other.role, true)
+	}
+	log.Printf("[SignalServer] %s joined relay for session %s", role, query.Get("sessionId"))
+
+	defer func() {
+		pair.mu.Lock()
+		current := pair.peers[role] == peer
+		if current {
+			delete(pair.peers, role)
+		}
+		other := pair.peers[otherRole(role)]
+		pair.mu.Unlock()
+
+		conn.Close()
+		if current && other != nil {
+			other.notify(role, false)
+		}
+		log.Printf("[SignalServer] %s left relay for session %s", role, query.Get("sessionId"))
+	}()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		pair.mu.Lock()
+		other := pair.peers[otherRole(role)]
+		pair.mu.Unlock()
+		if other == nil {
+			continue
+		}
+		if err := other.write(messageType, data); err != nil {
+			log.Printf("[SignalServer] Relay write to %s failed: %v", other.role, err)
+		}
+	}
+}
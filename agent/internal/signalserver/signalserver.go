@@ -0,0 +1,366 @@
+// Package signalserver is an in-memory stand-in for the Deskwise signalling API.
+// It serves /api/rc/signalling, /api/rc/artifacts and the /api/rc/relay WebSocket
+// relay, and offers sessions to agents through /api/agent/rc/poll, so an agent and
+// a test viewer can run a full session on one machine without the SaaS backend.
+package signalserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Session is a remote control session offered to agents
+type Session struct {
+	ID      string
+	Token   string
+	AssetID string
+	OrgID   string
+
+	// Fields are merged into the session info sent to the agent
+	// (iceServers, permissions, redaction, watermark, ...)
+	Fields map[string]interface{}
+}
+
+// Signal is one stored signalling message
+type Signal struct {
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp int64           `json:"timestamp"`
+	Sender    string          `json:"sender"`
+}
+
+// Artifact is a file the agent attached to a session (e.g. a terminal transcript)
+type Artifact struct {
+	Kind        string
+	ContentType string
+	Data        []byte
+	Timestamp   int64
+}
+
+// maxArtifactSize bounds uploads kept in memory
+const maxArtifactSize = 64 << 20
+
+type sessionState struct {
+	session   Session
+	status    string // pending, active, ended
+	signals   []Signal
+	artifacts []Artifact
+	relay     *relayPair // WebSocket relay, created when the first side connects
+}
+
+// Server holds sessions and their signalling messages
+type Server struct {
+	mu            sync.Mutex
+	sessions      map[string]*sessionState
+	order         []string
+	lastTimestamp int64
+}
+
+// New creates an empty server
+func New() *Server {
+	return &Server{sessions: make(map[string]*sessionState)}
+}
+
+// AddSession registers a session; agents receive it from the next rc/poll
+func (s *Server) AddSession(session Session) error {
+	if session.ID == "" || session.Token == "" {
+		return fmt.Errorf("session requires an ID and token")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sessions[session.ID]; exists {
+		return fmt.Errorf("session %s already exists", session.ID)
+	}
+	s.sessions[session.ID] = &sessionState{session: session, status: "pending"}
+	s.order = append(s.order, session.ID)
+	return nil
+}
+
+// EndSession stops offering a session to agents
+func (s *Server) EndSession(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state, ok := s.sessions[id]; ok {
+		state.status = "ended"
+	}
+}
+
+// Sessions returns the info of every session in the order they were added
+func (s *Server) Sessions() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make([]map[string]interface{}, 0, len(s.order))
+	for _, id := range s.order {
+		sessions = append(sessions, s.sessions[id].info())
+	}
+	return sessions
+}
+
+// Signals returns a copy of all signals stored for a session
+func (s *Server) Signals(id string) []Signal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.sessions[id]
+	if !ok {
+		return nil
+	}
+	return append([]Signal(nil), state.signals...)
+}
+
+// AddArtifact stores an artifact the agent uploaded with its own credential, for
+// a session that may have ended since
+func (s *Server) AddArtifact(id string, artifact Artifact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.sessions[id]
+	if !ok {
+		return fmt.Errorf("session %s not found", id)
+	}
+	if artifact.Timestamp == 0 {
+		artifact.Timestamp = time.Now().UnixMilli()
+	}
+	state.artifacts = append(state.artifacts, artifact)
+	log.Printf("[SignalServer] Stored %s artifact (%d bytes) for session %s", artifact.Kind, len(artifact.Data), id)
+	return nil
+}
+
+// Artifacts returns a copy of the artifacts uploaded for a session
+func (s *Server) Artifacts(id string) []Artifact {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.sessions[id]
+	if !ok {
+		return nil
+	}
+	return append([]Artifact(nil), state.artifacts...)
+}
+
+// Handler returns the HTTP handler for the signalling, artifact, relay and session poll endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/rc/signalling", s.handleSignalling)
+	mux.HandleFunc("/api/rc/artifacts", s.handleArtifact)
+	mux.HandleFunc("/api/rc/relay", s.handleRelay)
+	mux.HandleFunc("/api/agent/rc/poll", s.handlePoll)
+	return mux
+}
+
+// handlePoll hands the oldest session that has not ended to the polling agent
+func (s *Server) handlePoll(w http.ResponseWriter, r *http.Request) {
+	if info, ok := s.NextSession(""); ok {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "session": info})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// NextSession returns the session info for the oldest session that has not ended
+// and is meant for the given asset (sessions without an asset go to any agent;
+// an empty assetID matches every session). The session is marked active.
+func (s *Server) NextSession(assetID string) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range s.order {
+		state := s.sessions[id]
+		if state.status == "ended" {
+			continue
+		}
+		if assetID != "" && state.session.AssetID != "" && state.session.AssetID != assetID {
+			continue
+		}
+		state.status = "active"
+		return state.info(), true
+	}
+	return nil, false
+}
+
+func (st *sessionState) info() map[string]interface{} {
+	info := make(map[string]interface{}, len(st.session.Fields)+5)
+	for key, value := range st.session.Fields {
+		info[key] = value
+	}
+	info["sessionId"] = st.session.ID
+	info["token"] = st.session.Token
+	info["assetId"] = st.session.AssetID
+	info["orgId"] = st.session.OrgID
+	info["status"] = st.status
+	return info
+}
+
+func (s *Server) handleSignalling(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.postSignal(w, r)
+	case http.MethodGet:
+		s.pollSignals(w, r)
+	case http.MethodDelete:
+		s.clearSignals(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// authorize looks up a session and checks its token; s.mu must be held
+func (s *Server) authorize(id, token string) (*sessionState, int, string) {
+	state, ok := s.sessions[id]
+	if !ok {
+		return nil, http.StatusNotFound, "session not found"
+	}
+	if state.session.Token != token {
+		return nil, http.StatusUnauthorized, "invalid token"
+	}
+	return state, http.StatusOK, ""
+}
+
+func (s *Server) postSignal(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		SessionID string          `json:"sessionId"`
+		Token     string          `json:"token"`
+		Type      string          `json:"type"`
+		Data      json.RawMessage `json:"data"`
+		Sender    string          `json:"sender"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if payload.Type == "" || (payload.Sender != "agent" && payload.Sender != "operator") {
+		writeError(w, http.StatusBadRequest, "type and sender (agent or operator) are required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, status, message := s.authorize(payload.SessionID, payload.Token)
+	if state == nil {
+		writeError(w, status, message)
+		return
+	}
+
+	// Timestamps double as poll cursors, so they must be unique and increasing
+	timestamp := time.Now().UnixMilli()
+	if timestamp <= s.lastTimestamp {
+		timestamp = s.lastTimestamp + 1
+	}
+	s.lastTimestamp = timestamp
+
+	state.signals = append(state.signals, Signal{
+		Type:      payload.Type,
+		Data:      payload.Data,
+		Timestamp: timestamp,
+		Sender:    payload.Sender,
+	})
+	log.Printf("[SignalServer] %s -> %s signal for session %s", payload.Sender, payload.Type, payload.SessionID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// pollSignals returns messages from the other side newer than since
+func (s *Server) pollSignals(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	since, _ := strconv.ParseInt(query.Get("since"), 10, 64)
+	role := query.Get("role")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, status, message := s.authorize(query.Get("sessionId"), query.Get("token"))
+	if state == nil {
+		writeError(w, status, message)
+		return
+	}
+
+	signals := []Signal{}
+	for _, signal := range state.signals {
+		if signal.Timestamp > since && signal.Sender != role {
+			signals = append(signals, signal)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": signals})
+}
+
+func (s *Server) clearSignals(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, status, message := s.authorize(query.Get("sessionId"), query.Get("token"))
+	if state == nil {
+		writeError(w, status, message)
+		return
+	}
+	state.signals = nil
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// handleArtifact stores an uploaded session artifact
+func (s *Server) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	kind := query.Get("kind")
+	if kind == "" {
+		writeError(w, http.StatusBadRequest, "kind is required")
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxArtifactSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	if len(data) > maxArtifactSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "artifact too large")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, status, message := s.authorize(query.Get("sessionId"), query.Get("token"))
+	if state == nil {
+		writeError(w, status, message)
+		return
+	}
+
+	state.artifacts = append(state.artifacts, Artifact{
+		Kind:        kind,
+		ContentType: r.Header.Get("Content-Type"),
+		Data:        data,
+		Timestamp:   time.Now().UnixMilli(),
+	})
+	log.Printf("[SignalServer] Stored %s artifact (%d bytes) for session %s", kind, len(data), state.session.ID)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{"success": false, "error": message})
+}
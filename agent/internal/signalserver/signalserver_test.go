@@ -0,0 +1,171 @@
+package signalserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"deskwise-agent/remotecontrol"
+)
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	server := New()
+	if err := server.AddSession(Session{
+		ID:      "s1",
+		Token:   "secret",
+		AssetID: "asset-1",
+		Fields:  map[string]interface{}{"iceServers": []interface{}{}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	web := httptest.NewServer(server.Handler())
+	t.Cleanup(web.Close)
+	return server, web
+}
+
+// TestSignallingRoundTrip plays both sides of a negotiation through the stand-in
+func TestSignallingRoundTrip(t *testing.T) {
+	server, web := newTestServer(t)
+
+	if _, ok := server.NextSession("other-asset"); ok {
+		t.Error("session offered to another asset")
+	}
+	response, err := http.Get(web.URL + "/api/agent/rc/poll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var poll struct {
+		Success bool                   `json:"success"`
+		Session map[string]interface{} `json:"session"`
+	}
+	json.NewDecoder(response.Body).Decode(&poll)
+	response.Body.Close()
+	if !poll.Success || poll.Session["sessionId"] != "s1" || poll.Session["token"] != "secret" || poll.Session["status"] != "active" {
+		t.Fatalf("poll = %+v", poll)
+	}
+
+	agent := remotecontrol.NewSignalClient(web.URL, "s1", "secret")
+	operator := remotecontrol.NewSignalClientForRole(web.URL, "s1", "secret", "operator")
+
+	if err := operator.SendSignal("offer", map[string]string{"type": "offer", "sdp": "v=0"}); err != nil {
+		t.Fatal(err)
+	}
+	if signals, err := operator.PollSignals(); err != nil || len(signals) != 0 {
+		t.Errorf("operator saw its own signals: %v, %v", signals, err)
+	}
+	signals, err := agent.PollSignals()
+	if err != nil || len(signals) != 1 || signals[0].Type != "offer" || !strings.Contains(string(signals[0].Data), "v=0") {
+		t.Fatalf("agent got %v, %v", signals, err)
+	}
+
+	if err := agent.SendSignal("answer", map[string]string{"type": "answer", "sdp": "v=0"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.SendSignal("ice-candidate", map[string]string{"candidate": "candidate:1"}); err != nil {
+		t.Fatal(err)
+	}
+	signals, err = operator.PollSignals()
+	if err != nil || len(signals) != 2 || signals[0].Type != "answer" || signals[1].Type != "ice-candidate" {
+		t.Fatalf("operator got %v, %v", signals, err)
+	}
+	if signals[0].Timestamp >= signals[1].Timestamp {
+		t.Error("signals posted in the same millisecond share a poll cursor")
+	}
+	// Later polls only return newer signals
+	if signals, err := operator.PollSignals(); err != nil || len(signals) != 0 {
+		t.Errorf("repeated poll returned %v, %v", signals, err)
+	}
+
+	if err := agent.UploadArtifact("terminal", "application/x-ndjson", strings.NewReader("{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if artifacts := server.Artifacts("s1"); len(artifacts) != 1 || artifacts[0].Kind != "terminal" || string(artifacts[0].Data) != "{}\n" {
+		t.Errorf("artifacts = %+v", artifacts)
+	}
+
+	if err := agent.ClearSignals(); err != nil {
+		t.Fatal(err)
+	}
+	if signals := server.Signals("s1"); len(signals) != 0 {
+		t.Errorf("signals after clear = %v", signals)
+	}
+
+	server.EndSession("s1")
+	if _, ok := server.NextSession(""); ok {
+		t.Error("ended session still offered")
+	}
+}
+
+func TestSignallingRejectsWrongToken(t *testing.T) {
+	_, web := newTestServer(t)
+
+	intruder := remotecontrol.NewSignalClientForRole(web.URL, "s1", "guess", "operator")
+	if err := intruder.SendSignal("offer", map[string]string{}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("send with a wrong token: %v", err)
+	}
+	if _, err := intruder.PollSignals(); err == nil {
+		t.Error("poll with a wrong token succeeded")
+	}
+	unknown := remotecontrol.NewSignalClient(web.URL, "nope", "secret")
+	if err := unknown.SendSignal("answer", map[string]string{}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("send for an unknown session: %v", err)
+	}
+}
+
+func TestRelayForwardsBetweenSides(t *testing.T) {
+	_, web := newTestServer(t)
+	relay := "ws" + strings.TrimPrefix(web.URL, "http") + "/api/rc/relay?sessionId=s1"
+	base := relay + "&token=secret&role="
+
+	if _, response, err := websocket.DefaultDialer.Dial(relay+"&token=guess&role=operator", nil); err == nil {
+		t.Fatal("relay accepted a wrong token")
+	} else if response != nil && response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d", response.StatusCode)
+	}
+
+	operator, _, err := websocket.DefaultDialer.Dial(base+"operator", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer operator.Close()
+	agent, _, err := websocket.DefaultDialer.Dial(base+"agent", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+
+	read := func(conn *websocket.Conn) (int, string) {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return messageType, string(data)
+	}
+	if _, status := read(operator); !strings.Contains(status, `"relay-peer"`) || !strings.Contains(status, `"agent"`) {
+		t.Errorf("operator status = %s", status)
+	}
+	if _, status := read(agent); !strings.Contains(status, `"relay-peer"`) || !strings.Contains(status, `"operator"`) {
+		t.Errorf("agent status = %s", status)
+	}
+
+	if err := operator.WriteMessage(websocket.TextMessage, []byte(`{"type":"ping"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if messageType, data := read(agent); messageType != websocket.TextMessage || data != `{"type":"ping"}` {
+		t.Errorf("agent got %d %q", messageType, data)
+	}
+	if err := agent.WriteMessage(websocket.BinaryMessage, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if messageType, data := read(operator); messageType != websocket.BinaryMessage || data != "\x01\x02\x03" {
+		t.Errorf("operator got %d %q", messageType, data)
+	}
+}
@@ -0,0 +1,204 @@
+package simserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"deskwise-agent/internal/signalserver"
+)
+
+// registerControl adds the /sim/ API used to script the simulator at runtime:
+//
+//	GET    /sim/requests[?path=&method=]  recorded requests
+//	DELETE /sim/requests                  forget recorded requests
+//	GET    /sim/agents                    enrolled agents
+//	GET    /sim/faults                    active faults
+//	POST   /sim/faults                    add a fault (Fault JSON)
+//	DELETE /sim/faults[/{id}]             remove one or all faults
+//	GET    /sim/sessions                  offered sessions
+//	POST   /sim/sessions                  offer a session (see ParseSession)
+//	DELETE /sim/sessions/{id}             end a session
+//	GET    /sim/sessions/{id}/signals     signalling messages of a session
+//	POST   /sim/rfb                       issue a VNC one-time password ({"password","expiresAt","redaction","watermark"})
+//	GET    /sim/screenshots               uploaded screenshots and failures
+//	POST   /sim/screenshots               request a screenshot ({"requestId","ticketId","monitor",...})
+//	GET    /sim/screenshots/{requestId}   the uploaded image
+//	GET    /sim/power                     power action reports
+//	POST   /sim/power                     request a power action ({"requestId","action","delaySeconds",...})
+func (s *Server) registerControl(mux *http.ServeMux) {
+	mux.HandleFunc("GET /sim/requests", func(w http.ResponseWriter, r *http.Request) {
+		path, method := r.URL.Query().Get("path"), r.URL.Query().Get("method")
+		requests := []Request{}
+		for _, request := range s.Requests() {
+			if (path == "" || request.Path == path) && (method == "" || strings.EqualFold(request.Method, method)) {
+				requests = append(requests, request)
+			}
+		}
+		writeJSON(w, http.StatusOK, requests)
+	})
+	mux.HandleFunc("DELETE /sim/requests", func(w http.ResponseWriter, r *http.Request) {
+		s.ResetRequests()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+	})
+
+	mux.HandleFunc("GET /sim/agents", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Agents())
+	})
+
+	mux.HandleFunc("GET /sim/faults", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Faults())
+	})
+	mux.HandleFunc("POST /sim/faults", func(w http.ResponseWriter, r *http.Request) {
+		var fault Fault
+		if err := json.NewDecoder(r.Body).Decode(&fault); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid fault: %v", err))
+			return
+		}
+		id, err := s.AddFault(fault)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "id": id})
+	})
+	mux.HandleFunc("DELETE /sim/faults", func(w http.ResponseWriter, r *http.Request) {
+		s.ClearFaults()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+	})
+	mux.HandleFunc("DELETE /sim/faults/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if !s.RemoveFault(r.PathValue("id")) {
+			writeError(w, http.StatusNotFound, "fault not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+	})
+
+	mux.HandleFunc("GET /sim/sessions", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.signaling.Sessions())
+	})
+	mux.HandleFunc("POST /sim/sessions", func(w http.ResponseWriter, r *http.Request) {
+		var spec map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid session: %v", err))
+			return
+		}
+		session, err := s.AddSession(ParseSession(spec))
+		if err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":   true,
+			"sessionId": session.ID,
+			"token":     session.Token,
+		})
+	})
+	mux.HandleFunc("DELETE /sim/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		s.EndSession(r.PathValue("id"))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+	})
+	mux.HandleFunc("GET /sim/sessions/{id}/signals", func(w http.ResponseWriter, r *http.Request) {
+		signals := s.signaling.Signals(r.PathValue("id"))
+		if signals == nil {
+			signals = []signalserver.Signal{}
+		}
+		writeJSON(w, http.StatusOK, signals)
+	})
+
+	mux.HandleFunc("POST /sim/rfb", func(w http.ResponseWriter, r *http.Request) {
+		var grant map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&grant); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid password: %v", err))
+			return
+		}
+		if password, _ := grant["password"].(string); password == "" {
+			writeError(w, http.StatusBadRequest, "password is required")
+			return
+		}
+		s.IssueRFBPassword(grant)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+	})
+
+	mux.HandleFunc("GET /sim/screenshots", func(w http.ResponseWriter, r *http.Request) {
+		shots := s.Screenshots()
+		if shots == nil {
+			shots = []Screenshot{}
+		}
+		writeJSON(w, http.StatusOK, shots)
+	})
+	mux.HandleFunc("POST /sim/screenshots", func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid screenshot request: %v", err))
+			return
+		}
+		if id, _ := request["requestId"].(string); id == "" {
+			request["requestId"] = "shot-" + randomHex(4)
+		}
+		s.RequestScreenshot(request)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "requestId": request["requestId"]})
+	})
+	mux.HandleFunc("GET /sim/screenshots/{requestId}", func(w http.ResponseWriter, r *http.Request) {
+		shot, err := s.screenshotData(r.PathValue("requestId"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", shot.ContentType)
+		w.Write(shot.Data)
+	})
+
+	mux.HandleFunc("GET /sim/power", func(w http.ResponseWriter, r *http.Request) {
+		reports := s.PowerReports()
+		if reports == nil {
+			reports = []PowerReport{}
+		}
+		writeJSON(w, http.StatusOK, reports)
+	})
+	mux.HandleFunc("POST /sim/power", func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid power request: %v", err))
+			return
+		}
+		if action, _ := request["action"].(string); action == "" {
+			writeError(w, http.StatusBadRequest, "action is required")
+			return
+		}
+		if id, _ := request["requestId"].(string); id == "" {
+			request["requestId"] = "power-" + randomHex(4)
+		}
+		s.RequestPower(request)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "requestId": request["requestId"]})
+	})
+}
+
+// ParseSession builds a session from the JSON the agent would receive from rc/poll:
+// sessionId, token, assetId and orgId are picked out and every other field
+// (iceServers, permissions, redaction, ...) is passed through to the agent
+func ParseSession(spec map[string]interface{}) signalserver.Session {
+	session := signalserver.Session{Fields: make(map[string]interface{})}
+	for key, value := range spec {
+		text, _ := value.(string)
+		switch key {
+		case "sessionId":
+			session.ID = text
+		case "token":
+			session.Token = text
+		case "assetId":
+			session.AssetID = text
+		case "orgId":
+			session.OrgID = text
+		case "status":
+			// Set by the server
+		default:
+			session.Fields[key] = value
+		}
+	}
+	if session.OrgID == "" {
+		session.OrgID = "sim-org"
+	}
+	return session
+}
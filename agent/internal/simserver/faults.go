@@ -0,0 +1,205 @@
+package simserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Duration is a time.Duration that reads from JSON as "1.5s" or as milliseconds
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case float64:
+		*d = Duration(time.Duration(v) * time.Millisecond)
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration %s", string(data))
+	}
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Fault changes how the simulator answers matching requests.
+// A fault with only a Delay slows requests down and then serves them normally.
+//
+//	{"path":"/api/agent/performance","status":500,"count":3}
+//	{"path":"/api/rc/*","delay":"2s"}
+//	{"method":"GET","path":"/api/agent/rc/poll","drop":true,"skip":5}
+type Fault struct {
+	ID     string `json:"id,omitempty"`
+	Method string `json:"method,omitempty"` // empty matches every method
+	Path   string `json:"path"`             // exact path, or a prefix ending in *
+
+	Delay  Duration `json:"delay,omitempty"`
+	Status int      `json:"status,omitempty"` // respond with this status instead of serving
+	Body   string   `json:"body,omitempty"`   // response body for Status (default: JSON error)
+	Drop   bool     `json:"drop,omitempty"`   // close the connection without a response
+
+	Skip  int `json:"skip,omitempty"`  // let this many matching requests through first
+	Count int `json:"count,omitempty"` // apply this many times, then expire (0 = forever)
+
+	matched int
+	applied int
+}
+
+func (f *Fault) validate() error {
+	if f.Path == "" {
+		return fmt.Errorf("fault requires a path")
+	}
+	if f.Status != 0 && (f.Status < 100 || f.Status > 599) {
+		return fmt.Errorf("invalid fault status %d", f.Status)
+	}
+	if f.Delay == 0 && f.Status == 0 && !f.Drop {
+		return fmt.Errorf("fault needs a delay, status or drop")
+	}
+	return nil
+}
+
+func (f *Fault) matches(r *http.Request) bool {
+	if f.Method != "" && !strings.EqualFold(f.Method, r.Method) {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(f.Path, "*"); ok {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	}
+	return r.URL.Path == f.Path
+}
+
+func (f *Fault) expired() bool {
+	return f.Count > 0 && f.applied >= f.Count
+}
+
+// faultSet holds the active faults in the order they were added
+type faultSet struct {
+	mu     sync.Mutex
+	faults []*Fault
+	nextID int
+}
+
+func (fs *faultSet) add(fault Fault) (string, error) {
+	if err := fault.validate(); err != nil {
+		return "", err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.nextID++
+	if fault.ID == "" {
+		fault.ID = fmt.Sprintf("fault-%d", fs.nextID)
+	}
+	fs.faults = append(fs.faults, &fault)
+	return fault.ID, nil
+}
+
+func (fs *faultSet) remove(id string) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for i, fault := range fs.faults {
+		if fault.ID == id {
+			fs.faults = append(fs.faults[:i], fs.faults[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (fs *faultSet) clear() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.faults = nil
+}
+
+func (fs *faultSet) list() []Fault {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	faults := make([]Fault, 0, len(fs.faults))
+	for _, fault := range fs.faults {
+		faults = append(faults, *fault)
+	}
+	return faults
+}
+
+// take returns the first fault that applies to the request and counts it;
+// expired faults are dropped
+func (fs *faultSet) take(r *http.Request) (Fault, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for i, fault := range fs.faults {
+		if !fault.matches(r) {
+			continue
+		}
+		fault.matched++
+		if fault.matched <= fault.Skip {
+			continue
+		}
+
+		fault.applied++
+		applied := *fault
+		if fault.expired() {
+			fs.faults = append(fs.faults[:i], fs.faults[i+1:]...)
+		}
+		return applied, true
+	}
+	return Fault{}, false
+}
+
+// apply delays the request and writes the injected response; it reports
+// whether the request was answered (and must not be served normally)
+func (f Fault) apply(w http.ResponseWriter, r *http.Request) bool {
+	if f.Delay > 0 {
+		select {
+		case <-r.Context().Done():
+			return true
+		case <-time.After(time.Duration(f.Delay)):
+		}
+	}
+
+	if f.Drop {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return true
+			}
+		}
+		// Not hijackable: abort the handler, which also resets the connection
+		panic(http.ErrAbortHandler)
+	}
+
+	if f.Status == 0 {
+		return false
+	}
+
+	if f.Body != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(f.Status)
+		w.Write([]byte(f.Body))
+		return true
+	}
+	writeJSON(w, f.Status, map[string]interface{}{
+		"success": false,
+		"error":   fmt.Sprintf("injected fault %s", f.ID),
+	})
+	return true
+}
@@ -0,0 +1,68 @@
+package simserver
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// PowerReport is a step of a power action an agent reported
+type PowerReport struct {
+	RequestID    string    `json:"requestId"`
+	AgentID      string    `json:"agentId,omitempty"`
+	Action       string    `json:"action"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error,omitempty"`
+	ScheduledFor string    `json:"scheduledFor,omitempty"`
+	BootTime     string    `json:"bootTime,omitempty"`
+	Time         string    `json:"time"`
+	ReceivedAt   time.Time `json:"receivedAt"`
+}
+
+// RequestPower queues a power action ({"requestId", "action", "delaySeconds",
+// "message", "requireIdle", ...}); the next rc/poll from any agent receives it
+func (s *Server) RequestPower(request map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.powerRequests = append(s.powerRequests, request)
+	log.Printf("[Sim] Power action %v (%v) queued", request["requestId"], request["action"])
+}
+
+// PowerReports returns the power action reports received so far
+func (s *Server) PowerReports() []PowerReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]PowerReport(nil), s.powerReports...)
+}
+
+// handlePower stores a power action report
+func (s *Server) handlePower(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	agentID, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var report PowerReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if report.RequestID == "" || report.Status == "" {
+		writeError(w, http.StatusBadRequest, "requestId and status are required")
+		return
+	}
+	report.AgentID = agentID
+	report.ReceivedAt = time.Now()
+
+	s.mu.Lock()
+	s.powerReports = append(s.powerReports, report)
+	s.mu.Unlock()
+
+	log.Printf("[Sim] Power action %s (%s): %s %s", report.RequestID, report.Action, report.Status, report.Error)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
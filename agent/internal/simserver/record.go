@@ -0,0 +1,174 @@
+package simserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRecordedBody is how much of each request body is kept in the recording
+const maxRecordedBody = 256 << 10
+
+// Request is one request the simulator received
+type Request struct {
+	Seq     int               `json:"seq"`
+	Time    time.Time         `json:"time"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Query   map[string]string `json:"query,omitempty"`
+	AgentID string            `json:"agentId,omitempty"` // resolved from the bearer credential
+	Body    json.RawMessage   `json:"body,omitempty"`    // JSON bodies as-is
+	Text    string            `json:"text,omitempty"`    // other bodies as text
+	Size    int64             `json:"size"`
+	Status  int               `json:"status"`
+	Fault   string            `json:"fault,omitempty"` // ID of the injected fault, if any
+	Elapsed Duration          `json:"elapsed"`
+}
+
+// Decode unmarshals the recorded JSON body
+func (r Request) Decode(v interface{}) error {
+	if len(r.Body) == 0 {
+		return fmt.Errorf("request %d has no JSON body", r.Seq)
+	}
+	return json.Unmarshal(r.Body, v)
+}
+
+// recorder keeps every request in memory and optionally appends them to a JSON-lines file
+type recorder struct {
+	mu       sync.Mutex
+	requests []Request
+	file     *os.File
+	notify   chan struct{} // closed and replaced on every new request
+}
+
+func newRecorder(path string) (*recorder, error) {
+	rec := &recorder{notify: make(chan struct{})}
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open recording: %w", err)
+		}
+		rec.file = file
+	}
+	return rec, nil
+}
+
+func (rec *recorder) add(request Request) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	request.Seq = len(rec.requests) + 1
+	rec.requests = append(rec.requests, request)
+
+	if rec.file != nil {
+		if line, err := json.Marshal(request); err == nil {
+			rec.file.Write(append(line, '\n'))
+		}
+	}
+
+	close(rec.notify)
+	rec.notify = make(chan struct{})
+}
+
+func (rec *recorder) list() []Request {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]Request(nil), rec.requests...)
+}
+
+func (rec *recorder) reset() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.requests = nil
+}
+
+// wait blocks until match accepts a recorded request or the context ends
+func (rec *recorder) wait(ctx context.Context, match func(Request) bool) (Request, error) {
+	seen := 0
+	for {
+		rec.mu.Lock()
+		pending := rec.requests[seen:]
+		seen = len(rec.requests)
+		notify := rec.notify
+		rec.mu.Unlock()
+
+		for _, request := range pending {
+			if match(request) {
+				return request, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return Request{}, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+func (rec *recorder) close() error {
+	if rec.file == nil {
+		return nil
+	}
+	return rec.file.Close()
+}
+
+// readBody reads the request body for the recording and puts it back for the handler
+func readBody(r *http.Request) (json.RawMessage, string, int64) {
+	if r.Body == nil {
+		return nil, "", 0
+	}
+
+	data, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil || len(data) == 0 {
+		return nil, "", int64(len(data))
+	}
+
+	size := int64(len(data))
+	if len(data) <= maxRecordedBody && json.Valid(data) {
+		return json.RawMessage(data), "", size
+	}
+	if len(data) > maxRecordedBody {
+		data = data[:maxRecordedBody]
+	}
+	return nil, strings.ToValidUTF8(string(data), "�"), size
+}
+
+// statusWriter captures the response status for the recording
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(data []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(data)
+}
+
+func (sw *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("connection cannot be hijacked")
+	}
+	return hijacker.Hijack()
+}
@@ -0,0 +1,113 @@
+package simserver
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// maxScreenshotSize bounds screenshot uploads kept in memory
+const maxScreenshotSize = 64 << 20
+
+// Screenshot is a screenshot (or capture failure) an agent uploaded
+type Screenshot struct {
+	RequestID   string    `json:"requestId"`
+	TicketID    string    `json:"ticketId"`
+	AgentID     string    `json:"agentId,omitempty"`
+	ContentType string    `json:"contentType"`
+	Size        int       `json:"size"`
+	Width       string    `json:"width,omitempty"`
+	Height      string    `json:"height,omitempty"`
+	Monitor     string    `json:"monitor,omitempty"`
+	CapturedAt  string    `json:"capturedAt,omitempty"`
+	Error       string    `json:"error,omitempty"` // Set when the agent reported a failure instead
+	ReceivedAt  time.Time `json:"receivedAt"`
+	Data        []byte    `json:"-"`
+}
+
+// RequestScreenshot queues a screenshot command ({"requestId", "ticketId", "monitor",
+// "format", "scale", "notifyUser", ...}); the next rc/poll from any agent receives it
+func (s *Server) RequestScreenshot(request map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.screenshotRequests = append(s.screenshotRequests, request)
+	log.Printf("[Sim] Screenshot %v queued for ticket %v", request["requestId"], request["ticketId"])
+}
+
+// Screenshots returns the screenshots uploaded so far
+func (s *Server) Screenshots() []Screenshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Screenshot(nil), s.screenshots...)
+}
+
+// handleScreenshot stores an uploaded screenshot or failure report
+func (s *Server) handleScreenshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	agentID, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("requestId") == "" {
+		writeError(w, http.StatusBadRequest, "requestId is required")
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxScreenshotSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	if len(data) > maxScreenshotSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "screenshot too large")
+		return
+	}
+
+	shot := Screenshot{
+		RequestID:   query.Get("requestId"),
+		TicketID:    query.Get("ticketId"),
+		AgentID:     agentID,
+		ContentType: r.Header.Get("Content-Type"),
+		Size:        len(data),
+		Width:       query.Get("width"),
+		Height:      query.Get("height"),
+		Monitor:     query.Get("monitor"),
+		CapturedAt:  query.Get("capturedAt"),
+		ReceivedAt:  time.Now(),
+		Data:        data,
+	}
+	if shot.ContentType == "application/json" {
+		shot.Error = string(data)
+	}
+
+	s.mu.Lock()
+	s.screenshots = append(s.screenshots, shot)
+	s.mu.Unlock()
+
+	if shot.Error != "" {
+		log.Printf("[Sim] Screenshot %s failed: %s", shot.RequestID, shot.Error)
+	} else {
+		log.Printf("[Sim] Stored %s screenshot %s (%sx%s, %d bytes) for ticket %s",
+			shot.ContentType, shot.RequestID, shot.Width, shot.Height, shot.Size, shot.TicketID)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// screenshotData returns the image of the latest upload for a request
+func (s *Server) screenshotData(requestID string) (Screenshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.screenshots) - 1; i >= 0; i-- {
+		if s.screenshots[i].RequestID == requestID {
+			return s.screenshots[i], nil
+		}
+	}
+	return Screenshot{}, fmt.Errorf("no screenshot for request %s", requestID)
+}
@@ -0,0 +1,102 @@
+package simserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// ScriptStep is one timed action of a simulator script. Scripts are JSON lines;
+// "at" is the offset from the start of the script:
+//
+//	# fail the first three performance reports
+//	{"at":"0s","fault":{"path":"/api/agent/performance","status":500,"count":3}}
+//	{"at":"20s","session":{"sessionId":"demo","token":"secret","iceServers":[]}}
+//	{"at":"2m","endSession":"demo"}
+//	{"at":"2m","clearFaults":true}
+type ScriptStep struct {
+	At          Duration               `json:"at"`
+	Fault       *Fault                 `json:"fault,omitempty"`
+	RemoveFault string                 `json:"removeFault,omitempty"`
+	ClearFaults bool                   `json:"clearFaults,omitempty"`
+	Session     map[string]interface{} `json:"session,omitempty"`
+	EndSession  string                 `json:"endSession,omitempty"`
+}
+
+// LoadScript reads a JSON-lines simulator script
+func LoadScript(path string) ([]ScriptStep, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var steps []ScriptStep
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var step ScriptStep
+		if err := json.Unmarshal([]byte(text), &step); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if step.Fault != nil {
+			if err := step.Fault.validate(); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, scanner.Err()
+}
+
+// RunScript applies the steps at their offsets; steps must be in time order
+func (s *Server) RunScript(ctx context.Context, steps []ScriptStep) {
+	started := time.Now()
+	for i, step := range steps {
+		if wait := time.Duration(step.At) - time.Since(started); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+
+		if err := s.applyStep(step); err != nil {
+			log.Printf("[Sim] Script step %d failed: %v", i+1, err)
+		}
+	}
+	log.Printf("[Sim] Script finished (%d steps)", len(steps))
+}
+
+func (s *Server) applyStep(step ScriptStep) error {
+	if step.Fault != nil {
+		if _, err := s.AddFault(*step.Fault); err != nil {
+			return err
+		}
+	}
+	if step.RemoveFault != "" && !s.RemoveFault(step.RemoveFault) {
+		return fmt.Errorf("fault %s not found", step.RemoveFault)
+	}
+	if step.ClearFaults {
+		s.ClearFaults()
+	}
+	if step.Session != nil {
+		if _, err := s.AddSession(ParseSession(step.Session)); err != nil {
+			return err
+		}
+	}
+	if step.EndSession != "" {
+		s.EndSession(step.EndSession)
+	}
+	return nil
+}
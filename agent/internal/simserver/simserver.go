@@ -0,0 +1,505 @@
+// Package simserver simulates the agent-facing Deskwise API for offline
+// development and integration tests. It implements enrollment, performance
+// reports, the remote control session poll, screenshot uploads, power action reports,
+// transcript uploads retried with the agent credential, the signalling endpoints and the
+// WebSocket relay with in-memory state, records every request it receives, and
+// can inject errors, delays and dropped connections per endpoint.
+//
+// Tests drive it directly:
+//
+//	sim, _ := simserver.New(simserver.Options{})
+//	server := httptest.NewServer(sim.Handler())
+//	sim.AddFault(simserver.Fault{Path: "/api/agent/performance", Status: 500, Count: 1})
+//	request, err := sim.WaitForRequest(ctx, "POST", "/api/agent/performance")
+//
+// The deskwise-sim command exposes the same controls over /sim/ and a startup script.
+package simserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"deskwise-agent/internal/signalserver"
+)
+
+// Options configures a simulator
+type Options struct {
+	// EnrollmentToken is the token agents must enroll with (empty accepts any)
+	EnrollmentToken string
+
+	// RequireEnrollment rejects credentials the simulator did not issue;
+	// otherwise unknown agents are served as anonymous
+	RequireEnrollment bool
+
+	// RecordPath appends every received request to this JSON-lines file
+	RecordPath string
+}
+
+// Agent is an enrolled agent and what it last reported
+type Agent struct {
+	AgentID       string    `json:"agentId"`
+	AssetID       string    `json:"assetId"`
+	CredentialKey string    `json:"credentialKey"`
+	Hostname      string    `json:"hostname,omitempty"`
+	Platform      string    `json:"platform,omitempty"`
+	Arch          string    `json:"arch,omitempty"`
+	EnrolledAt    time.Time `json:"enrolledAt"`
+	LastSeen      time.Time `json:"lastSeen"`
+
+	PerformanceReports int             `json:"performanceReports"`
+	LastPerformance    json.RawMessage `json:"lastPerformance,omitempty"`
+	Capabilities       json.RawMessage `json:"capabilities,omitempty"`
+}
+
+// Server is the simulated Deskwise API
+type Server struct {
+	options   Options
+	signaling *signalserver.Server
+	faults    faultSet
+	recorder  *recorder
+
+	mu           sync.Mutex
+	agents       map[string]*Agent // by agent ID
+	credentials  map[string]string // credential key -> agent ID
+	nextAssetNum int
+	rfbPasswords []map[string]interface{} // VNC one-time passwords awaiting the next poll
+
+	screenshotRequests []map[string]interface{} // Screenshot commands awaiting the next poll
+	screenshots        []Screenshot
+	powerRequests      []map[string]interface{} // Power actions awaiting the next poll
+	powerReports       []PowerReport
+}
+
+// New creates a simulator with no agents, sessions or faults
+func New(options Options) (*Server, error) {
+	rec, err := newRecorder(options.RecordPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		options:     options,
+		signaling:   signalserver.New(),
+		recorder:    rec,
+		agents:      make(map[string]*Agent),
+		credentials: make(map[string]string),
+	}, nil
+}
+
+// Close flushes the recording file
+func (s *Server) Close() error {
+	return s.recorder.close()
+}
+
+// Handler serves the agent API (with recording and fault injection) and the /sim/ control API
+func (s *Server) Handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("/api/agent/enroll", s.handleEnroll)
+	api.HandleFunc("/api/agent/performance", s.handlePerformance)
+	api.HandleFunc("/api/agent/rc/poll", s.handlePoll)
+	api.HandleFunc("/api/agent/rc/screenshot", s.handleScreenshot)
+	api.HandleFunc("/api/agent/rc/power", s.handlePower)
+	api.HandleFunc("/api/agent/rc/artifacts", s.handleAgentArtifact)
+	api.Handle("/api/rc/", s.signaling.Handler())
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", s.instrument(api))
+	s.registerControl(mux)
+	return mux
+}
+
+// Signalling returns the signalling store for inspecting signals and artifacts
+func (s *Server) Signalling() *signalserver.Server {
+	return s.signaling
+}
+
+// AddFault starts injecting a fault and returns its ID
+func (s *Server) AddFault(fault Fault) (string, error) {
+	id, err := s.faults.add(fault)
+	if err == nil {
+		log.Printf("[Sim] Fault %s added for %s %s", id, fault.Method, fault.Path)
+	}
+	return id, err
+}
+
+// RemoveFault stops injecting a fault
+func (s *Server) RemoveFault(id string) bool {
+	return s.faults.remove(id)
+}
+
+// ClearFaults removes every fault
+func (s *Server) ClearFaults() {
+	s.faults.clear()
+}
+
+// Faults returns the active faults
+func (s *Server) Faults() []Fault {
+	return s.faults.list()
+}
+
+// AddSession offers a remote control session to agents, generating an ID and token when missing
+func (s *Server) AddSession(session signalserver.Session) (signalserver.Session, error) {
+	if session.ID == "" {
+		session.ID = "sim-" + randomHex(6)
+	}
+	if session.Token == "" {
+		session.Token = randomHex(16)
+	}
+	if err := s.signaling.AddSession(session); err != nil {
+		return session, err
+	}
+
+	log.Printf("[Sim] Session %s offered (asset %q, token %s)", session.ID, session.AssetID, session.Token)
+	return session, nil
+}
+
+// EndSession stops offering a session
+func (s *Server) EndSession(id string) {
+	s.signaling.EndSession(id)
+	log.Printf("[Sim] Session %s ended", id)
+}
+
+// RegisterAgent adds an agent as if it had enrolled, so a saved credential is accepted
+func (s *Server) RegisterAgent(agent Agent) error {
+	if agent.AgentID == "" || agent.CredentialKey == "" {
+		return fmt.Errorf("agent requires an agent ID and credential key")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if agent.AssetID == "" {
+		agent.AssetID = s.newAssetID()
+	}
+	if agent.EnrolledAt.IsZero() {
+		agent.EnrolledAt = time.Now()
+	}
+	s.agents[agent.AgentID] = &agent
+	s.credentials[agent.CredentialKey] = agent.AgentID
+	return nil
+}
+
+// Agents returns a snapshot of every known agent
+func (s *Server) Agents() []Agent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agents := make([]Agent, 0, len(s.agents))
+	for _, agent := range s.agents {
+		agents = append(agents, *agent)
+	}
+	return agents
+}
+
+// Requests returns every request recorded so far
+func (s *Server) Requests() []Request {
+	return s.recorder.list()
+}
+
+// ResetRequests forgets the recorded requests (the recording file is kept)
+func (s *Server) ResetRequests() {
+	s.recorder.reset()
+}
+
+// WaitForRequest blocks until a request with the given method and path has been
+// recorded (including ones already received); an empty method matches any
+func (s *Server) WaitForRequest(ctx context.Context, method, path string) (Request, error) {
+	return s.recorder.wait(ctx, func(r Request) bool {
+		return r.Path == path && (method == "" || strings.EqualFold(r.Method, method))
+	})
+}
+
+// WaitFor blocks until a recorded request satisfies match
+func (s *Server) WaitFor(ctx context.Context, match func(Request) bool) (Request, error) {
+	return s.recorder.wait(ctx, match)
+}
+
+// instrument records each API request and applies the first matching fault
+func (s *Server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		body, text, size := readBody(r)
+
+		request := Request{
+			Time:   started,
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Body:   body,
+			Text:   text,
+			Size:   size,
+		}
+		if query := r.URL.Query(); len(query) > 0 {
+			request.Query = make(map[string]string, len(query))
+			for key := range query {
+				request.Query[key] = query.Get(key)
+			}
+		}
+		if agent, ok := s.agentForRequest(r); ok {
+			request.AgentID = agent.AgentID
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			request.Status = sw.status
+			// An accepted relay WebSocket hijacks the connection before anything is recorded
+			if request.Status == 0 && request.Fault == "" && strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+				request.Status = http.StatusSwitchingProtocols
+			}
+			request.Elapsed = Duration(time.Since(started))
+			s.recorder.add(request)
+		}()
+
+		if fault, ok := s.faults.take(r); ok {
+			request.Fault = fault.ID
+			if fault.apply(sw, r) {
+				return
+			}
+		}
+		next.ServeHTTP(sw, r)
+	})
+}
+
+func (s *Server) handleEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var enrollment struct {
+		EnrollmentToken string `json:"enrollmentToken"`
+		AgentID         string `json:"agentId"`
+		Hostname        string `json:"hostname"`
+		Platform        string `json:"platform"`
+		Arch            string `json:"arch"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&enrollment); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if s.options.EnrollmentToken != "" && enrollment.EnrollmentToken != s.options.EnrollmentToken {
+		writeError(w, http.StatusUnauthorized, "invalid enrollment token")
+		return
+	}
+	if enrollment.AgentID == "" {
+		enrollment.AgentID = "agent-" + randomHex(6)
+	}
+
+	s.mu.Lock()
+	agent, exists := s.agents[enrollment.AgentID]
+	if exists {
+		// Re-enrollment keeps the asset and rotates the credential
+		delete(s.credentials, agent.CredentialKey)
+	} else {
+		agent = &Agent{AgentID: enrollment.AgentID, AssetID: s.newAssetID()}
+		s.agents[agent.AgentID] = agent
+	}
+	agent.CredentialKey = randomHex(24)
+	agent.Hostname = enrollment.Hostname
+	agent.Platform = enrollment.Platform
+	agent.Arch = enrollment.Arch
+	agent.EnrolledAt = time.Now()
+	agent.LastSeen = agent.EnrolledAt
+	s.credentials[agent.CredentialKey] = agent.AgentID
+	response := map[string]interface{}{
+		"success":       true,
+		"credentialKey": agent.CredentialKey,
+		"assetId":       agent.AssetID,
+		"message":       "Agent enrolled with the simulator",
+	}
+	s.mu.Unlock()
+
+	log.Printf("[Sim] Agent %s enrolled as asset %s (%s/%s)", enrollment.AgentID, agent.AssetID, enrollment.Platform, enrollment.Arch)
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handlePerformance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	agentID, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var snapshot struct {
+		Capabilities json.RawMessage `json:"capabilities"`
+	}
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	json.Unmarshal(raw, &snapshot)
+
+	if agentID != "" {
+		s.mu.Lock()
+		if agent, ok := s.agents[agentID]; ok {
+			agent.PerformanceReports++
+			agent.LastPerformance = raw
+			if len(snapshot.Capabilities) > 0 {
+				agent.Capabilities = snapshot.Capabilities
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+func (s *Server) handlePoll(w http.ResponseWriter, r *http.Request) {
+	agentID, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	assetID := ""
+	if agentID != "" {
+		s.mu.Lock()
+		if agent, ok := s.agents[agentID]; ok {
+			assetID = agent.AssetID
+		}
+		s.mu.Unlock()
+	}
+
+	response := map[string]interface{}{"success": true}
+	if info, ok := s.signaling.NextSession(assetID); ok {
+		response["session"] = info
+	}
+
+	s.mu.Lock()
+	if len(s.rfbPasswords) > 0 {
+		response["rfb"] = s.rfbPasswords[0]
+		s.rfbPasswords = s.rfbPasswords[1:]
+	}
+	if len(s.screenshotRequests) > 0 {
+		response["screenshot"] = s.screenshotRequests[0]
+		s.screenshotRequests = s.screenshotRequests[1:]
+	}
+	if len(s.powerRequests) > 0 {
+		response["power"] = s.powerRequests[0]
+		s.powerRequests = s.powerRequests[1:]
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleAgentArtifact stores a transcript the agent retried with its own credential
+// after the session ended
+func (s *Server) handleAgentArtifact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if _, ok := s.authenticate(w, r); !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("kind") == "" {
+		writeError(w, http.StatusBadRequest, "kind is required")
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxScreenshotSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	if len(data) > maxScreenshotSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "artifact too large")
+		return
+	}
+
+	artifact := signalserver.Artifact{Kind: query.Get("kind"), ContentType: r.Header.Get("Content-Type"), Data: data}
+	if err := s.signaling.AddArtifact(query.Get("sessionId"), artifact); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// IssueRFBPassword queues a VNC one-time password ({"password", "expiresAt",
+// optional "redaction" and "watermark"); the next rc/poll from any agent receives it
+func (s *Server) IssueRFBPassword(grant map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rfbPasswords = append(s.rfbPasswords, grant)
+	log.Printf("[Sim] VNC one-time password queued")
+}
+
+// authenticate resolves the bearer credential and updates the agent's last-seen time.
+// Unknown credentials are served anonymously (empty agent ID) unless enrollment is required.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || key == "" {
+		writeError(w, http.StatusUnauthorized, "missing credential")
+		return "", false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agentID, known := s.credentials[key]
+	if !known {
+		if s.options.RequireEnrollment {
+			writeError(w, http.StatusUnauthorized, "unknown credential")
+			return "", false
+		}
+		return "", true
+	}
+
+	s.agents[agentID].LastSeen = time.Now()
+	return agentID, true
+}
+
+// agentForRequest looks up the agent behind a bearer credential without side effects
+func (s *Server) agentForRequest(r *http.Request) (Agent, bool) {
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return Agent{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agent, ok := s.agents[s.credentials[key]]
+	if !ok {
+		return Agent{}, false
+	}
+	return *agent, true
+}
+
+// newAssetID returns the next asset ID; s.mu must be held
+func (s *Server) newAssetID() string {
+	s.nextAssetNum++
+	return fmt.Sprintf("sim-asset-%d", s.nextAssetNum)
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	return hex.EncodeToString(buf)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{"success": false, "error": message})
+}
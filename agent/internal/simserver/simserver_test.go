@@ -0,0 +1,55 @@
+package simserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFaultSkipCountAndPrefix(t *testing.T) {
+	sim, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	server := httptest.NewServer(sim.Handler())
+	defer server.Close()
+
+	if _, err := sim.AddFault(Fault{Path: "/api/agent/rc/*", Status: http.StatusBadGateway, Skip: 1, Count: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.AddFault(Fault{Path: "/api/agent/performance"}); err == nil {
+		t.Error("a fault without a delay, status or drop was accepted")
+	}
+
+	poll := func() int {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/api/agent/rc/poll", nil)
+		request.Header.Set("Authorization", "Bearer anonymous")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	want := []int{http.StatusOK, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}
+	for i, status := range want {
+		if got := poll(); got != status {
+			t.Errorf("poll %d: status %d, want %d", i+1, got, status)
+		}
+	}
+	if faults := sim.Faults(); len(faults) != 0 {
+		t.Errorf("expired fault still active: %+v", faults)
+	}
+
+	// Unknown credentials are refused once enrollment is required
+	strict, _ := New(Options{RequireEnrollment: true})
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/api/agent/performance", strings.NewReader(`{}`))
+	request.Header.Set("Authorization", "Bearer unknown")
+	strict.Handler().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("unknown credential: status %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+}
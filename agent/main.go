@@ -1,11 +1,13 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -36,6 +38,32 @@ type Config struct {
 	Interval        int    // Collection interval in seconds (default: 60)
 	TimeWindow      string // Time window for data aggregation
 	CredentialFile  string // Path to local credential file
+	TerminalUser    string // Account remote terminals run as (empty = agent account)
+	TerminalShell   string // Shell for remote terminals (empty = platform default)
+	TranscriptDir   string // Local directory for terminal and chat transcripts awaiting upload
+	FileRoots       string // Path list of directories exposed to file transfer (empty = disabled)
+	FileMaxUpload   int64  // Largest file the operator may upload, in MB
+	FileMaxDownload int64  // Largest file the operator may download, in MB
+	CaptureSource   string // screen, console for the Linux text console, or synthetic for test frames without a display
+	Pattern         string // Synthetic test pattern (bars, checker, noise, static)
+	PatternSize     string // Synthetic monitor size, WIDTHxHEIGHT
+	PatternMonitors int    // Number of synthetic monitors
+	ReplayDir       string // Directory of PNG/JPEG frames the synthetic source replays
+	FrameCounter    bool   // Burn frame counters into synthetic frames
+	RFBInterface    string // Interface (name or address) for the built-in VNC server (empty = disabled)
+	RFBPort         int    // Port of the built-in VNC server
+	RFBMonitor      int    // Monitor the VNC server shows (-1 = all monitors)
+	VirtualDisplays bool   // Start virtual display sessions the server asks for (Linux)
+	DisplayUsers    string // Comma-separated accounts virtual displays may run as
+	DisplayServer   string // X server for virtual display sessions, Xvfb or Xvnc (empty = first found)
+	WindowManager   string // Window manager for virtual display sessions (empty = first found)
+	ChatListen      string // Local endpoint for the end-user chat and pause helper, unix:/path or loopback host:port (empty = notifications only)
+	ChatUser        string // Desktop account the chat Unix socket belongs to (empty = the agent's account)
+	ChatGroup       string // Group that may also use the chat Unix socket (empty = none)
+	AccessPINHash   string // argon2id hash of the unattended-access PIN, kept in the credential file (empty = no PIN)
+	PINAttempts     int    // Wrong access PINs before remote access is locked
+	PINLockout      int    // First access PIN lockout in minutes, doubled on each further lockout
+	PowerActions    bool   // Carry out reboot, shutdown, logoff and lock requests from the server
 }
 
 // EnrollmentRequest is sent to the server during initial enrollment
@@ -176,6 +204,31 @@ type SessionInfo struct {
 	AssetID   string `json:"assetId"`
 	OrgID     string `json:"orgId"`
 	Status    string `json:"status"`
+
+	// Optional per-session stream settings
+	ScalingMode      string `json:"scalingMode,omitempty"`
+	PerMonitorTracks bool   `json:"perMonitorTracks,omitempty"`
+
+	// Organisation policy: screen regions that must never be streamed
+	Redaction *remotecontrol.RedactionPolicy `json:"redaction,omitempty"`
+
+	// Attribution overlay (operator, ticket); disabled per organisation via enabled=false
+	Watermark *remotecontrol.WatermarkConfig `json:"watermark,omitempty"`
+
+	// Optional features explicitly granted for this session (e.g. terminal)
+	Permissions remotecontrol.SessionPermissions `json:"permissions,omitempty"`
+
+	// Organisation policy: LAN hosts the operator may reach via port forwarding
+	PortForward *remotecontrol.PortForwardPolicy `json:"portForward,omitempty"`
+
+	// STUN/TURN servers for this session; an empty list means host candidates only
+	ICEServers []remotecontrol.ICEServer `json:"iceServers,omitempty"`
+
+	// Headless X display to start for the session (display number, resolution, user)
+	VirtualDisplay *remotecontrol.VirtualDisplayOptions `json:"virtualDisplay,omitempty"`
+
+	// Graphical session (logind ID or X display) to control on multi-user Linux hosts
+	GraphicalSession string `json:"graphicalSession,omitempty"`
 }
 
 // Global variables for network statistics delta calculation
@@ -192,21 +245,104 @@ func main() {
 	interval := flag.Int("interval", 60, "Collection interval in seconds")
 	timeWindow := flag.String("time-window", "1min", "Time window for aggregation")
 	credentialFile := flag.String("credential-file", "./agent-credential.json", "Path to credential file")
+	terminalUser := flag.String("terminal-user", "", "Account remote terminal sessions run as (default: agent account)")
+	terminalShell := flag.String("terminal-shell", "", "Shell for remote terminal sessions (default: platform shell)")
+	transcriptDir := flag.String("transcript-dir", "", "Directory for terminal and chat transcripts awaiting upload (default: temp dir)")
+	fileRoots := flag.String("file-roots", "", "Directories available for file transfer, separated by the OS path list separator (default: disabled)")
+	fileMaxUpload := flag.Int64("file-max-upload-mb", 1024, "Maximum file transfer upload size in MB")
+	fileMaxDownload := flag.Int64("file-max-download-mb", 1024, "Maximum file transfer download size in MB")
+	captureSource := flag.String("capture", "screen", "Capture source: screen, console (Linux text console via /dev/vcsa), or synthetic for test frames without a display")
+	pattern := flag.String("synthetic-pattern", "bars", "Synthetic test pattern: bars, checker, noise or static")
+	patternSize := flag.String("synthetic-size", "1280x720", "Synthetic monitor size (ignored when replaying, unless set)")
+	patternMonitors := flag.Int("synthetic-monitors", 1, "Number of synthetic monitors")
+	replayDir := flag.String("synthetic-replay", "", "Replay PNG/JPEG frames from this directory instead of a pattern")
+	frameCounter := flag.Bool("synthetic-counter", true, "Burn a frame counter into synthetic frames")
+	rfbInterface := flag.String("rfb-interface", "", "Serve VNC (RFB) on this interface name or address, with one-time passwords from the server (default: disabled; unavailable with an access PIN)")
+	rfbPort := flag.Int("rfb-port", 5900, "Port of the built-in VNC server")
+	rfbMonitor := flag.Int("rfb-monitor", 0, "Monitor shown by the built-in VNC server (-1 for all monitors)")
+	virtualDisplays := flag.Bool("virtual-displays", false, "Start headless X displays for sessions that ask for one on Linux (default: disabled)")
+	displayUsers := flag.String("virtual-display-users", "", "Comma-separated accounts virtual displays may run as; root is always refused")
+	displayServer := flag.String("virtual-display-server", "", "X server for virtual display sessions on Linux: Xvfb or Xvnc (default: first installed)")
+	windowManager := flag.String("virtual-display-wm", "", "Window manager command for virtual display sessions (default: first installed)")
+	chatListen := flag.String("chat-listen", "", "Local endpoint for the end-user chat and pause helper: unix:/path/to/socket or a loopback host:port (default: desktop notifications only)")
+	chatUser := flag.String("chat-user", "", "Desktop account the chat Unix socket is handed to (default: the agent's account only)")
+	chatGroup := flag.String("chat-group", "", "Group that may also use the chat Unix socket (default: none)")
+	sessionAction := flag.String("session", "", "Pause, resume or show (status) the active remote session of the agent listening on -chat-listen, then exit")
+	setAccessPIN := flag.Bool("set-access-pin", false, "Read an unattended-access PIN from stdin, store its hash in the credential file and exit (an empty PIN removes it)")
+	accessPINAttempts := flag.Int("access-pin-attempts", 5, "Wrong access PINs before remote access is locked")
+	accessPINLockout := flag.Int("access-pin-lockout-minutes", 15, "Minutes remote access is locked after too many wrong PINs (doubles on each further lockout)")
+	powerActions := flag.Bool("power-actions", false, "Carry out reboot, shutdown, logoff and lock requests from the server (default: disabled)")
 
 	flag.Parse()
 
+	// The end user's pause control talks to the running agent and exits
+	if *sessionAction != "" {
+		if *chatListen == "" {
+			log.Fatal("-session needs the agent's -chat-listen endpoint")
+		}
+		state, err := remotecontrol.ControlSession(*chatListen, *sessionAction)
+		if err != nil {
+			log.Fatalf("Failed to %s the session: %v", *sessionAction, err)
+		}
+		switch {
+		case !state.Active:
+			fmt.Println("No remote session in progress")
+		case state.Paused:
+			fmt.Printf("Remote session %s is paused\n", state.SessionID)
+		default:
+			fmt.Printf("Remote session %s is running\n", state.SessionID)
+		}
+		return
+	}
+
 	// Load or create configuration
 	config := Config{
-		ServerURL:      *serverURL,
-		Interval:       *interval,
-		TimeWindow:     *timeWindow,
-		CredentialFile: *credentialFile,
+		ServerURL:       *serverURL,
+		Interval:        *interval,
+		TimeWindow:      *timeWindow,
+		CredentialFile:  *credentialFile,
+		TerminalUser:    *terminalUser,
+		TerminalShell:   *terminalShell,
+		TranscriptDir:   *transcriptDir,
+		FileRoots:       *fileRoots,
+		FileMaxUpload:   *fileMaxUpload,
+		FileMaxDownload: *fileMaxDownload,
+		CaptureSource:   *captureSource,
+		Pattern:         *pattern,
+		PatternSize:     *patternSize,
+		PatternMonitors: *patternMonitors,
+		ReplayDir:       *replayDir,
+		FrameCounter:    *frameCounter,
+		RFBInterface:    *rfbInterface,
+		RFBPort:         *rfbPort,
+		RFBMonitor:      *rfbMonitor,
+		ChatListen:      *chatListen,
+		ChatUser:        *chatUser,
+		ChatGroup:       *chatGroup,
+		VirtualDisplays: *virtualDisplays,
+		DisplayUsers:    *displayUsers,
+		DisplayServer:   *displayServer,
+		WindowManager:   *windowManager,
+		PINAttempts:     *accessPINAttempts,
+		PINLockout:      *accessPINLockout,
+		PowerActions:    *powerActions,
+	}
+	if *replayDir != "" && !flagWasSet("synthetic-size") {
+		config.PatternSize = ""
 	}
 
 	// Generate agent ID if not already set
 	hostname, _ := os.Hostname()
 	config.AgentID = fmt.Sprintf("%s-%s-%d", runtime.GOOS, hostname, time.Now().Unix())
 
+	// The PIN is set at install time, after enrollment, and stored with the credential
+	if *setAccessPIN {
+		if err := storeAccessPIN(&config); err != nil {
+			log.Fatalf("Failed to set the access PIN: %v", err)
+		}
+		return
+	}
+
 	// Try to load existing credential
 	if err := loadCredential(&config); err != nil {
 		log.Printf("No existing credential found: %v", err)
@@ -252,12 +388,92 @@ func main() {
 	// Initialize remote control manager
 	const agentVersion = "1.0.0"
 	rcManager = remotecontrol.NewManager(config.ServerURL, runtime.GOOS, agentVersion)
-	log.Printf("[RemoteControl] Manager initialized with capabilities: %+v", rcManager.GetCapabilities())
+	rcManager.SetTerminalConfig(remotecontrol.TerminalConfig{
+		User:          config.TerminalUser,
+		Shell:         config.TerminalShell,
+		TranscriptDir: config.TranscriptDir,
+	})
+	rcManager.SetFileTransferConfig(remotecontrol.FileTransferConfig{
+		Roots:           filepath.SplitList(config.FileRoots),
+		MaxUploadSize:   config.FileMaxUpload << 20,
+		MaxDownloadSize: config.FileMaxDownload << 20,
+	})
+	rcManager.SetVirtualDisplayConfig(remotecontrol.VirtualDisplayConfig{
+		Enabled:       config.VirtualDisplays,
+		Users:         splitList(config.DisplayUsers),
+		Server:        config.DisplayServer,
+		WindowManager: config.WindowManager,
+	})
+	if config.VirtualDisplays && config.DisplayUsers == "" {
+		log.Printf("[RemoteControl] Virtual displays stay off: no -virtual-display-users given")
+	}
+	synthetic, err := syntheticCaptureConfig(config)
+	if err == nil {
+		err = rcManager.SetSyntheticCapture(synthetic)
+	}
+	if err == nil && useConsoleCapture(config) {
+		err = rcManager.SetConsoleCapture(true)
+	}
+	if err != nil {
+		log.Fatalf("Invalid capture configuration: %v", err)
+	}
+	if synthetic != nil {
+		log.Printf("[RemoteControl] Capturing synthetic %s frames instead of the screen", synthetic.Pattern)
+	}
+	if rcManager.GetCapabilities().CaptureMode == "console" {
+		log.Printf("[RemoteControl] Capturing the text console instead of the screen")
+	}
+	if config.AccessPINHash != "" {
+		if err := rcManager.SetAccessPIN(remotecontrol.AccessPINConfig{
+			Hash:        config.AccessPINHash,
+			MaxAttempts: config.PINAttempts,
+			Lockout:     time.Duration(config.PINLockout) * time.Minute,
+			StateFile:   filepath.Join(filepath.Dir(config.CredentialFile), accessPINStateFile),
+		}); err != nil {
+			log.Fatalf("Invalid access PIN in %s: %v", config.CredentialFile, err)
+		}
+		log.Printf("[RemoteControl] Sessions require the unattended-access PIN")
+	}
+	// Power actions report what became of a reboot once the agent is back
+	if config.PowerActions {
+		power, err := powerConfig(config)
+		if err == nil {
+			err = rcManager.SetPowerConfig(power)
+		}
+		if err != nil {
+			log.Printf("[Power] Power actions disabled: %v", err)
+		}
+	}
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// The built-in VNC server is opt-in and bound to a single interface; VNC
+	// clients cannot enter the access PIN, so it stays off while one is set
+	if config.RFBInterface != "" && config.AccessPINHash != "" {
+		log.Printf("[RemoteControl] Not starting the VNC server: sessions require the unattended-access PIN, which VNC clients cannot enter")
+	} else if config.RFBInterface != "" {
+		if err := rcManager.StartRFBServer(ctx, remotecontrol.RFBConfig{
+			Interface: config.RFBInterface,
+			Port:      config.RFBPort,
+			Monitor:   config.RFBMonitor,
+		}); err != nil {
+			log.Fatalf("Failed to start VNC server: %v", err)
+		}
+	}
+	// Operator chat reaches the user through a tray helper on this endpoint
+	if config.ChatListen != "" {
+		if err := rcManager.StartChatServer(ctx, remotecontrol.ChatConfig{
+			Listen: config.ChatListen,
+			User:   config.ChatUser,
+			Group:  config.ChatGroup,
+		}); err != nil {
+			log.Fatalf("Failed to start chat endpoint: %v", err)
+		}
+	}
+	log.Printf("[RemoteControl] Manager initialized with capabilities: %+v", rcManager.GetCapabilities())
+
 	// Handle interrupt signals
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -445,6 +661,80 @@ func collectNetworkInfo() NetworkInfo {
 	return netInfo
 }
 
+// syntheticCaptureConfig builds the synthetic source from the capture flags (nil captures the screen)
+func syntheticCaptureConfig(config Config) (*remotecontrol.SyntheticConfig, error) {
+	switch config.CaptureSource {
+	case "", "screen", "console":
+		return nil, nil
+	case "synthetic":
+	default:
+		return nil, fmt.Errorf("unknown capture source %q (use screen, console or synthetic)", config.CaptureSource)
+	}
+
+	synthetic := &remotecontrol.SyntheticConfig{
+		Pattern:  config.Pattern,
+		Monitors: config.PatternMonitors,
+		Counter:  config.FrameCounter,
+		Replay:   config.ReplayDir,
+	}
+	if config.PatternSize != "" {
+		width, height, err := remotecontrol.ParseSyntheticSize(config.PatternSize)
+		if err != nil {
+			return nil, err
+		}
+		synthetic.Width, synthetic.Height = width, height
+	}
+	return synthetic, nil
+}
+
+// useConsoleCapture reports whether sessions should stream the text console: when
+// asked to, or on a Linux server with no graphical display but a readable console
+func useConsoleCapture(config Config) bool {
+	switch config.CaptureSource {
+	case "console":
+		return true
+	case "", "screen":
+	default:
+		return false
+	}
+
+	if runtime.GOOS != "linux" || os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != "" {
+		return false
+	}
+	for _, pattern := range []string{"/tmp/.X11-unix/X*", "/run/user/*/wayland-*"} {
+		if sockets, _ := filepath.Glob(pattern); len(sockets) > 0 {
+			return false
+		}
+	}
+	if remotecontrol.ConsoleAvailable() != nil {
+		return false
+	}
+	log.Printf("[RemoteControl] No graphical display found; falling back to console capture")
+	return true
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// flagWasSet reports whether a flag was given on the command line
+func flagWasSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
 // enrollAgent enrolls the agent with the server using an enrollment token
 func enrollAgent(config *Config, enrollmentToken string) error {
 	hostname, _ := os.Hostname()
@@ -523,6 +813,7 @@ func loadCredential(config *Config) error {
 		AgentID       string `json:"agentId"`
 		AssetID       string `json:"assetId"`
 		CredentialKey string `json:"credentialKey"`
+		AccessPINHash string `json:"accessPinHash,omitempty"`
 	}
 
 	if err := json.Unmarshal(data, &cred); err != nil {
@@ -532,6 +823,7 @@ func loadCredential(config *Config) error {
 	config.AgentID = cred.AgentID
 	config.AssetID = cred.AssetID
 	config.CredentialKey = cred.CredentialKey
+	config.AccessPINHash = cred.AccessPINHash
 
 	return nil
 }
@@ -542,10 +834,12 @@ func saveCredential(config *Config) error {
 		AgentID       string `json:"agentId"`
 		AssetID       string `json:"assetId"`
 		CredentialKey string `json:"credentialKey"`
+		AccessPINHash string `json:"accessPinHash,omitempty"`
 	}{
 		AgentID:       config.AgentID,
 		AssetID:       config.AssetID,
 		CredentialKey: config.CredentialKey,
+		AccessPINHash: config.AccessPINHash,
 	}
 
 	data, err := json.MarshalIndent(cred, "", "  ")
@@ -563,6 +857,45 @@ func saveCredential(config *Config) error {
 	return ioutil.WriteFile(config.CredentialFile, data, 0600)
 }
 
+// accessPINStateFile keeps access PIN failures and lockouts across restarts, next
+// to the credential
+const accessPINStateFile = "access-pin-state.json"
+
+// storeAccessPIN reads the unattended-access PIN from stdin and stores its hash in
+// the credential file (an empty line removes the PIN)
+func storeAccessPIN(config *Config) error {
+	if err := loadCredential(config); err != nil {
+		return fmt.Errorf("enroll the agent first: %w", err)
+	}
+
+	fmt.Fprint(os.Stderr, "Access PIN (empty to remove): ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" && err != io.EOF {
+		return fmt.Errorf("failed to read the PIN: %w", err)
+	}
+	pin := strings.TrimRight(line, "\r\n")
+
+	if pin == "" {
+		config.AccessPINHash = ""
+	} else {
+		hash, err := remotecontrol.HashAccessPIN(pin)
+		if err != nil {
+			return err
+		}
+		config.AccessPINHash = hash
+	}
+	if err := saveCredential(config); err != nil {
+		return fmt.Errorf("failed to save %s: %w", config.CredentialFile, err)
+	}
+
+	if pin == "" {
+		fmt.Println("Access PIN removed; restart the agent to apply")
+	} else {
+		fmt.Println("Access PIN set; restart the agent to apply")
+	}
+	return nil
+}
+
 // collectAndSend collects performance data and sends it to the server
 func collectAndSend(config Config) {
 	snapshot := collectPerformanceData(config)
@@ -603,6 +936,15 @@ func checkForRemoteControlSession(config Config) {
 	var result struct {
 		Success bool        `json:"success"`
 		Session SessionInfo `json:"session,omitempty"`
+
+		// One-time password for the built-in VNC server, issued independently of sessions
+		RFB *remotecontrol.RFBPassword `json:"rfb,omitempty"`
+
+		// One-off screenshot for a ticket, taken without a session
+		Screenshot *remotecontrol.ScreenshotRequest `json:"screenshot,omitempty"`
+
+		// Reboot, shutdown, logoff or lock (or cancelling one), independent of sessions
+		Power *remotecontrol.PowerRequest `json:"power,omitempty"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
@@ -610,6 +952,25 @@ func checkForRemoteControlSession(config Config) {
 		return
 	}
 
+	if result.RFB != nil {
+		if err := rcManager.AddRFBPassword(*result.RFB); err != nil {
+			log.Printf("[RemoteControl] Ignoring VNC password: %v", err)
+		}
+	}
+
+	if result.Screenshot != nil {
+		go handleScreenshotRequest(config, *result.Screenshot)
+	}
+
+	if result.Power != nil {
+		if err := rcManager.HandlePowerRequest(*result.Power); err != nil {
+			log.Printf("[Power] Ignoring power request %s: %v", result.Power.RequestID, err)
+		}
+	}
+	// Reports the server did not take yet (e.g. sent while the network came up)
+	go rcManager.FlushPowerReports()
+	go rcManager.RetryTranscriptUploads(config.CredentialKey)
+
 	if result.Success && result.Session.SessionID != "" {
 		// Check if we already have an active session
 		if activeSession := rcManager.GetActiveSession(); activeSession != nil {
@@ -624,6 +985,24 @@ func checkForRemoteControlSession(config Config) {
 			rcManager.StopSession(activeSession.SessionID)
 		}
 
+		// Build per-session options from the server response
+		scalingMode, err := remotecontrol.ParseScalingMode(result.Session.ScalingMode)
+		if err != nil {
+			log.Printf("[RemoteControl] Ignoring session scaling mode: %v", err)
+			scalingMode = remotecontrol.ScalingAuto
+		}
+		opts := remotecontrol.SessionOptions{
+			ScalingMode:      scalingMode,
+			PerMonitorTracks: result.Session.PerMonitorTracks,
+			Redaction:        result.Session.Redaction,
+			Watermark:        result.Session.Watermark,
+			Permissions:      result.Session.Permissions,
+			PortForward:      result.Session.PortForward,
+			ICEServers:       result.Session.ICEServers,
+			VirtualDisplay:   result.Session.VirtualDisplay,
+			GraphicalSession: result.Session.GraphicalSession,
+		}
+
 		// Start new remote control session
 		log.Printf("[RemoteControl] Starting session: %s", result.Session.SessionID)
 		if err := rcManager.StartSession(
@@ -631,6 +1010,7 @@ func checkForRemoteControlSession(config Config) {
 			result.Session.Token,
 			result.Session.AssetID,
 			result.Session.OrgID,
+			opts,
 		); err != nil {
 			log.Printf("[RemoteControl] Failed to start session: %v", err)
 		}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+
+	"deskwise-agent/remotecontrol"
+)
+
+// powerStateFile keeps power actions across reboots, next to the credential
+const powerStateFile = "power-actions.json"
+
+// powerConfig enables power actions, reporting to the server
+func powerConfig(config Config) (remotecontrol.PowerConfig, error) {
+	boot, err := host.BootTime()
+	if err != nil {
+		return remotecontrol.PowerConfig{}, fmt.Errorf("failed to read boot time: %w", err)
+	}
+	return remotecontrol.PowerConfig{
+		StateFile: filepath.Join(filepath.Dir(config.CredentialFile), powerStateFile),
+		BootTime:  time.Unix(int64(boot), 0),
+		Report: func(report remotecontrol.PowerReport) error {
+			return reportPowerAction(config, report)
+		},
+	}, nil
+}
+
+// reportPowerAction posts one step of a power action, with its request ID
+func reportPowerAction(config Config, report remotecontrol.PowerReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/agent/rc/power", config.ServerURL)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Use credential key for authentication
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", config.CredentialKey))
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(data))
+	}
+	return nil
+}
@@ -0,0 +1,389 @@
+package remotecontrol
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Unattended-access PIN.
+//
+// A PIN or passphrase set at install time is a second factor on top of the session
+// token: the agent keeps only its argon2id hash, and until the operator supplies
+// the PIN nothing is streamed (no frames, cursor or console), input and other
+// control messages are refused and viewer-opened channels are rejected. When the
+// control channel opens the agent asks for it:
+//
+//	{"type":"pin-required","attemptsLeft":5}
+//	{"type":"pin","pin":"2468"}                                       (viewer)
+//	{"type":"pin","status":"accepted"}
+//	{"type":"pin","status":"rejected","attemptsLeft":4}
+//	{"type":"pin","status":"rejected","lockedUntil":"2024-01-01T12:15:00Z"}  (last attempt)
+//	{"type":"pin","status":"locked","lockedUntil":"2024-01-01T12:15:00Z"}
+//
+// After MaxAttempts wrong PINs in a row further attempts are refused for Lockout,
+// doubling with every lockout until a PIN is accepted. The failure count and the
+// lockout are kept across sessions and, in the state file, across agent restarts,
+// so restarting the agent (or rebooting the machine) buys no extra guesses. Every failure and lockout is
+// reported to the server as an "access-pin" signal, and lockouts are shown to the
+// end user.
+//
+// VNC clients of the built-in RFB server have no way to send the PIN, so the RFB
+// server and the PIN are mutually exclusive. Nor can one-off screenshots requested
+// through rc/poll carry it, so they are refused while a PIN is set.
+
+const (
+	defaultAccessPINAttempts = 5
+	defaultAccessPINLockout  = 15 * time.Minute
+	maxAccessPINLockout      = 24 * time.Hour
+	minAccessPINLength       = 4
+)
+
+// argon2id parameters for new hashes (RFC 9106, second recommended option)
+const (
+	accessPINTime    = 3
+	accessPINMemory  = 64 * 1024 // KiB
+	accessPINThreads = 4
+	accessPINSaltLen = 16
+	accessPINKeyLen  = 32
+)
+
+// errAccessPINRequired is returned for operator messages sent before the PIN was accepted
+var errAccessPINRequired = errors.New("the access PIN has not been entered")
+
+// errRFBWithAccessPIN refuses the RFB server, whose clients cannot enter the PIN
+var errRFBWithAccessPIN = errors.New("the VNC server is unavailable while an access PIN is set")
+
+// errScreenshotWithAccessPIN refuses rc/poll screenshots, which are taken without the PIN
+var errScreenshotWithAccessPIN = errors.New("screenshots are unavailable while an access PIN is set")
+
+// AccessPINConfig enables the unattended-access PIN
+type AccessPINConfig struct {
+	Hash        string        // argon2id hash from HashAccessPIN
+	MaxAttempts int           // Wrong PINs before a lockout (0 = 5)
+	Lockout     time.Duration // First lockout; doubles on each further lockout (0 = 15 minutes)
+	StateFile   string        // Keeps failures and lockouts across restarts (empty = memory only)
+}
+
+// HashAccessPIN hashes a PIN for the agent configuration, in the PHC string format
+// ($argon2id$v=19$m=...,t=...,p=...$salt$key)
+func HashAccessPIN(pin string) (string, error) {
+	if len([]rune(pin)) < minAccessPINLength {
+		return "", fmt.Errorf("the access PIN must be at least %d characters", minAccessPINLength)
+	}
+	salt := make([]byte, accessPINSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(pin), salt, accessPINTime, accessPINMemory, accessPINThreads, accessPINKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		accessPINMemory, accessPINTime, accessPINThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// accessPINHash is a parsed argon2id hash
+type accessPINHash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func parseAccessPINHash(encoded string) (*accessPINHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return nil, fmt.Errorf("access PIN hash is not an argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	hash := &accessPINHash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.memory, &hash.time, &hash.threads); err != nil {
+		return nil, fmt.Errorf("invalid argon2 parameters %q: %w", parts[3], err)
+	}
+	if hash.time == 0 || hash.threads == 0 || hash.memory < 8*uint32(hash.threads) || hash.memory > 4*1024*1024 {
+		return nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+	var err error
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid access PIN salt: %w", err)
+	}
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(hash.key) == 0 {
+		return nil, fmt.Errorf("invalid access PIN hash")
+	}
+	return hash, nil
+}
+
+func (h *accessPINHash) matches(pin string) bool {
+	key := argon2.IDKey([]byte(pin), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// accessPINResult is the agent's answer to a PIN attempt
+type accessPINResult struct {
+	Type         string `json:"type"`             // "pin"
+	Status       string `json:"status,omitempty"` // accepted, rejected or locked
+	AttemptsLeft int    `json:"attemptsLeft,omitempty"`
+	LockedUntil  string `json:"lockedUntil,omitempty"`
+}
+
+// accessPINGuard checks PIN attempts and enforces the lockout; it is shared by all
+// sessions of the agent
+type accessPINGuard struct {
+	hash        *accessPINHash
+	maxAttempts int
+	lockout     time.Duration
+	stateFile   string
+
+	mu          sync.Mutex // Held while hashing, so attempts cannot run in parallel
+	failures    int        // Wrong PINs since the last lockout or success
+	lockouts    int        // Lockouts since the last success
+	lockedUntil time.Time
+}
+
+// accessPINState is what the state file keeps
+type accessPINState struct {
+	Failures    int       `json:"failures"`
+	Lockouts    int       `json:"lockouts"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+func newAccessPINGuard(config AccessPINConfig) (*accessPINGuard, error) {
+	hash, err := parseAccessPINHash(config.Hash)
+	if err != nil {
+		return nil, err
+	}
+	guard := &accessPINGuard{hash: hash, maxAttempts: config.MaxAttempts, lockout: config.Lockout, stateFile: config.StateFile}
+	if guard.maxAttempts <= 0 {
+		guard.maxAttempts = defaultAccessPINAttempts
+	}
+	if guard.lockout <= 0 {
+		guard.lockout = defaultAccessPINLockout
+	}
+	if err := guard.load(); err != nil {
+		return nil, err
+	}
+	return guard, nil
+}
+
+// load restores the failures and lockout of an earlier run; a state file that
+// cannot be parsed starts a lockout rather than handing out fresh attempts
+func (g *accessPINGuard) load() error {
+	if g.stateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(g.stateFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to read access PIN state: %w", err)
+	}
+
+	var state accessPINState
+	if err := json.Unmarshal(data, &state); err != nil || state.Failures < 0 || state.Lockouts < 0 {
+		log.Printf("[AccessPIN] Unreadable state file %s, locking remote access", g.stateFile)
+		g.lockouts = 1
+		g.lockedUntil = time.Now().Add(g.lockout)
+		return nil
+	}
+	g.failures, g.lockouts, g.lockedUntil = state.Failures, state.Lockouts, state.LockedUntil
+	if g.failures >= g.maxAttempts {
+		// MaxAttempts was lowered since; the next wrong PIN locks
+		g.failures = g.maxAttempts - 1
+	}
+	return nil
+}
+
+// saveLocked writes the state file; g.mu must be held
+func (g *accessPINGuard) saveLocked() {
+	if g.stateFile == "" {
+		return
+	}
+	data, err := json.Marshal(accessPINState{Failures: g.failures, Lockouts: g.lockouts, LockedUntil: g.lockedUntil})
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(g.stateFile), 0755)
+	}
+	// Write and rename, so a crash never leaves half a file
+	tmp := g.stateFile + ".tmp"
+	if err == nil {
+		err = os.WriteFile(tmp, data, 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp, g.stateFile)
+	}
+	if err != nil {
+		log.Printf("[AccessPIN] Failed to save access PIN state: %v", err)
+	}
+}
+
+// state reports how many attempts are left, or the lockout in force
+func (g *accessPINGuard) state() accessPINResult {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stateLocked("")
+}
+
+func (g *accessPINGuard) stateLocked(status string) accessPINResult {
+	result := accessPINResult{Type: "pin", Status: status}
+	if time.Now().Before(g.lockedUntil) {
+		result.Status = "locked"
+		result.LockedUntil = g.lockedUntil.UTC().Format(time.RFC3339)
+		return result
+	}
+	result.AttemptsLeft = g.maxAttempts - g.failures
+	return result
+}
+
+// verify checks one attempt; a lockout refuses attempts without looking at them
+func (g *accessPINGuard) verify(pin string) accessPINResult {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if time.Now().Before(g.lockedUntil) {
+		return g.stateLocked("locked")
+	}
+	if g.hash.matches(pin) {
+		g.failures, g.lockouts = 0, 0
+		g.saveLocked()
+		return accessPINResult{Type: "pin", Status: "accepted"}
+	}
+
+	g.failures++
+	defer g.saveLocked()
+	if g.failures >= g.maxAttempts {
+		lockout := g.lockout << g.lockouts
+		if lockout <= 0 || lockout > maxAccessPINLockout {
+			lockout = maxAccessPINLockout
+		}
+		g.failures = 0
+		g.lockouts++
+		g.lockedUntil = time.Now().Add(lockout)
+		return accessPINResult{Type: "pin", Status: "rejected", LockedUntil: g.lockedUntil.UTC().Format(time.RFC3339)}
+	}
+	return g.stateLocked("rejected")
+}
+
+// accessPINReport is the "access-pin" signal sent to the server for failed attempts
+type accessPINReport struct {
+	Event        string `json:"event"` // rejected or locked
+	AttemptsLeft int    `json:"attemptsLeft,omitempty"`
+	LockedUntil  string `json:"lockedUntil,omitempty"`
+	Transport    string `json:"transport"`
+	Time         string `json:"time"`
+}
+
+// SetAccessPIN requires the PIN before anything is released in this session's
+// streams (nil guard = no PIN configured)
+func (wp *WebRTCPeer) SetAccessPIN(guard *accessPINGuard) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	wp.accessPIN = guard
+}
+
+// accessGranted reports whether the operator may receive frames and send input
+func (wp *WebRTCPeer) accessGranted() bool {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+	return wp.accessPIN == nil || wp.pinAccepted
+}
+
+// requestAccessPIN asks a (re)connected viewer for the PIN; it returns false when
+// access was already granted
+func (wp *WebRTCPeer) requestAccessPIN() bool {
+	wp.mu.RLock()
+	guard, accepted := wp.accessPIN, wp.pinAccepted
+	wp.mu.RUnlock()
+	if guard == nil || accepted {
+		return false
+	}
+
+	request := guard.state()
+	request.Type = "pin-required"
+	if err := wp.sendDataChannelMessage(request); err != nil {
+		log.Printf("[WebRTCPeer] Failed to request the access PIN: %v", err)
+	}
+	return true
+}
+
+// handleAccessPIN checks the operator's PIN and releases the session when it matches
+func (wp *WebRTCPeer) handleAccessPIN(message map[string]interface{}) error {
+	wp.mu.RLock()
+	guard, accepted := wp.accessPIN, wp.pinAccepted
+	wp.mu.RUnlock()
+	if guard == nil || accepted {
+		return wp.sendDataChannelMessage(accessPINResult{Type: "pin", Status: "accepted"})
+	}
+
+	pin, _ := message["pin"].(string)
+	result := guard.verify(pin)
+	if err := wp.sendDataChannelMessage(result); err != nil {
+		log.Printf("[WebRTCPeer] Failed to send access PIN result: %v", err)
+	}
+
+	if result.Status != "accepted" {
+		wp.reportAccessPINFailure(result)
+		return fmt.Errorf("access PIN %s", result.Status)
+	}
+
+	log.Println("[WebRTCPeer] Access PIN accepted")
+	wp.mu.Lock()
+	wp.pinAccepted = true
+	connected := wp.connected
+	wp.mu.Unlock()
+
+	// What a viewer normally gets when the channel opens
+	if err := wp.sendMonitorsMessage(); err != nil {
+		log.Printf("[WebRTCPeer] Failed to send monitors message: %v", err)
+	}
+	wp.sendGraphicalSessions()
+	wp.sendPauseState()
+	if connected {
+		wp.startStreaming()
+	}
+	return nil
+}
+
+// reportAccessPINFailure tells the server (and, for a lockout, the end user) about
+// a wrong PIN
+func (wp *WebRTCPeer) reportAccessPINFailure(result accessPINResult) {
+	event := "rejected"
+	if result.LockedUntil != "" {
+		event = "locked"
+	}
+	log.Printf("[WebRTCPeer] Access PIN %s (attempts left: %d, locked until: %q)", event, result.AttemptsLeft, result.LockedUntil)
+
+	if wp.signalClient != nil {
+		report := accessPINReport{
+			Event:        event,
+			AttemptsLeft: result.AttemptsLeft,
+			LockedUntil:  result.LockedUntil,
+			Transport:    wp.Transport(),
+			Time:         time.Now().UTC().Format(time.RFC3339),
+		}
+		if err := wp.signalClient.SendSignal("access-pin", report); err != nil {
+			log.Printf("[WebRTCPeer] Failed to report access PIN failure: %v", err)
+		}
+	}
+	// The attempt that started the lockout
+	if event == "locked" && result.Status == "rejected" {
+		message := "Remote access was locked after repeated wrong PINs."
+		if err := NotifyUser("Deskwise", message); err != nil {
+			log.Printf("[WebRTCPeer] %v", err)
+		}
+	}
+}
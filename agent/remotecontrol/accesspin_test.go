@@ -0,0 +1,265 @@
+package remotecontrol
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// cheapAccessPINHash hashes a PIN with minimal argon2 parameters so guard tests stay fast
+func cheapAccessPINHash(pin string) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(pin), salt, 1, 8, 1, accessPINKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=8,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestHashAccessPIN(t *testing.T) {
+	if _, err := HashAccessPIN("123"); err == nil {
+		t.Error("3-digit PIN accepted")
+	}
+
+	encoded, err := HashAccessPIN("2468")
+	if err != nil {
+		t.Fatalf("HashAccessPIN: %v", err)
+	}
+	hash, err := parseAccessPINHash(encoded)
+	if err != nil {
+		t.Fatalf("parseAccessPINHash(%q): %v", encoded, err)
+	}
+	if !hash.matches("2468") {
+		t.Error("hash does not match its PIN")
+	}
+	if hash.matches("2469") {
+		t.Error("hash matches a wrong PIN")
+	}
+}
+
+func TestParseAccessPINHashRejectsMalformed(t *testing.T) {
+	valid := cheapAccessPINHash("2468")
+	if _, err := parseAccessPINHash(valid); err != nil {
+		t.Fatalf("valid hash refused: %v", err)
+	}
+
+	cases := []string{
+		"",
+		"2468",
+		"$argon2i$v=19$m=8,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=16$m=8,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=8,t=0,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=4,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=99999999,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=8,t=1,p=1$c2FsdA$",
+		"$argon2id$v=19$m=8,t=1,p=1$!!$a2V5",
+	}
+	for _, encoded := range cases {
+		if _, err := parseAccessPINHash(encoded); err == nil {
+			t.Errorf("parseAccessPINHash(%q) accepted a malformed hash", encoded)
+		}
+	}
+}
+
+func TestAccessPINGuardLockout(t *testing.T) {
+	guard, err := newAccessPINGuard(AccessPINConfig{Hash: cheapAccessPINHash("2468"), MaxAttempts: 3, Lockout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state := guard.state(); state.AttemptsLeft != 3 || state.Status != "" {
+		t.Fatalf("initial state = %+v, want 3 attempts", state)
+	}
+	for _, want := range []int{2, 1} {
+		if result := guard.verify("0000"); result.Status != "rejected" || result.AttemptsLeft != want {
+			t.Fatalf("wrong PIN = %+v, want rejected with %d left", result, want)
+		}
+	}
+
+	// The attempt that triggers the lockout says so
+	result := guard.verify("0000")
+	if result.Status != "rejected" || result.LockedUntil == "" {
+		t.Fatalf("last attempt = %+v, want rejected with lockedUntil", result)
+	}
+	if result := guard.verify("2468"); result.Status != "locked" {
+		t.Fatalf("correct PIN during the lockout = %+v, want locked", result)
+	}
+
+	// Each further lockout doubles, up to the cap
+	lockouts := []time.Duration{2 * time.Minute, 4 * time.Minute}
+	for _, want := range lockouts {
+		guard.lockedUntil = time.Now().Add(-time.Second)
+		for i := 0; i < 3; i++ {
+			guard.verify("0000")
+		}
+		if got := time.Until(guard.lockedUntil); got < want-time.Second || got > want {
+			t.Errorf("lockout = %v, want %v", got.Round(time.Second), want)
+		}
+	}
+	guard.lockouts = 20
+	guard.lockedUntil = time.Now().Add(-time.Second)
+	for i := 0; i < 3; i++ {
+		guard.verify("0000")
+	}
+	if got := time.Until(guard.lockedUntil); got > maxAccessPINLockout {
+		t.Errorf("lockout = %v, want at most %v", got, maxAccessPINLockout)
+	}
+
+	// The right PIN resets the failures and the doubling
+	guard.lockedUntil = time.Now().Add(-time.Second)
+	if result := guard.verify("2468"); result.Status != "accepted" {
+		t.Fatalf("correct PIN = %+v, want accepted", result)
+	}
+	if guard.failures != 0 || guard.lockouts != 0 {
+		t.Errorf("after success failures=%d lockouts=%d, want 0", guard.failures, guard.lockouts)
+	}
+}
+
+func TestAccessPINGatesSession(t *testing.T) {
+	guard, err := newAccessPINGuard(AccessPINConfig{Hash: cheapAccessPINHash("2468")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wp := NewWebRTCPeer(NewScreenCapture(), nil)
+	if !wp.accessGranted() {
+		t.Fatal("session without a PIN is not released")
+	}
+	wp.SetAccessPIN(guard)
+	if wp.accessGranted() {
+		t.Fatal("session released before the PIN was entered")
+	}
+	if err := wp.handleAccessPIN(map[string]interface{}{"pin": "1357"}); err == nil {
+		t.Error("wrong PIN accepted")
+	}
+	if wp.accessGranted() {
+		t.Fatal("session released after a wrong PIN")
+	}
+	wp.handleAccessPIN(map[string]interface{}{"pin": "2468"})
+	if !wp.accessGranted() {
+		t.Error("session not released after the right PIN")
+	}
+}
+
+func TestAccessPINExcludesRFBServer(t *testing.T) {
+	config := AccessPINConfig{Hash: cheapAccessPINHash("2468")}
+
+	m := NewManager("http://127.0.0.1:9", "linux", "test")
+	if err := m.SetAccessPIN(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.StartRFBServer(context.Background(), RFBConfig{Interface: "127.0.0.1"}); !errors.Is(err, errRFBWithAccessPIN) {
+		t.Errorf("StartRFBServer with a PIN = %v, want %v", err, errRFBWithAccessPIN)
+	}
+	if err := m.AddRFBPassword(RFBPassword{Password: "k3y5ecr7"}); !errors.Is(err, errRFBWithAccessPIN) {
+		t.Errorf("AddRFBPassword with a PIN = %v, want %v", err, errRFBWithAccessPIN)
+	}
+	if m.GetCapabilities().RFB {
+		t.Error("RFB capability advertised with a PIN")
+	}
+
+	// And the other way round: no PIN while VNC clients may log in
+	m = NewManager("http://127.0.0.1:9", "linux", "test")
+	m.rfb = NewRFBServer(RFBConfig{}, nil)
+	if err := m.SetAccessPIN(config); !errors.Is(err, errRFBWithAccessPIN) {
+		t.Errorf("SetAccessPIN with the RFB server running = %v, want %v", err, errRFBWithAccessPIN)
+	}
+}
+
+func TestAccessPINRefusesScreenshots(t *testing.T) {
+	m := NewManager("http://127.0.0.1:9", "linux", "test")
+	if err := m.SetSyntheticCapture(&SyntheticConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if !m.GetCapabilities().Screenshot {
+		t.Fatal("Screenshot capability missing with a synthetic source")
+	}
+	if err := m.SetAccessPIN(AccessPINConfig{Hash: cheapAccessPINHash("2468")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if shot, err := m.TakeScreenshot(ScreenshotRequest{RequestID: "s1"}); !errors.Is(err, errScreenshotWithAccessPIN) || shot != nil {
+		t.Errorf("TakeScreenshot with a PIN = %v, %v, want %v", shot, err, errScreenshotWithAccessPIN)
+	}
+	if m.GetCapabilities().Screenshot {
+		t.Error("Screenshot capability advertised with a PIN")
+	}
+	// Changing the capture source does not bring it back
+	if err := m.SetSyntheticCapture(nil); err != nil {
+		t.Fatal(err)
+	}
+	if m.GetCapabilities().Screenshot {
+		t.Error("Screenshot capability advertised with a PIN after the capture source changed")
+	}
+}
+
+func TestAccessPINLockoutSurvivesRestart(t *testing.T) {
+	config := AccessPINConfig{
+		Hash:        cheapAccessPINHash("2468"),
+		MaxAttempts: 3,
+		Lockout:     time.Minute,
+		StateFile:   filepath.Join(t.TempDir(), "access-pin-state.json"),
+	}
+	guard, err := newAccessPINGuard(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard.verify("0000")
+	guard.verify("0000")
+
+	// A restart keeps the failures, not a fresh set of attempts
+	guard, err = newAccessPINGuard(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := guard.state(); state.AttemptsLeft != 1 {
+		t.Fatalf("after restart state = %+v, want 1 attempt left", state)
+	}
+	if result := guard.verify("0000"); result.LockedUntil == "" {
+		t.Fatalf("third wrong PIN = %+v, want a lockout", result)
+	}
+
+	// And the lockout with its doubling
+	guard, err = newAccessPINGuard(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := guard.verify("2468"); result.Status != "locked" {
+		t.Fatalf("correct PIN after restart during the lockout = %+v, want locked", result)
+	}
+	if guard.lockouts != 1 {
+		t.Errorf("lockouts after restart = %d, want 1", guard.lockouts)
+	}
+
+	// Success clears the saved state
+	guard.lockedUntil = time.Now().Add(-time.Second)
+	if result := guard.verify("2468"); result.Status != "accepted" {
+		t.Fatalf("correct PIN = %+v, want accepted", result)
+	}
+	guard, err = newAccessPINGuard(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := guard.state(); state.AttemptsLeft != 3 || guard.lockouts != 0 {
+		t.Errorf("after success and restart state = %+v lockouts=%d, want 3 attempts", state, guard.lockouts)
+	}
+}
+
+func TestAccessPINCorruptStateLocks(t *testing.T) {
+	config := AccessPINConfig{Hash: cheapAccessPINHash("2468"), StateFile: filepath.Join(t.TempDir(), "access-pin-state.json")}
+	if err := os.WriteFile(config.StateFile, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	guard, err := newAccessPINGuard(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := guard.verify("2468"); result.Status != "locked" {
+		t.Errorf("correct PIN with a corrupt state file = %+v, want locked", result)
+	}
+}
@@ -0,0 +1,623 @@
+package remotecontrol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Chat between the operator and the end user.
+//
+// The operator sends {"type":"chat","text":"...","name":"Alice"} on the control
+// channel. The agent stamps it and passes it to the local tray or notification
+// helper, or shows a desktop notification when no helper is connected, and answers
+// with {"type":"chat-delivery","id":"1","via":"helper|notification|none"}.
+//
+// Helpers talk HTTP to the chat endpoint (a Unix socket or a loopback port):
+//
+//	GET  /v1/chat/events    newline-delimited JSON: chat-session events and chat messages
+//	POST /v1/chat/messages  {"text":"...","name":"Bob"} sends the user's reply to the operator
+//
+// The same endpoint carries the end user's pause control (see pause.go).
+//
+// Only local helpers may use it: requests from a browser (with an Origin header)
+// and, on a loopback port, requests for a Host that is not loopback (DNS
+// rebinding) are refused. A Unix socket is only open to the agent's account and
+// the configured desktop user or group.
+//
+// Every message is kept in the session's chat transcript, uploaded when the session ends.
+
+// ChatConfig is the agent-side configuration for the end-user chat helper endpoint
+type ChatConfig struct {
+	Listen string // "unix:/path/to/socket" or a loopback host:port
+	User   string // Account the Unix socket is handed to (empty = the agent's)
+	Group  string // Group that may also use the Unix socket (empty = none)
+}
+
+const (
+	// chatMaxText limits one chat message, in bytes
+	chatMaxText = 4096
+
+	// chatHelperBuffer is how many messages a slow helper may fall behind before losing some
+	chatHelperBuffer = 64
+)
+
+// chatMessage is one chat line, sent to the operator, the helper and the transcript
+type chatMessage struct {
+	Type string    `json:"type"`
+	ID   string    `json:"id"`
+	From string    `json:"from"`           // operator or user
+	Name string    `json:"name,omitempty"` // Display name of the sender
+	Text string    `json:"text"`
+	Time time.Time `json:"time"`
+}
+
+// chatDelivery tells the operator how a message reached the user
+type chatDelivery struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	Via   string `json:"via"` // helper, notification or none
+	Error string `json:"error,omitempty"`
+}
+
+// chatSessionEvent tells helpers whether a session they can chat in is running
+type chatSessionEvent struct {
+	Type      string `json:"type"`
+	SessionID string `json:"sessionId"`
+	Active    bool   `json:"active"`
+}
+
+// chatSession relays the chat of one remote control session and records its transcript
+type chatSession struct {
+	sessionID     string
+	transcriptDir string
+	server        *ChatServer // Helper endpoint (nil = desktop notifications only)
+
+	mu         sync.Mutex
+	send       func(interface{}) error // To the operator's control channel
+	history    []chatMessage
+	nextID     int
+	transcript *os.File
+	closed     bool
+}
+
+func newChatSession(sessionID, transcriptDir string, server *ChatServer) *chatSession {
+	cs := &chatSession{sessionID: sessionID, transcriptDir: transcriptDir, server: server}
+	if server != nil {
+		server.attach(cs)
+	}
+	return cs
+}
+
+// FromOperator delivers an operator's message to the user
+func (cs *chatSession) FromOperator(name, text string) error {
+	message, err := cs.record("operator", name, text)
+	if err != nil {
+		cs.sendToOperator(chatDelivery{Type: "chat-delivery", Via: "none", Error: err.Error()})
+		return err
+	}
+
+	delivery := chatDelivery{Type: "chat-delivery", ID: message.ID, Via: "helper"}
+	if cs.server == nil || cs.server.broadcast(message) == 0 {
+		// No helper to show it in: a notification at least gets it seen, without a reply path
+		title := "Message from IT support"
+		if name != "" {
+			title = "Message from " + name
+		}
+		delivery.Via = "notification"
+		if err := NotifyUser(title, text); err != nil {
+			log.Printf("[Chat] %v", err)
+			delivery.Via, delivery.Error = "none", err.Error()
+		}
+	}
+	cs.sendToOperator(delivery)
+	return nil
+}
+
+// FromUser sends the user's message (from the helper) to the operator
+func (cs *chatSession) FromUser(name, text string) (chatMessage, error) {
+	message, err := cs.record("user", name, text)
+	if err != nil {
+		return chatMessage{}, err
+	}
+	if err := cs.sendToOperator(message); err != nil {
+		return message, fmt.Errorf("failed to reach the operator: %w", err)
+	}
+	return message, nil
+}
+
+// record stamps a message and appends it to the history and the transcript
+func (cs *chatSession) record(from, name, text string) (chatMessage, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return chatMessage{}, fmt.Errorf("empty chat message")
+	}
+	if len(text) > chatMaxText {
+		return chatMessage{}, fmt.Errorf("chat message too long (%d bytes, max %d)", len(text), chatMaxText)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.closed {
+		return chatMessage{}, fmt.Errorf("session %s has ended", cs.sessionID)
+	}
+
+	cs.nextID++
+	message := chatMessage{
+		Type: "chat",
+		ID:   strconv.Itoa(cs.nextID),
+		From: from,
+		Name: name,
+		Text: text,
+		Time: time.Now().UTC(),
+	}
+	cs.history = append(cs.history, message)
+
+	if cs.transcript == nil {
+		file, err := createTranscriptFile(cs.transcriptDir, cs.sessionID+"-chat.jsonl")
+		if err != nil {
+			log.Printf("[Chat] %v", err)
+		}
+		cs.transcript = file
+	}
+	if cs.transcript != nil {
+		if err := json.NewEncoder(cs.transcript).Encode(message); err != nil {
+			log.Printf("[Chat] Failed to write transcript: %v", err)
+		}
+	}
+	return message, nil
+}
+
+func (cs *chatSession) sendToOperator(message interface{}) error {
+	cs.mu.Lock()
+	send := cs.send
+	cs.mu.Unlock()
+	if send == nil {
+		return fmt.Errorf("operator is not connected")
+	}
+	return send(message)
+}
+
+// History returns the messages so far
+func (cs *chatSession) History() []chatMessage {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return append([]chatMessage(nil), cs.history...)
+}
+
+// Close ends the chat, tells helpers and returns the transcript path ("" if nothing was said)
+func (cs *chatSession) Close() string {
+	cs.mu.Lock()
+	if cs.closed {
+		cs.mu.Unlock()
+		return ""
+	}
+	cs.closed = true
+	transcript := cs.transcript
+	cs.mu.Unlock()
+
+	if cs.server != nil {
+		cs.server.detach(cs)
+	}
+	if transcript == nil {
+		return ""
+	}
+	if err := transcript.Close(); err != nil {
+		log.Printf("[Chat] Error closing transcript: %v", err)
+	}
+	return transcript.Name()
+}
+
+// ChatServer is the local endpoint tray and notification helpers connect to
+type ChatServer struct {
+	config ChatConfig
+
+	mu      sync.Mutex
+	server  *http.Server
+	socket  string // Unix socket path to remove on close
+	helpers map[chan interface{}]struct{}
+	session *chatSession
+	control sessionControl // Pauses and resumes the active session (nil = not offered)
+}
+
+// sessionControl is the end user's pause control over the active session
+type sessionControl interface {
+	SessionState() SessionState
+	SetSessionPaused(paused bool) (SessionState, error)
+}
+
+// NewChatServer creates the helper endpoint; Start begins listening
+func NewChatServer(config ChatConfig) *ChatServer {
+	return &ChatServer{config: config, helpers: make(map[chan interface{}]struct{})}
+}
+
+// SetSessionControl offers pausing the active session to helpers; call before Start
+func (s *ChatServer) SetSessionControl(control sessionControl) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.control = control
+}
+
+// Start listens on the configured Unix socket or loopback address until ctx ends
+func (s *ChatServer) Start(ctx context.Context) error {
+	listener, socket, err := listenChat(s.config)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: s.handler(socket != ""), ReadHeaderTimeout: 10 * time.Second}
+
+	s.mu.Lock()
+	s.server = server
+	s.socket = socket
+	s.mu.Unlock()
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[Chat] Helper endpoint stopped: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+
+	log.Printf("[Chat] Helper endpoint listening on %s", s.config.Listen)
+	return nil
+}
+
+// handler routes the helper API, refusing requests that did not come from a local helper
+func (s *ChatServer) handler(unixSocket bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/events", s.handleEvents)
+	mux.HandleFunc("/v1/chat/messages", s.handleMessages)
+	mux.HandleFunc("/v1/session", s.handleSession)
+	mux.HandleFunc("/v1/session/pause", s.handleSession)
+	mux.HandleFunc("/v1/session/resume", s.handleSession)
+	return localHelpersOnly(mux, unixSocket)
+}
+
+// listenChat opens a Unix socket ("unix:/path") or a loopback-only TCP listener
+func listenChat(config ChatConfig) (net.Listener, string, error) {
+	address := config.Listen
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, "", fmt.Errorf("failed to create chat socket directory: %w", err)
+		}
+		os.Remove(path) // A socket left behind by a previous run
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to listen for chat helpers: %w", err)
+		}
+		if err := restrictChatSocket(path, config.User, config.Group); err != nil {
+			listener.Close()
+			return nil, "", err
+		}
+		return listener, path, nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid chat address %q: %w", address, err)
+	}
+	if !isLoopbackHost(host) {
+		return nil, "", fmt.Errorf("chat address %s is not a loopback address", address)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to listen for chat helpers: %w", err)
+	}
+	return listener, "", nil
+}
+
+// restrictChatSocket hands the socket to the desktop user (helpers run as the
+// user, not as the agent's account) and opens it to the group, if any, only
+func restrictChatSocket(path, username, group string) error {
+	uid, gid := -1, -1
+	if username != "" {
+		account, err := user.Lookup(username)
+		if err != nil {
+			return fmt.Errorf("failed to look up chat user %s: %w", username, err)
+		}
+		if uid, err = strconv.Atoi(account.Uid); err != nil {
+			return fmt.Errorf("chat user %s has no numeric uid", username)
+		}
+	}
+	if group != "" {
+		found, err := user.LookupGroup(group)
+		if err != nil {
+			return fmt.Errorf("failed to look up chat group %s: %w", group, err)
+		}
+		if gid, err = strconv.Atoi(found.Gid); err != nil {
+			return fmt.Errorf("chat group %s has no numeric gid", group)
+		}
+	}
+
+	mode := os.FileMode(0600)
+	if group != "" {
+		mode = 0660
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("failed to restrict chat socket: %w", err)
+	}
+	if uid >= 0 || gid >= 0 {
+		if err := os.Chown(path, uid, gid); err != nil {
+			return fmt.Errorf("failed to hand chat socket to %s: %w", strings.Trim(username+":"+group, ":"), err)
+		}
+	}
+	return nil
+}
+
+// isLoopbackHost reports whether host (without port) names this machine's loopback interface
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// localHelpersOnly refuses requests a web page could have made: browsers send
+// Origin on cross-origin requests, and a page that rebinds its own name to
+// 127.0.0.1 still sends its Host. Over a Unix socket the Host is not checked.
+func localHelpersOnly(next http.Handler, unixSocket bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			http.Error(w, "browser requests are not allowed", http.StatusForbidden)
+			return
+		}
+		if !unixSocket {
+			host, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				host = r.Host
+			}
+			if !isLoopbackHost(host) {
+				http.Error(w, "host not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Close stops the endpoint and disconnects helpers
+func (s *ChatServer) Close() {
+	s.mu.Lock()
+	server, socket := s.server, s.socket
+	s.server = nil
+	s.mu.Unlock()
+
+	if server == nil {
+		return
+	}
+	server.Close()
+	if socket != "" {
+		os.Remove(socket)
+	}
+	log.Println("[Chat] Helper endpoint closed")
+}
+
+// attach makes cs the session helpers chat in
+func (s *ChatServer) attach(cs *chatSession) {
+	s.mu.Lock()
+	s.session = cs
+	s.mu.Unlock()
+	s.broadcast(chatSessionEvent{Type: "chat-session", SessionID: cs.sessionID, Active: true})
+}
+
+// detach ends chatting in cs, unless another session took over
+func (s *ChatServer) detach(cs *chatSession) {
+	s.mu.Lock()
+	if s.session != cs {
+		s.mu.Unlock()
+		return
+	}
+	s.session = nil
+	s.mu.Unlock()
+	s.broadcast(chatSessionEvent{Type: "chat-session", SessionID: cs.sessionID, Active: false})
+}
+
+func (s *ChatServer) currentSession() *chatSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.session
+}
+
+// broadcast queues an event for every connected helper and returns how many got it
+func (s *ChatServer) broadcast(event interface{}) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivered := 0
+	for helper := range s.helpers {
+		select {
+		case helper <- event:
+			delivered++
+		default:
+			log.Printf("[Chat] Helper is not keeping up, dropping a message")
+		}
+	}
+	return delivered
+}
+
+// handleEvents streams the current session state, its history and new messages to a helper
+func (s *ChatServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	events := make(chan interface{}, chatHelperBuffer)
+	s.mu.Lock()
+	s.helpers[events] = struct{}{}
+	session := s.session
+	control := s.control
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.helpers, events)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", transcriptContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(w)
+	controller := http.NewResponseController(w)
+
+	// Catch the helper up: a helper started mid-session still shows the conversation
+	if session != nil {
+		encoder.Encode(chatSessionEvent{Type: "chat-session", SessionID: session.sessionID, Active: true})
+		for _, message := range session.History() {
+			encoder.Encode(message)
+		}
+	} else {
+		encoder.Encode(chatSessionEvent{Type: "chat-session", Active: false})
+	}
+	if control != nil {
+		encoder.Encode(control.SessionState())
+	}
+	if err := controller.Flush(); err != nil {
+		return
+	}
+	log.Printf("[Chat] Helper connected")
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("[Chat] Helper disconnected")
+			return
+		case event := <-events:
+			if err := encoder.Encode(event); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleMessages sends a reply typed into the helper to the operator
+func (s *ChatServer) handleMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		Text string `json:"text"`
+		Name string `json:"name"`
+	}
+	// A JSON body cannot be sent by a plain HTML form
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "chat messages must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*chatMaxText)).Decode(&request); err != nil {
+		http.Error(w, "invalid chat message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session := s.currentSession()
+	if session == nil {
+		http.Error(w, "no remote session in progress", http.StatusConflict)
+		return
+	}
+	message, err := session.FromUser(request.Name, request.Text)
+	if err != nil && message.ID == "" {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Helpers show the reply in the conversation, including on another tray
+	s.broadcast(message)
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		// Recorded in the transcript, but the operator is not connected right now
+		log.Printf("[Chat] %v", err)
+		w.WriteHeader(http.StatusAccepted)
+	}
+	json.NewEncoder(w).Encode(message)
+}
+
+// handleSession reports the active session (GET /v1/session) or pauses and resumes
+// it (POST /v1/session/pause, /v1/session/resume)
+func (s *ChatServer) handleSession(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	control := s.control
+	s.mu.Unlock()
+	if control == nil {
+		http.Error(w, "session control is not available", http.StatusNotFound)
+		return
+	}
+
+	var state SessionState
+	switch {
+	case r.URL.Path == "/v1/session" && r.Method == http.MethodGet:
+		state = control.SessionState()
+	case r.URL.Path != "/v1/session" && r.Method == http.MethodPost:
+		var err error
+		state, err = control.SetSessionPaused(r.URL.Path == "/v1/session/pause")
+		if errors.Is(err, errNoActiveSession) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// SetChat routes chat messages between the viewer and the end user (nil = chat off)
+func (wp *WebRTCPeer) SetChat(chat *chatSession) {
+	wp.mu.Lock()
+	wp.chat = chat
+	wp.mu.Unlock()
+
+	if chat != nil {
+		chat.mu.Lock()
+		chat.send = wp.sendChatMessage
+		chat.mu.Unlock()
+	}
+}
+
+// sendChatMessage sends chat to the operator; like the operator's messages, none
+// pass before the access PIN is accepted (the user's stay in the transcript)
+func (wp *WebRTCPeer) sendChatMessage(message interface{}) error {
+	if !wp.accessGranted() {
+		return errAccessPINRequired
+	}
+	return wp.sendDataChannelMessage(message)
+}
+
+// handleChatMessage passes an operator's chat message to the end user
+func (wp *WebRTCPeer) handleChatMessage(message map[string]interface{}) error {
+	wp.mu.RLock()
+	chat := wp.chat
+	wp.mu.RUnlock()
+
+	if chat == nil {
+		return fmt.Errorf("chat is not available in this session")
+	}
+	text, _ := message["text"].(string)
+	name, _ := message["name"].(string)
+	return chat.FromOperator(name, text)
+}
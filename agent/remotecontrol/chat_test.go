@@ -0,0 +1,287 @@
+package remotecontrol
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSessionControl records pause requests from helpers
+type fakeSessionControl struct {
+	mu     sync.Mutex
+	paused bool
+}
+
+func (f *fakeSessionControl) SessionState() SessionState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return SessionState{Type: "session-state", SessionID: "s1", Active: true, Paused: f.paused}
+}
+
+func (f *fakeSessionControl) SetSessionPaused(paused bool) (SessionState, error) {
+	f.mu.Lock()
+	f.paused = paused
+	f.mu.Unlock()
+	return f.SessionState(), nil
+}
+
+func chatRequest(t *testing.T, handler http.Handler, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestChatRefusesBrowserRequests(t *testing.T) {
+	server := NewChatServer(ChatConfig{})
+	server.SetSessionControl(&fakeSessionControl{})
+	tcp, unix := server.handler(false), server.handler(true)
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		target  string
+		origin  string
+		want    int
+	}{
+		{"loopback", tcp, "http://127.0.0.1:7777/v1/session", "", http.StatusOK},
+		{"loopback v6", tcp, "http://[::1]:7777/v1/session", "", http.StatusOK},
+		{"localhost", tcp, "http://localhost:7777/v1/session", "", http.StatusOK},
+		{"rebound name", tcp, "http://attacker.example:7777/v1/session", "", http.StatusForbidden},
+		{"lan address", tcp, "http://192.168.1.10:7777/v1/session", "", http.StatusForbidden},
+		{"cross origin", tcp, "http://127.0.0.1:7777/v1/session", "http://attacker.example", http.StatusForbidden},
+		{"null origin", tcp, "http://127.0.0.1:7777/v1/session", "null", http.StatusForbidden},
+		{"unix socket", unix, "http://agent/v1/session", "", http.StatusOK},
+		{"unix socket origin", unix, "http://agent/v1/session", "http://attacker.example", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			response := chatRequest(t, tt.handler, http.MethodGet, tt.target, "", header)
+			if response.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", response.Code, tt.want, strings.TrimSpace(response.Body.String()))
+			}
+		})
+	}
+}
+
+func TestChatMessageFromHelper(t *testing.T) {
+	server := NewChatServer(ChatConfig{})
+	handler := server.handler(false)
+	target := "http://127.0.0.1:7777/v1/chat/messages"
+	jsonHeader := http.Header{"Content-Type": {"application/json"}}
+
+	if response := chatRequest(t, handler, http.MethodPost, target, `{"text":"hi"}`, jsonHeader); response.Code != http.StatusConflict {
+		t.Errorf("without a session: status = %d, want %d", response.Code, http.StatusConflict)
+	}
+
+	session := newChatSession("s1", t.TempDir(), server)
+	defer session.Close()
+	var sent []interface{}
+	session.send = func(message interface{}) error {
+		sent = append(sent, message)
+		return nil
+	}
+
+	// A form post (text/plain) is what a web page can send without a preflight
+	formHeader := http.Header{"Content-Type": {"text/plain"}}
+	if response := chatRequest(t, handler, http.MethodPost, target, `{"text":"hi"}`, formHeader); response.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("text/plain: status = %d, want %d", response.Code, http.StatusUnsupportedMediaType)
+	}
+	if response := chatRequest(t, handler, http.MethodPost, target, `{"text":"   "}`, jsonHeader); response.Code != http.StatusBadRequest {
+		t.Errorf("empty text: status = %d, want %d", response.Code, http.StatusBadRequest)
+	}
+	if len(sent) != 0 {
+		t.Fatalf("refused messages reached the operator: %v", sent)
+	}
+
+	response := chatRequest(t, handler, http.MethodPost, target, `{"text":" printer is jammed ","name":"Sam"}`, jsonHeader)
+	if response.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (%s)", response.Code, http.StatusOK, response.Body.String())
+	}
+	if len(sent) != 1 {
+		t.Fatalf("operator got %d messages, want 1", len(sent))
+	}
+	message, ok := sent[0].(chatMessage)
+	if !ok || message.From != "user" || message.Name != "Sam" || message.Text != "printer is jammed" {
+		t.Errorf("operator got %+v", sent[0])
+	}
+	if history := session.History(); len(history) != 1 || history[0].ID != message.ID {
+		t.Errorf("history = %+v", history)
+	}
+
+	// The operator dropping off still records the reply
+	session.send = nil
+	if response := chatRequest(t, handler, http.MethodPost, target, `{"text":"hello?"}`, jsonHeader); response.Code != http.StatusAccepted {
+		t.Errorf("operator gone: status = %d, want %d", response.Code, http.StatusAccepted)
+	}
+}
+
+func TestChatSessionControl(t *testing.T) {
+	server := NewChatServer(ChatConfig{})
+	handler := server.handler(false)
+	if response := chatRequest(t, handler, http.MethodGet, "http://127.0.0.1/v1/session", "", nil); response.Code != http.StatusNotFound {
+		t.Errorf("without control: status = %d, want %d", response.Code, http.StatusNotFound)
+	}
+
+	control := &fakeSessionControl{}
+	server.SetSessionControl(control)
+	tests := []struct {
+		method, path string
+		want         int
+		paused       bool
+	}{
+		{http.MethodPost, "/v1/session/pause", http.StatusOK, true},
+		{http.MethodGet, "/v1/session", http.StatusOK, true},
+		{http.MethodGet, "/v1/session/resume", http.StatusMethodNotAllowed, true},
+		{http.MethodPost, "/v1/session", http.StatusMethodNotAllowed, true},
+		{http.MethodPost, "/v1/session/resume", http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		response := chatRequest(t, handler, tt.method, "http://127.0.0.1"+tt.path, "", nil)
+		if response.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, response.Code, tt.want)
+			continue
+		}
+		if control.SessionState().Paused != tt.paused {
+			t.Errorf("%s %s: paused = %v, want %v", tt.method, tt.path, !tt.paused, tt.paused)
+		}
+		if tt.want == http.StatusOK {
+			var state SessionState
+			if err := json.NewDecoder(response.Body).Decode(&state); err != nil || state.Paused != tt.paused {
+				t.Errorf("%s %s: state = %+v, %v", tt.method, tt.path, state, err)
+			}
+		}
+	}
+}
+
+func TestChatEventsCatchUp(t *testing.T) {
+	server := NewChatServer(ChatConfig{})
+	session := newChatSession("s1", t.TempDir(), server)
+	defer session.Close()
+	if _, err := session.record("operator", "Alex", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	web := httptest.NewServer(server.handler(false))
+	defer web.Close()
+	response, err := http.Get(web.URL + "/v1/chat/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	lines := bufio.NewScanner(response.Body)
+
+	var events []map[string]interface{}
+	for len(events) < 2 && lines.Scan() {
+		var event map[string]interface{}
+		if err := json.Unmarshal(lines.Bytes(), &event); err != nil {
+			t.Fatalf("bad event %q: %v", lines.Text(), err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 2 || events[0]["type"] != "chat-session" || events[0]["active"] != true ||
+		events[1]["type"] != "chat" || events[1]["text"] != "hello" {
+		t.Fatalf("catch-up events = %v", events)
+	}
+
+	// New messages follow once the helper is registered
+	deadline := time.Now().Add(2 * time.Second)
+	for server.broadcast(chatMessage{Type: "chat", Text: "live"}) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("helper never registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !lines.Scan() || !strings.Contains(lines.Text(), `"live"`) {
+		t.Errorf("live event = %q", lines.Text())
+	}
+}
+
+func TestChatUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "agent.sock")
+
+	server := NewChatServer(ChatConfig{Listen: "unix:" + socket})
+	control := &fakeSessionControl{}
+	server.SetSessionControl(control)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := server.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("socket mode = %v, want 0600", mode)
+	}
+
+	state, err := ControlSession("unix:"+socket, "pause")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Paused || !control.SessionState().Paused {
+		t.Errorf("pause over the socket: state = %+v", state)
+	}
+}
+
+func TestChatRejectsRemoteListen(t *testing.T) {
+	for _, address := range []string{"0.0.0.0:7777", "192.168.1.10:7777", "example.com:7777", "7777"} {
+		if listener, _, err := listenChat(ChatConfig{Listen: address}); err == nil {
+			listener.Close()
+			t.Errorf("listenChat(%q) succeeded", address)
+		}
+	}
+	if _, _, err := listenChat(ChatConfig{Listen: "unix:" + filepath.Join(t.TempDir(), "s"), Group: "no-such-group-deskwise"}); err == nil {
+		t.Error("unknown socket group was accepted")
+	}
+}
+
+func TestChatHeldUntilAccessPIN(t *testing.T) {
+	guard, err := newAccessPINGuard(AccessPINConfig{Hash: cheapAccessPINHash("2468")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wp := NewWebRTCPeer(NewScreenCapture(), nil)
+	wp.SetAccessPIN(guard)
+	session := newChatSession("s1", t.TempDir(), nil)
+	defer session.Close()
+	wp.SetChat(session)
+
+	message, err := session.FromUser("Alex", "is anyone there?")
+	if !errors.Is(err, errAccessPINRequired) {
+		t.Fatalf("reply before the PIN: err = %v, want %v", err, errAccessPINRequired)
+	}
+	if message.ID == "" || len(session.History()) != 1 {
+		t.Error("reply before the PIN was not kept in the transcript")
+	}
+
+	wp.handleAccessPIN(map[string]interface{}{"pin": "2468"})
+	if _, err := session.FromUser("Alex", "hello"); errors.Is(err, errAccessPINRequired) {
+		t.Errorf("reply after the PIN: %v", err)
+	}
+}
@@ -0,0 +1,336 @@
+package remotecontrol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Console capture streams a text console (the active Linux virtual console) as
+// structured data-channel messages instead of video, for headless servers:
+//
+//	{"type":"console","tty":"tty1","cols":80,"rows":25,"cursor":{"x":0,"y":3},"full":true,
+//	 "lines":[{"y":0,"text":"...","attrs":[[0,80,7]]}, ...]}
+//
+// "full" tells the viewer to clear its grid first; otherwise only changed rows are
+// sent. Attributes are VGA bytes in [start, length, attribute] runs: foreground
+// attr&15, background (attr>>4)&7, blink attr&128. The viewer asks for a full frame
+// with {"type":"console","refresh":true}; keyboard messages are typed into the TTY.
+//
+// Typing uses TIOCSTI, which needs CAP_SYS_ADMIN for a TTY that is not the agent's
+// own and which Linux 6.2+ can switch off (dev.tty.legacy_tiocsti=0). Where it is
+// refused the screen is still streamed, keystrokes are rejected and the
+// capabilities report console input as unavailable.
+
+const (
+	consolePollInterval = 100 * time.Millisecond
+
+	// consoleMessageBudget bounds the text carried by one message, so large consoles
+	// stay under data channel message limits
+	consoleMessageBudget = 16 << 10
+)
+
+// errConsoleInputUnavailable is returned by consoleDevice.Write when the kernel refuses to type into the console
+var errConsoleInputUnavailable = errors.New("console input is unavailable")
+
+// consoleDevice reads a text console and types into it
+type consoleDevice interface {
+	Read() (*consoleScreen, error)
+	Write(input []byte) error
+	Close() error
+}
+
+// consoleScreen is one snapshot of a text console
+type consoleScreen struct {
+	TTY     string
+	Cols    int
+	Rows    int
+	CursorX int
+	CursorY int
+	Lines   []consoleLine
+}
+
+// consoleLine is one row of a console: its characters and their VGA attributes
+type consoleLine struct {
+	Text  []rune
+	Attrs []byte
+}
+
+type consoleMessage struct {
+	Type   string              `json:"type"`
+	TTY    string              `json:"tty"`
+	Cols   int                 `json:"cols"`
+	Rows   int                 `json:"rows"`
+	Cursor consoleCursor       `json:"cursor"`
+	Full   bool                `json:"full"`
+	Lines  []consoleLineUpdate `json:"lines"`
+}
+
+type consoleCursor struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type consoleLineUpdate struct {
+	Y     int      `json:"y"`
+	Text  string   `json:"text"`
+	Attrs [][3]int `json:"attrs"` // [start, length, attribute] runs
+}
+
+// consoleSession streams one console to a session's viewer and types its keystrokes
+type consoleSession struct {
+	device  consoleDevice
+	refresh chan struct{}
+
+	mu        sync.Mutex
+	ctrl      bool
+	alt       bool
+	inputErr  error       // Why keystrokes are refused (nil = typed into the TTY)
+	inputLost func(error) // Called once when typing turns out to be refused
+}
+
+func newConsoleSession(device consoleDevice) *consoleSession {
+	return &consoleSession{
+		device:  device,
+		refresh: make(chan struct{}, 1),
+	}
+}
+
+// Refresh makes the next update a full frame
+func (c *consoleSession) Refresh() {
+	select {
+	case c.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// Close releases the console device
+func (c *consoleSession) Close() error {
+	return c.device.Close()
+}
+
+// stream polls the console and sends changed rows until ctx ends
+func (c *consoleSession) stream(ctx context.Context, connected func() bool, send func(message interface{}) error) {
+	ticker := time.NewTicker(consolePollInterval)
+	defer ticker.Stop()
+
+	var last *consoleScreen
+	lastErr := ""
+	for {
+		full := false
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.refresh:
+			full = true
+		case <-ticker.C:
+		}
+
+		if !connected() {
+			last = nil
+			continue
+		}
+
+		screen, err := c.device.Read()
+		if err != nil {
+			// A console that stays unreadable would log every poll
+			if err.Error() != lastErr {
+				log.Printf("[Console] Failed to read console: %v", err)
+				lastErr = err.Error()
+			}
+			continue
+		}
+		lastErr = ""
+
+		if full {
+			last = nil
+		}
+		for _, message := range consoleUpdates(last, screen) {
+			if err := send(message); err != nil {
+				log.Printf("[Console] Failed to send console update: %v", err)
+				screen = nil // Resend everything once the channel works again
+				break
+			}
+		}
+		last = screen
+	}
+}
+
+// consoleUpdates builds the messages that bring a viewer showing prev up to date
+// with screen; a nil prev (or a new size or TTY) sends every row
+func consoleUpdates(prev, screen *consoleScreen) []consoleMessage {
+	full := prev == nil || prev.TTY != screen.TTY || prev.Cols != screen.Cols || prev.Rows != screen.Rows
+
+	var changed []consoleLineUpdate
+	for y, line := range screen.Lines {
+		if !full && string(prev.Lines[y].Text) == string(line.Text) && bytes.Equal(prev.Lines[y].Attrs, line.Attrs) {
+			continue
+		}
+		changed = append(changed, consoleLineUpdate{
+			Y:     y,
+			Text:  string(line.Text),
+			Attrs: consoleAttrRuns(line.Attrs),
+		})
+	}
+
+	cursor := consoleCursor{X: screen.CursorX, Y: screen.CursorY}
+	if !full && len(changed) == 0 && prev.CursorX == cursor.X && prev.CursorY == cursor.Y {
+		return nil
+	}
+
+	var messages []consoleMessage
+	next := func() *consoleMessage {
+		messages = append(messages, consoleMessage{
+			Type:   "console",
+			TTY:    screen.TTY,
+			Cols:   screen.Cols,
+			Rows:   screen.Rows,
+			Cursor: cursor,
+			Full:   full && len(messages) == 0,
+			Lines:  []consoleLineUpdate{},
+		})
+		return &messages[len(messages)-1]
+	}
+
+	message, size := next(), 0
+	for _, line := range changed {
+		if size > 0 && size+len(line.Text) > consoleMessageBudget {
+			message, size = next(), 0
+		}
+		message.Lines = append(message.Lines, line)
+		size += len(line.Text)
+	}
+	return messages
+}
+
+// consoleAttrRuns compresses a row of attributes into [start, length, attribute] runs
+func consoleAttrRuns(attrs []byte) [][3]int {
+	runs := [][3]int{}
+	for x := 0; x < len(attrs); {
+		start := x
+		for x < len(attrs) && attrs[x] == attrs[start] {
+			x++
+		}
+		runs = append(runs, [3]int{start, x - start, int(attrs[start])})
+	}
+	return runs
+}
+
+// consoleKeys are the sequences the Linux console sends for non-printing keys
+var consoleKeys = map[string]string{
+	"Enter":      "\r",
+	"Backspace":  "\x7f",
+	"Tab":        "\t",
+	"Escape":     "\x1b",
+	"Space":      " ",
+	"ArrowUp":    "\x1b[A",
+	"ArrowDown":  "\x1b[B",
+	"ArrowRight": "\x1b[C",
+	"ArrowLeft":  "\x1b[D",
+	"Home":       "\x1b[1~",
+	"Insert":     "\x1b[2~",
+	"Delete":     "\x1b[3~",
+	"End":        "\x1b[4~",
+	"PageUp":     "\x1b[5~",
+	"PageDown":   "\x1b[6~",
+	"F1":         "\x1b[[A",
+	"F2":         "\x1b[[B",
+	"F3":         "\x1b[[C",
+	"F4":         "\x1b[[D",
+	"F5":         "\x1b[[E",
+	"F6":         "\x1b[17~",
+	"F7":         "\x1b[18~",
+	"F8":         "\x1b[19~",
+	"F9":         "\x1b[20~",
+	"F10":        "\x1b[21~",
+	"F11":        "\x1b[23~",
+	"F12":        "\x1b[24~",
+}
+
+// HandleKey types a viewer keyboard event into the console. Control and Alt are
+// tracked so Ctrl+C becomes ^C and Alt+x is sent as ESC x, as the console does.
+func (c *consoleSession) HandleKey(key string, down bool) error {
+	c.mu.Lock()
+	switch key {
+	case "Control", "ControlLeft", "ControlRight":
+		c.ctrl = down
+		c.mu.Unlock()
+		return nil
+	case "Alt", "AltLeft", "AltRight":
+		c.alt = down
+		c.mu.Unlock()
+		return nil
+	}
+	ctrl, alt, inputErr := c.ctrl, c.alt, c.inputErr
+	c.mu.Unlock()
+
+	if !down {
+		return nil
+	}
+	input, ok := consoleKeyInput(key, ctrl, alt)
+	if !ok {
+		// Shift, Meta, lock keys and the like produce no input on their own
+		return nil
+	}
+	if inputErr != nil {
+		return inputErr
+	}
+
+	err := c.device.Write(input)
+	if errors.Is(err, errConsoleInputUnavailable) {
+		c.mu.Lock()
+		first := c.inputErr == nil
+		c.inputErr = err
+		inputLost := c.inputLost
+		c.mu.Unlock()
+		if first && inputLost != nil {
+			inputLost(err)
+		}
+	}
+	return err
+}
+
+// consoleKeyInput is the input a key produces with the given modifiers held
+func consoleKeyInput(key string, ctrl, alt bool) ([]byte, bool) {
+	var input []byte
+	if sequence, ok := consoleKeys[key]; ok {
+		input = []byte(sequence)
+	} else if runes := []rune(key); len(runes) == 1 {
+		input = []byte(key)
+	} else {
+		return nil, false
+	}
+
+	if ctrl && len(input) == 1 {
+		switch ch := input[0]; {
+		case ch >= 'a' && ch <= 'z':
+			input[0] = ch - 'a' + 1
+		case ch >= '@' && ch <= '_':
+			input[0] = ch - '@'
+		case ch == ' ':
+			input[0] = 0
+		case ch == '?':
+			input[0] = 0x7f
+		}
+	}
+	if alt {
+		input = append([]byte{0x1b}, input...)
+	}
+	return input, true
+}
+
+// SetConsole makes the peer stream a text console instead of the screen (nil = screen)
+func (wp *WebRTCPeer) SetConsole(console *consoleSession) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	wp.console = console
+}
+
+func (wp *WebRTCPeer) getConsole() *consoleSession {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+	return wp.console
+}
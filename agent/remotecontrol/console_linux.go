@@ -0,0 +1,228 @@
+//go:build linux
+// +build linux
+
+package remotecontrol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// vcsaPath is the foreground virtual console: a rows, cols, cursor x, cursor y
+	// header followed by character/attribute byte pairs
+	vcsaPath = "/dev/vcsa"
+	// vcsuPath holds the same console as UTF-32 characters (Linux 4.19+)
+	vcsuPath = "/dev/vcsu"
+	// activeTTYPath names the virtual console currently in the foreground
+	activeTTYPath = "/sys/class/tty/tty0/active"
+	// legacyTIOCSTIPath is 0 when Linux 6.2+ refuses TIOCSTI without CAP_SYS_ADMIN
+	legacyTIOCSTIPath = "/proc/sys/dev/tty/legacy_tiocsti"
+
+	// capSysAdmin is CAP_SYS_ADMIN's bit in the capability sets of /proc/PID/status
+	capSysAdmin = 21
+)
+
+// cp437 maps console glyph bytes 0x80-0xFF to Unicode when vcsu is unavailable
+var cp437 = []rune("ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒáíóúñÑªº¿⌐¬½¼¡«»" +
+	"░▒▓│┤╡╢╖╕╣║╗╝╜╛┐└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀" +
+	"αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■\u00a0")
+
+// vcsaConsole captures the foreground virtual console and types into its TTY
+type vcsaConsole struct {
+	mu      sync.Mutex
+	unicode bool     // vcsu is readable
+	tty     string   // TTY that input is open on
+	input   *os.File // Input side of tty, reopened when another console comes to the foreground
+}
+
+// ConsoleAvailable reports whether the virtual console can be read (root is normally required)
+func ConsoleAvailable() error {
+	file, err := os.Open(vcsaPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", vcsaPath, err)
+	}
+	return file.Close()
+}
+
+// consoleInputAvailable reports why keystrokes cannot be typed into the console.
+// TIOCSTI into a TTY other than the agent's own needs CAP_SYS_ADMIN, on Linux 6.2+
+// with dev.tty.legacy_tiocsti=0 as well as before it.
+func consoleInputAvailable() error {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return fmt.Errorf("%w: failed to read the agent's capabilities: %v", errConsoleInputUnavailable, err)
+	}
+	if hasEffectiveCapability(status, capSysAdmin) {
+		return nil
+	}
+	if setting, err := os.ReadFile(legacyTIOCSTIPath); err == nil && strings.TrimSpace(string(setting)) == "0" {
+		return fmt.Errorf("%w: dev.tty.legacy_tiocsti is 0 and the agent lacks CAP_SYS_ADMIN", errConsoleInputUnavailable)
+	}
+	return fmt.Errorf("%w: typing into a console needs CAP_SYS_ADMIN", errConsoleInputUnavailable)
+}
+
+// hasEffectiveCapability reads the CapEff bitmask from /proc/PID/status contents
+func hasEffectiveCapability(status []byte, capability uint) bool {
+	for _, line := range strings.Split(string(status), "\n") {
+		value, ok := strings.CutPrefix(line, "CapEff:")
+		if !ok {
+			continue
+		}
+		mask, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		return err == nil && mask&(1<<capability) != 0
+	}
+	return false
+}
+
+func openConsoleDevice() (consoleDevice, error) {
+	if err := ConsoleAvailable(); err != nil {
+		return nil, err
+	}
+	return &vcsaConsole{unicode: true}, nil
+}
+
+// activeConsoleTTY returns the name of the foreground virtual console, such as tty2
+func activeConsoleTTY() string {
+	data, err := os.ReadFile(activeTTYPath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Read snapshots the foreground console
+func (c *vcsaConsole) Read() (*consoleScreen, error) {
+	data, err := os.ReadFile(vcsaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", vcsaPath, err)
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("short read from %s (%d bytes)", vcsaPath, len(data))
+	}
+
+	screen := &consoleScreen{
+		TTY:     activeConsoleTTY(),
+		Rows:    int(data[0]),
+		Cols:    int(data[1]),
+		CursorX: int(data[2]),
+		CursorY: int(data[3]),
+	}
+	cells := data[4:]
+	if len(cells) < screen.Rows*screen.Cols*2 {
+		return nil, fmt.Errorf("%s holds %d bytes for a %dx%d console", vcsaPath, len(cells), screen.Cols, screen.Rows)
+	}
+
+	chars := c.readUnicode(screen.Rows * screen.Cols)
+	screen.Lines = make([]consoleLine, screen.Rows)
+	for y := range screen.Lines {
+		line := consoleLine{
+			Text:  make([]rune, screen.Cols),
+			Attrs: make([]byte, screen.Cols),
+		}
+		for x := 0; x < screen.Cols; x++ {
+			i := y*screen.Cols + x
+			glyph, attr := cells[2*i], cells[2*i+1]
+			switch {
+			case chars != nil:
+				line.Text[x] = chars[i]
+			case glyph >= 0x80:
+				line.Text[x] = cp437[glyph-0x80]
+			case glyph < 0x20:
+				line.Text[x] = ' '
+			default:
+				line.Text[x] = rune(glyph)
+			}
+			line.Attrs[x] = attr
+		}
+		screen.Lines[y] = line
+	}
+	return screen, nil
+}
+
+// readUnicode returns the console's characters from vcsu, or nil to fall back to
+// the glyph bytes; a kernel without vcsu is only tried once
+func (c *vcsaConsole) readUnicode(cells int) []rune {
+	c.mu.Lock()
+	unicode := c.unicode
+	c.mu.Unlock()
+	if !unicode {
+		return nil
+	}
+
+	data, err := os.ReadFile(vcsuPath)
+	if err != nil || len(data) < cells*4 {
+		if err == nil {
+			err = fmt.Errorf("short read (%d bytes)", len(data))
+		}
+		log.Printf("[Console] Unicode console unavailable, decoding glyphs as CP437: %v", err)
+		c.mu.Lock()
+		c.unicode = false
+		c.mu.Unlock()
+		return nil
+	}
+
+	chars := make([]rune, cells)
+	for i := range chars {
+		chars[i] = rune(binary.NativeEndian.Uint32(data[4*i:]))
+		if chars[i] < 0x20 {
+			chars[i] = ' '
+		}
+	}
+	return chars
+}
+
+// Write types input into the foreground console's TTY as if it came from its keyboard
+func (c *vcsaConsole) Write(input []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tty := activeConsoleTTY()
+	if tty == "" {
+		return fmt.Errorf("no active virtual console")
+	}
+	if c.input == nil || c.tty != tty {
+		if c.input != nil {
+			c.input.Close()
+		}
+		// O_NOCTTY: the agent must not adopt the console as its controlling terminal
+		file, err := os.OpenFile("/dev/"+tty, os.O_WRONLY|syscall.O_NOCTTY, 0)
+		if err != nil {
+			c.input = nil
+			return fmt.Errorf("failed to open /dev/%s: %w", tty, err)
+		}
+		c.input, c.tty = file, tty
+	}
+
+	fd := c.input.Fd()
+	for i := range input {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCSTI, uintptr(unsafe.Pointer(&input[i])))
+		if errno != 0 {
+			// EPERM: no CAP_SYS_ADMIN; EIO: Linux 6.2+ with dev.tty.legacy_tiocsti=0
+			if errno == syscall.EPERM || errno == syscall.EIO {
+				return fmt.Errorf("failed to type into %s: %w: %w", tty, errConsoleInputUnavailable, errno)
+			}
+			return fmt.Errorf("failed to type into %s: %w", tty, errno)
+		}
+	}
+	return nil
+}
+
+// Close releases the TTY input
+func (c *vcsaConsole) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.input == nil {
+		return nil
+	}
+	err := c.input.Close()
+	c.input = nil
+	return err
+}
@@ -0,0 +1,27 @@
+//go:build linux
+// +build linux
+
+package remotecontrol
+
+import "testing"
+
+func TestHasEffectiveCapability(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		want   bool
+	}{
+		{"root", "Name:\tdeskwise-agent\nCapInh:\t0000000000000000\nCapPrm:\t000001ffffffffff\nCapEff:\t000001ffffffffff\n", true},
+		{"unprivileged", "Name:\tdeskwise-agent\nCapPrm:\t0000000000000000\nCapEff:\t0000000000000000\n", false},
+		{"only CAP_SYS_ADMIN", "CapEff:\t0000000000200000\n", true},
+		{"permitted but not effective", "CapPrm:\t0000000000200000\nCapEff:\t0000000000000000\n", false},
+		{"CAP_SYS_TTY_CONFIG is not enough", "CapEff:\t0000000004000000\n", false},
+		{"no CapEff line", "Name:\tdeskwise-agent\n", false},
+		{"garbled", "CapEff:\tzz\n", false},
+	}
+	for _, tt := range tests {
+		if got := hasEffectiveCapability([]byte(tt.status), capSysAdmin); got != tt.want {
+			t.Errorf("%s: hasEffectiveCapability = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package remotecontrol
+
+import "fmt"
+
+// ConsoleAvailable reports why the text console cannot be captured on this platform
+func ConsoleAvailable() error {
+	return fmt.Errorf("console capture is only supported on Linux")
+}
+
+// openConsoleDevice is only available on Linux
+func openConsoleDevice() (consoleDevice, error) {
+	return nil, ConsoleAvailable()
+}
+
+// consoleInputAvailable is only meaningful on Linux
+func consoleInputAvailable() error {
+	return ConsoleAvailable()
+}
@@ -0,0 +1,250 @@
+package remotecontrol
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeConsole records what is typed and can refuse it like a kernel without TIOCSTI
+type fakeConsole struct {
+	typed    []string
+	writeErr error
+}
+
+func (f *fakeConsole) Read() (*consoleScreen, error) { return nil, errors.New("not used") }
+func (f *fakeConsole) Close() error                  { return nil }
+
+func (f *fakeConsole) Write(input []byte) error {
+	if f.writeErr != nil {
+		return f.writeErr
+	}
+	f.typed = append(f.typed, string(input))
+	return nil
+}
+
+// testScreen builds a console whose rows hold the given text, attribute 7 throughout
+func testScreen(cols int, rows ...string) *consoleScreen {
+	screen := &consoleScreen{TTY: "tty1", Cols: cols, Rows: len(rows)}
+	for _, row := range rows {
+		text := []rune(fmt.Sprintf("%-*s", cols, row))
+		attrs := make([]byte, cols)
+		for i := range attrs {
+			attrs[i] = 7
+		}
+		screen.Lines = append(screen.Lines, consoleLine{Text: text, Attrs: attrs})
+	}
+	return screen
+}
+
+func changedRows(messages []consoleMessage) []int {
+	var rows []int
+	for _, message := range messages {
+		for _, line := range message.Lines {
+			rows = append(rows, line.Y)
+		}
+	}
+	return rows
+}
+
+func TestConsoleUpdates(t *testing.T) {
+	screen := testScreen(8, "login:", "", "")
+
+	full := consoleUpdates(nil, screen)
+	if len(full) != 1 || !full[0].Full || !reflect.DeepEqual(changedRows(full), []int{0, 1, 2}) {
+		t.Fatalf("first update = %+v", full)
+	}
+	if full[0].Lines[0].Text != "login:  " || !reflect.DeepEqual(full[0].Lines[0].Attrs, [][3]int{{0, 8, 7}}) {
+		t.Errorf("row 0 = %+v", full[0].Lines[0])
+	}
+
+	if messages := consoleUpdates(screen, testScreen(8, "login:", "", "")); messages != nil {
+		t.Errorf("unchanged screen sent %+v", messages)
+	}
+
+	typed := testScreen(8, "login:", "root", "")
+	typed.CursorX, typed.CursorY = 4, 1
+	messages := consoleUpdates(screen, typed)
+	if len(messages) != 1 || messages[0].Full || !reflect.DeepEqual(changedRows(messages), []int{1}) {
+		t.Errorf("one changed row sent %+v", messages)
+	}
+	if messages[0].Cursor != (consoleCursor{X: 4, Y: 1}) {
+		t.Errorf("cursor = %+v", messages[0].Cursor)
+	}
+
+	// The cursor moving alone still needs a message, with no rows
+	moved := testScreen(8, "login:", "root", "")
+	moved.CursorX, moved.CursorY = 0, 2
+	messages = consoleUpdates(typed, moved)
+	if len(messages) != 1 || len(messages[0].Lines) != 0 || messages[0].Lines == nil || messages[0].Cursor.Y != 2 {
+		t.Errorf("cursor move sent %+v", messages)
+	}
+
+	// An attribute change (e.g. a highlighted menu entry) is a change
+	highlighted := testScreen(8, "login:", "root", "")
+	highlighted.CursorX, highlighted.CursorY = 0, 2
+	highlighted.Lines[0].Attrs[0] = 0x70
+	if rows := changedRows(consoleUpdates(moved, highlighted)); !reflect.DeepEqual(rows, []int{0}) {
+		t.Errorf("attribute change sent rows %v", rows)
+	}
+
+	// A resize or console switch starts over with a full frame
+	resized := testScreen(10, "login:", "root", "")
+	if messages := consoleUpdates(typed, resized); len(messages) != 1 || !messages[0].Full || len(messages[0].Lines) != 3 {
+		t.Errorf("resize sent %+v", messages)
+	}
+	switched := testScreen(8, "login:", "root", "")
+	switched.TTY = "tty2"
+	if messages := consoleUpdates(typed, switched); len(messages) != 1 || !messages[0].Full {
+		t.Errorf("console switch sent %+v", messages)
+	}
+}
+
+func TestConsoleUpdatesSplitLargeScreens(t *testing.T) {
+	cols := 4000
+	rows := make([]string, 10)
+	for i := range rows {
+		rows[i] = strings.Repeat(string(rune('a'+i)), cols)
+	}
+	messages := consoleUpdates(nil, testScreen(cols, rows...))
+
+	if len(messages) < 3 {
+		t.Fatalf("%d messages for %d bytes of text", len(messages), cols*len(rows))
+	}
+	for i, message := range messages {
+		if message.Full != (i == 0) {
+			t.Errorf("message %d full = %t; only the first clears the grid", i, message.Full)
+		}
+		size := 0
+		for _, line := range message.Lines {
+			size += len(line.Text)
+		}
+		if size > consoleMessageBudget {
+			t.Errorf("message %d carries %d bytes, budget %d", i, size, consoleMessageBudget)
+		}
+	}
+	if rows := changedRows(messages); len(rows) != 10 || rows[0] != 0 || rows[9] != 9 {
+		t.Errorf("rows = %v", rows)
+	}
+}
+
+func TestConsoleAttrRuns(t *testing.T) {
+	tests := []struct {
+		attrs []byte
+		want  [][3]int
+	}{
+		{nil, [][3]int{}},
+		{[]byte{7}, [][3]int{{0, 1, 7}}},
+		{[]byte{7, 7, 0x70, 0x70, 0x70, 7}, [][3]int{{0, 2, 7}, {2, 3, 0x70}, {5, 1, 7}}},
+		{[]byte{0x8f, 0x1f}, [][3]int{{0, 1, 0x8f}, {1, 1, 0x1f}}},
+	}
+	for _, tt := range tests {
+		if got := consoleAttrRuns(tt.attrs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("consoleAttrRuns(%v) = %v, want %v", tt.attrs, got, tt.want)
+		}
+	}
+}
+
+func TestConsoleKeyInput(t *testing.T) {
+	tests := []struct {
+		key       string
+		ctrl, alt bool
+		want      string
+		ok        bool
+	}{
+		{"a", false, false, "a", true},
+		{"A", false, false, "A", true},
+		{"é", false, false, "é", true},
+		{"Enter", false, false, "\r", true},
+		{"Backspace", false, false, "\x7f", true},
+		{"ArrowUp", false, false, "\x1b[A", true},
+		{"F1", false, false, "\x1b[[A", true},
+		{"F12", false, false, "\x1b[24~", true},
+		{"c", true, false, "\x03", true},
+		{"C", true, false, "\x03", true},
+		{"[", true, false, "\x1b", true},
+		{"Space", true, false, "\x00", true},
+		{"?", true, false, "\x7f", true},
+		{"1", true, false, "1", true},
+		{"ArrowUp", true, false, "\x1b[A", true},
+		{"x", false, true, "\x1bx", true},
+		{"c", true, true, "\x1b\x03", true},
+		{"Shift", false, false, "", false},
+		{"CapsLock", false, false, "", false},
+		{"Meta", true, false, "", false},
+	}
+	for _, tt := range tests {
+		input, ok := consoleKeyInput(tt.key, tt.ctrl, tt.alt)
+		if ok != tt.ok || string(input) != tt.want {
+			t.Errorf("consoleKeyInput(%q, ctrl=%t, alt=%t) = %q, %t; want %q, %t",
+				tt.key, tt.ctrl, tt.alt, input, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestConsoleHandleKey(t *testing.T) {
+	device := &fakeConsole{}
+	console := newConsoleSession(device)
+
+	keys := []struct {
+		key  string
+		down bool
+	}{
+		{"l", true}, {"l", false},
+		{"Control", true}, {"c", true}, {"c", false}, {"Control", false},
+		{"Shift", true}, {"S", true}, {"Shift", false},
+		{"AltLeft", true}, {"b", true}, {"AltLeft", false},
+		{"Enter", true},
+	}
+	for _, k := range keys {
+		if err := console.HandleKey(k.key, k.down); err != nil {
+			t.Fatalf("HandleKey(%q, %t): %v", k.key, k.down, err)
+		}
+	}
+	want := []string{"l", "\x03", "S", "\x1bb", "\r"}
+	if !reflect.DeepEqual(device.typed, want) {
+		t.Errorf("typed %q, want %q", device.typed, want)
+	}
+}
+
+func TestConsoleInputUnavailable(t *testing.T) {
+	refused := fmt.Errorf("failed to type into tty1: %w: %w", errConsoleInputUnavailable, errors.New("input/output error"))
+	device := &fakeConsole{writeErr: refused}
+	console := newConsoleSession(device)
+	var lost []error
+	console.inputLost = func(err error) { lost = append(lost, err) }
+
+	for i := 0; i < 3; i++ {
+		if err := console.HandleKey("a", true); !errors.Is(err, errConsoleInputUnavailable) {
+			t.Fatalf("key %d: err = %v, want console input unavailable", i, err)
+		}
+	}
+	if len(lost) != 1 || lost[0] != refused {
+		t.Errorf("inputLost called %d times with %v, want once", len(lost), lost)
+	}
+
+	// Other write errors (e.g. no foreground console) are not a lost capability
+	device.writeErr = errors.New("no active virtual console")
+	other := newConsoleSession(device)
+	other.inputLost = func(err error) { t.Errorf("inputLost(%v) for a transient error", err) }
+	if err := other.HandleKey("a", true); err == nil {
+		t.Error("write error was dropped")
+	}
+	device.writeErr = nil
+	if err := other.HandleKey("a", true); err != nil {
+		t.Errorf("typing after a transient error: %v", err)
+	}
+
+	// Keys are refused without touching the TTY once input is known to be unavailable
+	preset := &fakeConsole{}
+	known := newConsoleSession(preset)
+	known.inputErr = errConsoleInputUnavailable
+	if err := known.HandleKey("a", true); !errors.Is(err, errConsoleInputUnavailable) || len(preset.typed) != 0 {
+		t.Errorf("err = %v, typed %q", err, preset.typed)
+	}
+	if err := known.HandleKey("Shift", true); err != nil {
+		t.Errorf("modifier refused: %v", err)
+	}
+}
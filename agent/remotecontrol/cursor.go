@@ -0,0 +1,226 @@
+package remotecontrol
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/png"
+	"log"
+	"time"
+)
+
+// errCursorUnsupported is returned by capturers that cannot report the mouse cursor
+var errCursorUnsupported = errors.New("cursor capture not supported on this platform")
+
+// cursorPollInterval is how often the cursor is sampled (~60 Hz, independent of the video frame rate)
+const cursorPollInterval = 16 * time.Millisecond
+
+// CursorState describes the mouse cursor position and shape.
+// Platform capturers report X/Y in absolute desktop coordinates;
+// ScreenCapture.CaptureCursor converts them to the captured area.
+type CursorState struct {
+	X       int
+	Y       int
+	Visible bool
+	Shape   string      // CSS cursor name: default, text, wait, progress, pointer, crosshair, move, *-resize, not-allowed or custom
+	Serial  uint64      // Changes whenever the cursor shape changes
+	Image   *image.RGBA // Optional cursor bitmap (nil when only the named shape is known)
+	HotX    int
+	HotY    int
+}
+
+// cursorShapeFromName maps X11 / freedesktop cursor theme names to CSS cursor names
+func cursorShapeFromName(name string) string {
+	switch name {
+	case "", "left_ptr", "default", "arrow", "top_left_arrow":
+		return "default"
+	case "xterm", "text", "ibeam":
+		return "text"
+	case "watch", "wait":
+		return "wait"
+	case "left_ptr_watch", "progress", "half-busy":
+		return "progress"
+	case "hand", "hand1", "hand2", "pointer", "pointing_hand":
+		return "pointer"
+	case "crosshair", "cross", "tcross":
+		return "crosshair"
+	case "fleur", "move", "all-scroll", "size_all":
+		return "move"
+	case "sb_h_double_arrow", "h_double_arrow", "ew-resize", "col-resize", "size_hor":
+		return "ew-resize"
+	case "sb_v_double_arrow", "v_double_arrow", "ns-resize", "row-resize", "size_ver":
+		return "ns-resize"
+	case "top_left_corner", "bottom_right_corner", "nwse-resize", "size_fdiag":
+		return "nwse-resize"
+	case "top_right_corner", "bottom_left_corner", "nesw-resize", "size_bdiag":
+		return "nesw-resize"
+	case "not-allowed", "crossed_circle", "forbidden", "no-drop":
+		return "not-allowed"
+	default:
+		return "custom"
+	}
+}
+
+// CaptureCursor returns the cursor state relative to the captured monitor (or virtual desktop)
+func (sc *ScreenCapture) CaptureCursor() (*CursorState, error) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	if !sc.running || sc.capturer == nil {
+		return nil, errors.New("screen capture not running")
+	}
+
+	cursor, err := sc.capturer.CaptureCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	originX, originY, width, height := sc.captureAreaLocked()
+	cursor.X -= originX
+	cursor.Y -= originY
+
+	// A cursor on another monitor (or outside the shared window) is not visible in
+	// this stream, and where it is must not be given away either
+	if cursor.X < 0 || cursor.Y < 0 || cursor.X >= width || cursor.Y >= height {
+		cursor.Visible = false
+		cursor.X, cursor.Y = 0, 0
+	}
+
+	return cursor, nil
+}
+
+// captureAreaLocked returns the desktop rectangle being captured; sc.mu must be held
+func (sc *ScreenCapture) captureAreaLocked() (x, y, width, height int) {
+	if sc.window != nil {
+		return sc.window.X, sc.window.Y, sc.window.Width, sc.window.Height
+	}
+	if sc.monitorIndex >= 0 && sc.monitorIndex < len(sc.monitors.Monitors) {
+		mon := sc.monitors.Monitors[sc.monitorIndex]
+		return mon.X, mon.Y, mon.Width, mon.Height
+	}
+	if sc.monitors.VirtualWidth > 0 && sc.monitors.VirtualHeight > 0 {
+		return sc.monitors.VirtualMinX, sc.monitors.VirtualMinY, sc.monitors.VirtualWidth, sc.monitors.VirtualHeight
+	}
+
+	info := sc.capturer.GetDisplayInfo()
+	return 0, 0, info.Width, info.Height
+}
+
+// GetCaptureSize returns the size in pixels of the area being captured
+func (sc *ScreenCapture) GetCaptureSize() (int, int) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	if sc.capturer == nil {
+		return 0, 0
+	}
+	_, _, width, height := sc.captureAreaLocked()
+	return width, height
+}
+
+// encodeCursorImage encodes a cursor bitmap as base64 PNG for the data channel
+func encodeCursorImage(img *image.RGBA) (string, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// sendCursorUpdates streams cursor position and shape changes as "cursor" data channel
+// messages so the viewer can draw the pointer locally instead of waiting for video frames
+func (wp *WebRTCPeer) sendCursorUpdates() {
+	ticker := time.NewTicker(cursorPollInterval)
+	defer ticker.Stop()
+
+	var last CursorState
+	var lastSerial uint64
+	sentAny := false
+
+	for {
+		select {
+		case <-wp.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !wp.IsConnected() {
+			continue
+		}
+
+		if wp.isPaused() {
+			// The pointer is hidden while paused and not read at all, so it does not
+			// give away where the user is working; last is already in encoded coordinates
+			if sentAny && !last.Visible {
+				continue
+			}
+			message := map[string]interface{}{"type": "cursor", "x": last.X, "y": last.Y, "visible": false}
+			if err := wp.sendDataChannelMessage(message); err == nil {
+				last.Visible = false
+				sentAny = true
+			}
+			continue
+		}
+
+		cursor, err := wp.screenCapture.CaptureCursor()
+		if err != nil {
+			if err == errCursorUnsupported {
+				log.Printf("[WebRTCPeer] Cursor streaming disabled: %v", err)
+				return
+			}
+			continue
+		}
+
+		// Map capture coordinates into the encoded video space the viewer renders
+		quality := wp.GetQualitySettings()
+		captureWidth, captureHeight := wp.screenCapture.GetCaptureSize()
+		if captureWidth > 0 && captureHeight > 0 {
+			cursor.X = cursor.X * quality.Width / captureWidth
+			cursor.Y = cursor.Y * quality.Height / captureHeight
+		}
+		if !cursor.Visible {
+			// A hidden cursor stays where it was last seen in the stream
+			cursor.X, cursor.Y = last.X, last.Y
+		}
+
+		shapeChanged := !sentAny || cursor.Serial != lastSerial || cursor.Shape != last.Shape
+		if !shapeChanged && cursor.X == last.X && cursor.Y == last.Y && cursor.Visible == last.Visible {
+			continue
+		}
+
+		message := map[string]interface{}{
+			"type":    "cursor",
+			"x":       cursor.X,
+			"y":       cursor.Y,
+			"visible": cursor.Visible,
+		}
+
+		// Shape details are only sent when they change; the viewer keeps the last one
+		if shapeChanged {
+			message["shape"] = cursor.Shape
+			message["serial"] = cursor.Serial
+			if cursor.Image != nil {
+				encoded, err := encodeCursorImage(cursor.Image)
+				if err != nil {
+					log.Printf("[WebRTCPeer] Failed to encode cursor image: %v", err)
+				} else {
+					message["image"] = encoded
+					message["width"] = cursor.Image.Bounds().Dx()
+					message["height"] = cursor.Image.Bounds().Dy()
+					message["hotX"] = cursor.HotX
+					message["hotY"] = cursor.HotY
+				}
+			}
+		}
+
+		if err := wp.sendDataChannelMessage(message); err != nil {
+			// Data channel not open yet; try again on the next tick
+			continue
+		}
+
+		last = *cursor
+		lastSerial = cursor.Serial
+		sentAny = true
+	}
+}
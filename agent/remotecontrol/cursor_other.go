@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package remotecontrol
+
+// captureWindowsCursor is only available on Windows
+func captureWindowsCursor() (*CursorState, error) {
+	return nil, errCursorUnsupported
+}
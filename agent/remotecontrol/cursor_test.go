@@ -0,0 +1,65 @@
+package remotecontrol
+
+import "testing"
+
+func TestCursorShapeFromName(t *testing.T) {
+	tests := map[string]string{
+		"":                    "default",
+		"left_ptr":            "default",
+		"top_left_arrow":      "default",
+		"xterm":               "text",
+		"ibeam":               "text",
+		"watch":               "wait",
+		"left_ptr_watch":      "progress",
+		"half-busy":           "progress",
+		"hand2":               "pointer",
+		"pointing_hand":       "pointer",
+		"tcross":              "crosshair",
+		"fleur":               "move",
+		"size_all":            "move",
+		"sb_h_double_arrow":   "ew-resize",
+		"col-resize":          "ew-resize",
+		"sb_v_double_arrow":   "ns-resize",
+		"row-resize":          "ns-resize",
+		"top_left_corner":     "nwse-resize",
+		"bottom_right_corner": "nwse-resize",
+		"top_right_corner":    "nesw-resize",
+		"size_bdiag":          "nesw-resize",
+		"crossed_circle":      "not-allowed",
+		"no-drop":             "not-allowed",
+		"dnd-copy":            "custom",
+		"Left_ptr":            "custom", // Theme names are case-sensitive
+		"pirate":              "custom",
+	}
+	for name, want := range tests {
+		if got := cursorShapeFromName(name); got != want {
+			t.Errorf("cursorShapeFromName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCaptureCursorOutsideCaptureArea(t *testing.T) {
+	synthetic := &SyntheticConfig{Width: 320, Height: 200, Monitors: 2}
+	capture := func(monitor int) *CursorState {
+		t.Helper()
+		sc := NewScreenCaptureWithMonitor(monitor)
+		sc.SetSyntheticSource(synthetic)
+		if err := sc.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer sc.Stop()
+		cursor, err := sc.CaptureCursor()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cursor
+	}
+
+	// The synthetic pointer circles the middle of monitor 0
+	if cursor := capture(0); !cursor.Visible || cursor.X < 0 || cursor.X >= 320 || cursor.Y < 0 || cursor.Y >= 200 {
+		t.Errorf("monitor 0 cursor = %+v, want visible inside the monitor", cursor)
+	}
+	if cursor := capture(1); cursor.Visible || cursor.X != 0 || cursor.Y != 0 {
+		t.Errorf("monitor 1 cursor = visible %t at %d,%d; want hidden without a position", cursor.Visible, cursor.X, cursor.Y)
+	}
+}
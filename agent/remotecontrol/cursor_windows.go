@@ -0,0 +1,87 @@
+//go:build windows
+// +build windows
+
+package remotecontrol
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+var (
+	procGetCursorInfo = user32.NewProc("GetCursorInfo")
+	procLoadCursorW   = user32.NewProc("LoadCursorW")
+)
+
+const CURSOR_SHOWING = 0x00000001
+
+// Standard system cursor resource IDs (IDC_*)
+var windowsCursorShapes = map[uintptr]string{
+	32512: "default",     // IDC_ARROW
+	32513: "text",        // IDC_IBEAM
+	32514: "wait",        // IDC_WAIT
+	32515: "crosshair",   // IDC_CROSS
+	32642: "nwse-resize", // IDC_SIZENWSE
+	32643: "nesw-resize", // IDC_SIZENESW
+	32644: "ew-resize",   // IDC_SIZEWE
+	32645: "ns-resize",   // IDC_SIZENS
+	32646: "move",        // IDC_SIZEALL
+	32648: "not-allowed", // IDC_NO
+	32649: "pointer",     // IDC_HAND
+	32650: "progress",    // IDC_APPSTARTING
+}
+
+type POINT struct {
+	X int32
+	Y int32
+}
+
+type CURSORINFO struct {
+	CbSize      uint32
+	Flags       uint32
+	HCursor     uintptr
+	PtScreenPos POINT
+}
+
+// systemCursorHandles maps shared system cursor handles to CSS cursor names.
+// Shared cursors loaded with LoadCursor return the same handle GetCursorInfo reports.
+var systemCursorHandles map[uintptr]string
+
+func loadSystemCursorHandles() map[uintptr]string {
+	handles := make(map[uintptr]string, len(windowsCursorShapes))
+	for id, shape := range windowsCursorShapes {
+		handle, _, _ := procLoadCursorW.Call(0, id)
+		if handle != 0 {
+			handles[handle] = shape
+		}
+	}
+	return handles
+}
+
+// captureWindowsCursor reads the cursor position (virtual screen coordinates) and shape
+func captureWindowsCursor() (*CursorState, error) {
+	if systemCursorHandles == nil {
+		systemCursorHandles = loadSystemCursorHandles()
+	}
+
+	var info CURSORINFO
+	info.CbSize = uint32(unsafe.Sizeof(info))
+
+	ret, _, err := procGetCursorInfo.Call(uintptr(unsafe.Pointer(&info)))
+	if ret == 0 {
+		return nil, fmt.Errorf("GetCursorInfo failed: %v", err)
+	}
+
+	shape, ok := systemCursorHandles[info.HCursor]
+	if !ok {
+		shape = "custom"
+	}
+
+	return &CursorState{
+		X:       int(info.PtScreenPos.X),
+		Y:       int(info.PtScreenPos.Y),
+		Visible: info.Flags&CURSOR_SHOWING != 0,
+		Shape:   shape,
+		Serial:  uint64(info.HCursor),
+	}, nil
+}
@@ -0,0 +1,114 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"image"
+	"log"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xfixes"
+	"github.com/jezek/xgb/xproto"
+)
+
+// x11CursorSource reads the X11 cursor using the XFixes extension.
+// The pointer position is queried on every call; the cursor image is only
+// fetched again after XFixes reports a shape change.
+type x11CursorSource struct {
+	conn   *xgb.Conn
+	root   xproto.Window
+	cached *CursorState
+}
+
+// newX11CursorSource connects to the X server (the zero display is $DISPLAY) and subscribes to cursor changes
+func newX11CursorSource(display X11Display) (*x11CursorSource, error) {
+	conn, err := dialX11(display)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := xfixes.Init(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("XFixes extension not available: %w", err)
+	}
+
+	// GetCursorImageAndName needs XFixes 2.0 or newer
+	if _, err := xfixes.QueryVersion(conn, 4, 0).Reply(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to query XFixes version: %w", err)
+	}
+
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+	if err := xfixes.SelectCursorInputChecked(conn, root, xfixes.CursorNotifyMaskDisplayCursor).Check(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to select cursor events: %w", err)
+	}
+
+	log.Println("[X11Cursor] Initialized XFixes cursor capture")
+	return &x11CursorSource{conn: conn, root: root}, nil
+}
+
+// Capture returns the current cursor in absolute root window coordinates
+func (xc *x11CursorSource) Capture() (*CursorState, error) {
+	// Drain pending events; any cursor notify invalidates the cached shape
+	for {
+		ev, xerr := xc.conn.PollForEvent()
+		if ev == nil && xerr == nil {
+			break
+		}
+		if _, ok := ev.(xfixes.CursorNotifyEvent); ok {
+			xc.cached = nil
+		}
+	}
+
+	if xc.cached == nil {
+		reply, err := xfixes.GetCursorImageAndName(xc.conn).Reply()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cursor image: %w", err)
+		}
+		xc.cached = cursorFromXFixes(reply)
+	}
+
+	pointer, err := xproto.QueryPointer(xc.conn, xc.root).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pointer: %w", err)
+	}
+
+	cursor := *xc.cached
+	cursor.X = int(pointer.RootX)
+	cursor.Y = int(pointer.RootY)
+	return &cursor, nil
+}
+
+// Close disconnects from the X server
+func (xc *x11CursorSource) Close() {
+	xc.conn.Close()
+}
+
+// cursorFromXFixes converts an XFixes cursor reply (premultiplied ARGB pixels) into a CursorState
+func cursorFromXFixes(reply *xfixes.GetCursorImageAndNameReply) *CursorState {
+	width := int(reply.Width)
+	height := int(reply.Height)
+
+	cursor := &CursorState{
+		Visible: width > 0 && height > 0,
+		Shape:   cursorShapeFromName(reply.Name),
+		Serial:  uint64(reply.CursorSerial),
+		HotX:    int(reply.Xhot),
+		HotY:    int(reply.Yhot),
+	}
+
+	if !cursor.Visible || len(reply.CursorImage) < width*height {
+		return cursor
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i, argb := range reply.CursorImage[:width*height] {
+		img.Pix[i*4] = uint8(argb >> 16)
+		img.Pix[i*4+1] = uint8(argb >> 8)
+		img.Pix[i*4+2] = uint8(argb)
+		img.Pix[i*4+3] = uint8(argb >> 24)
+	}
+	cursor.Image = img
+
+	return cursor
+}
@@ -0,0 +1,87 @@
+package remotecontrol
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/jezek/xgb/xfixes"
+)
+
+func TestCursorFromXFixes(t *testing.T) {
+	reply := &xfixes.GetCursorImageAndNameReply{
+		Width:        2,
+		Height:       2,
+		Xhot:         1,
+		Yhot:         0,
+		CursorSerial: 42,
+		Name:         "xterm",
+		CursorImage: []uint32{
+			0xFF102030, // Opaque
+			0x00000000, // Transparent
+			0x80402010, // Half transparent, premultiplied
+			0xFFFFFFFF, // Opaque white
+		},
+	}
+	cursor := cursorFromXFixes(reply)
+
+	if !cursor.Visible || cursor.Shape != "text" || cursor.Serial != 42 || cursor.HotX != 1 || cursor.HotY != 0 {
+		t.Errorf("cursor = %+v", cursor)
+	}
+	if cursor.Image == nil || cursor.Image.Bounds() != image.Rect(0, 0, 2, 2) {
+		t.Fatalf("image = %v", cursor.Image)
+	}
+
+	// Both XFixes and image.RGBA are premultiplied, so channels copy across unchanged
+	want := map[image.Point]color.RGBA{
+		{0, 0}: {R: 0x10, G: 0x20, B: 0x30, A: 0xFF},
+		{1, 0}: {},
+		{0, 1}: {R: 0x40, G: 0x20, B: 0x10, A: 0x80},
+		{1, 1}: {R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+	}
+	for point, pixel := range want {
+		if got := cursor.Image.RGBAAt(point.X, point.Y); got != pixel {
+			t.Errorf("pixel %v = %v, want %v", point, got, pixel)
+		}
+	}
+
+	// The PNG sent to the viewer carries straight alpha: the half-transparent pixel
+	// comes out at twice its premultiplied brightness
+	encoded, err := encodeCursorImage(cursor.Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	straight := color.NRGBAModel.Convert(decoded.At(0, 1)).(color.NRGBA)
+	if straight.A != 0x80 || straight.R < 0x7E || straight.R > 0x80 || straight.G < 0x3F || straight.G > 0x40 {
+		t.Errorf("decoded half-transparent pixel = %v", straight)
+	}
+}
+
+func TestCursorFromXFixesWithoutImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   xfixes.GetCursorImageAndNameReply
+		visible bool
+	}{
+		{"hidden cursor", xfixes.GetCursorImageAndNameReply{Name: "left_ptr"}, false},
+		{"zero height", xfixes.GetCursorImageAndNameReply{Width: 16, Name: "left_ptr"}, false},
+		{"truncated pixels", xfixes.GetCursorImageAndNameReply{Width: 2, Height: 2, Name: "left_ptr", CursorImage: []uint32{0, 0, 0}}, true},
+	}
+	for _, tt := range tests {
+		cursor := cursorFromXFixes(&tt.reply)
+		if cursor.Visible != tt.visible || cursor.Image != nil || cursor.Shape != "default" {
+			t.Errorf("%s: cursor = %+v", tt.name, cursor)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package remotecontrol
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// dataChannelHighWater pauses senders while this much data is queued on a channel
+	dataChannelHighWater = 1 << 20
+
+	// dataChannelLowWater resumes paused senders once the queue drains below it
+	dataChannelLowWater = 256 << 10
+)
+
+// DataChannelHandler takes ownership of a data channel opened by the viewer
+type DataChannelHandler func(dc *webrtc.DataChannel)
+
+// RegisterDataChannelHandler routes viewer-opened data channels by label.
+// The label is matched up to the first ':' so "name:stream-id" channels share a handler.
+// Channels without a registered handler are treated as the control/input channel.
+func (wp *WebRTCPeer) RegisterDataChannelHandler(label string, handler DataChannelHandler) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	if wp.channelHandlers == nil {
+		wp.channelHandlers = make(map[string]DataChannelHandler)
+	}
+	wp.channelHandlers[label] = handler
+}
+
+// dataChannelHandler returns the registered handler for a channel label, if any
+func (wp *WebRTCPeer) dataChannelHandler(label string) (DataChannelHandler, bool) {
+	if i := strings.IndexByte(label, ':'); i >= 0 {
+		label = label[:i]
+	}
+
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+	handler, ok := wp.channelHandlers[label]
+	return handler, ok
+}
+
+// dataChannelSender writes to a data channel without letting the SCTP send queue grow unbounded
+type dataChannelSender struct {
+	dc      *webrtc.DataChannel
+	drained chan struct{}
+}
+
+// newDataChannelSender installs the buffered-amount callback on dc; create at most one per channel
+func newDataChannelSender(dc *webrtc.DataChannel) *dataChannelSender {
+	s := &dataChannelSender{
+		dc:      dc,
+		drained: make(chan struct{}, 1),
+	}
+
+	dc.SetBufferedAmountLowThreshold(dataChannelLowWater)
+	dc.OnBufferedAmountLow(func() {
+		select {
+		case s.drained <- struct{}{}:
+		default:
+		}
+	})
+	return s
+}
+
+// wait blocks while the channel's send queue is above the high-water mark
+func (s *dataChannelSender) wait() error {
+	for s.dc.BufferedAmount() > dataChannelHighWater {
+		if s.dc.ReadyState() != webrtc.DataChannelStateOpen {
+			return fmt.Errorf("data channel %s is not open", s.dc.Label())
+		}
+		select {
+		case <-s.drained:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// Send writes a binary message once there is room in the send queue
+func (s *dataChannelSender) Send(data []byte) error {
+	if err := s.wait(); err != nil {
+		return err
+	}
+	return s.dc.Send(data)
+}
+
+// SendJSON writes a JSON control message as text
+func (s *dataChannelSender) SendJSON(message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	if err := s.wait(); err != nil {
+		return err
+	}
+	return s.dc.SendText(string(data))
+}
+
+// rejectDataChannel tells the viewer why a channel is refused and closes it
+func rejectDataChannel(dc *webrtc.DataChannel, reason string) {
+	log.Printf("[WebRTCPeer] Rejecting data channel %s: %s", dc.Label(), reason)
+
+	dc.OnOpen(func() {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":  "error",
+			"error": reason,
+		})
+		if err := dc.SendText(string(data)); err != nil {
+			log.Printf("[WebRTCPeer] Failed to send rejection on %s: %v", dc.Label(), err)
+		}
+		dc.Close()
+	})
+}
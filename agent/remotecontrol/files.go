@@ -0,0 +1,685 @@
+package remotecontrol
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// FileTransferConfig is the agent-side configuration for the files data channel
+type FileTransferConfig struct {
+	Roots           []string // Directories the operator may browse, download from and upload to
+	MaxUploadSize   int64    // Largest file accepted from the operator, in bytes
+	MaxDownloadSize int64    // Largest file sent to the operator, in bytes
+}
+
+const (
+	// fileChunkSize is the payload of one binary chunk message
+	fileChunkSize = 16 << 10
+
+	// fileChunkHeaderSize prefixes every chunk: transfer ID (uint32) and file offset (uint64), big-endian
+	fileChunkHeaderSize = 12
+
+	// fileProgressInterval is how often upload progress is acknowledged, so the viewer knows where to resume
+	fileProgressInterval = 1 << 20
+
+	// filePartSuffix marks incomplete uploads kept on disk for resuming
+	filePartSuffix = ".part"
+)
+
+// fileMessage is a JSON request or response on the files channel.
+// Viewer requests: list, download, upload, cancel.
+// Agent responses: list, download-start, download-complete, upload-ready,
+// upload-progress, upload-complete, cancelled, error.
+type fileMessage struct {
+	Type      string      `json:"type"`
+	ID        uint32      `json:"id"`
+	Path      string      `json:"path,omitempty"`
+	Size      int64       `json:"size,omitempty"`
+	Offset    int64       `json:"offset,omitempty"`
+	SHA256    string      `json:"sha256,omitempty"`
+	Overwrite bool        `json:"overwrite,omitempty"`
+	Entries   []fileEntry `json:"entries,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// fileEntry is one item of a directory listing
+type fileEntry struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Dir     bool   `json:"dir"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"` // Unix milliseconds
+	Mode    string `json:"mode"`
+}
+
+// fileUpload is an upload in progress, written to a part file next to its destination
+type fileUpload struct {
+	path     string
+	partPath string
+	size     int64
+	offset   int64
+	expected string
+	file     *os.File
+	hash     hash.Hash
+	acked    int64
+}
+
+// fileTransferManager holds the file transfer policy of one session
+type fileTransferManager struct {
+	config FileTransferConfig
+	roots  []string  // Cleaned, symlink-resolved roots
+	pause  pauseGate // Requests are refused while the user has paused the session
+
+	mu       sync.Mutex
+	channels map[*fileChannel]struct{}
+	closed   bool
+}
+
+// fileChannel is one open files data channel and its transfers; transfer IDs are per channel
+type fileChannel struct {
+	manager *fileTransferManager
+	sender  *dataChannelSender
+
+	mu        sync.Mutex
+	uploads   map[uint32]*fileUpload
+	downloads map[uint32]chan struct{}
+}
+
+func newFileTransferManager(config FileTransferConfig) *fileTransferManager {
+	fm := &fileTransferManager{
+		config:   config,
+		channels: make(map[*fileChannel]struct{}),
+	}
+
+	for _, root := range config.Roots {
+		resolved, err := filepath.Abs(root)
+		if err == nil {
+			resolved, err = filepath.EvalSymlinks(resolved)
+		}
+		if err != nil {
+			log.Printf("[FileTransfer] Ignoring root %s: %v", root, err)
+			continue
+		}
+		fm.roots = append(fm.roots, resolved)
+	}
+
+	return fm
+}
+
+// HandleChannel serves requests on a newly opened files data channel
+func (fm *fileTransferManager) HandleChannel(dc *webrtc.DataChannel) {
+	fc := &fileChannel{
+		manager:   fm,
+		sender:    newDataChannelSender(dc),
+		uploads:   make(map[uint32]*fileUpload),
+		downloads: make(map[uint32]chan struct{}),
+	}
+
+	fm.mu.Lock()
+	if fm.closed {
+		fm.mu.Unlock()
+		rejectDataChannel(dc, "session is ending")
+		return
+	}
+	fm.channels[fc] = struct{}{}
+	fm.mu.Unlock()
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if !msg.IsString {
+			fc.handleChunk(msg.Data)
+			return
+		}
+
+		var request fileMessage
+		if err := json.Unmarshal(msg.Data, &request); err != nil {
+			log.Printf("[FileTransfer] Invalid message: %v", err)
+			return
+		}
+
+		// Cancelling stays possible while paused so the viewer can clean up
+		if request.Type != "cancel" && fm.pause.isPaused() {
+			sendFileError(fc.sender, request.ID, errPausedByUser)
+			return
+		}
+
+		var err error
+		switch request.Type {
+		case "list":
+			err = fc.handleList(request)
+		case "download":
+			err = fc.startDownload(request)
+		case "upload":
+			err = fc.startUpload(request)
+		case "cancel":
+			fc.cancel(request.ID)
+		default:
+			err = fmt.Errorf("unknown request type: %s", request.Type)
+		}
+
+		if err != nil {
+			log.Printf("[FileTransfer] %s request %d failed: %v", request.Type, request.ID, err)
+			sendFileError(fc.sender, request.ID, err)
+		}
+	})
+
+	dc.OnClose(func() {
+		// Part files stay on disk so uploads can resume on a new channel
+		log.Printf("[FileTransfer] Files channel closed")
+		fc.abortAll()
+
+		fm.mu.Lock()
+		delete(fm.channels, fc)
+		fm.mu.Unlock()
+	})
+}
+
+// isClosed reports whether the session has ended
+func (fm *fileTransferManager) isClosed() bool {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	return fm.closed
+}
+
+// resolvePath cleans a viewer-supplied path and checks it lies inside an allowed root.
+// Symlinks are resolved so they cannot point outside the roots; for paths that do not
+// exist yet (upload targets) the parent directory is resolved instead.
+func (fm *fileTransferManager) resolvePath(path string) (string, error) {
+	if path == "" || !filepath.IsAbs(path) {
+		return "", fmt.Errorf("path must be absolute")
+	}
+
+	cleaned := filepath.Clean(path)
+	resolved, err := filepath.EvalSymlinks(cleaned)
+	if os.IsNotExist(err) {
+		parent, parentErr := filepath.EvalSymlinks(filepath.Dir(cleaned))
+		if parentErr != nil {
+			return "", fmt.Errorf("parent directory not accessible: %w", parentErr)
+		}
+		resolved, err = filepath.Join(parent, filepath.Base(cleaned)), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("path not accessible: %w", err)
+	}
+
+	for _, root := range fm.roots {
+		if pathWithinRoot(resolved, root) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("path is outside the allowed roots")
+}
+
+// pathWithinRoot reports whether path equals root or is below it
+func pathWithinRoot(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel))
+}
+
+// openPartFile opens, or creates, the part file of an upload. Only the destination
+// went through resolvePath, so anything but a regular file at the part path (such
+// as a symlink planted next to the destination) is refused rather than followed.
+func openPartFile(path string) (*os.File, error) {
+	existing, err := os.Lstat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil && !existing.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", filepath.Base(path))
+	}
+
+	if existing == nil {
+		// O_EXCL fails on anything created meanwhile, symlinks included
+		return os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// The file checked must be the file opened
+	if opened, err := file.Stat(); err != nil || !os.SameFile(existing, opened) {
+		file.Close()
+		return nil, fmt.Errorf("%s changed while it was opened", filepath.Base(path))
+	}
+	return file, nil
+}
+
+// handleList returns the allowed roots (empty path) or the contents of a directory
+func (fc *fileChannel) handleList(request fileMessage) error {
+	response := fileMessage{Type: "list", ID: request.ID, Path: request.Path, Entries: []fileEntry{}}
+
+	if request.Path == "" {
+		for _, root := range fc.manager.roots {
+			if info, err := os.Stat(root); err == nil {
+				response.Entries = append(response.Entries, newFileEntry(root, info))
+			}
+		}
+		return fc.sender.SendJSON(response)
+	}
+
+	dir, err := fc.manager.resolvePath(request.Path)
+	if err != nil {
+		return err
+	}
+
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	for _, item := range items {
+		// Hide incomplete uploads
+		if strings.HasSuffix(item.Name(), filePartSuffix) {
+			continue
+		}
+		info, err := item.Info()
+		if err != nil {
+			continue
+		}
+		response.Entries = append(response.Entries, newFileEntry(filepath.Join(dir, item.Name()), info))
+	}
+	sort.Slice(response.Entries, func(i, j int) bool {
+		if response.Entries[i].Dir != response.Entries[j].Dir {
+			return response.Entries[i].Dir
+		}
+		return strings.ToLower(response.Entries[i].Name) < strings.ToLower(response.Entries[j].Name)
+	})
+
+	response.Path = dir
+	return fc.sender.SendJSON(response)
+}
+
+func newFileEntry(path string, info os.FileInfo) fileEntry {
+	return fileEntry{
+		Name:    info.Name(),
+		Path:    path,
+		Dir:     info.IsDir(),
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixMilli(),
+		Mode:    info.Mode().String(),
+	}
+}
+
+// startDownload validates a download request and streams the file in the background.
+// A non-zero offset resumes a download the viewer already partly received.
+func (fc *fileChannel) startDownload(request fileMessage) error {
+	if fc.manager.isClosed() {
+		return fmt.Errorf("session is ending")
+	}
+
+	path, err := fc.manager.resolvePath(request.Path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		file.Close()
+		return fmt.Errorf("not a regular file")
+	}
+	if fc.manager.config.MaxDownloadSize > 0 && info.Size() > fc.manager.config.MaxDownloadSize {
+		file.Close()
+		return fmt.Errorf("file exceeds the maximum download size of %d bytes", fc.manager.config.MaxDownloadSize)
+	}
+	if request.Offset < 0 || request.Offset > info.Size() {
+		file.Close()
+		return fmt.Errorf("invalid resume offset %d", request.Offset)
+	}
+
+	fc.mu.Lock()
+	if _, busy := fc.downloads[request.ID]; busy {
+		fc.mu.Unlock()
+		file.Close()
+		return fmt.Errorf("transfer %d is already active", request.ID)
+	}
+	cancel := make(chan struct{})
+	fc.downloads[request.ID] = cancel
+	fc.mu.Unlock()
+
+	if err := fc.sender.SendJSON(fileMessage{
+		Type:   "download-start",
+		ID:     request.ID,
+		Path:   path,
+		Size:   info.Size(),
+		Offset: request.Offset,
+	}); err != nil {
+		fc.finishDownload(request.ID)
+		file.Close()
+		return err
+	}
+
+	go fc.streamDownload(request.ID, file, info.Size(), request.Offset, cancel)
+	return nil
+}
+
+// streamDownload sends file chunks from offset, then the SHA-256 of the whole file
+func (fc *fileChannel) streamDownload(id uint32, file *os.File, size, offset int64, cancel chan struct{}) {
+	defer file.Close()
+	defer fc.finishDownload(id)
+
+	started := time.Now()
+	digest := sha256.New()
+
+	// The checksum covers the whole file, so a resumed download hashes the part the viewer already has
+	if offset > 0 {
+		if _, err := io.CopyN(digest, file, offset); err != nil {
+			sendFileError(fc.sender, id, fmt.Errorf("failed to read file: %w", err))
+			return
+		}
+	}
+
+	buf := make([]byte, fileChunkHeaderSize+fileChunkSize)
+	position := offset
+	for position < size {
+		select {
+		case <-cancel:
+			log.Printf("[FileTransfer] Download %d cancelled at %d/%d bytes", id, position, size)
+			return
+		default:
+		}
+
+		n, err := file.Read(buf[fileChunkHeaderSize:])
+		if n > 0 {
+			digest.Write(buf[fileChunkHeaderSize : fileChunkHeaderSize+n])
+			binary.BigEndian.PutUint32(buf[0:4], id)
+			binary.BigEndian.PutUint64(buf[4:12], uint64(position))
+
+			// Send blocks while the channel's buffered amount is above the high-water mark
+			if err := fc.sender.Send(append([]byte(nil), buf[:fileChunkHeaderSize+n]...)); err != nil {
+				log.Printf("[FileTransfer] Download %d interrupted at %d/%d bytes: %v", id, position, size, err)
+				return
+			}
+			position += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			sendFileError(fc.sender, id, fmt.Errorf("failed to read file: %w", err))
+			return
+		}
+	}
+
+	checksum := hex.EncodeToString(digest.Sum(nil))
+	log.Printf("[FileTransfer] Download %d complete: %d bytes in %v (sha256 %s)",
+		id, position-offset, time.Since(started).Round(time.Millisecond), checksum)
+
+	if err := fc.sender.SendJSON(fileMessage{Type: "download-complete", ID: id, Size: position, SHA256: checksum}); err != nil {
+		log.Printf("[FileTransfer] Failed to send download completion: %v", err)
+	}
+}
+
+func (fc *fileChannel) finishDownload(id uint32) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	delete(fc.downloads, id)
+}
+
+// startUpload prepares the part file for an upload and tells the viewer where to (re)start.
+// Part files are named after the expected checksum so only the same content is resumed.
+func (fc *fileChannel) startUpload(request fileMessage) error {
+	if fc.manager.isClosed() {
+		return fmt.Errorf("session is ending")
+	}
+
+	expected := strings.ToLower(request.SHA256)
+	if decoded, err := hex.DecodeString(expected); err != nil || len(decoded) != sha256.Size {
+		return fmt.Errorf("upload requires the file's sha256")
+	}
+	if request.Size < 0 {
+		return fmt.Errorf("invalid size %d", request.Size)
+	}
+	if fc.manager.config.MaxUploadSize > 0 && request.Size > fc.manager.config.MaxUploadSize {
+		return fmt.Errorf("file exceeds the maximum upload size of %d bytes", fc.manager.config.MaxUploadSize)
+	}
+
+	path, err := fc.manager.resolvePath(request.Path)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("destination is a directory")
+		}
+		if !request.Overwrite {
+			return fmt.Errorf("destination already exists")
+		}
+	}
+
+	partPath := fmt.Sprintf("%s.%s%s", path, expected[:16], filePartSuffix)
+	file, err := openPartFile(partPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	// Resume from whatever is already on disk, re-hashing it so the final check covers the whole file
+	digest := sha256.New()
+	offset, err := io.Copy(digest, file)
+	if err == nil && offset > request.Size {
+		// Stale part file larger than the upload; start over
+		offset = 0
+		digest.Reset()
+		err = file.Truncate(0)
+	}
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to prepare file: %w", err)
+	}
+
+	upload := &fileUpload{
+		path:     path,
+		partPath: partPath,
+		size:     request.Size,
+		offset:   offset,
+		expected: expected,
+		file:     file,
+		hash:     digest,
+		acked:    offset,
+	}
+
+	fc.mu.Lock()
+	if previous, busy := fc.uploads[request.ID]; busy {
+		previous.file.Close()
+	}
+	fc.uploads[request.ID] = upload
+	fc.mu.Unlock()
+
+	if offset > 0 {
+		log.Printf("[FileTransfer] Resuming upload %d to %s at %d/%d bytes", request.ID, path, offset, request.Size)
+	} else {
+		log.Printf("[FileTransfer] Upload %d to %s started (%d bytes)", request.ID, path, request.Size)
+	}
+
+	if err := fc.sender.SendJSON(fileMessage{Type: "upload-ready", ID: request.ID, Path: path, Size: request.Size, Offset: offset}); err != nil {
+		return err
+	}
+
+	if offset == request.Size {
+		return fc.completeUpload(request.ID, upload)
+	}
+	return nil
+}
+
+// handleChunk writes one binary upload chunk; chunks must arrive in order
+func (fc *fileChannel) handleChunk(data []byte) {
+	if len(data) < fileChunkHeaderSize {
+		log.Printf("[FileTransfer] Ignoring short chunk (%d bytes)", len(data))
+		return
+	}
+
+	id := binary.BigEndian.Uint32(data[0:4])
+	offset := int64(binary.BigEndian.Uint64(data[4:12]))
+	payload := data[fileChunkHeaderSize:]
+
+	fc.mu.Lock()
+	upload, ok := fc.uploads[id]
+	fc.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	var err error
+	switch {
+	case offset != upload.offset:
+		err = fmt.Errorf("unexpected chunk offset %d (expected %d)", offset, upload.offset)
+	case upload.offset+int64(len(payload)) > upload.size:
+		err = fmt.Errorf("upload exceeds the declared size of %d bytes", upload.size)
+	default:
+		if _, err = upload.file.Write(payload); err == nil {
+			upload.hash.Write(payload)
+			upload.offset += int64(len(payload))
+		}
+	}
+	if err != nil {
+		fc.abortUpload(id)
+		sendFileError(fc.sender, id, err)
+		return
+	}
+
+	if upload.offset == upload.size {
+		if err := fc.completeUpload(id, upload); err != nil {
+			sendFileError(fc.sender, id, err)
+		}
+		return
+	}
+
+	if upload.offset-upload.acked >= fileProgressInterval {
+		upload.acked = upload.offset
+		if err := fc.sender.SendJSON(fileMessage{Type: "upload-progress", ID: id, Offset: upload.offset}); err != nil {
+			log.Printf("[FileTransfer] Failed to send upload progress: %v", err)
+		}
+	}
+}
+
+// completeUpload verifies the checksum and moves the part file into place
+func (fc *fileChannel) completeUpload(id uint32, upload *fileUpload) error {
+	fc.mu.Lock()
+	delete(fc.uploads, id)
+	fc.mu.Unlock()
+
+	closeErr := upload.file.Close()
+
+	checksum := hex.EncodeToString(upload.hash.Sum(nil))
+	if checksum != upload.expected {
+		os.Remove(upload.partPath)
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", upload.expected, checksum)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to write file: %w", closeErr)
+	}
+	if err := os.Rename(upload.partPath, upload.path); err != nil {
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+
+	log.Printf("[FileTransfer] Upload %d complete: %s (%d bytes, sha256 verified)", id, upload.path, upload.size)
+	return fc.sender.SendJSON(fileMessage{Type: "upload-complete", ID: id, Path: upload.path, Size: upload.size, SHA256: checksum})
+}
+
+// abortUpload drops an upload after a protocol error; the part file is discarded
+func (fc *fileChannel) abortUpload(id uint32) {
+	fc.mu.Lock()
+	upload, ok := fc.uploads[id]
+	delete(fc.uploads, id)
+	fc.mu.Unlock()
+
+	if ok {
+		upload.file.Close()
+		os.Remove(upload.partPath)
+	}
+}
+
+// cancel stops a download or pauses an upload (its part file is kept for resuming)
+func (fc *fileChannel) cancel(id uint32) {
+	fc.mu.Lock()
+	if stop, ok := fc.downloads[id]; ok {
+		close(stop)
+		delete(fc.downloads, id)
+	}
+	if upload, ok := fc.uploads[id]; ok {
+		upload.file.Close()
+		delete(fc.uploads, id)
+	}
+	fc.mu.Unlock()
+
+	if err := fc.sender.SendJSON(fileMessage{Type: "cancelled", ID: id}); err != nil {
+		log.Printf("[FileTransfer] Failed to send cancel confirmation: %v", err)
+	}
+}
+
+// abortAll stops every transfer; part files are kept so uploads can resume after reconnecting
+func (fc *fileChannel) abortAll() {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	for id, stop := range fc.downloads {
+		close(stop)
+		delete(fc.downloads, id)
+	}
+	for id, upload := range fc.uploads {
+		upload.file.Close()
+		delete(fc.uploads, id)
+	}
+}
+
+// SetPaused aborts running transfers when the user pauses the session and refuses
+// new requests until it is resumed; part files stay so uploads can resume
+func (fm *fileTransferManager) SetPaused(paused bool) {
+	if !fm.pause.set(paused) || !paused {
+		return
+	}
+
+	fm.mu.Lock()
+	channels := make([]*fileChannel, 0, len(fm.channels))
+	for fc := range fm.channels {
+		channels = append(channels, fc)
+	}
+	fm.mu.Unlock()
+
+	for _, fc := range channels {
+		fc.abortAll()
+	}
+}
+
+// Close stops all transfers when the session ends
+func (fm *fileTransferManager) Close() {
+	fm.mu.Lock()
+	fm.closed = true
+	channels := fm.channels
+	fm.channels = make(map[*fileChannel]struct{})
+	fm.mu.Unlock()
+
+	for fc := range channels {
+		fc.abortAll()
+	}
+}
+
+func sendFileError(sender *dataChannelSender, id uint32, err error) {
+	if sendErr := sender.SendJSON(fileMessage{Type: "error", ID: id, Error: err.Error()}); sendErr != nil {
+		log.Printf("[FileTransfer] Failed to send error: %v", sendErr)
+	}
+}
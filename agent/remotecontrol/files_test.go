@@ -0,0 +1,146 @@
+package remotecontrol
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPathWithinRoot(t *testing.T) {
+	root := filepath.FromSlash("/srv/data")
+
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{"/srv/data", true},
+		{"/srv/data/report.pdf", true},
+		{"/srv/data/sub/dir", true},
+		{"/srv/data/..hidden", true},
+		{"/srv", false},
+		{"/srv/database", false},
+		{"/srv/data/../etc/passwd", false},
+		{"/etc/passwd", false},
+	}
+
+	for _, tc := range cases {
+		path := filepath.Clean(filepath.FromSlash(tc.path))
+		if got := pathWithinRoot(path, root); got != tc.want {
+			t.Errorf("pathWithinRoot(%q, %q) = %v, want %v", path, root, got, tc.want)
+		}
+	}
+}
+
+// symlinkOrSkip creates a symlink, skipping the test where that is not allowed
+func symlinkOrSkip(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not available: %v", err)
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "sub"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "sub", "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	symlinkOrSkip(t, filepath.Join(outside, "secret.txt"), filepath.Join(root, "secret-link"))
+	symlinkOrSkip(t, outside, filepath.Join(root, "outside-dir"))
+	symlinkOrSkip(t, filepath.Join(root, "sub"), filepath.Join(root, "sub-link"))
+
+	fm := newFileTransferManager(FileTransferConfig{Roots: []string{root}})
+
+	cases := []struct {
+		name    string
+		path    string
+		allowed bool
+	}{
+		{"root itself", root, true},
+		{"existing file", filepath.Join(root, "sub", "notes.txt"), true},
+		{"new file", filepath.Join(root, "sub", "upload.bin"), true},
+		{"symlink inside the root", filepath.Join(root, "sub-link", "notes.txt"), true},
+		{"dot-dot out of the root", root + string(filepath.Separator) + filepath.Join("..", "outside", "secret.txt"), false},
+		{"dot-dot back into the root", filepath.Join(root, "sub") + string(filepath.Separator) + filepath.Join("..", "sub", "notes.txt"), true},
+		{"parent of the root", base, false},
+		{"symlinked file pointing outside", filepath.Join(root, "secret-link"), false},
+		{"new file under a symlinked directory pointing outside", filepath.Join(root, "outside-dir", "upload.bin"), false},
+		{"relative path", filepath.Join("sub", "notes.txt"), false},
+		{"empty path", "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resolved, err := fm.resolvePath(tc.path)
+			if tc.allowed {
+				if err != nil {
+					t.Fatalf("resolvePath(%q) refused: %v", tc.path, err)
+				}
+				if !strings.HasPrefix(resolved, fm.roots[0]) {
+					t.Errorf("resolvePath(%q) = %q, outside root %q", tc.path, resolved, fm.roots[0])
+				}
+			} else if err == nil {
+				t.Errorf("resolvePath(%q) = %q, want an error", tc.path, resolved)
+			}
+		})
+	}
+}
+
+func TestOpenPartFileRefusesSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "victim")
+	if err := os.WriteFile(target, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	part := filepath.Join(dir, "upload.bin.0123456789abcdef.part")
+	symlinkOrSkip(t, target, part)
+
+	if file, err := openPartFile(part); err == nil {
+		file.Close()
+		t.Fatal("openPartFile followed a symlink")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "original" {
+		t.Errorf("symlink target changed to %q", data)
+	}
+
+	// A dangling symlink must not be created through either
+	dangling := filepath.Join(dir, "dangling.part")
+	symlinkOrSkip(t, filepath.Join(dir, "created-through-link"), dangling)
+	if file, err := openPartFile(dangling); err == nil {
+		file.Close()
+		t.Fatal("openPartFile followed a dangling symlink")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "created-through-link")); !os.IsNotExist(err) {
+		t.Error("file created through a dangling symlink")
+	}
+}
+
+func TestOpenPartFileResumes(t *testing.T) {
+	part := filepath.Join(t.TempDir(), "upload.bin.0123456789abcdef.part")
+
+	file, err := openPartFile(part)
+	if err != nil {
+		t.Fatalf("creating part file: %v", err)
+	}
+	file.WriteString("first chunk")
+	file.Close()
+
+	file, err = openPartFile(part)
+	if err != nil {
+		t.Fatalf("reopening part file: %v", err)
+	}
+	defer file.Close()
+	if info, _ := file.Stat(); info.Size() != int64(len("first chunk")) {
+		t.Errorf("resumed part file has %d bytes, want %d", info.Size(), len("first chunk"))
+	}
+}
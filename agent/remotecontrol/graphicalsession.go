@@ -0,0 +1,309 @@
+package remotecontrol
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// graphicalSessionPollInterval is how often sessions are re-discovered during a session
+const graphicalSessionPollInterval = 5 * time.Second
+
+// GraphicalSession is a desktop session on the host that capture and input can attach to
+type GraphicalSession struct {
+	ID         string `json:"id"`                // logind session ID, or "x11-N" for an X display without one
+	User       string `json:"user,omitempty"`    // Account the session belongs to
+	Seat       string `json:"seat,omitempty"`    // e.g. seat0 (empty for remote and headless sessions)
+	TTY        string `json:"tty,omitempty"`     // Virtual terminal the session runs on
+	Type       string `json:"type"`              // x11 or wayland
+	Class      string `json:"class,omitempty"`   // user, or greeter for a login screen
+	Display    string `json:"display,omitempty"` // X display, e.g. ":0"
+	Active     bool   `json:"active"`            // In the foreground of its seat
+	Remote     bool   `json:"remote"`            // Logged in over the network (XDMCP, RDP, ...)
+	Attachable bool   `json:"attachable"`        // Capture and input can attach to it
+	Reason     string `json:"reason,omitempty"`  // Why the session cannot be attached
+
+	xauthority string // Cookie file for Display (empty = none found)
+}
+
+// x11Display is the X display capture and input connect to for the session
+func (gs GraphicalSession) x11Display() X11Display {
+	return X11Display{Display: gs.Display, XAuthority: gs.xauthority}
+}
+
+// findGraphicalSession returns the session with the given ID or X display
+func findGraphicalSession(sessions []GraphicalSession, selector string) (GraphicalSession, error) {
+	for _, gs := range sessions {
+		if gs.ID == selector || (gs.Display != "" && gs.Display == selector) {
+			return gs, nil
+		}
+	}
+	return GraphicalSession{}, fmt.Errorf("graphical session %s not found", selector)
+}
+
+// defaultGraphicalSession picks the session to attach when none was requested: the
+// foreground local session, then any foreground session, then any user session
+func defaultGraphicalSession(sessions []GraphicalSession) (GraphicalSession, bool) {
+	preferences := []func(GraphicalSession) bool{
+		func(gs GraphicalSession) bool { return gs.Active && gs.Seat == "seat0" && !gs.Remote },
+		func(gs GraphicalSession) bool { return gs.Active },
+		func(gs GraphicalSession) bool { return gs.Class != "greeter" },
+		func(gs GraphicalSession) bool { return true },
+	}
+	for _, preferred := range preferences {
+		for _, gs := range sessions {
+			if gs.Attachable && preferred(gs) {
+				return gs, true
+			}
+		}
+	}
+	return GraphicalSession{}, false
+}
+
+// graphicalSessionsMessage reports the discovered sessions to the viewer
+type graphicalSessionsMessage struct {
+	Type     string             `json:"type"`
+	Sessions []GraphicalSession `json:"sessions"`
+	ActiveID string             `json:"activeId,omitempty"` // Session capture and input are attached to
+	Follow   bool               `json:"follow"`             // Attachment follows the foreground session
+	Error    string             `json:"error,omitempty"`
+}
+
+// graphicalSessions keeps a remote control session's capture, input and window
+// redaction attached to one graphical session on a multi-user host
+type graphicalSessions struct {
+	capture   *ScreenCapture
+	input     *InputHandler
+	redaction *RedactionPolicy
+
+	mu       sync.Mutex
+	sessions []GraphicalSession
+	attached *GraphicalSession
+	follow   bool // Chosen automatically: move along when another session comes to the foreground
+	notify   func(graphicalSessionsMessage)
+}
+
+func newGraphicalSessions(capture *ScreenCapture, input *InputHandler, redaction *RedactionPolicy) *graphicalSessions {
+	return &graphicalSessions{capture: capture, input: input, redaction: redaction}
+}
+
+// SetNotifier registers where session reports are sent (the viewer's control channel)
+func (g *graphicalSessions) SetNotifier(notify func(graphicalSessionsMessage)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.notify = notify
+}
+
+// Attach discovers sessions and attaches to the one matching selector (an ID or X
+// display); an empty selector picks the foreground session and follows it
+func (g *graphicalSessions) Attach(selector string) error {
+	sessions, err := discoverGraphicalSessions()
+	if err != nil {
+		return fmt.Errorf("failed to discover graphical sessions: %w", err)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sessions = sessions
+
+	if selector == "" {
+		g.follow = true
+		gs, ok := defaultGraphicalSession(sessions)
+		if !ok {
+			return fmt.Errorf("no graphical session to attach to (%d found)", len(sessions))
+		}
+		return g.attachLocked(gs)
+	}
+
+	gs, err := findGraphicalSession(sessions, selector)
+	if err != nil {
+		return err
+	}
+	if err := g.attachLocked(gs); err != nil {
+		return err
+	}
+	g.follow = false
+	return nil
+}
+
+// attachLocked points capture, input and window redaction at a session; g.mu must be held
+func (g *graphicalSessions) attachLocked(gs GraphicalSession) error {
+	if !gs.Attachable {
+		return fmt.Errorf("graphical session %s cannot be attached: %s", gs.ID, gs.Reason)
+	}
+	if g.attached != nil && g.attached.ID == gs.ID && g.attached.x11Display() == gs.x11Display() {
+		g.attached = &gs
+		return nil
+	}
+
+	display := gs.x11Display()
+	if err := g.capture.SwitchX11Display(display); err != nil {
+		return err
+	}
+	if err := g.input.SetX11Display(display); err != nil {
+		log.Printf("[GraphicalSession] Warning: Failed to set up input on %s: %v", display.Display, err)
+	}
+	if g.redaction != nil && g.redaction.hasWindowRules() {
+		previous := g.capture.GetRedactor()
+		g.capture.SetRedactor(newRedactorOnDisplay(*g.redaction, display))
+		if previous != nil {
+			previous.Close()
+		}
+	}
+
+	g.attached = &gs
+	log.Printf("[GraphicalSession] Attached to session %s (%s on %s, user %s)", gs.ID, gs.Type, gs.Display, gs.User)
+	return nil
+}
+
+// Switch attaches to another session at the viewer's request ("" = follow the foreground session)
+func (g *graphicalSessions) Switch(selector string) error {
+	err := g.Attach(selector)
+	if err != nil {
+		log.Printf("[GraphicalSession] Failed to switch to %q: %v", selector, err)
+	}
+	g.report(err)
+	return err
+}
+
+// Refresh re-discovers sessions and reports them to the viewer
+func (g *graphicalSessions) Refresh() {
+	sessions, err := discoverGraphicalSessions()
+	if err == nil {
+		g.mu.Lock()
+		g.sessions = sessions
+		g.mu.Unlock()
+	}
+	g.report(err)
+}
+
+// watch re-discovers sessions until ctx ends: changes are reported, a followed
+// attachment moves to the new foreground session, and an explicit one that ended
+// falls back to following
+func (g *graphicalSessions) watch(ctx context.Context) {
+	ticker := time.NewTicker(graphicalSessionPollInterval)
+	defer ticker.Stop()
+
+	lastErr := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sessions, err := discoverGraphicalSessions()
+		if err != nil {
+			if err.Error() != lastErr {
+				log.Printf("[GraphicalSession] Failed to discover graphical sessions: %v", err)
+			}
+			lastErr = err.Error()
+			continue
+		}
+		lastErr = ""
+
+		g.mu.Lock()
+		changed := !reflect.DeepEqual(sessions, g.sessions)
+		g.sessions = sessions
+
+		var attachErr error
+		if g.attached != nil && !g.follow {
+			if current, err := findGraphicalSession(sessions, g.attached.ID); err == nil && current.Attachable {
+				attachErr = g.attachLocked(current)
+			} else {
+				log.Printf("[GraphicalSession] Session %s ended, following the foreground session", g.attached.ID)
+				g.follow = true
+			}
+		}
+		if g.follow {
+			if next, ok := defaultGraphicalSession(sessions); ok {
+				attachErr = g.attachLocked(next)
+			}
+		}
+		g.mu.Unlock()
+
+		if attachErr != nil {
+			log.Printf("[GraphicalSession] Failed to follow session change: %v", attachErr)
+		}
+		if changed || attachErr != nil {
+			g.report(attachErr)
+		}
+	}
+}
+
+// report sends the current sessions and attachment to the viewer
+func (g *graphicalSessions) report(err error) {
+	g.mu.Lock()
+	message := graphicalSessionsMessage{
+		Type:     "graphical-sessions",
+		Sessions: g.sessions,
+		Follow:   g.follow,
+	}
+	if g.attached != nil {
+		message.ActiveID = g.attached.ID
+	}
+	if err != nil {
+		message.Error = err.Error()
+	}
+	notify := g.notify
+	g.mu.Unlock()
+
+	if message.Sessions == nil {
+		message.Sessions = []GraphicalSession{}
+	}
+	if notify != nil {
+		notify(message)
+	}
+}
+
+// SetGraphicalSessions lets the viewer list and switch graphical sessions (nil = not offered)
+func (wp *WebRTCPeer) SetGraphicalSessions(sessions *graphicalSessions) {
+	wp.mu.Lock()
+	wp.graphical = sessions
+	wp.mu.Unlock()
+
+	if sessions != nil {
+		sessions.SetNotifier(func(message graphicalSessionsMessage) {
+			if err := wp.sendDataChannelMessage(message); err != nil {
+				log.Printf("[WebRTCPeer] Failed to send graphical sessions: %v", err)
+			}
+		})
+	}
+}
+
+func (wp *WebRTCPeer) getGraphicalSessions() *graphicalSessions {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+	return wp.graphical
+}
+
+// sendGraphicalSessions reports the host's graphical sessions when the viewer connects
+func (wp *WebRTCPeer) sendGraphicalSessions() {
+	if sessions := wp.getGraphicalSessions(); sessions != nil {
+		sessions.report(nil)
+	}
+}
+
+// handleGraphicalSessionMessage lists sessions ("graphical-sessions") or switches
+// to another one ("graphical-session" with an id; an empty id follows the foreground)
+func (wp *WebRTCPeer) handleGraphicalSessionMessage(msgType string, message map[string]interface{}) error {
+	sessions := wp.getGraphicalSessions()
+	if sessions == nil {
+		wp.sendDataChannelMessage(graphicalSessionsMessage{
+			Type:     "graphical-sessions",
+			Sessions: []GraphicalSession{},
+			Error:    "graphical session selection is not available for this session",
+		})
+		return fmt.Errorf("graphical session selection is not available")
+	}
+
+	if msgType == "graphical-sessions" {
+		sessions.Refresh()
+		return nil
+	}
+	id, _ := message["id"].(string)
+	return sessions.Switch(id)
+}
@@ -0,0 +1,338 @@
+//go:build linux
+// +build linux
+
+package remotecontrol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// logindSessionProperties are the loginctl show-session properties discovery reads
+var logindSessionProperties = []string{"Id", "Name", "Seat", "TTY", "Display", "Type", "Class", "Active", "Remote", "State", "Scope"}
+
+// x11ServerBinaries are X servers whose command line names their display and
+// cookie file; true marks Xwayland, whose display belongs to a Wayland session
+var x11ServerBinaries = map[string]bool{
+	"X": false, "Xorg": false, "Xvfb": false, "Xvnc": false, "Xtigervnc": false, "Xephyr": false,
+	"Xwayland": true,
+}
+
+// sessionProcess is a process as far as session discovery cares about it
+type sessionProcess struct {
+	pid   int
+	uid   int
+	scope string // logind session scope from the cgroup, e.g. session-3.scope
+	args  []string
+}
+
+func isGraphicalSessionDiscoverySupported() bool {
+	return true
+}
+
+// discoverGraphicalSessions lists logind's graphical sessions, then X displays
+// that belong to none of them (Xvfb, VNC servers, hosts without systemd)
+func discoverGraphicalSessions() ([]GraphicalSession, error) {
+	processes := listSessionProcesses()
+
+	sessions, logindErr := logindGraphicalSessions(processes)
+	sessions = append(sessions, unclaimedX11Displays(sessions, processes)...)
+	if len(sessions) == 0 && logindErr != nil && !errors.Is(logindErr, exec.ErrNotFound) {
+		return nil, logindErr
+	}
+	return sessions, nil
+}
+
+// logindGraphicalSessions asks logind for x11 and wayland sessions and finds
+// their X display and cookie file in the session's processes
+func logindGraphicalSessions(processes []sessionProcess) ([]GraphicalSession, error) {
+	logindSessions, err := listLogindSessions(logindSessionProperties...)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []GraphicalSession
+	for _, properties := range logindSessions {
+		if properties["State"] == "closing" {
+			continue
+		}
+		switch properties["Type"] {
+		case "x11", "wayland", "mir":
+		default:
+			continue // tty, unspecified (ssh, cron) and manager sessions have no display
+		}
+
+		gs := GraphicalSession{
+			ID:      properties["Id"],
+			User:    properties["Name"],
+			Seat:    properties["Seat"],
+			TTY:     properties["TTY"],
+			Type:    properties["Type"],
+			Class:   properties["Class"],
+			Display: properties["Display"],
+			Active:  properties["Active"] == "yes",
+			Remote:  properties["Remote"] == "yes",
+		}
+		findSessionDisplay(&gs, properties["Scope"], processes)
+
+		switch {
+		case gs.Type != "x11":
+			gs.Reason = gs.Type + " sessions cannot be captured; log in with an X11 session"
+		case gs.Display == "":
+			gs.Reason = "no X display found for the session"
+		default:
+			gs.Attachable = true
+		}
+		sessions = append(sessions, gs)
+	}
+	return sessions, nil
+}
+
+// listLogindSessions reads the given show-session properties of every logind session
+// (nil when there are none); power actions and session discovery share it
+func listLogindSessions(properties ...string) ([]map[string]string, error) {
+	output, err := exec.Command("loginctl", "list-sessions", "--no-legend").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list logind sessions: %w", err)
+	}
+	var ids []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			ids = append(ids, fields[0])
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := append([]string{"show-session"}, ids...)
+	for _, property := range properties {
+		args = append(args, "-p", property)
+	}
+	output, err = exec.Command("loginctl", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logind sessions: %w", err)
+	}
+	return parseLogindSessions(output), nil
+}
+
+// parseLogindSessions splits loginctl show-session output into one property map per session
+func parseLogindSessions(output []byte) []map[string]string {
+	var sessions []map[string]string
+	for _, block := range strings.Split(string(output), "\n\n") {
+		properties := make(map[string]string)
+		for _, line := range strings.Split(block, "\n") {
+			if key, value, ok := strings.Cut(line, "="); ok {
+				properties[key] = value
+			}
+		}
+		if properties["Id"] != "" {
+			sessions = append(sessions, properties)
+		}
+	}
+	return sessions
+}
+
+// findSessionDisplay fills in the X display and cookie file of a logind session from
+// its X server's command line and its clients' environment
+func findSessionDisplay(gs *GraphicalSession, scope string, processes []sessionProcess) {
+	if scope == "" {
+		return
+	}
+
+	// An X server inside the session (startx, GDM) names its cookie file with -auth
+	for _, p := range processes {
+		if p.scope != scope {
+			continue
+		}
+		display, auth, xwayland, ok := x11ServerArgs(p.args)
+		if !ok || xwayland != (gs.Type == "wayland") {
+			continue
+		}
+		if gs.Display == "" {
+			gs.Display = display
+		}
+		if auth != "" && (display == "" || display == gs.Display) {
+			gs.xauthority = auth
+		}
+	}
+
+	// Clients got DISPLAY and XAUTHORITY from the session
+	for _, p := range processes {
+		if gs.Display != "" && gs.xauthority != "" {
+			break
+		}
+		if p.scope != scope {
+			continue
+		}
+		env := processEnv(p.pid, "DISPLAY", "XAUTHORITY")
+		if env["DISPLAY"] == "" {
+			continue
+		}
+		if gs.Display == "" {
+			gs.Display = env["DISPLAY"]
+		}
+		if gs.xauthority == "" && env["DISPLAY"] == gs.Display {
+			gs.xauthority = env["XAUTHORITY"]
+		}
+	}
+
+	if gs.xauthority == "" && gs.User != "" {
+		if account, err := user.Lookup(gs.User); err == nil {
+			if path := filepath.Join(account.HomeDir, ".Xauthority"); fileExists(path) {
+				gs.xauthority = path
+			}
+		}
+	}
+}
+
+// unclaimedX11Displays reports running X servers whose display no logind session owns
+func unclaimedX11Displays(claimed []GraphicalSession, processes []sessionProcess) []GraphicalSession {
+	entries, err := os.ReadDir("/tmp/.X11-unix")
+	if err != nil {
+		return nil
+	}
+
+	owned := make(map[int]bool)
+	for _, gs := range claimed {
+		if number, ok := localDisplayNumber(gs.Display); ok {
+			owned[number] = true
+		}
+	}
+
+	var sessions []GraphicalSession
+	for _, entry := range entries {
+		number, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "X"))
+		if err != nil || !strings.HasPrefix(entry.Name(), "X") || owned[number] {
+			continue
+		}
+		display := ":" + strconv.Itoa(number)
+
+		// Sockets of servers that are gone (or Xwayland's) are skipped
+		for _, p := range processes {
+			serverDisplay, auth, xwayland, ok := x11ServerArgs(p.args)
+			if !ok || serverDisplay != display {
+				continue
+			}
+			if xwayland {
+				break
+			}
+			gs := GraphicalSession{
+				ID:         fmt.Sprintf("x11-%d", number),
+				Type:       "x11",
+				Display:    display,
+				Attachable: true,
+				xauthority: auth,
+			}
+			if account, err := user.LookupId(strconv.Itoa(p.uid)); err == nil {
+				gs.User = account.Username
+			}
+			sessions = append(sessions, gs)
+			break
+		}
+	}
+	return sessions
+}
+
+// x11ServerArgs reads the display and -auth cookie file from an X server command line
+func x11ServerArgs(args []string) (display, auth string, xwayland, ok bool) {
+	if len(args) == 0 {
+		return "", "", false, false
+	}
+	xwayland, ok = x11ServerBinaries[filepath.Base(args[0])]
+	if !ok {
+		return "", "", false, false
+	}
+	for i, arg := range args[1:] {
+		if _, local := localDisplayNumber(arg); local && strings.HasPrefix(arg, ":") {
+			display = arg
+		}
+		if arg == "-auth" && i+2 < len(args) {
+			auth = args[i+2]
+		}
+	}
+	return display, auth, xwayland, true
+}
+
+// listSessionProcesses reads the command line, owner and logind scope of every process
+func listSessionProcesses() []sessionProcess {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	var processes []sessionProcess
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join("/proc", entry.Name())
+		info, err := os.Stat(dir)
+		if err != nil {
+			continue
+		}
+		cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue // Kernel threads have no command line
+		}
+		cgroup, _ := os.ReadFile(filepath.Join(dir, "cgroup"))
+
+		p := sessionProcess{
+			pid:   pid,
+			scope: logindScope(cgroup),
+			args:  strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00"),
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			p.uid = int(stat.Uid)
+		}
+		processes = append(processes, p)
+	}
+	return processes
+}
+
+// logindScope finds the session-N.scope a process's cgroup lies in
+func logindScope(cgroup []byte) string {
+	for _, line := range strings.Split(string(cgroup), "\n") {
+		for _, element := range strings.Split(line, "/") {
+			if strings.HasPrefix(element, "session-") && strings.HasSuffix(element, ".scope") {
+				return element
+			}
+		}
+	}
+	return ""
+}
+
+// processEnv returns the requested variables from a process's environment
+func processEnv(pid int, names ...string) map[string]string {
+	env := make(map[string]string)
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return env
+	}
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		key, value, ok := strings.Cut(string(entry), "=")
+		if !ok {
+			continue
+		}
+		for _, name := range names {
+			if key == name {
+				env[key] = value
+			}
+		}
+	}
+	return env
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
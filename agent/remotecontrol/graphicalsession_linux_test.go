@@ -0,0 +1,191 @@
+//go:build linux
+// +build linux
+
+package remotecontrol
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loginctlShowSessions is `loginctl show-session 2 3 7 -p ...` on a host with a GDM
+// greeter, a user's Xorg session and a closing Wayland session
+const loginctlShowSessions = `Id=2
+Name=gdm
+Seat=seat0
+TTY=tty1
+Display=
+Type=wayland
+Class=greeter
+Active=no
+Remote=no
+State=online
+Scope=session-2.scope
+
+Id=3
+Name=alice
+Seat=seat0
+TTY=tty2
+Display=:1
+Type=x11
+Class=user
+Active=yes
+Remote=no
+State=active
+Scope=session-3.scope
+
+Id=7
+Name=bob
+Seat=
+TTY=
+Display=
+Type=wayland
+Class=user
+Active=no
+Remote=yes
+State=closing
+Scope=session-7.scope
+`
+
+func TestParseLogindSessions(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		ids    []string
+	}{
+		{"three sessions", loginctlShowSessions, []string{"2", "3", "7"}},
+		{"empty", "", nil},
+		{"no trailing newline", "Id=4\nType=x11", []string{"4"}},
+		{"block without an id", "Name=ghost\nType=x11\n\nId=5\nType=tty\n", []string{"5"}},
+		{"value with equals sign", "Id=6\nDisplay=a=b\n", []string{"6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := parseLogindSessions([]byte(tt.output))
+			var ids []string
+			for _, properties := range sessions {
+				ids = append(ids, properties["Id"])
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("ids = %v, want %v", ids, tt.ids)
+			}
+		})
+	}
+
+	sessions := parseLogindSessions([]byte(loginctlShowSessions))
+	want := map[string]string{
+		"Id": "3", "Name": "alice", "Seat": "seat0", "TTY": "tty2", "Display": ":1", "Type": "x11",
+		"Class": "user", "Active": "yes", "Remote": "no", "State": "active", "Scope": "session-3.scope",
+	}
+	if !reflect.DeepEqual(sessions[1], want) {
+		t.Errorf("session 3 = %v, want %v", sessions[1], want)
+	}
+	if display, ok := sessions[0]["Display"]; !ok || display != "" {
+		t.Errorf("empty Display = %q, %t; want present and empty", display, ok)
+	}
+	if got := parseLogindSessions([]byte("Id=6\nDisplay=a=b\n"))[0]["Display"]; got != "a=b" {
+		t.Errorf("Display = %q, want a=b", got)
+	}
+}
+
+func TestX11ServerArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmdline  string // NUL-separated, as in /proc/PID/cmdline
+		display  string
+		auth     string
+		xwayland bool
+		ok       bool
+	}{
+		{
+			name:    "gdm Xorg",
+			cmdline: "/usr/lib/xorg/Xorg\x00vt2\x00-displayfd\x003\x00-auth\x00/run/user/1000/gdm/Xauthority\x00-nolisten\x00tcp\x00-background\x00none\x00-noreset\x00-keeptty\x00-novtswitch\x00-verbose\x003",
+			auth:    "/run/user/1000/gdm/Xauthority",
+			ok:      true,
+		},
+		{
+			name:    "lightdm Xorg",
+			cmdline: "/usr/lib/xorg/Xorg\x00-core\x00:0\x00-seat\x00seat0\x00-auth\x00/var/run/lightdm/root/:0\x00-nolisten\x00tcp\x00vt7\x00-novtswitch",
+			display: ":0",
+			auth:    "/var/run/lightdm/root/:0",
+			ok:      true,
+		},
+		{
+			name:    "Xvfb with screen",
+			cmdline: "Xvfb\x00:99\x00-screen\x000\x001920x1080x24",
+			display: ":99",
+			ok:      true,
+		},
+		{
+			name:    "Xtigervnc",
+			cmdline: "/usr/bin/Xtigervnc\x00:2\x00-desktop\x00host:2 (carol)\x00-auth\x00/home/carol/.Xauthority\x00-geometry\x001280x800",
+			display: ":2",
+			auth:    "/home/carol/.Xauthority",
+			ok:      true,
+		},
+		{
+			name:     "Xwayland",
+			cmdline:  "/usr/bin/Xwayland\x00:0\x00-rootless\x00-noreset\x00-accessx\x00-core\x00-auth\x00/run/user/1000/.mutter-Xwaylandauth.ABC123\x00-listenfd\x004",
+			display:  ":0",
+			auth:     "/run/user/1000/.mutter-Xwaylandauth.ABC123",
+			xwayland: true,
+			ok:       true,
+		},
+		{
+			name:    "trailing -auth without a file",
+			cmdline: "Xorg\x00:0\x00-auth",
+			display: ":0",
+			ok:      true,
+		},
+		{
+			name:    "remote display argument is not the server's",
+			cmdline: "Xephyr\x00-query\x00otherhost:0\x00:5",
+			display: ":5",
+			ok:      true,
+		},
+		{name: "X client", cmdline: "xterm\x00-display\x00:0"},
+		{name: "Xorg wrapper script", cmdline: "/usr/lib/xorg/Xorg.wrap\x00:0"},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var args []string
+			if tt.cmdline != "" {
+				args = strings.Split(tt.cmdline, "\x00")
+			}
+			display, auth, xwayland, ok := x11ServerArgs(args)
+			if display != tt.display || auth != tt.auth || xwayland != tt.xwayland || ok != tt.ok {
+				t.Errorf("x11ServerArgs = (%q, %q, %t, %t), want (%q, %q, %t, %t)",
+					display, auth, xwayland, ok, tt.display, tt.auth, tt.xwayland, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLogindScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		cgroup string
+		want   string
+	}{
+		{"cgroup v2 session", "0::/user.slice/user-1000.slice/session-3.scope\n", "session-3.scope"},
+		{"cgroup v2 user service", "0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-gnome-firefox-4242.scope\n", ""},
+		{
+			"cgroup v1 hybrid",
+			"12:pids:/user.slice/user-1000.slice/session-c2.scope\n11:cpu,cpuacct:/user.slice\n1:name=systemd:/user.slice/user-1000.slice/session-c2.scope\n0::/user.slice/user-1000.slice/session-c2.scope\n",
+			"session-c2.scope",
+		},
+		{"system service", "0::/system.slice/gdm.service\n", ""},
+		{"container root", "0::/\n", ""},
+		{"empty", "", ""},
+		{"session prefix without scope", "0::/user.slice/session-3.slice\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := logindScope([]byte(tt.cgroup)); got != tt.want {
+				t.Errorf("logindScope = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
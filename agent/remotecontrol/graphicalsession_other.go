@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package remotecontrol
+
+// Graphical session discovery is only available on Linux; other platforms capture
+// the console session
+func isGraphicalSessionDiscoverySupported() bool {
+	return false
+}
+
+func discoverGraphicalSessions() ([]GraphicalSession, error) {
+	return nil, nil
+}
@@ -0,0 +1,67 @@
+package remotecontrol
+
+import "testing"
+
+func TestDefaultGraphicalSession(t *testing.T) {
+	greeter := GraphicalSession{ID: "2", Class: "greeter", Seat: "seat0", Display: ":0", Attachable: true}
+	background := GraphicalSession{ID: "3", Class: "user", Seat: "seat0", Display: ":1", Attachable: true}
+	foreground := GraphicalSession{ID: "4", Class: "user", Seat: "seat0", Display: ":2", Active: true, Attachable: true}
+	remote := GraphicalSession{ID: "5", Class: "user", Display: ":10", Active: true, Remote: true, Attachable: true}
+	otherSeat := GraphicalSession{ID: "6", Class: "user", Seat: "seat1", Display: ":3", Active: true, Attachable: true}
+	wayland := GraphicalSession{ID: "7", Class: "user", Seat: "seat0", Type: "wayland", Active: true}
+
+	tests := []struct {
+		name     string
+		sessions []GraphicalSession
+		want     string // "" = none
+	}{
+		{"local foreground first", []GraphicalSession{remote, otherSeat, background, foreground}, "4"},
+		{"then any foreground", []GraphicalSession{background, remote, otherSeat}, "5"},
+		{"then a user session over the greeter", []GraphicalSession{greeter, background}, "3"},
+		{"greeter as last resort", []GraphicalSession{greeter}, "2"},
+		{"unattachable foreground is skipped", []GraphicalSession{wayland, background}, "3"},
+		{"nothing attachable", []GraphicalSession{wayland}, ""},
+		{"no sessions", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs, ok := defaultGraphicalSession(tt.sessions)
+			if ok != (tt.want != "") || gs.ID != tt.want {
+				t.Errorf("defaultGraphicalSession = %q, %t; want %q", gs.ID, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindGraphicalSession(t *testing.T) {
+	sessions := []GraphicalSession{
+		{ID: "3", Display: ":1"},
+		{ID: "7", Type: "wayland"},
+		{ID: "x11-99", Display: ":99"},
+	}
+	tests := []struct {
+		selector string
+		want     string // "" = not found
+	}{
+		{"3", "3"},
+		{":1", "3"},
+		{"x11-99", "x11-99"},
+		{":99", "x11-99"},
+		{"7", "7"},
+		{"", ""}, // A session without a display must not match an empty selector
+		{":0", ""},
+		{"8", ""},
+	}
+	for _, tt := range tests {
+		gs, err := findGraphicalSession(sessions, tt.selector)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("findGraphicalSession(%q) = %q, want not found", tt.selector, gs.ID)
+			}
+			continue
+		}
+		if err != nil || gs.ID != tt.want {
+			t.Errorf("findGraphicalSession(%q) = %q, %v; want %q", tt.selector, gs.ID, err, tt.want)
+		}
+	}
+}
@@ -2,19 +2,31 @@ package remotecontrol
 
 import (
 	"fmt"
+	"image"
 	"log"
 	"runtime"
+	"sync"
 )
 
 // InputHandler handles mouse and keyboard input injection
 type InputHandler struct {
 	injector PlatformInputInjector
+	mu       sync.RWMutex // Guards injector, which is replaced when the session changes display
+
+	encodedWidth  int // Last encoded resolution, carried over to a replacement injector
+	encodedHeight int
+
+	monitors     MultiMonitorInfo // Last monitor mapping, restored when window sharing ends
+	monitorIndex int
+	window       *CapturedWindow // Shared window input is confined to (nil = the monitor)
+	pointer      *image.Point    // Last accepted pointer position in the window, in encoded coordinates
 }
 
 // PlatformInputInjector is the platform-specific input injection interface
 type PlatformInputInjector interface {
 	Initialize() error
 	SetMonitorInfo(monitorIndex int, monitors MultiMonitorInfo) error
+	SetEncodedResolution(width, height int)
 	InjectMouseMove(x, y int) error
 	InjectMouseButton(button string, pressed bool) error
 	InjectMouseScroll(deltaX, deltaY int) error
@@ -48,29 +60,131 @@ func NewInputHandler() *InputHandler {
 
 // Initialize sets up the input handler
 func (ih *InputHandler) Initialize() error {
-	if ih.injector == nil {
+	injector := ih.current()
+	if injector == nil {
 		return fmt.Errorf("no input injector available for platform: %s", runtime.GOOS)
 	}
-	return ih.injector.Initialize()
+	return injector.Initialize()
 }
 
 // SetMonitorInfo updates the monitor configuration for coordinate mapping
 func (ih *InputHandler) SetMonitorInfo(monitorIndex int, monitors MultiMonitorInfo) error {
-	if ih.injector == nil {
+	ih.mu.Lock()
+	ih.monitorIndex, ih.monitors = monitorIndex, monitors
+	injector, window := ih.injector, ih.window
+	ih.mu.Unlock()
+	if injector == nil {
+		return fmt.Errorf("no input injector available")
+	}
+	if window != nil {
+		return ih.mapDesktop(injector, monitors)
+	}
+	return injector.SetMonitorInfo(monitorIndex, monitors)
+}
+
+// SetWindow confines input to a shared window (nil goes back to the monitor mapping).
+// Mouse coordinates then refer to the window's frame and are translated to the
+// desktop here, so the injector maps the whole desktop one to one
+func (ih *InputHandler) SetWindow(window *CapturedWindow) error {
+	ih.mu.Lock()
+	wasShared := ih.window != nil
+	if window != nil {
+		copied := *window
+		ih.window = &copied
+	} else {
+		ih.window = nil
+	}
+	ih.pointer = nil
+	injector := ih.injector
+	monitorIndex, monitors := ih.monitorIndex, ih.monitors
+	width, height := ih.encodedWidth, ih.encodedHeight
+	ih.mu.Unlock()
+
+	if injector == nil {
 		return fmt.Errorf("no input injector available")
 	}
-	return ih.injector.SetMonitorInfo(monitorIndex, monitors)
+	if window != nil {
+		return ih.mapDesktop(injector, monitors)
+	}
+	if !wasShared {
+		return nil
+	}
+	if width > 0 && height > 0 {
+		injector.SetEncodedResolution(width, height)
+	}
+	return injector.SetMonitorInfo(monitorIndex, monitors)
+}
+
+// mapDesktop makes the injector take desktop coordinates relative to the virtual
+// desktop's top-left corner, unscaled
+func (ih *InputHandler) mapDesktop(injector PlatformInputInjector, monitors MultiMonitorInfo) error {
+	if err := injector.SetMonitorInfo(-1, monitors); err != nil {
+		return err
+	}
+	if monitors.VirtualWidth > 0 && monitors.VirtualHeight > 0 {
+		injector.SetEncodedResolution(monitors.VirtualWidth, monitors.VirtualHeight)
+	}
+	return nil
+}
+
+// SetX11Display switches injection to an X display (a virtual or discovered session
+// display) through XTEST, replacing the platform injector
+func (ih *InputHandler) SetX11Display(display X11Display) error {
+	injector := newX11InputInjector(display)
+	if err := injector.Initialize(); err != nil {
+		return err
+	}
+	ih.mu.Lock()
+	previous := ih.injector
+	ih.injector = injector
+	if ih.window != nil {
+		ih.mapDesktop(injector, ih.monitors)
+	} else if ih.encodedWidth > 0 && ih.encodedHeight > 0 {
+		injector.SetEncodedResolution(ih.encodedWidth, ih.encodedHeight)
+	}
+	ih.mu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// current returns the injector in use (nil when the platform has none)
+func (ih *InputHandler) current() PlatformInputInjector {
+	ih.mu.RLock()
+	defer ih.mu.RUnlock()
+	return ih.injector
+}
+
+// SetEncodedResolution updates the video resolution that incoming mouse coordinates refer to
+func (ih *InputHandler) SetEncodedResolution(width, height int) {
+	ih.mu.Lock()
+	ih.encodedWidth, ih.encodedHeight = width, height
+	injector, window := ih.injector, ih.window
+	ih.mu.Unlock()
+	if injector == nil || window != nil {
+		return // A shared window is scaled here, not by the injector
+	}
+	injector.SetEncodedResolution(width, height)
 }
 
 // HandleMouseEvent processes a mouse event
 func (ih *InputHandler) HandleMouseEvent(event MouseEvent) error {
+	injector := ih.current()
+	if injector == nil {
+		return fmt.Errorf("no input injector available")
+	}
+	if window := ih.sharedWindow(); window != nil {
+		return ih.handleWindowMouseEvent(injector, *window, event)
+	}
 	switch event.Type {
 	case "move":
-		return ih.injector.InjectMouseMove(event.X, event.Y)
+		return injector.InjectMouseMove(event.X, event.Y)
 	case "button":
-		return ih.injector.InjectMouseButton(event.Button, event.Down)
+		return injector.InjectMouseButton(event.Button, event.Down)
 	case "scroll":
-		return ih.injector.InjectMouseScroll(event.DeltaX, event.DeltaY)
+		return injector.InjectMouseScroll(event.DeltaX, event.DeltaY)
 	default:
 		return fmt.Errorf("unknown mouse event type: %s", event.Type)
 	}
@@ -78,13 +192,129 @@ func (ih *InputHandler) HandleMouseEvent(event MouseEvent) error {
 
 // HandleKeyboardEvent processes a keyboard event
 func (ih *InputHandler) HandleKeyboardEvent(event KeyboardEvent) error {
-	return ih.injector.InjectKeyPress(event.Key, event.Down)
+	injector := ih.current()
+	if injector == nil {
+		return fmt.Errorf("no input injector available")
+	}
+	// Keys go wherever the focus is, so they are only sent while the shared window
+	// has it right now, and window manager shortcuts are not sent at all; releases
+	// always pass so no key stays stuck
+	if window := ih.sharedWindow(); window != nil && event.Down {
+		if isShortcutModifier(event.Key) {
+			return errInputOutsideWindow
+		}
+		checker, ok := injector.(windowFocusChecker)
+		if !ok {
+			return errInputOutsideWindow
+		}
+		focused, err := checker.WindowFocused(window.ID)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInputOutsideWindow, err)
+		}
+		if !focused {
+			return errInputOutsideWindow
+		}
+	}
+	return injector.InjectKeyPress(event.Key, event.Down)
+}
+
+// windowFocusChecker is implemented by injectors that can tell where keys would go
+type windowFocusChecker interface {
+	WindowFocused(id uint32) (bool, error)
+}
+
+// shortcutModifiers open window manager and desktop shortcuts (Super, Alt+Tab,
+// Alt+F2, Ctrl+Alt+T) that act outside a shared window; Ctrl and Shift stay for
+// the application's own shortcuts
+var shortcutModifiers = map[string]bool{
+	"Alt": true, "AltLeft": true, "AltRight": true,
+	"Meta": true, "MetaLeft": true, "MetaRight": true,
+	"OS": true, "OSLeft": true, "OSRight": true,
+	"Super": true, "Hyper": true,
+}
+
+func isShortcutModifier(key string) bool {
+	return shortcutModifiers[key]
+}
+
+func (ih *InputHandler) sharedWindow() *CapturedWindow {
+	ih.mu.RLock()
+	defer ih.mu.RUnlock()
+	return ih.window
+}
+
+// handleWindowMouseEvent injects a mouse event on the shared window; anything that
+// would land outside its visible part is rejected
+func (ih *InputHandler) handleWindowMouseEvent(injector PlatformInputInjector, window CapturedWindow, event MouseEvent) error {
+	switch event.Type {
+	case "move":
+		point, ok := ih.windowPoint(window, image.Pt(event.X, event.Y))
+		if !ok {
+			return errInputOutsideWindow
+		}
+		if err := injector.InjectMouseMove(point.X, point.Y); err != nil {
+			return err
+		}
+		ih.mu.Lock()
+		ih.pointer = &image.Point{X: event.X, Y: event.Y}
+		ih.mu.Unlock()
+		return nil
+	case "button", "scroll":
+		// Releases always pass so no button stays stuck
+		if event.Type == "button" && !event.Down {
+			return injector.InjectMouseButton(event.Button, false)
+		}
+		// The pointer may have been moved locally or the window moved since; put it
+		// back on the window first, and reject when that spot is no longer on it
+		ih.mu.RLock()
+		pointer := ih.pointer
+		ih.mu.RUnlock()
+		if pointer == nil {
+			return errInputOutsideWindow
+		}
+		point, ok := ih.windowPoint(window, *pointer)
+		if !ok {
+			return errInputOutsideWindow
+		}
+		if err := injector.InjectMouseMove(point.X, point.Y); err != nil {
+			return err
+		}
+		if event.Type == "button" {
+			return injector.InjectMouseButton(event.Button, true)
+		}
+		return injector.InjectMouseScroll(event.DeltaX, event.DeltaY)
+	default:
+		return fmt.Errorf("unknown mouse event type: %s", event.Type)
+	}
+}
+
+// windowPoint maps a point on the shared window's frame (in encoded coordinates) to
+// the injector's desktop coordinates; ok is false when it is not on the window's
+// visible part
+func (ih *InputHandler) windowPoint(window CapturedWindow, encoded image.Point) (image.Point, bool) {
+	ih.mu.RLock()
+	width, height := ih.encodedWidth, ih.encodedHeight
+	monitors := ih.monitors
+	ih.mu.RUnlock()
+	if width <= 0 || height <= 0 {
+		width, height = window.Width, window.Height
+	}
+	if width <= 0 || height <= 0 || !encoded.In(image.Rect(0, 0, width, height)) {
+		return image.Point{}, false
+	}
+
+	desktop := image.Pt(window.X+encoded.X*window.Width/width, window.Y+encoded.Y*window.Height/height)
+	if !window.accepts(desktop) {
+		return image.Point{}, false
+	}
+	return desktop.Sub(image.Pt(monitors.VirtualMinX, monitors.VirtualMinY)), true
 }
 
 // Close releases input handler resources
 func (ih *InputHandler) Close() {
-	if ih.injector != nil {
-		ih.injector.Close()
+	injector := ih.current()
+	if injector != nil {
+		injector.Close()
 	}
 }
 
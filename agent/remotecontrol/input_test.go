@@ -0,0 +1,168 @@
+package remotecontrol
+
+import (
+	"errors"
+	"image"
+	"reflect"
+	"testing"
+)
+
+// recordingInjector remembers the mapping it was given and the pointer moves
+type recordingInjector struct {
+	encoded image.Point
+	moves   []image.Point
+	keys    []string // Keys pressed
+}
+
+// focusInjector also reports which window has the input focus
+type focusInjector struct {
+	recordingInjector
+	focus uint32
+}
+
+func (f *focusInjector) WindowFocused(id uint32) (bool, error) {
+	return f.focus == id, nil
+}
+
+func (r *recordingInjector) Initialize() error                          { return nil }
+func (r *recordingInjector) SetMonitorInfo(int, MultiMonitorInfo) error { return nil }
+func (r *recordingInjector) SetEncodedResolution(width, height int) {
+	r.encoded = image.Pt(width, height)
+}
+func (r *recordingInjector) InjectMouseButton(string, bool) error { return nil }
+func (r *recordingInjector) InjectMouseScroll(int, int) error     { return nil }
+func (r *recordingInjector) InjectKeyPress(key string, down bool) error {
+	if down {
+		r.keys = append(r.keys, key)
+	}
+	return nil
+}
+func (r *recordingInjector) Close() error { return nil }
+func (r *recordingInjector) InjectMouseMove(x, y int) error {
+	r.moves = append(r.moves, image.Pt(x, y))
+	return nil
+}
+
+func TestWindowPoint(t *testing.T) {
+	monitors := MultiMonitorInfo{VirtualMinX: -1920, VirtualWidth: 3840, VirtualHeight: 1080}
+	window := CapturedWindow{X: 100, Y: 50, Width: 800, Height: 600, Visible: true,
+		obscured: []image.Rectangle{image.Rect(700, 550, 900, 650)}}
+
+	cases := []struct {
+		name    string
+		encoded image.Point // Encoder size the viewer's coordinates refer to
+		point   image.Point
+		want    image.Point // Relative to the virtual desktop's top-left corner
+		ok      bool
+	}{
+		{"origin at encoder size", image.Pt(1920, 1080), image.Pt(0, 0), image.Pt(2020, 50), true},
+		{"centre at encoder size", image.Pt(1920, 1080), image.Pt(960, 540), image.Pt(2420, 350), true},
+		{"bottom-right pixel, covered", image.Pt(1920, 1080), image.Pt(1919, 1079), image.Point{}, false},
+		{"bottom-left pixel", image.Pt(1920, 1080), image.Pt(0, 1079), image.Pt(2020, 649), true},
+		{"same size as the window", image.Pt(800, 600), image.Pt(400, 300), image.Pt(2420, 350), true},
+		{"outside the frame", image.Pt(1920, 1080), image.Pt(1920, 10), image.Point{}, false},
+		{"negative", image.Pt(1920, 1080), image.Pt(-1, 10), image.Point{}, false},
+		{"on the covered part", image.Pt(800, 600), image.Pt(650, 550), image.Point{}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ih := &InputHandler{injector: &recordingInjector{}}
+			ih.SetEncodedResolution(tc.encoded.X, tc.encoded.Y)
+			if err := ih.SetMonitorInfo(0, monitors); err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := ih.windowPoint(window, tc.point)
+			if ok != tc.ok || (ok && got != tc.want) {
+				t.Errorf("windowPoint(%v) = %v, %v; want %v, %v", tc.point, got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+func TestSetWindowKeepsEncodedResolution(t *testing.T) {
+	injector := &recordingInjector{}
+	ih := &InputHandler{injector: injector}
+	monitors := MultiMonitorInfo{VirtualWidth: 2560, VirtualHeight: 1440}
+	ih.SetMonitorInfo(0, monitors)
+	ih.SetEncodedResolution(1280, 720)
+
+	// Sharing a window maps the whole desktop one to one...
+	window := CapturedWindow{X: 0, Y: 0, Width: 2560, Height: 1440, Visible: true}
+	if err := ih.SetWindow(&window); err != nil {
+		t.Fatal(err)
+	}
+	if injector.encoded != image.Pt(2560, 1440) {
+		t.Errorf("injector resolution while sharing = %v, want the desktop", injector.encoded)
+	}
+	// ...while viewer coordinates are still scaled from the encoder size
+	if err := ih.HandleMouseEvent(MouseEvent{Type: "move", X: 640, Y: 360}); err != nil {
+		t.Fatal(err)
+	}
+	if last := injector.moves[len(injector.moves)-1]; last != image.Pt(1280, 720) {
+		t.Errorf("move to the centre of the frame injected at %v, want (1280,720)", last)
+	}
+
+	// Ending the share restores the encoder size on the injector
+	if err := ih.SetWindow(nil); err != nil {
+		t.Fatal(err)
+	}
+	if injector.encoded != image.Pt(1280, 720) {
+		t.Errorf("injector resolution after sharing = %v, want 1280x720", injector.encoded)
+	}
+}
+
+func TestSharedWindowKeyboardFocus(t *testing.T) {
+	injector := &focusInjector{focus: 7}
+	ih := &InputHandler{injector: injector}
+	// Focused as of the last frame, but the focus is looked up for each key
+	window := CapturedWindow{ID: 7, Width: 800, Height: 600, Visible: true, Focused: false}
+	if err := ih.SetWindow(&window); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ih.HandleKeyboardEvent(KeyboardEvent{Key: "a", Down: true}); err != nil {
+		t.Errorf("key on the focused window: %v", err)
+	}
+
+	// Alt+Tab moved the focus away between frames
+	injector.focus = 9
+	if err := ih.HandleKeyboardEvent(KeyboardEvent{Key: "b", Down: true}); !errors.Is(err, errInputOutsideWindow) {
+		t.Errorf("key after the focus moved = %v, want %v", err, errInputOutsideWindow)
+	}
+	// Releases always pass
+	if err := ih.HandleKeyboardEvent(KeyboardEvent{Key: "a", Down: false}); err != nil {
+		t.Errorf("key release: %v", err)
+	}
+
+	// Window manager shortcuts never reach the desktop
+	injector.focus = 7
+	for _, key := range []string{"Meta", "MetaLeft", "Alt", "AltLeft", "AltRight"} {
+		if err := ih.HandleKeyboardEvent(KeyboardEvent{Key: key, Down: true}); !errors.Is(err, errInputOutsideWindow) {
+			t.Errorf("%s while sharing a window = %v, want %v", key, err, errInputOutsideWindow)
+		}
+	}
+	for _, key := range []string{"Control", "Shift", "c"} {
+		if err := ih.HandleKeyboardEvent(KeyboardEvent{Key: key, Down: true}); err != nil {
+			t.Errorf("%s while sharing a window: %v", key, err)
+		}
+	}
+	if want := []string{"a", "Control", "Shift", "c"}; !reflect.DeepEqual(injector.keys, want) {
+		t.Errorf("keys pressed = %v, want %v", injector.keys, want)
+	}
+
+	// Injectors that cannot tell where keys go refuse them while a window is shared
+	plain := &recordingInjector{}
+	ih = &InputHandler{injector: plain}
+	ih.SetWindow(&window)
+	if err := ih.HandleKeyboardEvent(KeyboardEvent{Key: "a", Down: true}); !errors.Is(err, errInputOutsideWindow) {
+		t.Errorf("key without a focus check = %v, want %v", err, errInputOutsideWindow)
+	}
+
+	// The monitor takes every key
+	ih.SetWindow(nil)
+	if err := ih.HandleKeyboardEvent(KeyboardEvent{Key: "Meta", Down: true}); err != nil {
+		t.Errorf("Meta without a shared window: %v", err)
+	}
+}
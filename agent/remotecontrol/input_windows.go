@@ -6,6 +6,7 @@ package remotecontrol
 import (
 	"fmt"
 	"log"
+	"sync"
 	"syscall"
 	"unsafe"
 )
@@ -75,10 +76,11 @@ type INPUT_KEYBOARD struct {
 
 // WindowsInputInjector implements input injection for Windows using Windows API
 type WindowsInputInjector struct {
+	mu            sync.Mutex       // Guards the coordinate mapping, updated while input is injected
 	screenWidth   int32
 	screenHeight  int32
-	encodedWidth  int32            // Width of encoded video (always 1920)
-	encodedHeight int32            // Height of encoded video (always 1080)
+	encodedWidth  int32            // Width of encoded video (1920 unless changed by quality settings)
+	encodedHeight int32            // Height of encoded video (1080 unless changed by quality settings)
 	monitorIndex  int              // Which monitor is being captured (-1 for virtual desktop)
 	monitorInfo   *MonitorInfo     // Info about the monitor being captured (nil for virtual desktop)
 	monitors      MultiMonitorInfo // Info about all monitors
@@ -91,8 +93,8 @@ func (wii *WindowsInputInjector) Initialize() error {
 
 	wii.screenWidth = int32(width)
 	wii.screenHeight = int32(height)
-	wii.encodedWidth = 1920  // Fixed encoded resolution
-	wii.encodedHeight = 1080 // Fixed encoded resolution
+	wii.encodedWidth = 1920  // Default encoded resolution
+	wii.encodedHeight = 1080 // Default encoded resolution
 	wii.monitorIndex = 0     // Default to primary monitor
 
 	log.Printf("[WindowsInputInjector] Initialized (Primary Screen: %dx%d, Encoded: %dx%d)",
@@ -102,6 +104,9 @@ func (wii *WindowsInputInjector) Initialize() error {
 
 // SetMonitorInfo updates the monitor configuration for coordinate mapping
 func (wii *WindowsInputInjector) SetMonitorInfo(monitorIndex int, monitors MultiMonitorInfo) error {
+	wii.mu.Lock()
+	defer wii.mu.Unlock()
+
 	wii.monitorIndex = monitorIndex
 	wii.monitors = monitors
 
@@ -126,13 +131,23 @@ func (wii *WindowsInputInjector) SetMonitorInfo(monitorIndex int, monitors Multi
 	return nil
 }
 
+// SetEncodedResolution updates the encoded video size that mouse coordinates are relative to
+func (wii *WindowsInputInjector) SetEncodedResolution(width, height int) {
+	wii.mu.Lock()
+	defer wii.mu.Unlock()
+	wii.encodedWidth = int32(width)
+	wii.encodedHeight = int32(height)
+	log.Printf("[WindowsInputInjector] Encoded resolution set to %dx%d", width, height)
+}
+
 func (wii *WindowsInputInjector) InjectMouseMove(x, y int) error {
-	// Input coordinates are in encoded space (1920x1080)
+	// Input coordinates are in encoded space (1920x1080 by default)
 	// Need to scale to actual capture resolution, then add monitor offsets
 
 	var scaledX, scaledY float64
 	var screenX, screenY float64
 
+	wii.mu.Lock()
 	if wii.monitorInfo != nil {
 		// Single monitor mode
 		// 1. Scale from encoded resolution to actual monitor resolution
@@ -160,6 +175,7 @@ func (wii *WindowsInputInjector) InjectMouseMove(x, y int) error {
 		screenX = float64(x)
 		screenY = float64(y)
 	}
+	wii.mu.Unlock()
 
 	// Get total virtual screen dimensions for absolute coordinate calculation
 	virtualWidth, _, _ := procGetSystemMetrics.Call(uintptr(78))  // SM_CXVIRTUALSCREEN
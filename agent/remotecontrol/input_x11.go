@@ -0,0 +1,297 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+	"github.com/jezek/xgb/xtest"
+)
+
+// x11Keysyms maps InputHandler key names to X11 keysyms; printable characters
+// and function keys are converted in x11KeysymForKey
+var x11Keysyms = map[string]uint32{
+	"Backspace":    0xff08,
+	"Tab":          0xff09,
+	"Enter":        0xff0d,
+	"Escape":       0xff1b,
+	"Delete":       0xffff,
+	"Home":         0xff50,
+	"ArrowLeft":    0xff51,
+	"ArrowUp":      0xff52,
+	"ArrowRight":   0xff53,
+	"ArrowDown":    0xff54,
+	"PageUp":       0xff55,
+	"PageDown":     0xff56,
+	"End":          0xff57,
+	"Insert":       0xff63,
+	"CapsLock":     0xffe5,
+	"Space":        0x20,
+	"Shift":        0xffe1,
+	"ShiftLeft":    0xffe1,
+	"ShiftRight":   0xffe2,
+	"Control":      0xffe3,
+	"ControlLeft":  0xffe3,
+	"ControlRight": 0xffe4,
+	"Alt":          0xffe9,
+	"AltLeft":      0xffe9,
+	"AltRight":     0xffea,
+	"Meta":         0xffeb,
+	"MetaLeft":     0xffeb,
+	"MetaRight":    0xffec,
+}
+
+// x11KeysymForKey converts an InputHandler key name to an X11 keysym
+func x11KeysymForKey(key string) (uint32, bool) {
+	if keysym, ok := x11Keysyms[key]; ok {
+		return keysym, true
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(key, "F")); err == nil && strings.HasPrefix(key, "F") && n >= 1 && n <= 12 {
+		return 0xffbe + uint32(n-1), true
+	}
+	if runes := []rune(key); len(runes) == 1 {
+		if runes[0] < 0x100 {
+			return uint32(runes[0]), true // Latin-1 keysyms equal their code points
+		}
+		return 0x01000000 | uint32(runes[0]), true
+	}
+	return 0, false
+}
+
+// x11Key is the keycode that produces a keysym, and whether Shift is needed for it
+type x11Key struct {
+	code  xproto.Keycode
+	shift bool
+}
+
+// x11InputInjector injects input into an X display through the XTEST extension
+type x11InputInjector struct {
+	display X11Display
+
+	mu            sync.Mutex
+	conn          *xgb.Conn
+	root          xproto.Window
+	keys          map[uint32]x11Key
+	width         int
+	height        int
+	encodedWidth  int
+	encodedHeight int
+}
+
+func newX11InputInjector(display X11Display) *x11InputInjector {
+	return &x11InputInjector{display: display}
+}
+
+func (xi *x11InputInjector) Initialize() error {
+	conn, err := dialX11(xi.display)
+	if err != nil {
+		return err
+	}
+	if err := xtest.Init(conn); err != nil {
+		conn.Close()
+		return fmt.Errorf("XTEST extension not available: %w", err)
+	}
+
+	setup := xproto.Setup(conn)
+	screen := setup.DefaultScreen(conn)
+	count := int(setup.MaxKeycode) - int(setup.MinKeycode) + 1
+	mapping, err := xproto.GetKeyboardMapping(conn, setup.MinKeycode, byte(count)).Reply()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to get keyboard mapping: %w", err)
+	}
+
+	// Column 0 is the unshifted keysym and column 1 the shifted one
+	keys := make(map[uint32]x11Key)
+	perCode := int(mapping.KeysymsPerKeycode)
+	for i := 0; i < count; i++ {
+		code := xproto.Keycode(int(setup.MinKeycode) + i)
+		for column := 0; column < 2 && column < perCode; column++ {
+			keysym := uint32(mapping.Keysyms[i*perCode+column])
+			if _, seen := keys[keysym]; keysym != 0 && !seen {
+				keys[keysym] = x11Key{code: code, shift: column == 1}
+			}
+		}
+	}
+
+	xi.mu.Lock()
+	defer xi.mu.Unlock()
+	xi.conn = conn
+	xi.root = screen.Root
+	xi.keys = keys
+	xi.width, xi.height = int(screen.WidthInPixels), int(screen.HeightInPixels)
+	xi.encodedWidth, xi.encodedHeight = 1920, 1080 // Default encoded resolution
+
+	log.Printf("[X11Input] Initialized XTEST input on %s (%dx%d)", xi.displayName(), xi.width, xi.height)
+	return nil
+}
+
+func (xi *x11InputInjector) displayName() string {
+	if xi.display.Display == "" {
+		return "$DISPLAY"
+	}
+	return xi.display.Display
+}
+
+// SetMonitorInfo follows the captured monitor; a display captured by the X11
+// capturer is a single screen, so only its size matters
+func (xi *x11InputInjector) SetMonitorInfo(monitorIndex int, monitors MultiMonitorInfo) error {
+	xi.mu.Lock()
+	defer xi.mu.Unlock()
+	if monitors.VirtualWidth > 0 && monitors.VirtualHeight > 0 {
+		xi.width, xi.height = monitors.VirtualWidth, monitors.VirtualHeight
+	}
+	return nil
+}
+
+func (xi *x11InputInjector) SetEncodedResolution(width, height int) {
+	xi.mu.Lock()
+	defer xi.mu.Unlock()
+	xi.encodedWidth, xi.encodedHeight = width, height
+}
+
+// fake sends one XTEST event and waits for the server to accept it
+func (xi *x11InputInjector) fake(eventType, detail byte, x, y int16) error {
+	if xi.conn == nil {
+		return fmt.Errorf("X11 input not initialized")
+	}
+	if err := xtest.FakeInputChecked(xi.conn, eventType, detail, 0, xi.root, x, y, 0).Check(); err != nil {
+		return fmt.Errorf("failed to inject X11 input: %w", err)
+	}
+	return nil
+}
+
+func (xi *x11InputInjector) InjectMouseMove(x, y int) error {
+	xi.mu.Lock()
+	defer xi.mu.Unlock()
+
+	// Coordinates are in encoded video space; scale them to the display
+	if xi.encodedWidth > 0 && xi.encodedHeight > 0 {
+		x = x * xi.width / xi.encodedWidth
+		y = y * xi.height / xi.encodedHeight
+	}
+	x = max(0, min(x, xi.width-1))
+	y = max(0, min(y, xi.height-1))
+	return xi.fake(xproto.MotionNotify, 0, int16(x), int16(y))
+}
+
+func (xi *x11InputInjector) InjectMouseButton(button string, pressed bool) error {
+	var detail byte
+	switch button {
+	case "left":
+		detail = 1
+	case "middle", "center":
+		detail = 2
+	case "right":
+		detail = 3
+	default:
+		return fmt.Errorf("unknown mouse button: %s", button)
+	}
+
+	xi.mu.Lock()
+	defer xi.mu.Unlock()
+	return xi.click(detail, pressed)
+}
+
+func (xi *x11InputInjector) click(detail byte, pressed bool) error {
+	eventType := byte(xproto.ButtonRelease)
+	if pressed {
+		eventType = xproto.ButtonPress
+	}
+	return xi.fake(eventType, detail, 0, 0)
+}
+
+// InjectMouseScroll clicks the wheel buttons (4/5 vertical, 6/7 horizontal), one
+// click per 120 units of delta as on Windows
+func (xi *x11InputInjector) InjectMouseScroll(deltaX, deltaY int) error {
+	xi.mu.Lock()
+	defer xi.mu.Unlock()
+
+	for _, axis := range []struct {
+		delta         int
+		back, forward byte
+	}{{deltaY, 4, 5}, {deltaX, 6, 7}} {
+		if axis.delta == 0 {
+			continue
+		}
+		button, clicks := axis.forward, axis.delta
+		if clicks < 0 {
+			button, clicks = axis.back, -clicks
+		}
+		for i := 0; i < max(1, clicks/120); i++ {
+			if err := xi.click(button, true); err != nil {
+				return err
+			}
+			if err := xi.click(button, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (xi *x11InputInjector) InjectKeyPress(key string, pressed bool) error {
+	keysym, ok := x11KeysymForKey(key)
+	if !ok {
+		log.Printf("[X11Input] Unknown key: %s", key)
+		return nil // Don't error on unknown keys, just skip
+	}
+
+	xi.mu.Lock()
+	defer xi.mu.Unlock()
+
+	target, ok := xi.keys[keysym]
+	if !ok && keysym < 0x100 {
+		// Upper-case letters are usually only mapped as the shifted lower-case keysym
+		target, ok = xi.keys[uint32(unicode.ToLower(rune(keysym)))]
+		target.shift = ok
+	}
+	if !ok {
+		log.Printf("[X11Input] Key %s has no keycode on %s", key, xi.displayName())
+		return nil
+	}
+
+	shift := xi.keys[0xffe1]
+	if target.shift && pressed && shift.code != 0 {
+		if err := xi.fake(xproto.KeyPress, byte(shift.code), 0, 0); err != nil {
+			return err
+		}
+	}
+	eventType := byte(xproto.KeyRelease)
+	if pressed {
+		eventType = xproto.KeyPress
+	}
+	if err := xi.fake(eventType, byte(target.code), 0, 0); err != nil {
+		return err
+	}
+	if target.shift && !pressed && shift.code != 0 {
+		return xi.fake(xproto.KeyRelease, byte(shift.code), 0, 0)
+	}
+	return nil
+}
+
+// WindowFocused reports whether keys injected now would reach window id
+func (xi *x11InputInjector) WindowFocused(id uint32) (bool, error) {
+	xi.mu.Lock()
+	conn, root := xi.conn, xi.root
+	xi.mu.Unlock()
+	if conn == nil {
+		return false, fmt.Errorf("X input is not initialized")
+	}
+	return x11InputFocusInside(conn, root, xproto.Window(id))
+}
+
+func (xi *x11InputInjector) Close() error {
+	xi.mu.Lock()
+	defer xi.mu.Unlock()
+	if xi.conn != nil {
+		xi.conn.Close()
+		xi.conn = nil
+	}
+	return nil
+}
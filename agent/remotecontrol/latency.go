@@ -0,0 +1,403 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Latency stages, in pipeline order. Frame stages are measured on the agent;
+// rtt comes from data channel ping/pong, and glassToGlass/render from frame IDs
+// the viewer echoes back when it renders a frame.
+const (
+	stageCapture      = "capture"      // Grabbing (and redacting) the frame
+	stageQueue        = "queue"        // Waiting in the frame channel for the sender
+	stageProcess      = "process"      // Scaling, watermark and grayscale
+	stageEncode       = "encode"       // VP8 encoding
+	stageSend         = "send"         // Packetizing and writing RTP
+	stagePipeline     = "pipeline"     // Capture start to last packet written
+	stageRTT          = "rtt"          // Data channel round trip
+	stageRender       = "render"       // Last packet written to viewer render (one way)
+	stageGlassToGlass = "glassToGlass" // Capture start to viewer render
+)
+
+var latencyStages = []string{
+	stageCapture, stageQueue, stageProcess, stageEncode, stageSend,
+	stagePipeline, stageRTT, stageRender, stageGlassToGlass,
+}
+
+const (
+	// latencyPingInterval is how often the agent pings the viewer on the control channel
+	latencyPingInterval = 2 * time.Second
+
+	// latencyFrameHistory is how many recent frames can still be matched to a viewer echo
+	latencyFrameHistory = 512
+)
+
+// latencyBucketsMs are the upper bounds of the histogram buckets, in milliseconds
+var latencyBucketsMs = []float64{1, 2, 5, 10, 20, 35, 50, 75, 100, 150, 200, 300, 500, 1000, 2000}
+
+// LatencyBucket is one histogram bucket: observations up to LeMs (the last bucket has no bound)
+type LatencyBucket struct {
+	LeMs  float64 `json:"le,omitempty"`
+	Count uint64  `json:"count"`
+}
+
+// LatencyHistogram summarises one stage
+type LatencyHistogram struct {
+	Count   uint64          `json:"count"`
+	MeanMs  float64         `json:"meanMs"`
+	MinMs   float64         `json:"minMs"`
+	MaxMs   float64         `json:"maxMs"`
+	P50Ms   float64         `json:"p50Ms"`
+	P95Ms   float64         `json:"p95Ms"`
+	P99Ms   float64         `json:"p99Ms"`
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// latencyHistogram accumulates durations into fixed buckets
+type latencyHistogram struct {
+	counts []uint64 // One per bucket plus the overflow bucket
+	count  uint64
+	sumMs  float64
+	minMs  float64
+	maxMs  float64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{counts: make([]uint64, len(latencyBucketsMs)+1)}
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	if ms < 0 {
+		ms = 0
+	}
+
+	bucket := sort.SearchFloat64s(latencyBucketsMs, ms)
+	h.counts[bucket]++
+	if h.count == 0 || ms < h.minMs {
+		h.minMs = ms
+	}
+	if ms > h.maxMs {
+		h.maxMs = ms
+	}
+	h.count++
+	h.sumMs += ms
+}
+
+// quantile estimates a quantile by interpolating inside its bucket
+func (h *latencyHistogram) quantile(q float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := q * float64(h.count)
+	var seen float64
+	for i, count := range h.counts {
+		if count == 0 {
+			continue
+		}
+		if seen+float64(count) >= rank {
+			lower := 0.0
+			if i > 0 {
+				lower = latencyBucketsMs[i-1]
+			}
+			upper := h.maxMs
+			if i < len(latencyBucketsMs) {
+				upper = latencyBucketsMs[i]
+			}
+			lower, upper = math.Max(lower, h.minMs), math.Min(upper, h.maxMs)
+			return lower + (upper-lower)*(rank-seen)/float64(count)
+		}
+		seen += float64(count)
+	}
+	return h.maxMs
+}
+
+func (h *latencyHistogram) snapshot() LatencyHistogram {
+	snapshot := LatencyHistogram{Count: h.count, Buckets: make([]LatencyBucket, len(h.counts))}
+	for i, count := range h.counts {
+		snapshot.Buckets[i].Count = count
+		if i < len(latencyBucketsMs) {
+			snapshot.Buckets[i].LeMs = latencyBucketsMs[i]
+		}
+	}
+	if h.count > 0 {
+		snapshot.MeanMs = roundMs(h.sumMs / float64(h.count))
+		snapshot.MinMs = roundMs(h.minMs)
+		snapshot.MaxMs = roundMs(h.maxMs)
+		snapshot.P50Ms = roundMs(h.quantile(0.50))
+		snapshot.P95Ms = roundMs(h.quantile(0.95))
+		snapshot.P99Ms = roundMs(h.quantile(0.99))
+	}
+	return snapshot
+}
+
+func roundMs(ms float64) float64 {
+	return math.Round(ms*100) / 100
+}
+
+// frameTiming holds the timestamps of one frame on its way through the pipeline
+type frameTiming struct {
+	id        uint32
+	started   time.Time // Capture began
+	captured  time.Time // Capture (and redaction) finished
+	dequeued  time.Time // Sender picked the frame up
+	processed time.Time // Scaled, watermarked and ready for the encoder
+	encoded   time.Time
+	sent      time.Time
+}
+
+// latencyTracker measures per-stage latency for a session
+type latencyTracker struct {
+	mu           sync.Mutex
+	histograms   map[string]*latencyHistogram
+	frames       [latencyFrameHistory]frameTiming // Sent frames by id % latencyFrameHistory
+	nextFrameID  uint32
+	embedIDs     bool // Draw frame IDs into frames for the viewer to echo
+	pings        map[uint32]time.Time
+	nextPingID   uint32
+	lastRTT      time.Duration
+	framesEchoed uint64
+}
+
+func newLatencyTracker() *latencyTracker {
+	lt := &latencyTracker{
+		histograms: make(map[string]*latencyHistogram, len(latencyStages)),
+		pings:      make(map[uint32]time.Time),
+		// Start above zero so a black or missing barcode never matches a real frame
+		nextFrameID: 1,
+	}
+	for _, stage := range latencyStages {
+		lt.histograms[stage] = newLatencyHistogram()
+	}
+	return lt
+}
+
+// beginFrame assigns the next frame ID to a frame the sender just picked up
+func (lt *latencyTracker) beginFrame(frame *CapturedFrame) frameTiming {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	id := lt.nextFrameID
+	lt.nextFrameID++
+	if lt.nextFrameID == 0 {
+		lt.nextFrameID = 1
+	}
+	return frameTiming{id: id, started: frame.Started, captured: frame.Captured, dequeued: time.Now()}
+}
+
+// embedFrameID draws the frame ID into the encoded frame when the viewer asked for echoes
+func (lt *latencyTracker) embedFrameID(img *image.RGBA, timing frameTiming) {
+	lt.mu.Lock()
+	embed := lt.embedIDs
+	lt.mu.Unlock()
+
+	if embed {
+		drawCounterBarcode(img, img.Bounds(), timing.id)
+	}
+}
+
+// finishFrame records the stages of a frame whose packets were all written
+func (lt *latencyTracker) finishFrame(timing frameTiming) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if !timing.started.IsZero() {
+		lt.histograms[stageCapture].observe(timing.captured.Sub(timing.started))
+		lt.histograms[stageQueue].observe(timing.dequeued.Sub(timing.captured))
+		lt.histograms[stagePipeline].observe(timing.sent.Sub(timing.started))
+	}
+	lt.histograms[stageProcess].observe(timing.processed.Sub(timing.dequeued))
+	lt.histograms[stageEncode].observe(timing.encoded.Sub(timing.processed))
+	lt.histograms[stageSend].observe(timing.sent.Sub(timing.encoded))
+
+	lt.frames[timing.id%latencyFrameHistory] = timing
+}
+
+// frameRendered records the viewer's echo of a rendered frame. The echo's trip
+// back to the agent is estimated as half the round trip time.
+func (lt *latencyTracker) frameRendered(id uint32, received time.Time) bool {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	timing := lt.frames[id%latencyFrameHistory]
+	if timing.id != id || timing.sent.IsZero() {
+		return false
+	}
+
+	echoed := received.Add(-lt.lastRTT / 2)
+	lt.histograms[stageRender].observe(echoed.Sub(timing.sent))
+	if !timing.started.IsZero() {
+		lt.histograms[stageGlassToGlass].observe(echoed.Sub(timing.started))
+	}
+
+	// Each frame counts once, even if the viewer renders it again
+	lt.frames[id%latencyFrameHistory] = frameTiming{}
+	lt.framesEchoed++
+	return true
+}
+
+// setEmbedFrameIDs turns frame ID embedding on or off
+func (lt *latencyTracker) setEmbedFrameIDs(enabled bool) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.embedIDs = enabled
+}
+
+// newPing returns the ID for the next ping and remembers when it was sent
+func (lt *latencyTracker) newPing(sent time.Time) uint32 {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	lt.nextPingID++
+	lt.pings[lt.nextPingID] = sent
+
+	// Forget pings the viewer never answered
+	for id, at := range lt.pings {
+		if sent.Sub(at) > 10*latencyPingInterval {
+			delete(lt.pings, id)
+		}
+	}
+	return lt.nextPingID
+}
+
+// pong records the round trip of an answered ping
+func (lt *latencyTracker) pong(id uint32, received time.Time) (time.Duration, bool) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	sent, ok := lt.pings[id]
+	if !ok {
+		return 0, false
+	}
+	delete(lt.pings, id)
+
+	rtt := received.Sub(sent)
+	lt.lastRTT = rtt
+	lt.histograms[stageRTT].observe(rtt)
+	return rtt, true
+}
+
+// Snapshot returns the histogram of every stage
+func (lt *latencyTracker) Snapshot() map[string]LatencyHistogram {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	snapshot := make(map[string]LatencyHistogram, len(lt.histograms))
+	for stage, histogram := range lt.histograms {
+		snapshot[stage] = histogram.snapshot()
+	}
+	return snapshot
+}
+
+// estimate returns the best available end-to-end latency in milliseconds:
+// measured glass-to-glass, else the agent pipeline plus half the round trip
+func (lt *latencyTracker) estimate() float64 {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if g2g := lt.histograms[stageGlassToGlass]; g2g.count > 0 {
+		return roundMs(g2g.quantile(0.5))
+	}
+	estimate := lt.histograms[stagePipeline].quantile(0.5)
+	if rtt := lt.histograms[stageRTT]; rtt.count > 0 {
+		estimate += rtt.quantile(0.5) / 2
+	}
+	return roundMs(estimate)
+}
+
+// Summary describes every stage that has observations on one line
+func (lt *latencyTracker) Summary() string {
+	snapshot := lt.Snapshot()
+
+	var parts []string
+	for _, stage := range latencyStages {
+		histogram := snapshot[stage]
+		if histogram.Count == 0 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s p50=%.1fms p95=%.1fms max=%.1fms (n=%d)",
+			stage, histogram.P50Ms, histogram.P95Ms, histogram.MaxMs, histogram.Count))
+	}
+	if len(parts) == 0 {
+		return "no frames measured"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// startLatencyPings pings the viewer on the control channel until the peer closes
+func (wp *WebRTCPeer) startLatencyPings() {
+	ticker := time.NewTicker(latencyPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-wp.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		id := wp.latency.newPing(now)
+		if err := wp.sendDataChannelMessage(map[string]interface{}{
+			"type":   "ping",
+			"id":     id,
+			"sentAt": now.UnixMilli(),
+		}); err != nil {
+			return
+		}
+	}
+}
+
+// handleLatencyMessage handles ping, pong, latency and frame-rendered control messages
+func (wp *WebRTCPeer) handleLatencyMessage(msgType string, message map[string]interface{}) error {
+	received := time.Now()
+
+	switch msgType {
+	case "ping":
+		// Echo the viewer's ping with the agent clock for its own measurements
+		reply := make(map[string]interface{}, len(message)+1)
+		for key, value := range message {
+			reply[key] = value
+		}
+		reply["type"] = "pong"
+		reply["agentTime"] = received.UnixMilli()
+		return wp.sendDataChannelMessage(reply)
+
+	case "pong":
+		id, ok := message["id"].(float64)
+		if !ok {
+			return fmt.Errorf("pong without id")
+		}
+		wp.latency.pong(uint32(id), received)
+		return nil
+
+	case "latency":
+		enabled, _ := message["frameIds"].(bool)
+		wp.latency.setEmbedFrameIDs(enabled)
+		log.Printf("[WebRTCPeer] Frame ID echo %s", map[bool]string{true: "enabled", false: "disabled"}[enabled])
+		return nil
+
+	case "frame-rendered":
+		id, ok := message["id"].(float64)
+		if !ok {
+			return fmt.Errorf("frame-rendered without id")
+		}
+		wp.latency.frameRendered(uint32(id), received)
+		return nil
+	}
+
+	return fmt.Errorf("unknown latency message type: %s", msgType)
+}
+
+// LatencySummary describes the session's per-stage latency for the session log
+func (wp *WebRTCPeer) LatencySummary() string {
+	return wp.latency.Summary()
+}
@@ -0,0 +1,181 @@
+package remotecontrol
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogramQuantile(t *testing.T) {
+	ms := func(values ...float64) []time.Duration {
+		durations := make([]time.Duration, len(values))
+		for i, v := range values {
+			durations[i] = time.Duration(v * float64(time.Millisecond))
+		}
+		return durations
+	}
+	repeat := func(n int, v float64) []float64 {
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = v
+		}
+		return values
+	}
+
+	tests := []struct {
+		name         string
+		observations []time.Duration
+		q            float64
+		want         float64
+	}{
+		{"empty", nil, 0.5, 0},
+		// 10x 4ms land in (2,5] and 10x 40ms in (35,50]; bounds are clamped to min 4 and max 40
+		{"low bucket, interpolated", ms(append(repeat(10, 4), repeat(10, 40)...)...), 0.25, 4.5},
+		{"top of the low bucket", ms(append(repeat(10, 4), repeat(10, 40)...)...), 0.5, 5},
+		{"high bucket, interpolated", ms(append(repeat(10, 4), repeat(10, 40)...)...), 0.75, 37.5},
+		{"maximum", ms(append(repeat(10, 4), repeat(10, 40)...)...), 1, 40},
+		{"single value", ms(repeat(5, 12)...), 0.5, 12},
+		{"overflow bucket up to the maximum", ms(2500, 3500), 0.5, 3000},
+		{"negative durations count as zero", ms(-5, -5), 0.99, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newLatencyHistogram()
+			for _, d := range tt.observations {
+				h.observe(d)
+			}
+			if got := h.quantile(tt.q); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("quantile(%.2f) = %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatencyHistogramSnapshot(t *testing.T) {
+	h := newLatencyHistogram()
+	for _, d := range []time.Duration{time.Millisecond, 3 * time.Millisecond, 3 * time.Millisecond, 5 * time.Second} {
+		h.observe(d)
+	}
+	snapshot := h.snapshot()
+
+	if snapshot.Count != 4 || snapshot.MinMs != 1 || snapshot.MaxMs != 5000 || snapshot.MeanMs != 1251.75 {
+		t.Errorf("snapshot = %+v", snapshot)
+	}
+	if len(snapshot.Buckets) != len(latencyBucketsMs)+1 {
+		t.Fatalf("%d buckets, want %d", len(snapshot.Buckets), len(latencyBucketsMs)+1)
+	}
+	// 1ms is within the first bound, 3ms within (2,5], 5s overflows the last bound
+	want := map[int]uint64{0: 1, 2: 2, len(latencyBucketsMs): 1}
+	for i, bucket := range snapshot.Buckets {
+		if bucket.Count != want[i] {
+			t.Errorf("bucket %d (le %v) = %d, want %d", i, bucket.LeMs, bucket.Count, want[i])
+		}
+	}
+	if last := snapshot.Buckets[len(latencyBucketsMs)]; last.LeMs != 0 {
+		t.Errorf("overflow bucket has bound %v", last.LeMs)
+	}
+}
+
+func TestLatencyFrameRendered(t *testing.T) {
+	t0 := time.Now()
+	sentFrame := func(id uint32) frameTiming {
+		return frameTiming{
+			id:        id,
+			started:   t0,
+			captured:  t0.Add(2 * time.Millisecond),
+			dequeued:  t0.Add(3 * time.Millisecond),
+			processed: t0.Add(5 * time.Millisecond),
+			encoded:   t0.Add(8 * time.Millisecond),
+			sent:      t0.Add(10 * time.Millisecond),
+		}
+	}
+
+	lt := newLatencyTracker()
+	// A 20ms round trip puts the viewer's echo 10ms before it arrived
+	lt.pong(lt.newPing(t0), t0.Add(20*time.Millisecond))
+	lt.finishFrame(sentFrame(5))
+
+	if !lt.frameRendered(5, t0.Add(40*time.Millisecond)) {
+		t.Fatal("echo of a sent frame not matched")
+	}
+	snapshot := lt.Snapshot()
+	if render := snapshot[stageRender]; render.Count != 1 || render.MaxMs != 20 {
+		t.Errorf("render = %+v, want one 20ms observation", render)
+	}
+	if g2g := snapshot[stageGlassToGlass]; g2g.Count != 1 || g2g.MaxMs != 30 {
+		t.Errorf("glass to glass = %+v, want one 30ms observation", g2g)
+	}
+	if pipeline := snapshot[stagePipeline]; pipeline.Count != 1 || pipeline.MaxMs != 10 {
+		t.Errorf("pipeline = %+v, want one 10ms observation", pipeline)
+	}
+	if got := lt.estimate(); got != 30 {
+		t.Errorf("estimate = %v, want the measured 30ms glass to glass", got)
+	}
+
+	tests := []struct {
+		name string
+		id   uint32
+	}{
+		{"rendered again", 5},
+		{"never sent", 6},
+		{"zero", 0},
+	}
+	for _, tt := range tests {
+		if lt.frameRendered(tt.id, t0.Add(50*time.Millisecond)) {
+			t.Errorf("%s: frame %d matched", tt.name, tt.id)
+		}
+	}
+
+	// Frame 7 is overwritten by the frame sent latencyFrameHistory frames later
+	lt.finishFrame(sentFrame(7))
+	lt.finishFrame(sentFrame(7 + latencyFrameHistory))
+	if lt.frameRendered(7, t0.Add(50*time.Millisecond)) {
+		t.Error("evicted frame matched")
+	}
+	if !lt.frameRendered(7+latencyFrameHistory, t0.Add(50*time.Millisecond)) {
+		t.Error("frame in the evicting slot not matched")
+	}
+
+	if got := lt.Snapshot()[stageRender].Count; got != 2 || lt.framesEchoed != 2 {
+		t.Errorf("render observations = %d, echoed = %d; want 2 each", got, lt.framesEchoed)
+	}
+}
+
+func TestLatencyPong(t *testing.T) {
+	t0 := time.Now()
+	lt := newLatencyTracker()
+
+	if _, ok := lt.pong(1, t0); ok {
+		t.Error("pong for a ping never sent matched")
+	}
+
+	first := lt.newPing(t0)
+	// Pings unanswered for ten intervals are forgotten when the next one is sent
+	second := lt.newPing(t0.Add(10*latencyPingInterval + time.Millisecond))
+	if _, ok := lt.pong(first, t0.Add(11*latencyPingInterval)); ok {
+		t.Error("pong for an expired ping matched")
+	}
+
+	rtt, ok := lt.pong(second, t0.Add(10*latencyPingInterval+26*time.Millisecond))
+	if !ok || rtt != 25*time.Millisecond {
+		t.Errorf("pong = %v, %t; want 25ms", rtt, ok)
+	}
+	if _, ok := lt.pong(second, t0.Add(11*latencyPingInterval)); ok {
+		t.Error("second pong for the same ping matched")
+	}
+	if rtt := lt.Snapshot()[stageRTT]; rtt.Count != 1 || rtt.MaxMs != 25 {
+		t.Errorf("rtt = %+v, want one 25ms observation", rtt)
+	}
+}
+
+func TestLatencyFrameIDsSkipZero(t *testing.T) {
+	lt := newLatencyTracker()
+	lt.nextFrameID = math.MaxUint32
+
+	if id := lt.beginFrame(&CapturedFrame{}).id; id != math.MaxUint32 {
+		t.Errorf("id = %d, want %d", id, uint32(math.MaxUint32))
+	}
+	if id := lt.beginFrame(&CapturedFrame{}).id; id != 1 {
+		t.Errorf("id after wrapping = %d, want 1", id)
+	}
+}
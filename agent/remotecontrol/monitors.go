@@ -0,0 +1,534 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// monitorLayoutPollInterval is how often the display layout is re-detected
+	monitorLayoutPollInterval = 3 * time.Second
+
+	// captureErrorsBeforeLayoutCheck triggers an immediate layout check after repeated capture failures
+	captureErrorsBeforeLayoutCheck = 10
+)
+
+// newFixedMonitorCapture creates a capture bound to one monitor that is never remapped
+func newFixedMonitorCapture(monitorIndex int) *ScreenCapture {
+	sc := NewScreenCaptureWithMonitor(monitorIndex)
+	sc.fixedMonitor = true
+	return sc
+}
+
+// SetMonitorsChangedHandler registers a callback invoked after the display layout changes
+func (sc *ScreenCapture) SetMonitorsChangedHandler(handler func(monitors MultiMonitorInfo, monitorIndex int)) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.onMonitorsChanged = handler
+}
+
+// SetFrameCaptureEnabled turns frame grabbing on or off while keeping the capturer running
+func (sc *ScreenCapture) SetFrameCaptureEnabled(enabled bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.framesDisabled = !enabled
+}
+
+// watchMonitorLayout periodically re-detects monitors while capture is running
+func (sc *ScreenCapture) watchMonitorLayout() {
+	ticker := time.NewTicker(monitorLayoutPollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sc.mu.RLock()
+		running := sc.running
+		sc.mu.RUnlock()
+
+		if !running {
+			return
+		}
+
+		sc.refreshMonitorLayout()
+	}
+}
+
+// refreshMonitorLayout re-detects monitors and, if the layout changed, remaps the
+// captured monitor, restarts the capturer and notifies the change handler
+func (sc *ScreenCapture) refreshMonitorLayout() bool {
+	sc.mu.RLock()
+	layout := sc.detectLayoutLocked()
+	sc.mu.RUnlock()
+
+	sc.captureMu.Lock()
+	sc.mu.Lock()
+	if !sc.running || !monitorLayoutChanged(sc.monitors, layout) {
+		sc.mu.Unlock()
+		sc.captureMu.Unlock()
+		return false
+	}
+
+	previousIndex := sc.monitorIndex
+	newIndex := remapMonitorIndex(previousIndex, sc.monitors, layout)
+
+	log.Printf("[ScreenCapture] Monitor layout changed: %d -> %d monitor(s), capturing monitor %d (was %d)",
+		len(sc.monitors.Monitors), len(layout.Monitors), newIndex, previousIndex)
+
+	sc.monitors = layout
+	sc.monitorIndex = newIndex
+
+	if sc.capturer != nil {
+		if err := sc.capturer.Close(); err != nil {
+			log.Printf("[ScreenCapture] Error closing capturer: %v", err)
+		}
+	}
+	sc.capturer = sc.newCapturerLocked()
+	if err := sc.capturer.Initialize(); err != nil {
+		log.Printf("[ScreenCapture] Error reinitializing capturer after layout change: %v", err)
+	}
+
+	// Keep sharing the same window when it survived the change
+	var windowLost bool
+	if sc.window != nil {
+		window, err := sc.capturer.SelectWindow(&WindowTarget{ID: sc.window.ID})
+		if err != nil {
+			log.Printf("[ScreenCapture] Shared window 0x%x lost after layout change: %v", sc.window.ID, err)
+			windowLost = sc.clearWindowLocked()
+		} else {
+			sc.window = window
+		}
+	}
+
+	handler, windowHandler := sc.onMonitorsChanged, sc.onWindowChanged
+	sc.mu.Unlock()
+	sc.captureMu.Unlock()
+
+	if windowLost && windowHandler != nil {
+		windowHandler(nil)
+	}
+	if handler != nil {
+		handler(layout, newIndex)
+	}
+	return true
+}
+
+// monitorLayoutChanged reports whether the number, position or size of monitors differs
+func monitorLayoutChanged(previous, current MultiMonitorInfo) bool {
+	if len(previous.Monitors) != len(current.Monitors) {
+		return true
+	}
+	for i := range previous.Monitors {
+		a := previous.Monitors[i]
+		b := current.Monitors[i]
+		if a.X != b.X || a.Y != b.Y || a.Width != b.Width || a.Height != b.Height || a.Primary != b.Primary {
+			return true
+		}
+	}
+	return false
+}
+
+// remapMonitorIndex finds the monitor that was being captured in the new layout.
+// A monitor at the same position is preferred, then one with the same size; if the
+// monitor is gone, capture falls back to the primary monitor.
+func remapMonitorIndex(previousIndex int, previous, current MultiMonitorInfo) int {
+	if previousIndex == -1 || len(current.Monitors) == 0 {
+		// Virtual desktop follows the layout automatically; with no monitors keep the default
+		if previousIndex == -1 {
+			return -1
+		}
+		return 0
+	}
+
+	if previousIndex >= 0 && previousIndex < len(previous.Monitors) {
+		old := previous.Monitors[previousIndex]
+		for _, mon := range current.Monitors {
+			if mon.X == old.X && mon.Y == old.Y {
+				return mon.Index
+			}
+		}
+		for _, mon := range current.Monitors {
+			if mon.Width == old.Width && mon.Height == old.Height {
+				return mon.Index
+			}
+		}
+	}
+
+	for _, mon := range current.Monitors {
+		if mon.Primary {
+			return mon.Index
+		}
+	}
+	return 0
+}
+
+// monitorsMessage is sent to the viewer whenever the display layout is (re)reported
+type monitorsMessage struct {
+	Type          string           `json:"type"`
+	Monitors      []monitorSummary `json:"monitors"`
+	ActiveIndex   int              `json:"activeIndex"`
+	VirtualWidth  int              `json:"virtualWidth"`
+	VirtualHeight int              `json:"virtualHeight"`
+	PerMonitor    bool             `json:"perMonitorTracks"`
+	Window        *CapturedWindow  `json:"window,omitempty"` // Shared window instead of the active monitor
+}
+
+// monitorSummary is a MonitorInfo plus the ID of its video track in per-monitor mode
+type monitorSummary struct {
+	MonitorInfo
+	TrackID string `json:"trackId,omitempty"`
+}
+
+// monitorTrack streams a single monitor on its own video track (per-monitor mode)
+type monitorTrack struct {
+	index   int
+	monitor MonitorInfo // The monitor shown, followed across layout changes
+	track   *videoTrack
+	sender  *webrtc.RTPSender // nil once the session moved to the relay
+	sink    frameSink         // The track, or the relay after a fallback
+	stop    chan struct{}
+}
+
+// SetPerMonitorTracks enables publishing every monitor as its own video track.
+// Must be called before Init.
+func (wp *WebRTCPeer) SetPerMonitorTracks(enabled bool) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	wp.perMonitorTracks = enabled
+}
+
+// addMonitorTracks creates one video track per detected monitor; wp.mu must be held
+func (wp *WebRTCPeer) addMonitorTracks(pc *webrtc.PeerConnection) error {
+	monitors := wp.screenCapture.GetMonitors()
+	if len(monitors.Monitors) == 0 {
+		return fmt.Errorf("no monitors detected for per-monitor tracks")
+	}
+
+	for _, mon := range monitors.Monitors {
+		mt, err := wp.newMonitorTrackLocked(pc, nil, mon)
+		if err != nil {
+			return err
+		}
+		wp.monitorTracks = append(wp.monitorTracks, mt)
+	}
+
+	// The shared capture still drives cursor, input mapping and layout detection,
+	// but its frames are not needed
+	wp.screenCapture.SetFrameCaptureEnabled(false)
+
+	log.Printf("[WebRTCPeer] Publishing %d per-monitor video tracks", len(wp.monitorTracks))
+	return nil
+}
+
+// newMonitorTrackLocked creates the track for a monitor and adds it to the peer
+// connection, or sends it over the relay; wp.mu must be held
+func (wp *WebRTCPeer) newMonitorTrackLocked(pc *webrtc.PeerConnection, relay *relayConn, mon MonitorInfo) (*monitorTrack, error) {
+	// Track IDs stay unique while indices shift: a track keeps its ID when its monitor moves
+	inUse := make(map[string]bool, len(wp.monitorTracks))
+	for _, mt := range wp.monitorTracks {
+		inUse[mt.track.ID()] = true
+	}
+	id := fmt.Sprintf("monitor-%d", mon.Index)
+	for n := len(wp.monitorTracks); inUse[id]; n++ {
+		id = fmt.Sprintf("monitor-%d", n)
+	}
+
+	track, err := newVideoTrack(id, "screen-capture")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create track for monitor %d: %w", mon.Index, err)
+	}
+	mt := &monitorTrack{index: mon.Index, monitor: mon, track: track, sink: track, stop: make(chan struct{})}
+	if relay != nil {
+		mt.sink = relay.stream(mon.Index)
+		return mt, nil
+	}
+
+	if mt.sender, err = pc.AddTrack(track); err != nil {
+		return nil, fmt.Errorf("failed to add track for monitor %d: %w", mon.Index, err)
+	}
+	return mt, nil
+}
+
+// matchMonitors finds each previous monitor in a new layout, since indices shift
+// when a monitor is unplugged: same position and size first, then the same size (a
+// neighbour was unplugged and the monitor moved), then the same position (its
+// resolution changed). matches[i] is the index in current of previous[i] (-1 =
+// gone); added lists the monitors that are new.
+func matchMonitors(previous, current []MonitorInfo) (matches []int, added []MonitorInfo) {
+	matches = make([]int, len(previous))
+	claimed := make([]bool, len(current))
+	for i := range matches {
+		matches[i] = -1
+	}
+
+	samePosition := func(a, b MonitorInfo) bool { return a.X == b.X && a.Y == b.Y }
+	sameSize := func(a, b MonitorInfo) bool { return a.Width == b.Width && a.Height == b.Height }
+	sameRect := func(a, b MonitorInfo) bool { return samePosition(a, b) && sameSize(a, b) }
+	for _, same := range []func(a, b MonitorInfo) bool{sameRect, sameSize, samePosition} {
+		for i, old := range previous {
+			if matches[i] >= 0 {
+				continue
+			}
+			for j, mon := range current {
+				if !claimed[j] && same(old, mon) {
+					matches[i] = j
+					claimed[j] = true
+					break
+				}
+			}
+		}
+	}
+
+	for j, mon := range current {
+		if !claimed[j] {
+			added = append(added, mon)
+		}
+	}
+	return matches, added
+}
+
+// sendMonitorTrackFrames captures, encodes and sends one monitor on its own track
+func (wp *WebRTCPeer) sendMonitorTrackFrames(mt *monitorTrack) {
+	settings := wp.GetQualitySettings()
+
+	capture := newFixedMonitorCapture(mt.index)
+	capture.SetTargetFPS(settings.FPS)
+	capture.SetRedactor(wp.screenCapture.GetRedactor())
+	capture.SetSyntheticSource(wp.screenCapture.GetSyntheticSource())
+	if err := capture.Start(); err != nil {
+		log.Printf("[WebRTCPeer] Failed to start capture for monitor %d: %v", mt.index, err)
+		return
+	}
+	defer capture.Stop()
+
+	encoder, err := NewVP8Encoder(settings.Width, settings.Height, settings.FPS, settings.Bitrate)
+	if err != nil {
+		log.Printf("[WebRTCPeer] Failed to create encoder for monitor %d: %v", mt.index, err)
+		return
+	}
+	defer func() {
+		encoder.Close()
+	}()
+
+	log.Printf("[WebRTCPeer] Streaming monitor %d on track %s", mt.index, mt.track.ID())
+
+	frameCount := 0
+	frameChannel := capture.GetFrameChannel()
+
+	for {
+		select {
+		case <-wp.ctx.Done():
+			return
+		case <-mt.stop:
+			log.Printf("[WebRTCPeer] Stopped track for monitor %d", mt.index)
+			return
+		case frame, ok := <-frameChannel:
+			if !ok {
+				return
+			}
+			// This capture follows the session's pause from here; frames from before are dropped
+			capture.SetPaused(wp.isPaused())
+			if !wp.IsConnected() || frame.Paused != wp.isPaused() {
+				continue
+			}
+			timing := wp.latency.beginFrame(frame)
+
+			// Follow live quality changes; this loop owns its encoder so no locking is needed
+			quality := wp.GetQualitySettings()
+			if quality.Width != settings.Width || quality.Height != settings.Height || quality.FPS != settings.FPS {
+				newEncoder, err := NewVP8Encoder(quality.Width, quality.Height, quality.FPS, quality.Bitrate)
+				if err != nil {
+					log.Printf("[WebRTCPeer] Failed to recreate encoder for monitor %d: %v", mt.index, err)
+					continue
+				}
+				encoder.Close()
+				encoder = newEncoder
+				capture.SetTargetFPS(quality.FPS)
+			} else if quality.Bitrate != settings.Bitrate {
+				if err := encoder.SetBitrate(quality.Bitrate); err != nil {
+					log.Printf("[WebRTCPeer] Failed to update bitrate for monitor %d: %v", mt.index, err)
+				}
+			}
+			settings = quality
+
+			scaled := scaleFrame(frame.Image, settings.Width, settings.Height, settings.ScalingMode)
+			scaled = wp.drawableFrame(scaled, frame.Image, settings)
+			wp.applyWatermark(scaled)
+			if settings.Grayscale {
+				convertToGrayscale(scaled)
+			}
+			wp.latency.embedFrameID(scaled, timing)
+			timing.processed = time.Now()
+
+			encoded, err := encoder.Encode(scaled.Pix, frameCount)
+			if err != nil {
+				log.Printf("[WebRTCPeer] Failed to encode frame for monitor %d: %v", mt.index, err)
+				continue
+			}
+			frameCount++
+			timing.encoded = time.Now()
+
+			if len(encoded) == 0 {
+				continue
+			}
+			wp.mu.RLock()
+			sink := mt.sink
+			wp.mu.RUnlock()
+			if _, err := sink.WriteFrame(encoded, frame.Started); err != nil {
+				log.Printf("[WebRTCPeer] Failed to write sample for monitor %d: %v", mt.index, err)
+				continue
+			}
+			timing.sent = time.Now()
+			wp.latency.finishFrame(timing)
+		}
+	}
+}
+
+// handleMonitorsChanged reacts to display hotplug: input mapping follows the remapped
+// monitor, per-monitor tracks follow their monitor to its new index, tracks of
+// vanished monitors are removed and new monitors get a track (renegotiating the
+// peer connection), and the viewer receives the new layout
+func (wp *WebRTCPeer) handleMonitorsChanged(monitors MultiMonitorInfo, monitorIndex int) {
+	if wp.inputHandler != nil {
+		if err := wp.inputHandler.SetMonitorInfo(monitorIndex, monitors); err != nil {
+			log.Printf("[WebRTCPeer] Failed to update input monitor info: %v", err)
+		}
+	}
+
+	wp.mu.Lock()
+	if !wp.perMonitorTracks || len(wp.monitorTracks) == 0 {
+		wp.mu.Unlock()
+		if err := wp.sendMonitorsMessage(); err != nil {
+			log.Printf("[WebRTCPeer] Failed to send monitors message: %v", err)
+		}
+		return
+	}
+
+	pc := wp.peerConnection
+	relay, _ := wp.control.(*relayConn)
+	if wp.transport != transportRelay {
+		relay = nil
+	}
+
+	previous := make([]MonitorInfo, len(wp.monitorTracks))
+	for i, mt := range wp.monitorTracks {
+		previous[i] = mt.monitor
+	}
+	matches, added := matchMonitors(previous, monitors.Monitors)
+
+	var tracks, started []*monitorTrack
+	renegotiate := false
+	for i, mt := range wp.monitorTracks {
+		if matches[i] < 0 {
+			log.Printf("[WebRTCPeer] Monitor %d is gone, removing track %s", mt.index, mt.track.ID())
+			close(mt.stop)
+			if mt.sender != nil && pc != nil {
+				if err := pc.RemoveTrack(mt.sender); err != nil {
+					log.Printf("[WebRTCPeer] Failed to remove track %s: %v", mt.track.ID(), err)
+				}
+				renegotiate = true
+			}
+			continue
+		}
+
+		mon := monitors.Monitors[matches[i]]
+		if mon == mt.monitor {
+			tracks = append(tracks, mt)
+			continue
+		}
+		// Each track's capture is bound to a monitor index, so it is restarted on
+		// the monitor's new index and size; the track itself stays
+		log.Printf("[WebRTCPeer] Track %s follows its monitor from index %d to %d", mt.track.ID(), mt.index, mon.Index)
+		close(mt.stop)
+		moved := &monitorTrack{index: mon.Index, monitor: mon, track: mt.track, sender: mt.sender, sink: mt.sink, stop: make(chan struct{})}
+		if relay != nil {
+			moved.sink = relay.stream(mon.Index)
+		}
+		tracks = append(tracks, moved)
+		started = append(started, moved)
+	}
+	wp.monitorTracks = tracks
+
+	for _, mon := range added {
+		if relay == nil && pc == nil {
+			break
+		}
+		mt, err := wp.newMonitorTrackLocked(pc, relay, mon)
+		if err != nil {
+			log.Printf("[WebRTCPeer] %v", err)
+			continue
+		}
+		log.Printf("[WebRTCPeer] Monitor %d attached, publishing track %s", mon.Index, mt.track.ID())
+		wp.monitorTracks = append(wp.monitorTracks, mt)
+		started = append(started, mt)
+		renegotiate = renegotiate || relay == nil
+	}
+	streaming := wp.streaming
+	wp.mu.Unlock()
+
+	if streaming {
+		for _, mt := range started {
+			go wp.sendMonitorTrackFrames(mt)
+		}
+	}
+	if renegotiate {
+		wp.renegotiate()
+	}
+
+	if err := wp.sendMonitorsMessage(); err != nil {
+		log.Printf("[WebRTCPeer] Failed to send monitors message: %v", err)
+	}
+}
+
+// renegotiate offers the operator the current set of tracks after monitors were
+// added or removed; the answer arrives through signalling
+func (wp *WebRTCPeer) renegotiate() {
+	if wp.signalClient == nil {
+		return
+	}
+	offer, err := wp.CreateOffer()
+	if err != nil {
+		log.Printf("[WebRTCPeer] Failed to renegotiate tracks: %v", err)
+		return
+	}
+	if err := wp.signalClient.SendSignal("offer", offer); err != nil {
+		log.Printf("[WebRTCPeer] Failed to send renegotiation offer: %v", err)
+		return
+	}
+	log.Println("[WebRTCPeer] Sent renegotiation offer for the new monitor layout")
+}
+
+// sendMonitorsMessage reports the current monitor layout to the viewer
+func (wp *WebRTCPeer) sendMonitorsMessage() error {
+	// A console session has no monitors; the viewer gets a full console frame instead
+	if console := wp.getConsole(); console != nil {
+		console.Refresh()
+		return nil
+	}
+
+	monitors := wp.screenCapture.GetMonitors()
+
+	wp.mu.RLock()
+	trackIDs := make(map[int]string, len(wp.monitorTracks))
+	for _, mt := range wp.monitorTracks {
+		trackIDs[mt.index] = mt.track.ID()
+	}
+	perMonitor := wp.perMonitorTracks
+	wp.mu.RUnlock()
+
+	summaries := make([]monitorSummary, 0, len(monitors.Monitors))
+	for _, mon := range monitors.Monitors {
+		summaries = append(summaries, monitorSummary{MonitorInfo: mon, TrackID: trackIDs[mon.Index]})
+	}
+
+	return wp.sendDataChannelMessage(monitorsMessage{
+		Type:          "monitors",
+		Monitors:      summaries,
+		ActiveIndex:   wp.screenCapture.GetMonitorIndex(),
+		VirtualWidth:  monitors.VirtualWidth,
+		VirtualHeight: monitors.VirtualHeight,
+		PerMonitor:    perMonitor,
+		Window:        wp.screenCapture.GetWindow(),
+	})
+}
@@ -0,0 +1,124 @@
+package remotecontrol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func monitorAt(index, x, y, width, height int) MonitorInfo {
+	return MonitorInfo{Index: index, X: x, Y: y, Width: width, Height: height}
+}
+
+func TestMatchMonitors(t *testing.T) {
+	left := monitorAt(0, 0, 0, 1920, 1080)
+	middle := monitorAt(1, 1920, 0, 2560, 1440)
+	right := monitorAt(2, 4480, 0, 1920, 1080)
+
+	cases := []struct {
+		name        string
+		previous    []MonitorInfo
+		current     []MonitorInfo
+		wantMatches []int
+		wantAdded   []MonitorInfo
+	}{
+		{
+			name:        "unchanged",
+			previous:    []MonitorInfo{left, middle},
+			current:     []MonitorInfo{left, middle},
+			wantMatches: []int{0, 1},
+		},
+		{
+			name:        "middle unplugged, right shifts down an index",
+			previous:    []MonitorInfo{left, middle, right},
+			current:     []MonitorInfo{left, monitorAt(1, 4480, 0, 1920, 1080)},
+			wantMatches: []int{0, -1, 1},
+		},
+		{
+			name:        "left unplugged, desktop origin moves",
+			previous:    []MonitorInfo{left, middle},
+			current:     []MonitorInfo{monitorAt(0, 0, 0, 2560, 1440)},
+			wantMatches: []int{-1, 0},
+		},
+		{
+			name:        "monitor attached",
+			previous:    []MonitorInfo{left},
+			current:     []MonitorInfo{left, middle},
+			wantMatches: []int{0},
+			wantAdded:   []MonitorInfo{middle},
+		},
+		{
+			name:        "resolution change keeps the monitor",
+			previous:    []MonitorInfo{left},
+			current:     []MonitorInfo{monitorAt(0, 0, 0, 1280, 720)},
+			wantMatches: []int{0},
+		},
+		{
+			name:        "everything unplugged",
+			previous:    []MonitorInfo{left, middle},
+			current:     nil,
+			wantMatches: []int{-1, -1},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			matches, added := matchMonitors(tc.previous, tc.current)
+			if !reflect.DeepEqual(matches, tc.wantMatches) {
+				t.Errorf("matches = %v, want %v", matches, tc.wantMatches)
+			}
+			if !reflect.DeepEqual(added, tc.wantAdded) {
+				t.Errorf("added = %v, want %v", added, tc.wantAdded)
+			}
+		})
+	}
+}
+
+func TestRemapMonitorIndex(t *testing.T) {
+	previous := MultiMonitorInfo{Monitors: []MonitorInfo{
+		monitorAt(0, 0, 0, 1920, 1080),
+		monitorAt(1, 1920, 0, 2560, 1440),
+	}}
+	current := MultiMonitorInfo{Monitors: []MonitorInfo{
+		{Index: 0, X: 1920, Y: 0, Width: 2560, Height: 1440, Primary: true},
+	}}
+
+	if got := remapMonitorIndex(1, previous, current); got != 0 {
+		t.Errorf("captured monitor remapped to %d, want 0", got)
+	}
+	if got := remapMonitorIndex(0, previous, current); got != 0 {
+		t.Errorf("vanished monitor remapped to %d, want the primary (0)", got)
+	}
+	if got := remapMonitorIndex(-1, previous, current); got != -1 {
+		t.Errorf("virtual desktop remapped to %d, want -1", got)
+	}
+}
+
+func TestPerMonitorTracksRefusedOnExplicitDisplay(t *testing.T) {
+	tests := []struct {
+		name      string
+		display   *X11Display
+		graphical bool
+	}{
+		{"virtual display", &X11Display{Display: ":99"}, false},
+		{"graphical sessions", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capture := NewScreenCapture()
+			capture.SetX11Display(tt.display)
+			wp := NewWebRTCPeer(capture, nil)
+			defer wp.Close()
+			wp.SetPerMonitorTracks(true)
+			if tt.graphical {
+				wp.SetGraphicalSessions(newGraphicalSessions(capture, nil, nil))
+			}
+
+			if err := wp.Init(nil); err != nil {
+				t.Fatal(err)
+			}
+			if wp.perMonitorTracks || len(wp.monitorTracks) != 0 {
+				t.Errorf("per-monitor tracks = %t with %d tracks, want a single track", wp.perMonitorTracks, len(wp.monitorTracks))
+			}
+		})
+	}
+}
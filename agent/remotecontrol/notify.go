@@ -0,0 +1,29 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// NotifyUser shows a desktop notification to the interactive user. It is best
+// effort: the agent may run without access to the user's desktop.
+func NotifyUser(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		// msg reaches every interactive session, including from the service session
+		cmd = exec.Command("msg", "*", "/TIME:60", title+": "+message)
+	case "darwin":
+		cmd = exec.Command("osascript", "-e",
+			fmt.Sprintf("display notification %q with title %q", message, title))
+	default:
+		cmd = exec.Command("notify-send", "--app-name=Deskwise", title, message)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to notify user: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
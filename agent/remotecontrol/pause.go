@@ -0,0 +1,323 @@
+package remotecontrol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// End-user pause.
+//
+// The person at the machine can pause an active session, e.g. to type a password.
+// While paused the display is not read at all: the operator gets a static "Paused
+// by user" frame, and mouse and keyboard input from the viewer is dropped. Terminal
+// output is held back and keystrokes dropped, forwarded ports are closed and file
+// requests refused. Connected VNC clients are paused too. The viewer is told on the
+// control channel (again when it reconnects while paused):
+//
+//	{"type":"pause","paused":true,"by":"user","time":"2024-01-01T12:00:00Z"}
+//
+// The control is on the chat endpoint (see chat.go), which `-session pause|resume`
+// and tray helpers use:
+//
+//	GET  /v1/session         {"type":"session-state","sessionId":"...","active":true,"paused":false}
+//	POST /v1/session/pause   pauses the active session and answers with its state
+//	POST /v1/session/resume  resumes it
+//
+// Helpers following /v1/chat/events receive the same session-state events.
+
+// pausedFrameInterval is how often the placeholder is repeated while paused
+const pausedFrameInterval = time.Second
+
+// pausedFrameText is drawn on the placeholder frame
+const pausedFrameText = "Paused by user"
+
+// errNoActiveSession is returned when there is no session to pause or resume
+var errNoActiveSession = errors.New("no remote session in progress")
+
+// errPausedByUser refuses operator requests while the session is paused
+var errPausedByUser = errors.New("the user has paused the remote session")
+
+// SessionState is what the end user's pause control reports about the active session
+type SessionState struct {
+	Type      string `json:"type"` // "session-state"
+	SessionID string `json:"sessionId,omitempty"`
+	Active    bool   `json:"active"`
+	Paused    bool   `json:"paused"`
+}
+
+// pauseEvent tells the viewer the end user paused or resumed the session
+type pauseEvent struct {
+	Type   string `json:"type"` // "pause"
+	Paused bool   `json:"paused"`
+	By     string `json:"by"` // "user"
+	Time   string `json:"time"`
+}
+
+// renderPlaceholderFrame draws a dark frame with centred text, streamed instead of
+// the display while it must not be shown
+func renderPlaceholderFrame(width, height int, text string) *image.RGBA {
+	frame := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(frame, frame.Bounds(), image.NewUniform(color.RGBA{32, 36, 44, 255}), image.Point{}, draw.Src)
+
+	parsed, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		log.Printf("[ScreenCapture] Failed to load font for the placeholder frame: %v", err)
+		return frame
+	}
+	size := float64(height) / 16
+	if size < watermarkMinFontSize {
+		size = watermarkMinFontSize
+	}
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		log.Printf("[ScreenCapture] Failed to create font face for the placeholder frame: %v", err)
+		return frame
+	}
+	defer face.Close()
+
+	// Centre the text on the frame
+	metrics := face.Metrics()
+	textWidth := font.MeasureString(face, text).Ceil()
+	textHeight := (metrics.Ascent + metrics.Descent).Ceil()
+	drawer := &font.Drawer{
+		Dst:  frame,
+		Src:  image.NewUniform(color.RGBA{230, 230, 230, 255}),
+		Face: face,
+		Dot:  fixed.P((width-textWidth)/2, (height-textHeight)/2+metrics.Ascent.Ceil()),
+	}
+	drawer.DrawString(text)
+	return frame
+}
+
+// pauseGate holds operator traffic back while the end user has paused the session;
+// the zero value is not paused
+type pauseGate struct {
+	mu      sync.Mutex
+	resumed chan struct{} // Non-nil while paused, closed on resume
+}
+
+// set pauses or resumes; it returns false when the gate already was in that state
+func (g *pauseGate) set(paused bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if paused == (g.resumed != nil) {
+		return false
+	}
+	if paused {
+		g.resumed = make(chan struct{})
+	} else {
+		close(g.resumed)
+		g.resumed = nil
+	}
+	return true
+}
+
+func (g *pauseGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resumed != nil
+}
+
+// wait blocks while paused; it returns false when done is closed first
+func (g *pauseGate) wait(done <-chan struct{}) bool {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// copyRGBA returns a copy of img that consumers may draw on
+func copyRGBA(img *image.RGBA) *image.RGBA {
+	copied := &image.RGBA{Pix: make([]byte, len(img.Pix)), Stride: img.Stride, Rect: img.Rect}
+	copy(copied.Pix, img.Pix)
+	return copied
+}
+
+// SetPaused stops reading the display and repeats a "Paused by user" frame instead
+// (paused=false goes back to capturing)
+func (sc *ScreenCapture) SetPaused(paused bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if paused == (sc.paused != nil) {
+		return
+	}
+	if !paused {
+		sc.paused = nil
+		return
+	}
+
+	// Match the captured area so the viewer's layout and input mapping stay put
+	width, height := 1920, 1080
+	if sc.capturer != nil {
+		_, _, width, height = sc.captureAreaLocked()
+	} else if sc.monitorIndex >= 0 && sc.monitorIndex < len(sc.monitors.Monitors) {
+		width, height = sc.monitors.Monitors[sc.monitorIndex].Width, sc.monitors.Monitors[sc.monitorIndex].Height
+	}
+	if width <= 0 || height <= 0 {
+		width, height = 1920, 1080
+	}
+	sc.paused = renderPlaceholderFrame(width, height, pausedFrameText)
+}
+
+// IsPaused reports whether capture is sending the paused placeholder
+func (sc *ScreenCapture) IsPaused() bool {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.paused != nil
+}
+
+// SetPaused pauses or resumes the session for the end user and tells the viewer;
+// it returns false when the session already was in that state
+func (wp *WebRTCPeer) SetPaused(paused bool) bool {
+	wp.mu.Lock()
+	if wp.paused == paused {
+		wp.mu.Unlock()
+		return false
+	}
+	wp.paused = paused
+	wp.mu.Unlock()
+
+	// Per-monitor captures follow wp.paused from their own loops
+	wp.screenCapture.SetPaused(paused)
+
+	if paused {
+		log.Println("[WebRTCPeer] Session paused by the user")
+	} else {
+		log.Println("[WebRTCPeer] Session resumed by the user")
+	}
+	if err := wp.sendPauseEvent(paused); err != nil {
+		// The viewer is told again when it reconnects
+		log.Printf("[WebRTCPeer] Failed to send pause event: %v", err)
+	}
+	return true
+}
+
+func (wp *WebRTCPeer) isPaused() bool {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+	return wp.paused
+}
+
+// sendPauseState tells a viewer that (re)connects while the session is paused
+func (wp *WebRTCPeer) sendPauseState() {
+	if !wp.isPaused() {
+		return
+	}
+	if err := wp.sendPauseEvent(true); err != nil {
+		log.Printf("[WebRTCPeer] Failed to send pause event: %v", err)
+	}
+}
+
+func (wp *WebRTCPeer) sendPauseEvent(paused bool) error {
+	return wp.sendDataChannelMessage(pauseEvent{
+		Type:   "pause",
+		Paused: paused,
+		By:     "user",
+		Time:   time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// setPaused pauses or resumes everything the operator reaches through the session;
+// it returns false when the session already was in that state
+func (s *Session) setPaused(paused bool) bool {
+	if !s.webrtcPeer.SetPaused(paused) {
+		return false
+	}
+	if s.terminals != nil {
+		s.terminals.SetPaused(paused)
+	}
+	if s.portForwards != nil {
+		s.portForwards.SetPaused(paused)
+	}
+	if s.files != nil {
+		s.files.SetPaused(paused)
+	}
+	return true
+}
+
+// sessionState describes the session for the pause control (nil = no active session)
+func (s *Session) sessionState() SessionState {
+	if s == nil {
+		return SessionState{Type: "session-state"}
+	}
+	return SessionState{
+		Type:      "session-state",
+		SessionID: s.SessionID,
+		Active:    true,
+		Paused:    s.webrtcPeer.isPaused(),
+	}
+}
+
+// ControlSession asks a running agent's chat endpoint to "pause" or "resume" its
+// active session, or for its "status"; it is the -session command line mode
+func ControlSession(endpoint, action string) (SessionState, error) {
+	var state SessionState
+	method, path := http.MethodPost, "/v1/session/"+action
+	switch action {
+	case "pause", "resume":
+	case "status":
+		method, path = http.MethodGet, "/v1/session"
+	default:
+		return state, fmt.Errorf("unknown session action %q (pause, resume or status)", action)
+	}
+
+	// Talk HTTP over the agent's Unix socket or loopback port
+	client := &http.Client{Timeout: 10 * time.Second}
+	baseURL := "http://" + endpoint
+	if socket, ok := strings.CutPrefix(endpoint, "unix:"); ok {
+		baseURL = "http://agent"
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}
+	}
+
+	request, err := http.NewRequest(method, baseURL+path, nil)
+	if err != nil {
+		return state, fmt.Errorf("failed to create session request: %w", err)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return state, fmt.Errorf("failed to reach the agent at %s: %w", endpoint, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return state, fmt.Errorf("agent refused to %s the session: %s", action, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(response.Body).Decode(&state); err != nil {
+		return state, fmt.Errorf("invalid session state from the agent: %w", err)
+	}
+	return state, nil
+}
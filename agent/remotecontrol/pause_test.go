@@ -0,0 +1,50 @@
+package remotecontrol
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPauseGate(t *testing.T) {
+	var gate pauseGate
+	done := make(chan struct{})
+
+	if gate.isPaused() || !gate.wait(done) {
+		t.Fatal("zero gate is paused")
+	}
+	if gate.set(false) {
+		t.Error("resuming an open gate reported a change")
+	}
+	if !gate.set(true) || gate.set(true) {
+		t.Error("pausing should report a change exactly once")
+	}
+
+	waited := make(chan bool)
+	go func() { waited <- gate.wait(done) }()
+	select {
+	case <-waited:
+		t.Fatal("wait returned while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	gate.set(false)
+	if ok := <-waited; !ok {
+		t.Error("wait returned false on resume")
+	}
+
+	gate.set(true)
+	go func() { waited <- gate.wait(done) }()
+	close(done)
+	if ok := <-waited; ok {
+		t.Error("wait returned true when done closed while paused")
+	}
+}
+
+func TestPausedPortForwardRefusesConnections(t *testing.T) {
+	pm := newPortForwardManager(PortForwardPolicy{Allow: []PortForwardRule{{Host: "127.0.0.1", Ports: "1-65535"}}})
+	pm.SetPaused(true)
+
+	if _, err := pm.connect(nil, nil, "127.0.0.1", 8080); !errors.Is(err, errPausedByUser) {
+		t.Errorf("connect while paused = %v, want %v", err, errPausedByUser)
+	}
+}
@@ -0,0 +1,441 @@
+package remotecontrol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// PortForwardRule allows forwarding to a host (name, IP or CIDR, "*" for any) on a set of ports
+type PortForwardRule struct {
+	Host  string `json:"host"`            // printer.lan, *.corp.local, 192.168.1.20, 10.0.0.0/24 or *
+	Ports string `json:"ports,omitempty"` // "80,443,5900-5910"; empty allows any port
+}
+
+// PortForwardPolicy is the server-supplied allowlist for TCP port forwarding
+type PortForwardPolicy struct {
+	Allow []PortForwardRule `json:"allow"`
+}
+
+const (
+	portForwardDialTimeout = 10 * time.Second
+	portForwardReadBuffer  = 16 << 10
+
+	// portForwardMaxStreams limits concurrent forwarded connections per session
+	portForwardMaxStreams = 32
+)
+
+// portForwardMessage is a JSON control message on a port-forward channel.
+// The viewer sends connect (and optionally eof); the agent answers connected,
+// eof, closed or error. TCP payload travels as binary messages.
+type portForwardMessage struct {
+	Type       string `json:"type"`
+	Host       string `json:"host,omitempty"`
+	Port       int    `json:"port,omitempty"`
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	BytesIn    int64  `json:"bytesIn,omitempty"`  // Received from the remote host
+	BytesOut   int64  `json:"bytesOut,omitempty"` // Sent to the remote host
+	Error      string `json:"error,omitempty"`
+}
+
+// PortForwardStats is the bandwidth accounting of port forwarding in a session
+type PortForwardStats struct {
+	ActiveStreams int                 `json:"activeStreams"`
+	TotalStreams  int                 `json:"totalStreams"`
+	BytesIn       int64               `json:"bytesIn"`
+	BytesOut      int64               `json:"bytesOut"`
+	Streams       []PortForwardStream `json:"streams"`
+}
+
+// PortForwardStream is the accounting of one forwarded connection
+type PortForwardStream struct {
+	Label    string    `json:"label"`
+	Target   string    `json:"target"`
+	Started  time.Time `json:"started"`
+	Ended    time.Time `json:"ended,omitempty"`
+	BytesIn  int64     `json:"bytesIn"`
+	BytesOut int64     `json:"bytesOut"`
+}
+
+// portForwardManager opens policy-approved TCP connections for a session
+type portForwardManager struct {
+	policy PortForwardPolicy
+	pause  pauseGate // No connections while the user has paused the session
+
+	mu       sync.Mutex
+	streams  map[*portForwardStream]struct{}
+	finished []PortForwardStream
+	closed   bool
+}
+
+// portForwardStream pipes one TCP connection over one data channel
+type portForwardStream struct {
+	label   string
+	target  string
+	started time.Time
+	conn    net.Conn
+	dc      *webrtc.DataChannel
+	sender  *dataChannelSender
+
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+
+	closeOnce sync.Once
+	localEOF  atomic.Bool // Viewer finished sending
+	remoteEOF atomic.Bool // Remote host finished sending
+}
+
+func newPortForwardManager(policy PortForwardPolicy) *portForwardManager {
+	return &portForwardManager{
+		policy:  policy,
+		streams: make(map[*portForwardStream]struct{}),
+	}
+}
+
+// HandleChannel waits for the connect request on a new port-forward channel
+func (pm *portForwardManager) HandleChannel(dc *webrtc.DataChannel) {
+	sender := newDataChannelSender(dc)
+	var current atomic.Pointer[portForwardStream]
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		stream := current.Load()
+		if !msg.IsString {
+			if stream == nil {
+				return
+			}
+			if _, err := stream.conn.Write(msg.Data); err != nil {
+				log.Printf("[PortForward] %s: write to %s failed: %v", stream.label, stream.target, err)
+				pm.closeStream(stream, err)
+				return
+			}
+			stream.bytesOut.Add(int64(len(msg.Data)))
+			return
+		}
+
+		var control portForwardMessage
+		if err := json.Unmarshal(msg.Data, &control); err != nil {
+			log.Printf("[PortForward] Invalid control message on %s: %v", dc.Label(), err)
+			return
+		}
+
+		switch control.Type {
+		case "connect":
+			if stream != nil {
+				return
+			}
+			stream, err := pm.connect(dc, sender, control.Host, control.Port)
+			if err != nil {
+				log.Printf("[PortForward] %s: %v", dc.Label(), err)
+				sender.SendJSON(portForwardMessage{Type: "error", Error: err.Error()})
+				dc.Close()
+				return
+			}
+
+			current.Store(stream)
+			sender.SendJSON(portForwardMessage{Type: "connected", RemoteAddr: stream.conn.RemoteAddr().String()})
+			go pm.pumpRemote(stream)
+
+		case "eof":
+			// Viewer half-closed its side; pass it on so the remote sees end of request
+			if stream == nil {
+				return
+			}
+			stream.localEOF.Store(true)
+			if tcp, ok := stream.conn.(*net.TCPConn); ok {
+				tcp.CloseWrite()
+			}
+			if stream.remoteEOF.Load() {
+				pm.closeStream(stream, nil)
+			}
+		}
+	})
+
+	dc.OnClose(func() {
+		if stream := current.Load(); stream != nil {
+			pm.closeStream(stream, nil)
+		}
+	})
+}
+
+// connect checks the target against the policy and dials it
+func (pm *portForwardManager) connect(dc *webrtc.DataChannel, sender *dataChannelSender, host string, port int) (*portForwardStream, error) {
+	if host == "" || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid target %s:%d", host, port)
+	}
+
+	if pm.pause.isPaused() {
+		return nil, errPausedByUser
+	}
+	address, err := pm.allowedAddress(host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	pm.mu.Lock()
+	if pm.closed {
+		pm.mu.Unlock()
+		return nil, fmt.Errorf("session is ending")
+	}
+	if len(pm.streams) >= portForwardMaxStreams {
+		pm.mu.Unlock()
+		return nil, fmt.Errorf("too many forwarded connections (max %d)", portForwardMaxStreams)
+	}
+	pm.mu.Unlock()
+
+	conn, err := net.DialTimeout("tcp", address, portForwardDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+
+	stream := &portForwardStream{
+		label:   dc.Label(),
+		target:  net.JoinHostPort(host, strconv.Itoa(port)),
+		started: time.Now(),
+		conn:    conn,
+		dc:      dc,
+		sender:  sender,
+	}
+
+	pm.mu.Lock()
+	if pm.closed {
+		pm.mu.Unlock()
+		conn.Close()
+		return nil, fmt.Errorf("session is ending")
+	}
+	if pm.pause.isPaused() {
+		pm.mu.Unlock()
+		conn.Close()
+		return nil, errPausedByUser
+	}
+	pm.streams[stream] = struct{}{}
+	pm.mu.Unlock()
+
+	log.Printf("[PortForward] %s: connected to %s (%s)", stream.label, stream.target, conn.RemoteAddr())
+	return stream, nil
+}
+
+// allowedAddress returns the address to dial if some rule permits host:port.
+// For IP and CIDR rules the checked IP itself is dialled so a second DNS lookup
+// cannot redirect the connection elsewhere.
+func (pm *portForwardManager) allowedAddress(host string, port int) (string, error) {
+	var candidates []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		candidates = []net.IP{ip}
+	}
+
+	for _, rule := range pm.policy.Allow {
+		if !portAllowed(rule.Ports, port) {
+			continue
+		}
+		if rule.Host == "*" || (candidates == nil && hostnameMatches(rule.Host, host)) {
+			return net.JoinHostPort(host, strconv.Itoa(port)), nil
+		}
+	}
+
+	if candidates == nil {
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			return "", fmt.Errorf("%s:%d is not allowed by policy", host, port)
+		}
+		candidates = ips
+	}
+
+	for _, rule := range pm.policy.Allow {
+		if !portAllowed(rule.Ports, port) {
+			continue
+		}
+		for _, ip := range candidates {
+			if ipMatches(rule.Host, ip) {
+				return net.JoinHostPort(ip.String(), strconv.Itoa(port)), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("%s:%d is not allowed by policy", host, port)
+}
+
+// hostnameMatches compares a hostname rule, supporting a leading "*." wildcard
+func hostnameMatches(rule, host string) bool {
+	if net.ParseIP(rule) != nil || strings.Contains(rule, "/") {
+		return false
+	}
+	rule = strings.ToLower(strings.TrimSuffix(rule, "."))
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if strings.HasPrefix(rule, "*.") {
+		return strings.HasSuffix(host, rule[1:])
+	}
+	return rule == host
+}
+
+// ipMatches compares an IP or CIDR rule
+func ipMatches(rule string, ip net.IP) bool {
+	if _, network, err := net.ParseCIDR(rule); err == nil {
+		return network.Contains(ip)
+	}
+	if ruleIP := net.ParseIP(rule); ruleIP != nil {
+		return ruleIP.Equal(ip)
+	}
+	return false
+}
+
+// portAllowed checks a port against a list like "80,443,5900-5910" (empty = any)
+func portAllowed(ports string, port int) bool {
+	if strings.TrimSpace(ports) == "" {
+		return true
+	}
+	for _, part := range strings.Split(ports, ",") {
+		part = strings.TrimSpace(part)
+		low, high, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(low))
+		if err != nil {
+			continue
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(strings.TrimSpace(high)); err != nil {
+				continue
+			}
+		}
+		if port >= from && port <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// pumpRemote copies data from the remote host to the viewer until the remote closes
+func (pm *portForwardManager) pumpRemote(stream *portForwardStream) {
+	buf := make([]byte, portForwardReadBuffer)
+	for {
+		n, err := stream.conn.Read(buf)
+		if n > 0 {
+			if sendErr := stream.sender.Send(append([]byte(nil), buf[:n]...)); sendErr != nil {
+				pm.closeStream(stream, sendErr)
+				return
+			}
+			stream.bytesIn.Add(int64(n))
+		}
+		if err == io.EOF {
+			// Remote finished sending; the viewer may still be sending
+			stream.remoteEOF.Store(true)
+			stream.sender.SendJSON(portForwardMessage{Type: "eof"})
+			if stream.localEOF.Load() {
+				pm.closeStream(stream, nil)
+			}
+			return
+		}
+		if err != nil {
+			pm.closeStream(stream, err)
+			return
+		}
+	}
+}
+
+// closeStream tears down both directions once and records the stream's accounting
+func (pm *portForwardManager) closeStream(stream *portForwardStream, cause error) {
+	stream.closeOnce.Do(func() {
+		stream.conn.Close()
+
+		summary := stream.summary()
+		summary.Ended = time.Now()
+
+		pm.mu.Lock()
+		delete(pm.streams, stream)
+		pm.finished = append(pm.finished, summary)
+		pm.mu.Unlock()
+
+		message := portForwardMessage{Type: "closed", BytesIn: summary.BytesIn, BytesOut: summary.BytesOut}
+		if cause != nil && !errors.Is(cause, net.ErrClosed) {
+			message.Error = cause.Error()
+		}
+		if stream.dc.ReadyState() == webrtc.DataChannelStateOpen {
+			stream.sender.SendJSON(message)
+			stream.dc.Close()
+		}
+
+		log.Printf("[PortForward] %s: closed %s after %v (in %d bytes, out %d bytes)",
+			stream.label, stream.target, summary.Ended.Sub(summary.Started).Round(time.Millisecond),
+			summary.BytesIn, summary.BytesOut)
+	})
+}
+
+func (s *portForwardStream) summary() PortForwardStream {
+	return PortForwardStream{
+		Label:    s.label,
+		Target:   s.target,
+		Started:  s.started,
+		BytesIn:  s.bytesIn.Load(),
+		BytesOut: s.bytesOut.Load(),
+	}
+}
+
+// Stats returns the bandwidth accounting of active and finished streams
+func (pm *portForwardManager) Stats() PortForwardStats {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	stats := PortForwardStats{
+		ActiveStreams: len(pm.streams),
+		TotalStreams:  len(pm.streams) + len(pm.finished),
+		Streams:       append([]PortForwardStream(nil), pm.finished...),
+	}
+	for stream := range pm.streams {
+		stats.Streams = append(stats.Streams, stream.summary())
+	}
+	for _, stream := range stats.Streams {
+		stats.BytesIn += stream.BytesIn
+		stats.BytesOut += stream.BytesOut
+	}
+	return stats
+}
+
+// SetPaused drops every forwarded connection when the user pauses the session and
+// refuses new ones until it is resumed
+func (pm *portForwardManager) SetPaused(paused bool) {
+	if !pm.pause.set(paused) || !paused {
+		return
+	}
+
+	pm.mu.Lock()
+	streams := make([]*portForwardStream, 0, len(pm.streams))
+	for stream := range pm.streams {
+		streams = append(streams, stream)
+	}
+	pm.mu.Unlock()
+
+	for _, stream := range streams {
+		pm.closeStream(stream, errPausedByUser)
+	}
+}
+
+// Close drops every forwarded connection when the session ends
+func (pm *portForwardManager) Close() PortForwardStats {
+	pm.mu.Lock()
+	pm.closed = true
+	streams := make([]*portForwardStream, 0, len(pm.streams))
+	for stream := range pm.streams {
+		streams = append(streams, stream)
+	}
+	pm.mu.Unlock()
+
+	for _, stream := range streams {
+		pm.closeStream(stream, nil)
+	}
+
+	stats := pm.Stats()
+	if stats.TotalStreams > 0 {
+		log.Printf("[PortForward] Session totals: %d stream(s), in %d bytes, out %d bytes",
+			stats.TotalStreams, stats.BytesIn, stats.BytesOut)
+	}
+	return stats
+}
@@ -0,0 +1,118 @@
+package remotecontrol
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPortAllowed(t *testing.T) {
+	cases := []struct {
+		ports string
+		port  int
+		want  bool
+	}{
+		{"", 22, true},
+		{"  ", 22, true},
+		{"80,443", 443, true},
+		{"80,443", 8080, false},
+		{"5900-5910", 5900, true},
+		{"5900-5910", 5910, true},
+		{"5900-5910", 5911, false},
+		{"80, 443 , 3389", 3389, true},
+		{"ssh,22", 22, true},
+		{"ssh", 22, false},
+		{"100-x", 100, false},
+	}
+
+	for _, tc := range cases {
+		if got := portAllowed(tc.ports, tc.port); got != tc.want {
+			t.Errorf("portAllowed(%q, %d) = %v, want %v", tc.ports, tc.port, got, tc.want)
+		}
+	}
+}
+
+func TestHostnameMatches(t *testing.T) {
+	cases := []struct {
+		rule, host string
+		want       bool
+	}{
+		{"printer.lan", "printer.lan", true},
+		{"printer.lan", "PRINTER.LAN.", true},
+		{"printer.lan", "printer.lan.evil.com", false},
+		{"*.corp.local", "wiki.corp.local", true},
+		{"*.corp.local", "a.b.corp.local", true},
+		{"*.corp.local", "corp.local", false},
+		{"*.corp.local", "evilcorp.local", false},
+		{"10.0.0.0/24", "10.0.0.5", false},
+		{"192.168.1.20", "192.168.1.20", false}, // IP rules are compared as IPs
+	}
+
+	for _, tc := range cases {
+		if got := hostnameMatches(tc.rule, tc.host); got != tc.want {
+			t.Errorf("hostnameMatches(%q, %q) = %v, want %v", tc.rule, tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestIPMatches(t *testing.T) {
+	cases := []struct {
+		rule, ip string
+		want     bool
+	}{
+		{"10.0.0.0/24", "10.0.0.200", true},
+		{"10.0.0.0/24", "10.0.1.1", false},
+		{"192.168.1.20", "192.168.1.20", true},
+		{"192.168.1.20", "192.168.1.21", false},
+		{"fd00::/8", "fd12::1", true},
+		{"printer.lan", "192.168.1.20", false},
+	}
+
+	for _, tc := range cases {
+		if got := ipMatches(tc.rule, net.ParseIP(tc.ip)); got != tc.want {
+			t.Errorf("ipMatches(%q, %s) = %v, want %v", tc.rule, tc.ip, got, tc.want)
+		}
+	}
+}
+
+func TestAllowedAddress(t *testing.T) {
+	pm := newPortForwardManager(PortForwardPolicy{Allow: []PortForwardRule{
+		{Host: "printer.lan", Ports: "80,443"},
+		{Host: "*.corp.local", Ports: "22"},
+		{Host: "10.0.0.0/24", Ports: "5900-5910"},
+		{Host: "127.0.0.1", Ports: "8080"},
+	}})
+
+	cases := []struct {
+		host string
+		port int
+		want string // "" = refused
+	}{
+		{"printer.lan", 443, "printer.lan:443"},
+		{"printer.lan", 22, ""},
+		{"build.corp.local", 22, "build.corp.local:22"},
+		{"10.0.0.7", 5901, "10.0.0.7:5901"},
+		{"10.0.0.7", 22, ""},
+		{"10.0.1.7", 5901, ""},
+		{"127.0.0.1", 8080, "127.0.0.1:8080"},
+		{"127.0.0.1", 8081, ""},
+		{"localhost", 8080, "127.0.0.1:8080"}, // Resolved and dialled by IP
+		{"::1", 8080, ""},
+	}
+
+	for _, tc := range cases {
+		got, err := pm.allowedAddress(tc.host, tc.port)
+		switch {
+		case tc.want == "" && err == nil:
+			t.Errorf("allowedAddress(%s, %d) = %s, want refused", tc.host, tc.port, got)
+		case tc.want != "" && err != nil:
+			t.Errorf("allowedAddress(%s, %d) refused: %v", tc.host, tc.port, err)
+		case tc.want != "" && got != tc.want:
+			t.Errorf("allowedAddress(%s, %d) = %s, want %s", tc.host, tc.port, got, tc.want)
+		}
+	}
+
+	empty := newPortForwardManager(PortForwardPolicy{})
+	if got, err := empty.allowedAddress("127.0.0.1", 8080); err == nil {
+		t.Errorf("empty policy allowed %s", got)
+	}
+}
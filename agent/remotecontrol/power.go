@@ -0,0 +1,486 @@
+package remotecontrol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Remote power actions.
+//
+// Power actions are opt-in: the agent only carries them out (and only reports the
+// PowerActions capability) when started with -power-actions. The server delivers
+// them next to sessions in the rc/poll response:
+//
+//	{"power":{"requestId":"p-1","action":"reboot","delaySeconds":300,"message":"Installing updates",
+//	          "requireIdle":true,"idleMinutes":10,"idleTimeoutMinutes":120}}
+//	{"power":{"requestId":"p-2","action":"cancel","cancelRequestId":"p-1"}}
+//
+// Actions are reboot, shutdown, logoff and lock. Logged-in users are warned when
+// the action is scheduled and again a minute before it runs (desktop notification,
+// wall on Unix, and the chat helper). With requireIdle the action waits until no
+// user has touched the machine for idleMinutes, and is skipped if that does not
+// happen within idleTimeoutMinutes; a machine nobody is logged in to counts as idle.
+//
+// Every step is reported to /api/agent/rc/power with the request ID:
+//
+//	{"requestId":"p-1","action":"reboot","status":"scheduled","scheduledFor":"...","time":"..."}
+//
+// Statuses are scheduled, waiting-idle, cancelled, skipped, failed and completed.
+// A reboot or shutdown is completed once the agent starts again in a new boot
+// ("bootTime" is reported); reports the server has not accepted yet, and the
+// action being carried out, are kept in a state file so they survive the restart.
+
+const (
+	powerReboot   = "reboot"
+	powerShutdown = "shutdown"
+	powerLogoff   = "logoff"
+	powerLock     = "lock"
+	powerCancel   = "cancel"
+
+	defaultPowerIdleMinutes  = 5
+	defaultPowerIdleTimeout  = 60 // minutes
+	maxPowerDelay            = 24 * 60 * 60
+	powerFinalWarning        = time.Minute // Second warning this long before the action
+	powerIdlePollInterval    = 30 * time.Second
+	powerHandledMemory       = 50              // Request IDs remembered, so repeated commands run once
+	powerRebootBootTimeSlack = 5 * time.Second // Boot times computed from uptime may jitter
+)
+
+// errNoInteractiveUser is returned by userIdleTime when nobody is logged in
+var errNoInteractiveUser = errors.New("no interactive user is logged in")
+
+// PowerRequest is a power action delivered through rc/poll
+type PowerRequest struct {
+	RequestID   string `json:"requestId"`                    // Correlation ID, echoed in every report
+	Action      string `json:"action"`                       // reboot, shutdown, logoff, lock or cancel
+	Delay       int    `json:"delaySeconds,omitempty"`       // Wait before acting, so users can save their work
+	Message     string `json:"message,omitempty"`            // Shown to logged-in users with the warning
+	RequireIdle bool   `json:"requireIdle,omitempty"`        // Only act once the user is idle
+	IdleMinutes int    `json:"idleMinutes,omitempty"`        // Idle time required (default 5)
+	IdleTimeout int    `json:"idleTimeoutMinutes,omitempty"` // Give up waiting for idle after this (default 60)
+	CancelID    string `json:"cancelRequestId,omitempty"`    // cancel: the action to cancel (empty = the pending one)
+}
+
+// PowerReport tells the server how a power action went
+type PowerReport struct {
+	RequestID    string `json:"requestId"`
+	Action       string `json:"action"`
+	Status       string `json:"status"` // scheduled, waiting-idle, cancelled, skipped, failed or completed
+	Error        string `json:"error,omitempty"`
+	ScheduledFor string `json:"scheduledFor,omitempty"`
+	BootTime     string `json:"bootTime,omitempty"` // Start of the boot a reboot or shutdown led to
+	Time         string `json:"time"`
+}
+
+// PowerConfig enables power actions
+type PowerConfig struct {
+	StateFile string                  // Keeps the action being carried out and unsent reports across restarts
+	BootTime  time.Time               // Start of the current boot, to tell whether a reboot happened
+	Report    func(PowerReport) error // Sends a report to the server
+}
+
+// normalized fills in defaults and validates the request
+func (r PowerRequest) normalized() (PowerRequest, error) {
+	if r.RequestID == "" {
+		return r, fmt.Errorf("power request has no ID")
+	}
+	switch r.Action {
+	case powerReboot, powerShutdown, powerLogoff, powerLock, powerCancel:
+	default:
+		return r, fmt.Errorf("unknown power action %q (reboot, shutdown, logoff, lock or cancel)", r.Action)
+	}
+	if r.Delay < 0 || r.Delay > maxPowerDelay {
+		return r, fmt.Errorf("power action delay %ds outside 0-%d", r.Delay, maxPowerDelay)
+	}
+	if r.IdleMinutes <= 0 {
+		r.IdleMinutes = defaultPowerIdleMinutes
+	}
+	if r.IdleTimeout <= 0 {
+		r.IdleTimeout = defaultPowerIdleTimeout
+	}
+	return r, nil
+}
+
+// warning is the text shown to logged-in users
+func (r PowerRequest) warning(due time.Time) string {
+	verb := map[string]string{
+		powerReboot:   "This computer will restart",
+		powerShutdown: "This computer will shut down",
+		powerLogoff:   "You will be logged off",
+		powerLock:     "This computer will be locked",
+	}[r.Action]
+
+	text := verb + " now."
+	if wait := time.Until(due).Round(time.Second); wait >= time.Second {
+		text = fmt.Sprintf("%s in %s (at %s).", verb, formatPowerDelay(wait), due.Format("15:04"))
+	}
+	if r.RequireIdle {
+		text += " It waits until the computer is not in use."
+	}
+	if r.Message != "" {
+		text += " " + r.Message
+	}
+	return text + " Please save your work."
+}
+
+func formatPowerDelay(d time.Duration) string {
+	if d < 2*time.Second {
+		return "1 second"
+	}
+	if d < time.Minute {
+		return fmt.Sprintf("%d seconds", int(d.Seconds()))
+	}
+	minutes := int((d + 30*time.Second) / time.Minute)
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+// powerEvent tells chat helpers about a power action
+type powerEvent struct {
+	Type      string `json:"type"` // "power-action"
+	RequestID string `json:"requestId"`
+	Action    string `json:"action"`
+	Text      string `json:"text"`
+}
+
+// powerState is what the state file keeps
+type powerState struct {
+	Scheduled *PowerRequest   `json:"scheduled,omitempty"` // Waiting for its delay or for the user to be idle
+	Executing *powerExecution `json:"executing,omitempty"` // Reboot or shutdown issued; known once the agent restarts
+	Reports   []PowerReport   `json:"reports,omitempty"`   // Not accepted by the server yet
+	Handled   []string        `json:"handled,omitempty"`   // Recent request IDs
+}
+
+type powerExecution struct {
+	Request  PowerRequest `json:"request"`
+	IssuedAt time.Time    `json:"issuedAt"`
+	BootTime time.Time    `json:"bootTime"` // Boot the action was issued in
+}
+
+// scheduledPowerAction is the action waiting to run
+type scheduledPowerAction struct {
+	request PowerRequest
+	cancel  chan struct{}
+}
+
+// powerManager schedules power actions and reports them; at most one is pending
+type powerManager struct {
+	config PowerConfig
+	warn   func(request PowerRequest, text string) // Shows a warning to logged-in users
+
+	mu       sync.Mutex
+	state    powerState
+	pending  *scheduledPowerAction
+	flushMu  sync.Mutex // Serializes sending reports
+	runPower func(action string) error
+	idleTime func() (time.Duration, error)
+}
+
+// newPowerManager loads the state file and turns what happened before the agent
+// (re)started into reports
+func newPowerManager(config PowerConfig, warn func(PowerRequest, string)) (*powerManager, error) {
+	pm := &powerManager{config: config, warn: warn, runPower: runPowerAction, idleTime: userIdleTime}
+
+	data, err := os.ReadFile(config.StateFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read power action state: %w", err)
+	default:
+		if err := json.Unmarshal(data, &pm.state); err != nil {
+			log.Printf("[Power] Ignoring unreadable state file %s: %v", config.StateFile, err)
+			pm.state = powerState{}
+		}
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if executing := pm.state.Executing; executing != nil {
+		pm.state.Executing = nil
+		request := executing.Request
+		if config.BootTime.Sub(executing.BootTime) > powerRebootBootTimeSlack {
+			log.Printf("[Power] %s %s completed (booted at %s)", request.Action, request.RequestID, config.BootTime.Format(time.RFC3339))
+			report := newPowerReport(request, "completed", nil)
+			report.BootTime = config.BootTime.UTC().Format(time.RFC3339)
+			pm.state.Reports = append(pm.state.Reports, report)
+		} else {
+			pm.state.Reports = append(pm.state.Reports, newPowerReport(request, "failed",
+				fmt.Errorf("the agent restarted but the machine did not (issued at %s)", executing.IssuedAt.UTC().Format(time.RFC3339))))
+		}
+	}
+	if scheduled := pm.state.Scheduled; scheduled != nil {
+		pm.state.Scheduled = nil
+		pm.state.Reports = append(pm.state.Reports, newPowerReport(*scheduled, "failed",
+			fmt.Errorf("the agent stopped before the action ran")))
+	}
+	if err := pm.saveLocked(); err != nil {
+		log.Printf("[Power] %v", err)
+	}
+	return pm, nil
+}
+
+func newPowerReport(request PowerRequest, status string, failure error) PowerReport {
+	report := PowerReport{
+		RequestID: request.RequestID,
+		Action:    request.Action,
+		Status:    status,
+		Time:      time.Now().UTC().Format(time.RFC3339),
+	}
+	if failure != nil {
+		report.Error = failure.Error()
+	}
+	return report
+}
+
+// saveLocked writes the state file; pm.mu must be held
+func (pm *powerManager) saveLocked() error {
+	data, err := json.MarshalIndent(pm.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal power action state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(pm.config.StateFile), 0755); err != nil {
+		return fmt.Errorf("failed to save power action state: %w", err)
+	}
+	// Write and rename, so a reboot never leaves half a file
+	tmp := pm.config.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save power action state: %w", err)
+	}
+	if err := os.Rename(tmp, pm.config.StateFile); err != nil {
+		return fmt.Errorf("failed to save power action state: %w", err)
+	}
+	return nil
+}
+
+// report queues a report, keeps it on disk until the server accepts it and sends it
+func (pm *powerManager) report(report PowerReport) {
+	pm.mu.Lock()
+	pm.state.Reports = append(pm.state.Reports, report)
+	if err := pm.saveLocked(); err != nil {
+		log.Printf("[Power] %v", err)
+	}
+	pm.mu.Unlock()
+
+	go pm.flush()
+}
+
+// flush sends queued reports; those the server does not accept are retried on
+// the next flush
+func (pm *powerManager) flush() {
+	pm.flushMu.Lock()
+	defer pm.flushMu.Unlock()
+
+	pm.mu.Lock()
+	reports := append([]PowerReport(nil), pm.state.Reports...)
+	pm.mu.Unlock()
+	if len(reports) == 0 || pm.config.Report == nil {
+		return
+	}
+
+	sent := 0
+	for _, report := range reports {
+		if err := pm.config.Report(report); err != nil {
+			log.Printf("[Power] Failed to report %s %s: %v", report.RequestID, report.Status, err)
+			break
+		}
+		sent++
+	}
+	if sent == 0 {
+		return
+	}
+
+	pm.mu.Lock()
+	pm.state.Reports = pm.state.Reports[sent:]
+	if err := pm.saveLocked(); err != nil {
+		log.Printf("[Power] %v", err)
+	}
+	pm.mu.Unlock()
+}
+
+// handle starts, or cancels, the action a request asks for; requests already seen
+// are ignored, since the server repeats a command until it hears about it
+func (pm *powerManager) handle(request PowerRequest) {
+	request, err := request.normalized()
+	if err != nil {
+		log.Printf("[Power] Ignoring power request: %v", err)
+		if request.RequestID != "" {
+			pm.report(newPowerReport(request, "failed", err))
+		}
+		return
+	}
+
+	pm.mu.Lock()
+	for _, id := range pm.state.Handled {
+		if id == request.RequestID {
+			pm.mu.Unlock()
+			return
+		}
+	}
+	pm.state.Handled = append(pm.state.Handled, request.RequestID)
+	if len(pm.state.Handled) > powerHandledMemory {
+		pm.state.Handled = pm.state.Handled[len(pm.state.Handled)-powerHandledMemory:]
+	}
+
+	if request.Action == powerCancel {
+		pending := pm.pending
+		if pending == nil || (request.CancelID != "" && request.CancelID != pending.request.RequestID) {
+			pm.saveLocked()
+			pm.mu.Unlock()
+			pm.report(newPowerReport(request, "failed", fmt.Errorf("no pending power action to cancel")))
+			return
+		}
+		close(pending.cancel)
+		pm.pending = nil
+		pm.state.Scheduled = nil
+		pm.saveLocked()
+		pm.mu.Unlock()
+
+		log.Printf("[Power] %s %s cancelled by %s", pending.request.Action, pending.request.RequestID, request.RequestID)
+		pm.report(newPowerReport(pending.request, "cancelled", nil))
+		pm.report(newPowerReport(request, "completed", nil))
+		pm.warn(pending.request, "The scheduled "+pending.request.Action+" was cancelled.")
+		return
+	}
+
+	if pm.pending != nil {
+		other := pm.pending.request
+		pm.saveLocked()
+		pm.mu.Unlock()
+		pm.report(newPowerReport(request, "failed",
+			fmt.Errorf("%s %s is already pending; cancel it first", other.Action, other.RequestID)))
+		return
+	}
+	action := &scheduledPowerAction{request: request, cancel: make(chan struct{})}
+	pm.pending = action
+	pm.state.Scheduled = &request
+	if err := pm.saveLocked(); err != nil {
+		log.Printf("[Power] %v", err)
+	}
+	pm.mu.Unlock()
+
+	due := time.Now().Add(time.Duration(request.Delay) * time.Second)
+	log.Printf("[Power] %s %s scheduled for %s", request.Action, request.RequestID, due.Format(time.RFC3339))
+	report := newPowerReport(request, "scheduled", nil)
+	report.ScheduledFor = due.UTC().Format(time.RFC3339)
+	pm.report(report)
+	pm.warn(request, request.warning(due))
+
+	go pm.run(action, due)
+}
+
+// run waits for the delay (and for the user to be idle) and carries the action out
+func (pm *powerManager) run(action *scheduledPowerAction, due time.Time) {
+	request := action.request
+
+	if final := due.Add(-powerFinalWarning); time.Until(final) >= powerFinalWarning {
+		select {
+		case <-action.cancel:
+			return
+		case <-time.After(time.Until(final)):
+		}
+		pm.warn(request, request.warning(due))
+	}
+	select {
+	case <-action.cancel:
+		return
+	case <-time.After(time.Until(due)):
+	}
+
+	if request.RequireIdle && !pm.waitForIdle(action) {
+		return
+	}
+
+	// Past this point the action can no longer be cancelled
+	pm.mu.Lock()
+	if pm.pending != action {
+		pm.mu.Unlock()
+		return
+	}
+	pm.pending = nil
+	pm.state.Scheduled = nil
+	restarts := request.Action == powerReboot || request.Action == powerShutdown
+	if restarts {
+		pm.state.Executing = &powerExecution{Request: request, IssuedAt: time.Now(), BootTime: pm.config.BootTime}
+	}
+	if err := pm.saveLocked(); err != nil {
+		log.Printf("[Power] %v", err)
+	}
+	pm.mu.Unlock()
+
+	log.Printf("[Power] Carrying out %s %s", request.Action, request.RequestID)
+	if err := pm.runPower(request.Action); err != nil {
+		log.Printf("[Power] %s %s failed: %v", request.Action, request.RequestID, err)
+		// Cleared and queued in one save: a restart must not report the action again
+		pm.mu.Lock()
+		pm.state.Executing = nil
+		pm.state.Reports = append(pm.state.Reports, newPowerReport(request, "failed", err))
+		if err := pm.saveLocked(); err != nil {
+			log.Printf("[Power] %v", err)
+		}
+		pm.mu.Unlock()
+
+		go pm.flush()
+		return
+	}
+	if !restarts {
+		pm.report(newPowerReport(request, "completed", nil))
+	}
+}
+
+// waitForIdle returns true once the user has been idle long enough, and false
+// (after reporting why) when the action was cancelled or skipped
+func (pm *powerManager) waitForIdle(action *scheduledPowerAction) bool {
+	request := action.request
+	required := time.Duration(request.IdleMinutes) * time.Minute
+	deadline := time.Now().Add(time.Duration(request.IdleTimeout) * time.Minute)
+	waiting := false
+
+	for {
+		idle, err := pm.idleTime()
+		if errors.Is(err, errNoInteractiveUser) || (err == nil && idle >= required) {
+			return true
+		}
+
+		var failure error
+		switch {
+		case err != nil:
+			failure = fmt.Errorf("cannot tell whether the user is idle: %w", err)
+		case !time.Now().Before(deadline):
+			failure = fmt.Errorf("the user was not idle for %d minutes within %d minutes", request.IdleMinutes, request.IdleTimeout)
+		}
+		if failure != nil {
+			pm.mu.Lock()
+			current := pm.pending == action
+			if current {
+				pm.pending = nil
+				pm.state.Scheduled = nil
+				pm.saveLocked()
+			}
+			pm.mu.Unlock()
+			if current {
+				log.Printf("[Power] Skipping %s %s: %v", request.Action, request.RequestID, failure)
+				pm.report(newPowerReport(request, "skipped", failure))
+			}
+			return false
+		}
+
+		if !waiting {
+			waiting = true
+			log.Printf("[Power] %s %s waits for the user to be idle (idle %s)", request.Action, request.RequestID, idle.Round(time.Second))
+			pm.report(newPowerReport(request, "waiting-idle", nil))
+		}
+		select {
+		case <-action.cancel:
+			return false
+		case <-time.After(powerIdlePollInterval):
+		}
+	}
+}
@@ -0,0 +1,73 @@
+//go:build darwin
+// +build darwin
+
+package remotecontrol
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hidIdleTime matches the HID system's idle time in nanoseconds
+var hidIdleTime = regexp.MustCompile(`"HIDIdleTime" = (\d+)`)
+
+func runPowerAction(action string) error {
+	switch action {
+	case powerReboot:
+		return runCommand("shutdown", "-r", "now")
+	case powerShutdown:
+		return runCommand("shutdown", "-h", "now")
+	case powerLogoff:
+		uid, err := consoleUser()
+		if err != nil {
+			return err
+		}
+		return runCommand("launchctl", "bootout", "gui/"+uid)
+	case powerLock:
+		// Locks when the screen saver asks for the password immediately (the default)
+		return runCommand("pmset", "displaysleepnow")
+	default:
+		return fmt.Errorf("unknown power action %q", action)
+	}
+}
+
+// userIdleTime is the time since the last keyboard or mouse input
+func userIdleTime() (time.Duration, error) {
+	if _, err := consoleUser(); err != nil {
+		return 0, err
+	}
+	output, err := exec.Command("ioreg", "-c", "IOHIDSystem", "-d", "4").Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read HID idle time: %w", err)
+	}
+	match := hidIdleTime.FindSubmatch(output)
+	if match == nil {
+		return 0, fmt.Errorf("HID idle time not found")
+	}
+	nanoseconds, err := strconv.ParseInt(string(match[1]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid HID idle time: %w", err)
+	}
+	return time.Duration(nanoseconds), nil
+}
+
+// consoleUser returns the UID of the user logged in at the console
+func consoleUser() (string, error) {
+	output, err := exec.Command("stat", "-f", "%u", "/dev/console").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the console user: %w", err)
+	}
+	uid := strings.TrimSpace(string(output))
+	if uid == "0" || uid == "" {
+		return "", errNoInteractiveUser // The login window owns the console
+	}
+	return uid, nil
+}
+
+func warnLoggedInUsers(text string) error {
+	return warnWithWall(text)
+}
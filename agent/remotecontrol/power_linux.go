@@ -0,0 +1,102 @@
+//go:build linux
+// +build linux
+
+package remotecontrol
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// runPowerAction carries out a power action through logind (systemd), falling
+// back to shutdown(8) where systemd is not running
+func runPowerAction(action string) error {
+	switch action {
+	case powerReboot:
+		return runFirst([][]string{{"systemctl", "reboot"}, {"shutdown", "-r", "now"}})
+	case powerShutdown:
+		return runFirst([][]string{{"systemctl", "poweroff"}, {"shutdown", "-h", "now"}})
+	case powerLogoff:
+		sessions, err := logindUserSessions()
+		if err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			return errNoInteractiveUser
+		}
+		for _, session := range sessions {
+			if err := runCommand("loginctl", "terminate-session", session["Id"]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case powerLock:
+		return runCommand("loginctl", "lock-sessions")
+	default:
+		return fmt.Errorf("unknown power action %q", action)
+	}
+}
+
+// userIdleTime is how long the least idle user session has been idle, from
+// logind's idle hint (set by desktop environments, and from tty activity)
+func userIdleTime() (time.Duration, error) {
+	sessions, err := logindUserSessions()
+	if err != nil {
+		return 0, err
+	}
+	if len(sessions) == 0 {
+		return 0, errNoInteractiveUser
+	}
+
+	idle := time.Duration(-1)
+	for _, session := range sessions {
+		sessionIdle := time.Duration(0)
+		if session["IdleHint"] == "yes" {
+			since, err := strconv.ParseInt(session["IdleSinceHint"], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid idle hint for session %s: %w", session["Id"], err)
+			}
+			sessionIdle = time.Since(time.UnixMicro(since))
+		}
+		if idle < 0 || sessionIdle < idle {
+			idle = sessionIdle
+		}
+	}
+	return idle, nil
+}
+
+// logindUserSessions lists the properties of logind sessions that belong to users
+// (not greeters or the service manager)
+func logindUserSessions() ([]map[string]string, error) {
+	all, err := listLogindSessions("Id", "Class", "State", "IdleHint", "IdleSinceHint")
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []map[string]string
+	for _, properties := range all {
+		if properties["Class"] == "user" && properties["State"] != "closing" {
+			sessions = append(sessions, properties)
+		}
+	}
+	return sessions, nil
+}
+
+// warnLoggedInUsers writes the warning to every terminal
+func warnLoggedInUsers(text string) error {
+	return warnWithWall(text)
+}
+
+// runFirst runs the first command that is installed
+func runFirst(commands [][]string) error {
+	var err error
+	for _, command := range commands {
+		if err = runCommand(command[0], command[1:]...); !errors.Is(err, exec.ErrNotFound) {
+			return err
+		}
+	}
+	return err
+}
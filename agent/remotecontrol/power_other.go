@@ -0,0 +1,22 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package remotecontrol
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+func runPowerAction(action string) error {
+	return fmt.Errorf("power actions are not supported on %s", runtime.GOOS)
+}
+
+func userIdleTime() (time.Duration, error) {
+	return 0, fmt.Errorf("idle time is not available on %s", runtime.GOOS)
+}
+
+func warnLoggedInUsers(text string) error {
+	return nil
+}
@@ -0,0 +1,338 @@
+package remotecontrol
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// powerRecorder collects the reports a power manager sends
+type powerRecorder struct {
+	mu      sync.Mutex
+	reports []PowerReport
+	fail    bool
+}
+
+func (r *powerRecorder) report(report PowerReport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail {
+		return errors.New("server unavailable")
+	}
+	r.reports = append(r.reports, report)
+	return nil
+}
+
+// statuses waits until n reports arrived and returns their "requestId status" pairs
+func (r *powerRecorder) statuses(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.mu.Lock()
+		reports := append([]PowerReport(nil), r.reports...)
+		r.mu.Unlock()
+		if len(reports) >= n || time.Now().After(deadline) {
+			statuses := make([]string, len(reports))
+			for i, report := range reports {
+				statuses[i] = report.RequestID + " " + report.Status
+			}
+			return statuses
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestPowerManager(t *testing.T, stateFile string, boot time.Time, recorder *powerRecorder) *powerManager {
+	t.Helper()
+	pm, err := newPowerManager(PowerConfig{StateFile: stateFile, BootTime: boot, Report: recorder.report},
+		func(PowerRequest, string) {})
+	if err != nil {
+		t.Fatalf("newPowerManager: %v", err)
+	}
+	pm.runPower = func(string) error { return nil }
+	pm.idleTime = func() (time.Duration, error) { return time.Hour, nil }
+	return pm
+}
+
+func readPowerState(t *testing.T, stateFile string) powerState {
+	t.Helper()
+	var state powerState
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("reading state file: %v", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("parsing state file: %v", err)
+	}
+	return state
+}
+
+func TestPowerActionRun(t *testing.T) {
+	cases := []struct {
+		name          string
+		request       PowerRequest
+		runErr        error
+		idle          time.Duration
+		idleErr       error
+		wantStatuses  []string
+		wantRun       bool
+		wantExecuting bool
+	}{
+		{
+			name:         "lock completes",
+			request:      PowerRequest{RequestID: "p-1", Action: powerLock},
+			wantStatuses: []string{"p-1 scheduled", "p-1 completed"},
+			wantRun:      true,
+		},
+		{
+			name:          "reboot is completed after the restart",
+			request:       PowerRequest{RequestID: "p-1", Action: powerReboot},
+			wantStatuses:  []string{"p-1 scheduled"},
+			wantRun:       true,
+			wantExecuting: true,
+		},
+		{
+			name:         "failed reboot is not left executing",
+			request:      PowerRequest{RequestID: "p-1", Action: powerReboot},
+			runErr:       errors.New("permission denied"),
+			wantStatuses: []string{"p-1 scheduled", "p-1 failed"},
+			wantRun:      true,
+		},
+		{
+			name:         "idle user",
+			request:      PowerRequest{RequestID: "p-1", Action: powerLogoff, RequireIdle: true, IdleMinutes: 10},
+			idle:         11 * time.Minute,
+			wantStatuses: []string{"p-1 scheduled", "p-1 completed"},
+			wantRun:      true,
+		},
+		{
+			name:          "nobody logged in counts as idle",
+			request:       PowerRequest{RequestID: "p-1", Action: powerShutdown, RequireIdle: true},
+			idleErr:       errNoInteractiveUser,
+			wantStatuses:  []string{"p-1 scheduled"},
+			wantRun:       true,
+			wantExecuting: true,
+		},
+		{
+			name:         "idle time unknown skips",
+			request:      PowerRequest{RequestID: "p-1", Action: powerReboot, RequireIdle: true},
+			idleErr:      errors.New("no idle counter"),
+			wantStatuses: []string{"p-1 scheduled", "p-1 skipped"},
+		},
+		{
+			name:         "invalid request fails",
+			request:      PowerRequest{RequestID: "p-1", Action: "hibernate"},
+			wantStatuses: []string{"p-1 failed"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stateFile := filepath.Join(t.TempDir(), "power.json")
+			recorder := &powerRecorder{}
+			pm := newTestPowerManager(t, stateFile, time.Now().Add(-time.Hour), recorder)
+
+			ran := make(chan string, 1)
+			pm.runPower = func(action string) error {
+				ran <- action
+				return tc.runErr
+			}
+			pm.idleTime = func() (time.Duration, error) { return tc.idle, tc.idleErr }
+
+			pm.handle(tc.request)
+			statuses := recorder.statuses(t, len(tc.wantStatuses))
+			if !reflect.DeepEqual(statuses, tc.wantStatuses) {
+				t.Errorf("reports = %v, want %v", statuses, tc.wantStatuses)
+			}
+
+			select {
+			case action := <-ran:
+				if !tc.wantRun {
+					t.Errorf("%s was carried out", action)
+				} else if action != tc.request.Action {
+					t.Errorf("carried out %s, want %s", action, tc.request.Action)
+				}
+			default:
+				if tc.wantRun {
+					t.Errorf("%s was not carried out", tc.request.Action)
+				}
+			}
+
+			pm.mu.Lock()
+			state := readPowerState(t, stateFile)
+			pm.mu.Unlock()
+			if (state.Executing != nil) != tc.wantExecuting {
+				t.Errorf("state file executing = %+v, want executing %v", state.Executing, tc.wantExecuting)
+			}
+			if state.Scheduled != nil {
+				t.Errorf("state file still has %s scheduled", state.Scheduled.RequestID)
+			}
+		})
+	}
+}
+
+func TestPowerActionAfterRestart(t *testing.T) {
+	boot := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	reboot := PowerRequest{RequestID: "p-1", Action: powerReboot}
+
+	cases := []struct {
+		name         string
+		state        powerState
+		boot         time.Time
+		wantStatuses []string
+	}{
+		{
+			name:         "machine rebooted",
+			state:        powerState{Executing: &powerExecution{Request: reboot, IssuedAt: boot.Add(time.Hour), BootTime: boot}},
+			boot:         boot.Add(time.Hour + time.Minute),
+			wantStatuses: []string{"p-1 completed"},
+		},
+		{
+			name:         "boot time jitter is not a reboot",
+			state:        powerState{Executing: &powerExecution{Request: reboot, IssuedAt: boot.Add(time.Hour), BootTime: boot}},
+			boot:         boot.Add(2 * time.Second),
+			wantStatuses: []string{"p-1 failed"},
+		},
+		{
+			name:         "agent stopped before the action ran",
+			state:        powerState{Scheduled: &reboot},
+			boot:         boot,
+			wantStatuses: []string{"p-1 failed"},
+		},
+		{
+			name: "unsent reports are kept",
+			state: powerState{Reports: []PowerReport{
+				{RequestID: "p-0", Action: powerLock, Status: "completed"},
+			}},
+			boot:         boot,
+			wantStatuses: []string{"p-0 completed"},
+		},
+		{
+			name: "nothing pending",
+			boot: boot,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stateFile := filepath.Join(t.TempDir(), "power.json")
+			data, err := json.Marshal(tc.state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(stateFile, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := &powerRecorder{}
+			pm := newTestPowerManager(t, stateFile, tc.boot, recorder)
+			pm.flush()
+
+			statuses := recorder.statuses(t, len(tc.wantStatuses))
+			if len(statuses) != len(tc.wantStatuses) || (len(statuses) > 0 && !reflect.DeepEqual(statuses, tc.wantStatuses)) {
+				t.Errorf("reports = %v, want %v", statuses, tc.wantStatuses)
+			}
+			if state := readPowerState(t, stateFile); state.Executing != nil || state.Scheduled != nil || len(state.Reports) != 0 {
+				t.Errorf("state after flush = %+v, want empty", state)
+			}
+		})
+	}
+}
+
+func TestFailedRebootIsReportedOnce(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "power.json")
+	boot := time.Now().Add(-time.Hour)
+
+	recorder := &powerRecorder{fail: true} // The failure is not delivered before the restart
+	pm := newTestPowerManager(t, stateFile, boot, recorder)
+	ran := make(chan struct{})
+	pm.runPower = func(string) error {
+		defer close(ran)
+		return errors.New("permission denied")
+	}
+	pm.handle(PowerRequest{RequestID: "p-1", Action: powerReboot})
+	<-ran
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pm.mu.Lock()
+		queued := len(pm.state.Reports)
+		pm.mu.Unlock()
+		if queued == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The agent restarts in a later boot: only the queued reports are sent
+	delivered := &powerRecorder{}
+	restarted := newTestPowerManager(t, stateFile, boot.Add(time.Minute), delivered)
+	restarted.flush()
+	want := []string{"p-1 scheduled", "p-1 failed"}
+	if statuses := delivered.statuses(t, len(want)); !reflect.DeepEqual(statuses, want) {
+		t.Errorf("reports after restart = %v, want %v", statuses, want)
+	}
+}
+
+func TestPowerActionCancelAndConflicts(t *testing.T) {
+	recorder := &powerRecorder{}
+	pm := newTestPowerManager(t, filepath.Join(t.TempDir(), "power.json"), time.Now(), recorder)
+	pm.runPower = func(action string) error {
+		t.Errorf("%s was carried out", action)
+		return nil
+	}
+
+	steps := []struct {
+		request      PowerRequest
+		wantStatuses []string
+	}{
+		{PowerRequest{RequestID: "c-0", Action: powerCancel}, []string{"c-0 failed"}},
+		{PowerRequest{RequestID: "p-1", Action: powerReboot, Delay: 600}, []string{"p-1 scheduled"}},
+		{PowerRequest{RequestID: "p-1", Action: powerReboot, Delay: 600}, nil}, // Repeated by the server
+		{PowerRequest{RequestID: "p-2", Action: powerLock}, []string{"p-2 failed"}},
+		{PowerRequest{RequestID: "c-1", Action: powerCancel, CancelID: "p-9"}, []string{"c-1 failed"}},
+		{PowerRequest{RequestID: "c-2", Action: powerCancel, CancelID: "p-1"}, []string{"p-1 cancelled", "c-2 completed"}},
+	}
+
+	var want []string
+	for _, step := range steps {
+		pm.handle(step.request)
+		want = append(want, step.wantStatuses...)
+		if statuses := recorder.statuses(t, len(want)); !reflect.DeepEqual(statuses, want) {
+			t.Fatalf("after %s %s: reports = %v, want %v", step.request.RequestID, step.request.Action, statuses, want)
+		}
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.pending != nil || pm.state.Scheduled != nil {
+		t.Error("cancelled action still pending")
+	}
+}
+
+func TestPowerActionCancelWhileWaitingForIdle(t *testing.T) {
+	recorder := &powerRecorder{}
+	pm := newTestPowerManager(t, filepath.Join(t.TempDir(), "power.json"), time.Now(), recorder)
+	pm.idleTime = func() (time.Duration, error) { return time.Second, nil }
+	pm.runPower = func(action string) error {
+		t.Errorf("%s was carried out", action)
+		return nil
+	}
+
+	pm.handle(PowerRequest{RequestID: "p-1", Action: powerLock, RequireIdle: true})
+	want := []string{"p-1 scheduled", "p-1 waiting-idle"}
+	if statuses := recorder.statuses(t, len(want)); !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("reports = %v, want %v", statuses, want)
+	}
+
+	pm.handle(PowerRequest{RequestID: "c-1", Action: powerCancel})
+	want = append(want, "p-1 cancelled", "c-1 completed")
+	if statuses := recorder.statuses(t, len(want)); !reflect.DeepEqual(statuses, want) {
+		t.Errorf("reports = %v, want %v", statuses, want)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package remotecontrol
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// warnWithWall writes text to the terminals of all logged-in users
+func warnWithWall(text string) error {
+	cmd := exec.Command("wall")
+	cmd.Stdin = strings.NewReader(text + "\n")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to warn users: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// runCommand runs a power command, with its output in the error
+func runCommand(name string, args ...string) error {
+	if output, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+//go:build windows
+// +build windows
+
+package remotecontrol
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// windowsUserSession is a line of `query user`
+type windowsUserSession struct {
+	ID     string
+	Active bool
+	Idle   time.Duration
+}
+
+// runPowerAction carries out a power action; logoff and lock act on every user
+// session, since the service runs in session 0
+func runPowerAction(action string) error {
+	switch action {
+	case powerReboot:
+		return runCommand("shutdown", "/r", "/t", "0", "/d", "p:0:0")
+	case powerShutdown:
+		return runCommand("shutdown", "/s", "/t", "0", "/d", "p:0:0")
+	case powerLogoff, powerLock:
+		sessions, err := windowsUserSessions()
+		if err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			return errNoInteractiveUser
+		}
+		for _, session := range sessions {
+			if action == powerLogoff {
+				err = runCommand("logoff", session.ID)
+			} else if session.Active {
+				// Disconnecting a session leaves it at the lock screen
+				err = runCommand("tsdiscon", session.ID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown power action %q", action)
+	}
+}
+
+// userIdleTime is the idle time of the least idle active session
+func userIdleTime() (time.Duration, error) {
+	sessions, err := windowsUserSessions()
+	if err != nil {
+		return 0, err
+	}
+	idle := time.Duration(-1)
+	for _, session := range sessions {
+		if session.Active && (idle < 0 || session.Idle < idle) {
+			idle = session.Idle
+		}
+	}
+	if idle < 0 {
+		return 0, errNoInteractiveUser // Only disconnected sessions
+	}
+	return idle, nil
+}
+
+// windowsUserSessions lists logged-in user sessions: their state comes from
+// WTSEnumerateSessions, their idle time from `query user`, whose wording is
+// localised and so is only used for the idle column
+func windowsUserSessions() ([]windowsUserSession, error) {
+	states, err := wtsSessionStates()
+	if err != nil {
+		return nil, err
+	}
+	output, err := exec.Command("query", "user").Output()
+	if err != nil {
+		// query exits with 1 when nobody is logged in
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list user sessions: %w", err)
+	}
+	return parseQueryUser(string(output), states)
+}
+
+// wtsSessionStates maps the IDs of user sessions (not session 0 or listeners) to
+// whether they are active
+func wtsSessionStates() (map[string]bool, error) {
+	var info *windows.WTS_SESSION_INFO
+	var count uint32
+	if err := windows.WTSEnumerateSessions(0, 0, 1, &info, &count); err != nil {
+		return nil, fmt.Errorf("failed to enumerate sessions: %w", err)
+	}
+	defer windows.WTSFreeMemory(uintptr(unsafe.Pointer(info)))
+
+	states := make(map[string]bool)
+	for _, session := range unsafe.Slice(info, count) {
+		if session.SessionID == 0 {
+			continue
+		}
+		switch session.State {
+		case windows.WTSActive, windows.WTSDisconnected:
+			states[strconv.FormatUint(uint64(session.SessionID), 10)] = session.State == windows.WTSActive
+		}
+	}
+	return states, nil
+}
+
+// parseQueryUser reads the idle column of `query user` for the sessions in states:
+//
+//	 USERNAME   SESSIONNAME  ID  STATE   IDLE TIME  LOGON TIME
+//	>alice      console       1  Active       none  18/10/2026 09:00
+//	 bob                      2  Disc         1:05  18/10/2026 08:12
+//
+// A line without a known session ID is an error rather than a session left out,
+// so a user who cannot be seen is never taken for an idle one
+func parseQueryUser(output string, states map[string]bool) ([]windowsUserSession, error) {
+	var sessions []windowsUserSession
+	lines := strings.Split(strings.ReplaceAll(output, "\r", ""), "\n")
+	for _, line := range lines[min(1, len(lines)):] {
+		fields := strings.Fields(strings.TrimLeft(line, ">"))
+		if len(fields) == 0 {
+			continue
+		}
+		found := false
+		// The ID is followed by the state and the idle time; the user name comes first
+		for i := 1; i+2 < len(fields); i++ {
+			active, ok := states[fields[i]]
+			if !ok {
+				continue
+			}
+			sessions = append(sessions, windowsUserSession{
+				ID:     fields[i],
+				Active: active,
+				Idle:   parseWindowsIdleTime(fields[i+2]),
+			})
+			found = true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("unrecognised user session %q", strings.TrimSpace(line))
+		}
+	}
+	return sessions, nil
+}
+
+// parseWindowsIdleTime reads query's idle column: minutes, H:MM or D+H:MM; "none",
+// "." and localised words read as not idle
+func parseWindowsIdleTime(text string) time.Duration {
+	var days, hours, minutes int
+	if before, after, ok := strings.Cut(text, "+"); ok {
+		days, _ = strconv.Atoi(before)
+		text = after
+	}
+	if before, after, ok := strings.Cut(text, ":"); ok {
+		hours, _ = strconv.Atoi(before)
+		text = after
+	}
+	minutes, _ = strconv.Atoi(text)
+	return time.Duration(days*24+hours)*time.Hour + time.Duration(minutes)*time.Minute
+}
+
+// warnLoggedInUsers is covered by NotifyUser, which messages every session
+func warnLoggedInUsers(text string) error {
+	return nil
+}
+
+func runCommand(name string, args ...string) error {
+	if output, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package remotecontrol
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQueryUser(t *testing.T) {
+	states := map[string]bool{"1": true, "2": false, "3": true}
+
+	english := " USERNAME              SESSIONNAME        ID  STATE   IDLE TIME  LOGON TIME\r\n" +
+		">alice                 console             1  Active      none   18/10/2026 09:00\r\n" +
+		" bob                                       2  Disc         1:05  18/10/2026 08:12\r\n"
+	sessions, err := parseQueryUser(english, states)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []windowsUserSession{{ID: "1", Active: true}, {ID: "2", Idle: time.Hour + 5*time.Minute}}
+	if len(sessions) != len(want) {
+		t.Fatalf("sessions = %+v, want %+v", sessions, want)
+	}
+	for i := range want {
+		if sessions[i] != want[i] {
+			t.Errorf("session %d = %+v, want %+v", i, sessions[i], want[i])
+		}
+	}
+
+	// The state comes from WTS, so localised output parses the same
+	german := " BENUTZERNAME          SITZUNGSNAME       ID  STATUS  LEERLAUF   ANMELDEZEIT\r\n" +
+		">carol                 console             3  Aktiv       Kein   18.10.2026 09:00\r\n"
+	sessions, err = parseQueryUser(german, states)
+	if err != nil || len(sessions) != 1 || !sessions[0].Active || sessions[0].Idle != 0 {
+		t.Errorf("localised output = %+v, %v; want session 3 active and not idle", sessions, err)
+	}
+
+	// A session the agent cannot place fails closed instead of being left out
+	unknown := " USERNAME  SESSIONNAME  ID  STATE  IDLE TIME  LOGON TIME\r\n" +
+		">dave      rdp-tcp#4     7  Active   none  18/10/2026 09:00\r\n"
+	if sessions, err := parseQueryUser(unknown, states); err == nil {
+		t.Errorf("unknown session = %+v, want an error", sessions)
+	}
+}
+
+func TestParseWindowsIdleTime(t *testing.T) {
+	cases := map[string]time.Duration{
+		"none":   0,
+		".":      0,
+		"Kein":   0,
+		"7":      7 * time.Minute,
+		"1:05":   time.Hour + 5*time.Minute,
+		"2+3:10": 51*time.Hour + 10*time.Minute,
+	}
+	for text, want := range cases {
+		if got := parseWindowsIdleTime(text); got != want {
+			t.Errorf("parseWindowsIdleTime(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
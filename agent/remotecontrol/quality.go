@@ -0,0 +1,194 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"image"
+)
+
+// QualityPreset names a predefined set of stream quality settings
+type QualityPreset string
+
+const (
+	QualityText         QualityPreset = "text"          // Sharp text, lower frame rate
+	QualityBalanced     QualityPreset = "balanced"      // Default: Full HD at 30 FPS
+	QualityMotion       QualityPreset = "motion"        // Smooth motion at reduced resolution
+	QualityLowBandwidth QualityPreset = "low-bandwidth" // Grayscale, small and slow for poor links
+)
+
+// QualitySettings controls capture rate, scaling and encoding of the outgoing stream
+type QualitySettings struct {
+	Preset      QualityPreset `json:"preset,omitempty"`
+	FPS         int           `json:"fps"`
+	Bitrate     int           `json:"bitrate"` // in kbps
+	Width       int           `json:"width"`
+	Height      int           `json:"height"`
+	ScalingMode ScalingMode   `json:"scaling"`
+	Grayscale   bool          `json:"grayscale"`
+}
+
+// Limits accepted from operator overrides
+const (
+	minQualityFPS     = 1
+	maxQualityFPS     = 60
+	minQualityBitrate = 100
+	maxQualityBitrate = 20000
+	minQualityWidth   = 320
+	minQualityHeight  = 180
+	maxQualityWidth   = 3840
+	maxQualityHeight  = 2160
+)
+
+var qualityPresets = map[QualityPreset]QualitySettings{
+	QualityText: {
+		Preset:      QualityText,
+		FPS:         15,
+		Bitrate:     4000,
+		Width:       1920,
+		Height:      1080,
+		ScalingMode: ScalingArea,
+	},
+	QualityBalanced: {
+		Preset:      QualityBalanced,
+		FPS:         30,
+		Bitrate:     5000,
+		Width:       1920,
+		Height:      1080,
+		ScalingMode: ScalingAuto,
+	},
+	QualityMotion: {
+		Preset:      QualityMotion,
+		FPS:         30,
+		Bitrate:     4000,
+		Width:       1280,
+		Height:      720,
+		ScalingMode: ScalingBilinear,
+	},
+	QualityLowBandwidth: {
+		Preset:      QualityLowBandwidth,
+		FPS:         10,
+		Bitrate:     500,
+		Width:       960,
+		Height:      540,
+		ScalingMode: ScalingArea,
+		Grayscale:   true,
+	},
+}
+
+// DefaultQualitySettings returns the settings used when a session starts
+func DefaultQualitySettings() QualitySettings {
+	return qualityPresets[QualityBalanced]
+}
+
+// QualityPresetSettings returns the settings for a named preset
+func QualityPresetSettings(preset QualityPreset) (QualitySettings, error) {
+	settings, ok := qualityPresets[preset]
+	if !ok {
+		return QualitySettings{}, fmt.Errorf("unknown quality preset: %s", preset)
+	}
+	return settings, nil
+}
+
+// applyQualityMessage builds new settings from a "quality" data channel message.
+// The preset (if any) replaces the current settings, then explicit fields override it.
+func applyQualityMessage(current QualitySettings, message map[string]interface{}) (QualitySettings, error) {
+	settings := current
+
+	if preset, ok := message["preset"].(string); ok && preset != "" {
+		presetSettings, err := QualityPresetSettings(QualityPreset(preset))
+		if err != nil {
+			return current, err
+		}
+		settings = presetSettings
+	}
+
+	overridden := false
+
+	if fps, ok := message["fps"].(float64); ok {
+		if int(fps) < minQualityFPS || int(fps) > maxQualityFPS {
+			return current, fmt.Errorf("fps must be between %d and %d", minQualityFPS, maxQualityFPS)
+		}
+		settings.FPS = int(fps)
+		overridden = true
+	}
+
+	if bitrate, ok := message["bitrate"].(float64); ok {
+		if int(bitrate) < minQualityBitrate || int(bitrate) > maxQualityBitrate {
+			return current, fmt.Errorf("bitrate must be between %d and %d kbps", minQualityBitrate, maxQualityBitrate)
+		}
+		settings.Bitrate = int(bitrate)
+		overridden = true
+	}
+
+	width, hasWidth := message["width"].(float64)
+	height, hasHeight := message["height"].(float64)
+	if hasWidth || hasHeight {
+		if !hasWidth || !hasHeight {
+			return current, fmt.Errorf("width and height must be set together")
+		}
+		if int(width) < minQualityWidth || int(width) > maxQualityWidth ||
+			int(height) < minQualityHeight || int(height) > maxQualityHeight {
+			return current, fmt.Errorf("resolution must be between %dx%d and %dx%d",
+				minQualityWidth, minQualityHeight, maxQualityWidth, maxQualityHeight)
+		}
+		// I420 chroma subsampling needs even dimensions
+		settings.Width = int(width) &^ 1
+		settings.Height = int(height) &^ 1
+		overridden = true
+	}
+
+	if scaling, ok := message["scaling"].(string); ok {
+		mode, err := ParseScalingMode(scaling)
+		if err != nil {
+			return current, err
+		}
+		settings.ScalingMode = mode
+		overridden = true
+	}
+
+	if grayscale, ok := message["grayscale"].(bool); ok {
+		settings.Grayscale = grayscale
+		overridden = true
+	}
+
+	// Overrides mean the stream no longer matches a named preset
+	if overridden {
+		settings.Preset = ""
+	}
+
+	return settings, nil
+}
+
+// drawableFrame returns the frame the watermark and grayscale conversion may draw
+// on. scaleFrame hands back the captured frame itself when no scaling is needed,
+// and that frame is shared with the screenshot, redaction and recording paths, so
+// it is copied first.
+func (wp *WebRTCPeer) drawableFrame(scaled, captured *image.RGBA, quality QualitySettings) *image.RGBA {
+	if scaled != captured {
+		return scaled
+	}
+	wp.mu.RLock()
+	watermarked := wp.watermark != nil
+	wp.mu.RUnlock()
+	if !quality.Grayscale && !watermarked {
+		return scaled
+	}
+	return copyRGBA(scaled)
+}
+
+// convertToGrayscale replaces each pixel with its BT.601 luma in place.
+// Equal R, G and B give neutral chroma, which VP8 encodes very cheaply.
+func convertToGrayscale(img *image.RGBA) {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	for y := 0; y < height; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		for x := 0; x < len(row); x += 4 {
+			luma := uint8((77*uint32(row[x]) + 150*uint32(row[x+1]) + 29*uint32(row[x+2]) + 128) >> 8)
+			row[x] = luma
+			row[x+1] = luma
+			row[x+2] = luma
+		}
+	}
+}
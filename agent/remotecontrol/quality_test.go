@@ -0,0 +1,167 @@
+package remotecontrol
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// recordingChannel stands in for the control data channel
+type recordingChannel struct {
+	sent    []string
+	sendErr error
+}
+
+func (c *recordingChannel) SendText(text string) error {
+	if c.sendErr != nil {
+		return c.sendErr
+	}
+	c.sent = append(c.sent, text)
+	return nil
+}
+
+func (c *recordingChannel) Close() error { return nil }
+
+func TestQualityPresets(t *testing.T) {
+	if got := DefaultQualitySettings(); got.Preset != QualityBalanced || got.FPS != 30 || got.Width != 1920 || got.Height != 1080 {
+		t.Errorf("default settings = %+v", got)
+	}
+
+	for _, preset := range []QualityPreset{QualityText, QualityBalanced, QualityMotion, QualityLowBandwidth} {
+		settings, err := QualityPresetSettings(preset)
+		if err != nil {
+			t.Errorf("%s: %v", preset, err)
+			continue
+		}
+		if settings.Preset != preset {
+			t.Errorf("%s: preset field = %q", preset, settings.Preset)
+		}
+		// Every preset must itself pass the override limits
+		if settings.FPS < minQualityFPS || settings.FPS > maxQualityFPS ||
+			settings.Bitrate < minQualityBitrate || settings.Bitrate > maxQualityBitrate ||
+			settings.Width < minQualityWidth || settings.Width > maxQualityWidth || settings.Width%2 != 0 ||
+			settings.Height < minQualityHeight || settings.Height > maxQualityHeight || settings.Height%2 != 0 {
+			t.Errorf("%s: settings out of range: %+v", preset, settings)
+		}
+	}
+	if low, _ := QualityPresetSettings(QualityLowBandwidth); !low.Grayscale {
+		t.Error("low-bandwidth preset is not grayscale")
+	}
+	if _, err := QualityPresetSettings("ultra"); err == nil {
+		t.Error("unknown preset accepted")
+	}
+}
+
+func TestApplyQualityMessage(t *testing.T) {
+	current := DefaultQualitySettings()
+	motion, _ := QualityPresetSettings(QualityMotion)
+
+	tests := []struct {
+		name    string
+		message string
+		want    func(QualitySettings) QualitySettings // nil = rejected, current kept
+	}{
+		{"empty message keeps everything", `{"type":"quality"}`, func(s QualitySettings) QualitySettings { return s }},
+		{"preset", `{"preset":"motion"}`, func(QualitySettings) QualitySettings { return motion }},
+		{"empty preset is ignored", `{"preset":""}`, func(s QualitySettings) QualitySettings { return s }},
+		{"preset then override", `{"preset":"motion","fps":20}`, func(QualitySettings) QualitySettings {
+			s := motion
+			s.FPS, s.Preset = 20, ""
+			return s
+		}},
+		{"fps bounds", `{"fps":1}`, func(s QualitySettings) QualitySettings {
+			s.FPS, s.Preset = 1, ""
+			return s
+		}},
+		{"bitrate", `{"bitrate":20000}`, func(s QualitySettings) QualitySettings {
+			s.Bitrate, s.Preset = 20000, ""
+			return s
+		}},
+		{"odd resolution is made even", `{"width":1367,"height":769}`, func(s QualitySettings) QualitySettings {
+			s.Width, s.Height, s.Preset = 1366, 768, ""
+			return s
+		}},
+		{"scaling", `{"scaling":"nearest"}`, func(s QualitySettings) QualitySettings {
+			s.ScalingMode, s.Preset = ScalingNearest, ""
+			return s
+		}},
+		{"grayscale off is an override", `{"grayscale":false}`, func(s QualitySettings) QualitySettings {
+			s.Preset = ""
+			return s
+		}},
+		{"unknown preset", `{"preset":"ultra","fps":20}`, nil},
+		{"fps too low", `{"fps":0}`, nil},
+		{"fps too high", `{"fps":61}`, nil},
+		{"bitrate too low", `{"bitrate":99}`, nil},
+		{"bitrate too high", `{"bitrate":20001}`, nil},
+		{"width alone", `{"width":1280}`, nil},
+		{"height alone", `{"height":720}`, nil},
+		{"resolution too small", `{"width":319,"height":180}`, nil},
+		{"resolution too large", `{"width":3840,"height":2161}`, nil},
+		{"unknown scaling", `{"scaling":"lanczos"}`, nil},
+		{"valid field before an invalid one", `{"fps":20,"bitrate":5}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var message map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.message), &message); err != nil {
+				t.Fatal(err)
+			}
+			got, err := applyQualityMessage(current, message)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("accepted: %+v", got)
+				}
+				if got != current {
+					t.Errorf("rejected message changed settings to %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.want(current); got != want {
+				t.Errorf("settings = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestHandleQualityChange(t *testing.T) {
+	wp := NewWebRTCPeer(nil, nil)
+	defer wp.cancel()
+	channel := &recordingChannel{}
+	wp.control = channel
+
+	if err := wp.handleQualityChange(map[string]interface{}{"preset": "text"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := wp.GetQualitySettings(); got.Preset != QualityText {
+		t.Errorf("settings = %+v", got)
+	}
+	if len(channel.sent) != 1 || !strings.Contains(channel.sent[0], `"preset":"text"`) {
+		t.Errorf("confirmation = %q", channel.sent)
+	}
+
+	// A rejected change is reported to the viewer and leaves the stream as it was
+	channel.sent = nil
+	if err := wp.handleQualityChange(map[string]interface{}{"fps": float64(500)}); err == nil {
+		t.Fatal("invalid fps accepted")
+	}
+	if got := wp.GetQualitySettings(); got.Preset != QualityText || got.FPS != 15 {
+		t.Errorf("settings changed to %+v", got)
+	}
+	if len(channel.sent) != 1 || !strings.Contains(channel.sent[0], `"error":"fps must be between`) {
+		t.Errorf("error report = %q", channel.sent)
+	}
+
+	// A confirmation that cannot be sent is the caller's error
+	channel.sendErr = errors.New("channel closed")
+	if err := wp.handleQualityChange(map[string]interface{}{"preset": "motion"}); err == nil {
+		t.Error("unsent confirmation was not reported")
+	}
+	if err := wp.handleQualityChange(map[string]interface{}{"preset": "ultra"}); err == nil || !strings.Contains(err.Error(), "invalid quality settings") {
+		t.Errorf("invalid preset with a closed channel: %v", err)
+	}
+}
@@ -0,0 +1,377 @@
+package remotecontrol
+
+import (
+	"image"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedactionStyle controls how redacted regions are rendered
+type RedactionStyle string
+
+const (
+	RedactionBlur  RedactionStyle = "blur"  // Coarse block averaging; shapes stay recognisable, content does not
+	RedactionSolid RedactionStyle = "solid" // Opaque black fill
+)
+
+const (
+	// redactionBlockSize is the pixelation block used by the blur style; large enough that text is unrecoverable
+	redactionBlockSize = 32
+
+	// redactionWindowRefresh limits how often window geometry is re-queried
+	redactionWindowRefresh = 250 * time.Millisecond
+)
+
+// RedactionRule describes one region that must never be streamed.
+// Either a rectangle (relative to Monitor, or to the desktop when Monitor is -1)
+// or a window matched by title and/or class (X11 only).
+type RedactionRule struct {
+	Monitor int `json:"monitor"`
+	X       int `json:"x"`
+	Y       int `json:"y"`
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+
+	WindowTitle string `json:"windowTitle,omitempty"` // Case-insensitive substring of the window title
+	WindowClass string `json:"windowClass,omitempty"` // Case-insensitive WM_CLASS instance or class name
+}
+
+// RedactionPolicy is the server-supplied set of redaction rules for a session
+type RedactionPolicy struct {
+	Rules    []RedactionRule `json:"rules"`
+	Style    RedactionStyle  `json:"style,omitempty"`
+	TestMode bool            `json:"testMode,omitempty"` // Render masks visibly so admins can verify the zones
+}
+
+// isWindowRule reports whether the rule matches windows rather than a fixed rectangle
+func (r RedactionRule) isWindowRule() bool {
+	return r.WindowTitle != "" || r.WindowClass != ""
+}
+
+// hasWindowRules reports whether any rule depends on the display's windows
+func (p RedactionPolicy) hasWindowRules() bool {
+	for _, rule := range p.Rules {
+		if rule.isWindowRule() {
+			return true
+		}
+	}
+	return false
+}
+
+// redactionWindow is a top-level window with its geometry in absolute desktop coordinates
+type redactionWindow struct {
+	ID     uint32 // X11 window ID
+	Title  string
+	Class  []string
+	Bounds image.Rectangle
+}
+
+// windowLister enumerates visible top-level windows for window-based redaction
+type windowLister interface {
+	ListWindows() ([]redactionWindow, error)
+	Close()
+}
+
+// Redactor masks policy regions in captured frames before they reach the encoder
+type Redactor struct {
+	policy RedactionPolicy
+
+	mu             sync.Mutex
+	windows        windowLister
+	windowRects    []image.Rectangle
+	windowsFetched time.Time
+	windowsFailed  bool
+	monitorMissing bool // A rule's monitor is missing; logged once until it is back
+}
+
+// NewRedactor creates a redactor for the given policy
+func NewRedactor(policy RedactionPolicy) *Redactor {
+	return newRedactorOnDisplay(policy, X11Display{})
+}
+
+// newRedactorOnDisplay creates a redactor whose window rules look at an explicit X display
+func newRedactorOnDisplay(policy RedactionPolicy, display X11Display) *Redactor {
+	if policy.Style == "" {
+		policy.Style = RedactionBlur
+	}
+
+	r := &Redactor{policy: policy}
+
+	for _, rule := range policy.Rules {
+		if rule.isWindowRule() {
+			lister, err := newPlatformWindowLister(display)
+			if err != nil {
+				// Fail closed: without window positions the whole frame is redacted
+				log.Printf("[Redaction] Window rules present but windows cannot be enumerated: %v (redacting full frame)", err)
+				r.windowsFailed = true
+			} else {
+				r.windows = lister
+			}
+			break
+		}
+	}
+
+	log.Printf("[Redaction] Enabled with %d rule(s), style=%s, testMode=%t",
+		len(policy.Rules), policy.Style, policy.TestMode)
+	return r
+}
+
+// Close releases the window enumeration connection
+func (r *Redactor) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.windows != nil {
+		r.windows.Close()
+		r.windows = nil
+	}
+}
+
+// Apply redacts frame in place. area is the desktop rectangle the frame shows and
+// monitors is the current layout used to resolve per-monitor rectangles.
+func (r *Redactor) Apply(frame *image.RGBA, area image.Rectangle, monitors MultiMonitorInfo) {
+	rects, failClosed := r.resolve(monitors)
+
+	bounds := frame.Bounds()
+	if failClosed {
+		r.mask(frame, bounds)
+		return
+	}
+
+	for _, rect := range rects {
+		visible := rect.Intersect(area)
+		if visible.Empty() {
+			continue
+		}
+
+		// Translate desktop coordinates into frame coordinates
+		local := visible.Sub(area.Min).Add(bounds.Min).Intersect(bounds)
+		if !local.Empty() {
+			r.mask(frame, local)
+		}
+	}
+}
+
+// resolve converts all rules to absolute desktop rectangles
+func (r *Redactor) resolve(monitors MultiMonitorInfo) ([]image.Rectangle, bool) {
+	rects := make([]image.Rectangle, 0, len(r.policy.Rules))
+
+	for _, rule := range r.policy.Rules {
+		if rule.isWindowRule() || rule.Width <= 0 || rule.Height <= 0 {
+			continue
+		}
+
+		rect := image.Rect(rule.X, rule.Y, rule.X+rule.Width, rule.Y+rule.Height)
+		if rule.Monitor >= 0 {
+			if rule.Monitor >= len(monitors.Monitors) {
+				// Fail closed: the monitor went away (or the layout is not known yet)
+				// and the region cannot be placed
+				r.logMissingMonitor(rule.Monitor, len(monitors.Monitors))
+				return nil, true
+			}
+			mon := monitors.Monitors[rule.Monitor]
+			rect = rect.Add(image.Pt(mon.X, mon.Y))
+		}
+		rects = append(rects, rect)
+	}
+
+	r.mu.Lock()
+	r.monitorMissing = false
+	r.mu.Unlock()
+
+	windowRects, ok := r.matchedWindows()
+	if !ok {
+		return nil, true
+	}
+
+	return append(rects, windowRects...), false
+}
+
+// logMissingMonitor reports a rule whose monitor is not in the layout, once per outage
+func (r *Redactor) logMissingMonitor(monitor, count int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.monitorMissing {
+		log.Printf("[Redaction] Rule for monitor %d but only %d monitor(s) present, redacting full frame", monitor, count)
+		r.monitorMissing = true
+	}
+}
+
+// matchedWindows returns the (cached) rectangles of windows matching any window rule
+func (r *Redactor) matchedWindows() ([]image.Rectangle, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.windowsFailed {
+		return nil, false
+	}
+	if r.windows == nil {
+		return nil, true
+	}
+
+	if time.Since(r.windowsFetched) < redactionWindowRefresh {
+		return r.windowRects, true
+	}
+
+	windows, err := r.windows.ListWindows()
+	if err != nil {
+		log.Printf("[Redaction] Failed to list windows, redacting full frame: %v", err)
+		return nil, false
+	}
+
+	rects := r.windowRects[:0]
+	for _, window := range windows {
+		for _, rule := range r.policy.Rules {
+			if rule.isWindowRule() && windowMatchesRule(window, rule) {
+				rects = append(rects, window.Bounds)
+				break
+			}
+		}
+	}
+
+	r.windowRects = rects
+	r.windowsFetched = time.Now()
+	return rects, true
+}
+
+// windowMatchesRule checks the title substring and class name of a window against a rule
+func windowMatchesRule(window redactionWindow, rule RedactionRule) bool {
+	if rule.WindowTitle != "" &&
+		!strings.Contains(strings.ToLower(window.Title), strings.ToLower(rule.WindowTitle)) {
+		return false
+	}
+
+	if rule.WindowClass != "" {
+		matched := false
+		for _, class := range window.Class {
+			if strings.EqualFold(class, rule.WindowClass) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mask renders one redacted rectangle according to the policy style
+func (r *Redactor) mask(frame *image.RGBA, rect image.Rectangle) {
+	switch {
+	case r.policy.TestMode:
+		renderTestMask(frame, rect)
+	case r.policy.Style == RedactionSolid:
+		fillRect(frame, rect, 0, 0, 0)
+	default:
+		pixelateRect(frame, rect, redactionBlockSize)
+	}
+}
+
+// fillRect paints rect with an opaque colour
+func fillRect(frame *image.RGBA, rect image.Rectangle, red, green, blue uint8) {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		offset := frame.PixOffset(rect.Min.X, y)
+		row := frame.Pix[offset : offset+rect.Dx()*4]
+		for i := 0; i < len(row); i += 4 {
+			row[i] = red
+			row[i+1] = green
+			row[i+2] = blue
+			row[i+3] = 255
+		}
+	}
+}
+
+// pixelateRect replaces each block of rect with its average colour
+func pixelateRect(frame *image.RGBA, rect image.Rectangle, blockSize int) {
+	for by := rect.Min.Y; by < rect.Max.Y; by += blockSize {
+		for bx := rect.Min.X; bx < rect.Max.X; bx += blockSize {
+			block := image.Rect(bx, by, bx+blockSize, by+blockSize).Intersect(rect)
+
+			var sumR, sumG, sumB, count uint32
+			for y := block.Min.Y; y < block.Max.Y; y++ {
+				offset := frame.PixOffset(block.Min.X, y)
+				row := frame.Pix[offset : offset+block.Dx()*4]
+				for i := 0; i < len(row); i += 4 {
+					sumR += uint32(row[i])
+					sumG += uint32(row[i+1])
+					sumB += uint32(row[i+2])
+					count++
+				}
+			}
+
+			fillRect(frame, block, uint8(sumR/count), uint8(sumG/count), uint8(sumB/count))
+		}
+	}
+}
+
+// renderTestMask draws a magenta hatched mask with a border so redaction zones are obvious
+func renderTestMask(frame *image.RGBA, rect image.Rectangle) {
+	const border = 3
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		offset := frame.PixOffset(rect.Min.X, y)
+		row := frame.Pix[offset : offset+rect.Dx()*4]
+		for i := 0; i < len(row); i += 4 {
+			x := rect.Min.X + i/4
+			edge := x-rect.Min.X < border || rect.Max.X-x <= border ||
+				y-rect.Min.Y < border || rect.Max.Y-y <= border
+			stripe := (x+y)/8%2 == 0
+
+			switch {
+			case edge:
+				row[i], row[i+1], row[i+2] = 255, 255, 255
+			case stripe:
+				row[i], row[i+1], row[i+2] = 255, 0, 255
+			default:
+				row[i], row[i+1], row[i+2] = 120, 0, 120
+			}
+			row[i+3] = 255
+		}
+	}
+}
+
+// SetRedactor installs a redactor applied to every captured frame before it is delivered
+func (sc *ScreenCapture) SetRedactor(redactor *Redactor) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.redactor = redactor
+}
+
+// GetRedactor returns the installed redactor (nil when redaction is off)
+func (sc *ScreenCapture) GetRedactor() *Redactor {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.redactor
+}
+
+// redactFrame applies the installed redaction policy to a freshly captured frame
+func (sc *ScreenCapture) redactFrame(frame *image.RGBA) {
+	sc.mu.RLock()
+	redactor := sc.redactor
+	sc.mu.RUnlock()
+
+	sc.redactWith(redactor, frame)
+}
+
+// redactWith applies a redactor to a frame of this capture; RFB clients bring
+// their own policy to frames shared with other clients
+func (sc *ScreenCapture) redactWith(redactor *Redactor, frame *image.RGBA) {
+	if redactor == nil {
+		return
+	}
+
+	sc.mu.RLock()
+	monitors := sc.monitors
+	var area image.Rectangle
+	if sc.capturer != nil {
+		x, y, width, height := sc.captureAreaLocked()
+		area = image.Rect(x, y, x+width, y+height)
+	}
+	sc.mu.RUnlock()
+
+	redactor.Apply(frame, area, monitors)
+}
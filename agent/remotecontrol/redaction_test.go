@@ -0,0 +1,220 @@
+package remotecontrol
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// fakeWindowLister returns fixed windows, or an error
+type fakeWindowLister struct {
+	windows []redactionWindow
+	err     error
+	calls   int
+}
+
+func (f *fakeWindowLister) ListWindows() ([]redactionWindow, error) {
+	f.calls++
+	return f.windows, f.err
+}
+
+func (f *fakeWindowLister) Close() {}
+
+// filledFrame returns a frame of the given size painted white
+func filledFrame(width, height int) *image.RGBA {
+	frame := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range frame.Pix {
+		frame.Pix[i] = 255
+	}
+	return frame
+}
+
+// isBlack reports whether the pixel at x, y was masked by the solid style
+func isBlack(frame *image.RGBA, x, y int) bool {
+	c := frame.RGBAAt(x, y)
+	return c.R == 0 && c.G == 0 && c.B == 0 && c.A == 255
+}
+
+func twoMonitors() MultiMonitorInfo {
+	return MultiMonitorInfo{
+		Monitors:      []MonitorInfo{monitorAt(0, 0, 0, 100, 50), monitorAt(1, 100, 0, 100, 50)},
+		VirtualWidth:  200,
+		VirtualHeight: 50,
+	}
+}
+
+func TestRedactorResolve(t *testing.T) {
+	r := NewRedactor(RedactionPolicy{Rules: []RedactionRule{
+		{Monitor: -1, X: 5, Y: 5, Width: 10, Height: 10},
+		{Monitor: 1, X: 5, Y: 5, Width: 10, Height: 10},
+		{Monitor: 0, X: 0, Y: 0, Width: 0, Height: 10}, // Empty, ignored
+	}})
+
+	rects, failClosed := r.resolve(twoMonitors())
+	if failClosed {
+		t.Fatal("resolve failed closed with all monitors present")
+	}
+	want := []image.Rectangle{image.Rect(5, 5, 15, 15), image.Rect(105, 5, 115, 15)}
+	if !reflect.DeepEqual(rects, want) {
+		t.Errorf("rects = %v, want %v", rects, want)
+	}
+
+	// Monitor 1 unplugged: its region cannot be placed, so everything is masked
+	layout := twoMonitors()
+	layout.Monitors = layout.Monitors[:1]
+	if _, failClosed := r.resolve(layout); !failClosed {
+		t.Error("rule for a missing monitor did not fail closed")
+	}
+	if _, failClosed := r.resolve(twoMonitors()); failClosed {
+		t.Error("still failing closed after the monitor came back")
+	}
+}
+
+func TestRedactorApplyMonitorOffsets(t *testing.T) {
+	r := NewRedactor(RedactionPolicy{Style: RedactionSolid, Rules: []RedactionRule{
+		{Monitor: 1, X: 10, Y: 10, Width: 20, Height: 20},
+	}})
+
+	// The whole desktop: the region sits on the second monitor
+	frame := filledFrame(200, 50)
+	r.Apply(frame, image.Rect(0, 0, 200, 50), twoMonitors())
+	if !isBlack(frame, 110, 10) || !isBlack(frame, 129, 29) {
+		t.Error("region on monitor 1 not masked in a desktop frame")
+	}
+	if isBlack(frame, 10, 10) || isBlack(frame, 130, 30) || isBlack(frame, 109, 10) {
+		t.Error("pixels outside the region masked")
+	}
+
+	// Only monitor 1 captured: desktop coordinates shift into the frame
+	frame = filledFrame(100, 50)
+	r.Apply(frame, image.Rect(100, 0, 200, 50), twoMonitors())
+	if !isBlack(frame, 10, 10) || !isBlack(frame, 29, 29) {
+		t.Error("region not masked in a frame of monitor 1")
+	}
+	if isBlack(frame, 30, 30) || isBlack(frame, 9, 9) {
+		t.Error("pixels outside the region masked in a frame of monitor 1")
+	}
+
+	// Only monitor 0 captured: the region is off-frame
+	frame = filledFrame(100, 50)
+	r.Apply(frame, image.Rect(0, 0, 100, 50), twoMonitors())
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 100; x++ {
+			if isBlack(frame, x, y) {
+				t.Fatalf("pixel %d,%d masked for a region on another monitor", x, y)
+			}
+		}
+	}
+}
+
+func TestRedactorApplyFailsClosed(t *testing.T) {
+	assertAllMasked := func(name string, frame *image.RGBA) {
+		t.Helper()
+		for y := 0; y < frame.Rect.Dy(); y++ {
+			for x := 0; x < frame.Rect.Dx(); x++ {
+				if !isBlack(frame, x, y) {
+					t.Fatalf("%s: pixel %d,%d not masked", name, x, y)
+				}
+			}
+		}
+	}
+
+	// A rule for a monitor that is not there
+	r := NewRedactor(RedactionPolicy{Style: RedactionSolid, Rules: []RedactionRule{
+		{Monitor: 3, X: 0, Y: 0, Width: 10, Height: 10},
+	}})
+	frame := filledFrame(200, 50)
+	r.Apply(frame, image.Rect(0, 0, 200, 50), twoMonitors())
+	assertAllMasked("missing monitor", frame)
+
+	// Window rules whose windows cannot be listed
+	windowRule := RedactionRule{WindowTitle: "Password"}
+	lister := &fakeWindowLister{err: errors.New("connection lost")}
+	r = &Redactor{policy: RedactionPolicy{Style: RedactionSolid, Rules: []RedactionRule{windowRule}}, windows: lister}
+	frame = filledFrame(200, 50)
+	r.Apply(frame, image.Rect(0, 0, 200, 50), twoMonitors())
+	assertAllMasked("window listing error", frame)
+
+	// Window rules on a display without window enumeration
+	r = &Redactor{policy: RedactionPolicy{Style: RedactionSolid, Rules: []RedactionRule{windowRule}}, windowsFailed: true}
+	frame = filledFrame(200, 50)
+	r.Apply(frame, image.Rect(0, 0, 200, 50), twoMonitors())
+	assertAllMasked("no window enumeration", frame)
+}
+
+func TestRedactorWindowRules(t *testing.T) {
+	lister := &fakeWindowLister{windows: []redactionWindow{
+		{ID: 1, Title: "KeePassXC - Passwords.kdbx", Class: []string{"keepassxc", "KeePassXC"}, Bounds: image.Rect(20, 10, 40, 30)},
+		{ID: 2, Title: "Terminal", Class: []string{"xterm", "XTerm"}, Bounds: image.Rect(120, 10, 140, 30)},
+	}}
+	r := &Redactor{
+		policy:  RedactionPolicy{Style: RedactionSolid, Rules: []RedactionRule{{WindowClass: "KEEPASSXC"}}},
+		windows: lister,
+	}
+
+	frame := filledFrame(200, 50)
+	r.Apply(frame, image.Rect(0, 0, 200, 50), twoMonitors())
+	if !isBlack(frame, 20, 10) || !isBlack(frame, 39, 29) {
+		t.Error("matching window not masked")
+	}
+	if isBlack(frame, 120, 10) {
+		t.Error("other window masked")
+	}
+
+	// Geometry is cached between frames
+	r.Apply(filledFrame(200, 50), image.Rect(0, 0, 200, 50), twoMonitors())
+	if lister.calls != 1 {
+		t.Errorf("windows listed %d times for two frames, want 1", lister.calls)
+	}
+}
+
+func TestWindowMatchesRule(t *testing.T) {
+	window := redactionWindow{Title: "Online Banking - Firefox", Class: []string{"Navigator", "firefox"}}
+	cases := []struct {
+		rule RedactionRule
+		want bool
+	}{
+		{RedactionRule{WindowTitle: "banking"}, true},
+		{RedactionRule{WindowTitle: "Mail"}, false},
+		{RedactionRule{WindowClass: "FIREFOX"}, true},
+		{RedactionRule{WindowClass: "fire"}, false},
+		{RedactionRule{WindowTitle: "banking", WindowClass: "firefox"}, true},
+		{RedactionRule{WindowTitle: "banking", WindowClass: "chromium"}, false},
+	}
+	for _, tc := range cases {
+		if got := windowMatchesRule(window, tc.rule); got != tc.want {
+			t.Errorf("windowMatchesRule(%+v) = %v, want %v", tc.rule, got, tc.want)
+		}
+	}
+}
+
+func TestRedactorStyles(t *testing.T) {
+	rule := RedactionRule{Monitor: -1, X: 0, Y: 0, Width: 64, Height: 64}
+
+	// Blur averages each block: a half black, half white block turns grey
+	frame := filledFrame(64, 64)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 16; x++ {
+			frame.SetRGBA(x, y, color.RGBA{A: 255})
+		}
+	}
+	NewRedactor(RedactionPolicy{Rules: []RedactionRule{rule}}).Apply(frame, frame.Rect, MultiMonitorInfo{})
+	if c := frame.RGBAAt(0, 0); c.R != 127 || c != frame.RGBAAt(31, 31) {
+		t.Errorf("blurred block = %v and %v, want both 127 grey", c, frame.RGBAAt(31, 31))
+	}
+	if c := frame.RGBAAt(32, 0); c.R != 255 {
+		t.Errorf("white block = %v after blur, want white", c)
+	}
+
+	// Test mode draws a white border
+	frame = filledFrame(64, 64)
+	for i := range frame.Pix {
+		frame.Pix[i] = 0
+	}
+	NewRedactor(RedactionPolicy{TestMode: true, Rules: []RedactionRule{rule}}).Apply(frame, frame.Rect, MultiMonitorInfo{})
+	if c := frame.RGBAAt(0, 0); c.R != 255 || c.G != 255 || c.B != 255 {
+		t.Errorf("test mode border = %v, want white", c)
+	}
+}
@@ -0,0 +1,200 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"image"
+	"runtime"
+	"strings"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// newPlatformWindowLister returns the window enumerator for window-based redaction rules
+// on display (the zero display is $DISPLAY)
+func newPlatformWindowLister(display X11Display) (windowLister, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("window redaction rules are only supported on X11")
+	}
+	return newX11WindowLister(display)
+}
+
+// x11WindowLister enumerates top-level windows through EWMH (_NET_CLIENT_LIST)
+type x11WindowLister struct {
+	conn                   *xgb.Conn
+	root                   xproto.Window
+	atomClientList         xproto.Atom
+	atomClientListStacking xproto.Atom
+	atomActiveWindow       xproto.Atom
+	atomWMName             xproto.Atom
+	atomUTF8               xproto.Atom
+}
+
+func newX11WindowLister(display X11Display) (*x11WindowLister, error) {
+	conn, err := dialX11(display)
+	if err != nil {
+		return nil, err
+	}
+
+	wl := &x11WindowLister{
+		conn: conn,
+		root: xproto.Setup(conn).DefaultScreen(conn).Root,
+	}
+
+	for name, atom := range map[string]*xproto.Atom{
+		"_NET_CLIENT_LIST":          &wl.atomClientList,
+		"_NET_CLIENT_LIST_STACKING": &wl.atomClientListStacking,
+		"_NET_ACTIVE_WINDOW":        &wl.atomActiveWindow,
+		"_NET_WM_NAME":              &wl.atomWMName,
+		"UTF8_STRING":               &wl.atomUTF8,
+	} {
+		reply, err := xproto.InternAtom(conn, false, uint16(len(name)), name).Reply()
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to intern atom %s: %w", name, err)
+		}
+		*atom = reply.Atom
+	}
+
+	return wl, nil
+}
+
+// ListWindows returns viewable top-level windows with their absolute geometry
+func (wl *x11WindowLister) ListWindows() ([]redactionWindow, error) {
+	ids, err := wl.clientWindows(wl.atomClientList)
+	if err != nil {
+		return nil, err
+	}
+	return wl.describeWindows(ids), nil
+}
+
+// StackedWindows returns viewable top-level windows from the bottom of the stack to the top
+func (wl *x11WindowLister) StackedWindows() ([]redactionWindow, error) {
+	ids, err := wl.clientWindows(wl.atomClientListStacking)
+	if err != nil {
+		return nil, err
+	}
+	return wl.describeWindows(ids), nil
+}
+
+// describeWindows reads title, class and absolute geometry of the viewable windows in ids
+func (wl *x11WindowLister) describeWindows(ids []xproto.Window) []redactionWindow {
+	windows := make([]redactionWindow, 0, len(ids))
+	for _, id := range ids {
+		attrs, err := xproto.GetWindowAttributes(wl.conn, id).Reply()
+		if err != nil || attrs.MapState != xproto.MapStateViewable {
+			continue
+		}
+
+		geometry, err := xproto.GetGeometry(wl.conn, xproto.Drawable(id)).Reply()
+		if err != nil {
+			continue
+		}
+
+		origin, err := xproto.TranslateCoordinates(wl.conn, id, wl.root, 0, 0).Reply()
+		if err != nil {
+			continue
+		}
+
+		x := int(origin.DstX)
+		y := int(origin.DstY)
+		windows = append(windows, redactionWindow{
+			ID:     uint32(id),
+			Title:  wl.windowTitle(id),
+			Class:  wl.windowClass(id),
+			Bounds: image.Rect(x, y, x+int(geometry.Width), y+int(geometry.Height)),
+		})
+	}
+
+	return windows
+}
+
+// clientWindows lists managed windows from an EWMH client list, falling back to root
+// children (in stacking order) without an EWMH window manager
+func (wl *x11WindowLister) clientWindows(list xproto.Atom) ([]xproto.Window, error) {
+	reply, err := xproto.GetProperty(wl.conn, false, wl.root, list,
+		xproto.AtomWindow, 0, 1<<16).Reply()
+	if err == nil && reply.Format == 32 && reply.ValueLen > 0 {
+		ids := make([]xproto.Window, 0, reply.ValueLen)
+		for i := 0; i+4 <= len(reply.Value); i += 4 {
+			ids = append(ids, xproto.Window(xgb.Get32(reply.Value[i:])))
+		}
+		return ids, nil
+	}
+
+	tree, err := xproto.QueryTree(wl.conn, wl.root).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query window tree: %w", err)
+	}
+	return tree.Children, nil
+}
+
+// focusedWindow returns the active window (_NET_ACTIVE_WINDOW), falling back to the
+// window with the input focus
+func (wl *x11WindowLister) focusedWindow() (xproto.Window, error) {
+	reply, err := xproto.GetProperty(wl.conn, false, wl.root, wl.atomActiveWindow, xproto.AtomWindow, 0, 1).Reply()
+	if err == nil && reply.Format == 32 && len(reply.Value) >= 4 {
+		if active := xproto.Window(xgb.Get32(reply.Value)); active != 0 {
+			return active, nil
+		}
+	}
+
+	focus, err := xproto.GetInputFocus(wl.conn).Reply()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get input focus: %w", err)
+	}
+	return focus.Focus, nil
+}
+
+// isInside reports whether window is ancestor or one of its descendants
+func (wl *x11WindowLister) isInside(window, ancestor xproto.Window) bool {
+	return x11IsInside(wl.conn, wl.root, window, ancestor, 32)
+}
+
+// x11IsInside reports whether window is ancestor or one of its descendants at most
+// levels deep
+func x11IsInside(conn *xgb.Conn, root, window, ancestor xproto.Window, levels int) bool {
+	for depth := 0; depth <= levels && window != 0 && window != root; depth++ {
+		if window == ancestor {
+			return true
+		}
+		tree, err := xproto.QueryTree(conn, window).Reply()
+		if err != nil {
+			return false
+		}
+		window = tree.Parent
+	}
+	return false
+}
+
+// windowTitle reads _NET_WM_NAME, falling back to WM_NAME
+func (wl *x11WindowLister) windowTitle(id xproto.Window) string {
+	if reply, err := xproto.GetProperty(wl.conn, false, id, wl.atomWMName, wl.atomUTF8, 0, 1024).Reply(); err == nil && reply.ValueLen > 0 {
+		return string(reply.Value)
+	}
+	if reply, err := xproto.GetProperty(wl.conn, false, id, xproto.AtomWmName, xproto.AtomString, 0, 1024).Reply(); err == nil {
+		return string(reply.Value)
+	}
+	return ""
+}
+
+// windowClass reads WM_CLASS (instance and class names, NUL separated)
+func (wl *x11WindowLister) windowClass(id xproto.Window) []string {
+	reply, err := xproto.GetProperty(wl.conn, false, id, xproto.AtomWmClass, xproto.AtomString, 0, 1024).Reply()
+	if err != nil || reply.ValueLen == 0 {
+		return nil
+	}
+
+	var classes []string
+	for _, part := range strings.Split(string(reply.Value), "\x00") {
+		if part != "" {
+			classes = append(classes, part)
+		}
+	}
+	return classes
+}
+
+// Close disconnects from the X server
+func (wl *x11WindowLister) Close() {
+	wl.conn.Close()
+}
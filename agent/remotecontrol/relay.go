@@ -0,0 +1,256 @@
+package remotecontrol
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// relayFallbackTimeout is how long ICE may take after the operator's offer
+// before the session falls back to the WebSocket relay
+const relayFallbackTimeout = 30 * time.Second
+
+// relayWriteTimeout bounds a single write so a stalled relay cannot wedge the senders
+const relayWriteTimeout = 10 * time.Second
+
+// Relay video frames are binary WebSocket messages: a kind byte, the stream
+// (monitor track) index, the capture time in Unix microseconds (big endian) and
+// the encoded VP8 frame. Text messages are control-channel JSON, exactly as on
+// the data channel.
+const (
+	relayVideoFrame      = 0x01
+	relayFrameHeaderSize = 10
+)
+
+// RelayFrame is a video frame carried over the WebSocket relay
+type RelayFrame struct {
+	Stream   int       // Monitor track index (0 unless per-monitor tracks are used)
+	Captured time.Time // Capture time of the frame
+	Data     []byte    // Encoded VP8 frame
+}
+
+// Marshal encodes the frame as a binary relay message
+func (f RelayFrame) Marshal() []byte {
+	message := make([]byte, relayFrameHeaderSize+len(f.Data))
+	message[0] = relayVideoFrame
+	message[1] = byte(f.Stream)
+	binary.BigEndian.PutUint64(message[2:relayFrameHeaderSize], uint64(f.Captured.UnixMicro()))
+	copy(message[relayFrameHeaderSize:], f.Data)
+	return message
+}
+
+// ParseRelayFrame decodes a binary relay message
+func ParseRelayFrame(message []byte) (RelayFrame, error) {
+	if len(message) < relayFrameHeaderSize {
+		return RelayFrame{}, fmt.Errorf("relay message too short (%d bytes)", len(message))
+	}
+	if message[0] != relayVideoFrame {
+		return RelayFrame{}, fmt.Errorf("unknown relay message kind %d", message[0])
+	}
+
+	return RelayFrame{
+		Stream:   int(message[1]),
+		Captured: time.UnixMicro(int64(binary.BigEndian.Uint64(message[2:relayFrameHeaderSize]))),
+		Data:     message[relayFrameHeaderSize:],
+	}, nil
+}
+
+// relayConn is the agent's WebSocket to the server's session relay
+type relayConn struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+// dialRelay connects to the session relay
+func dialRelay(ctx context.Context, relayURL string) (*relayConn, error) {
+	dialer := websocket.Dialer{HandshakeTimeout: 15 * time.Second}
+	conn, resp, err := dialer.DialContext(ctx, relayURL, nil)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("failed to connect to relay: %s: %w", resp.Status, err)
+		}
+		return nil, fmt.Errorf("failed to connect to relay: %w", err)
+	}
+	return &relayConn{conn: conn}, nil
+}
+
+func (rc *relayConn) write(messageType int, data []byte) error {
+	rc.writeMu.Lock()
+	defer rc.writeMu.Unlock()
+
+	rc.conn.SetWriteDeadline(time.Now().Add(relayWriteTimeout))
+	return rc.conn.WriteMessage(messageType, data)
+}
+
+// SendText sends a control-channel message
+func (rc *relayConn) SendText(text string) error {
+	return rc.write(websocket.TextMessage, []byte(text))
+}
+
+// Close says goodbye to the relay and closes the connection
+func (rc *relayConn) Close() error {
+	rc.writeMu.Lock()
+	rc.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session ended"), time.Now().Add(time.Second))
+	rc.writeMu.Unlock()
+	return rc.conn.Close()
+}
+
+// stream returns the frame sink for one video stream on the relay
+func (rc *relayConn) stream(index int) *relayStream {
+	return &relayStream{relay: rc, index: index}
+}
+
+// relayStream sends one video stream's frames over the relay
+type relayStream struct {
+	relay *relayConn
+	index int
+	mu    sync.Mutex
+	clock frameClock
+}
+
+// WriteFrame sends an encoded frame stamped with its capture time
+func (s *relayStream) WriteFrame(frame []byte, captured time.Time) (time.Duration, error) {
+	if len(frame) == 0 {
+		return 0, fmt.Errorf("empty frame data")
+	}
+
+	s.mu.Lock()
+	captured, duration := s.clock.next(captured)
+	s.mu.Unlock()
+
+	message := RelayFrame{Stream: s.index, Captured: captured, Data: frame}.Marshal()
+	if err := s.relay.write(websocket.BinaryMessage, message); err != nil {
+		return duration, fmt.Errorf("failed to write relay frame: %w", err)
+	}
+	return duration, nil
+}
+
+// FrameRate returns the frame rate measured from capture timestamps
+func (s *relayStream) FrameRate() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clock.frameRate()
+}
+
+// RelayURL returns the WebSocket URL of the session relay on the signalling server
+// (wss:// for an https server)
+func (sc *SignalClient) RelayURL() string {
+	base := sc.serverURL
+	switch {
+	case strings.HasPrefix(base, "https://"):
+		base = "wss://" + strings.TrimPrefix(base, "https://")
+	case strings.HasPrefix(base, "http://"):
+		base = "ws://" + strings.TrimPrefix(base, "http://")
+	}
+	return fmt.Sprintf("%s/api/rc/relay?sessionId=%s&token=%s&role=%s",
+		base, sc.sessionID, sc.token, sc.role)
+}
+
+// StartRelay moves the session onto the WebSocket relay: the peer connection is
+// closed, frames and control messages go through the relay and the operator's
+// messages are handled as if they came over the data channel. Viewer-opened
+// channels (terminal, files, port forwarding) are not available on the relay.
+func (wp *WebRTCPeer) StartRelay(relayURL string) error {
+	relay, err := dialRelay(wp.ctx, relayURL)
+	if err != nil {
+		return err
+	}
+
+	wp.mu.Lock()
+	if wp.transport == transportRelay {
+		wp.mu.Unlock()
+		relay.Close()
+		return fmt.Errorf("relay already started")
+	}
+	wp.transport = transportRelay
+	pc := wp.peerConnection
+	wp.control = relay
+	if wp.video != nil {
+		wp.video = relay.stream(0)
+	}
+	for _, mt := range wp.monitorTracks {
+		mt.sink = relay.stream(mt.index)
+	}
+	wp.connected = true
+	wp.mu.Unlock()
+
+	// Stop ICE; the state callbacks ignore the peer connection from now on
+	if pc != nil {
+		if err := pc.Close(); err != nil {
+			log.Printf("[WebRTCPeer] Error closing peer connection: %v", err)
+		}
+	}
+
+	log.Println("[WebRTCPeer] Connected through the WebSocket relay")
+	go wp.readRelay(relay)
+	wp.startStreaming()
+	go wp.startLatencyPings()
+	return nil
+}
+
+// readRelay handles messages from the operator (and the relay's own status messages)
+// until the relay connection closes
+func (wp *WebRTCPeer) readRelay(relay *relayConn) {
+	defer func() {
+		wp.mu.Lock()
+		wp.connected = false
+		wp.mu.Unlock()
+	}()
+
+	for {
+		messageType, data, err := relay.conn.ReadMessage()
+		if err != nil {
+			if wp.ctx.Err() == nil {
+				log.Printf("[WebRTCPeer] Relay connection ended: %v", err)
+			}
+			return
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+
+		var message struct {
+			Type      string `json:"type"`
+			Role      string `json:"role"`
+			Connected bool   `json:"connected"`
+		}
+		if err := json.Unmarshal(data, &message); err == nil && message.Type == "relay-peer" {
+			log.Printf("[WebRTCPeer] Relay peer %s connected=%t", message.Role, message.Connected)
+			if message.Role == "operator" && message.Connected {
+				// The operator missed everything sent before it joined
+				if !wp.requestAccessPIN() {
+					if err := wp.sendMonitorsMessage(); err != nil {
+						log.Printf("[WebRTCPeer] Failed to send monitors message: %v", err)
+					}
+					wp.sendGraphicalSessions()
+					wp.sendPauseState()
+				}
+			}
+			continue
+		}
+
+		if err := wp.HandleDataChannel(data); err != nil {
+			log.Printf("[WebRTCPeer] Error handling relay message: %v", err)
+		}
+	}
+}
+
+// ICEFailed is closed when ICE fails for good
+func (wp *WebRTCPeer) ICEFailed() <-chan struct{} {
+	return wp.iceFailed
+}
+
+// Transport returns how the session reaches the operator ("webrtc" or "relay")
+func (wp *WebRTCPeer) Transport() string {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+	return wp.transport
+}
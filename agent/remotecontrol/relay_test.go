@@ -0,0 +1,129 @@
+package remotecontrol
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRelayFrameRoundTrip(t *testing.T) {
+	captured := time.UnixMicro(1_700_000_000_123_456)
+	frame := RelayFrame{Stream: 3, Captured: captured, Data: []byte{0x9d, 0x01, 0x2a, 0xff}}
+
+	message := frame.Marshal()
+	if len(message) != relayFrameHeaderSize+len(frame.Data) {
+		t.Fatalf("marshalled %d bytes, want %d", len(message), relayFrameHeaderSize+len(frame.Data))
+	}
+	if message[0] != relayVideoFrame || message[1] != 3 {
+		t.Fatalf("header = % x, want kind %d stream 3", message[:2], relayVideoFrame)
+	}
+
+	parsed, err := ParseRelayFrame(message)
+	if err != nil {
+		t.Fatalf("ParseRelayFrame: %v", err)
+	}
+	if parsed.Stream != frame.Stream || !parsed.Captured.Equal(captured) || !bytes.Equal(parsed.Data, frame.Data) {
+		t.Errorf("round trip = %+v, want %+v", parsed, frame)
+	}
+}
+
+func TestParseRelayFrameRejectsMalformed(t *testing.T) {
+	valid := RelayFrame{Stream: 0, Captured: time.Now(), Data: []byte{1}}.Marshal()
+
+	cases := map[string][]byte{
+		"empty":          nil,
+		"short header":   valid[:relayFrameHeaderSize-1],
+		"unknown kind":   append([]byte{0x7f}, valid[1:]...),
+		"text-like kind": []byte(`{"type":"ping"}`),
+	}
+	for name, message := range cases {
+		if frame, err := ParseRelayFrame(message); err == nil {
+			t.Errorf("%s: parsed %+v, want an error", name, frame)
+		}
+	}
+
+	// A header without payload is a valid (empty) frame
+	if frame, err := ParseRelayFrame(valid[:relayFrameHeaderSize]); err != nil || len(frame.Data) != 0 {
+		t.Errorf("header only = %+v, %v; want an empty frame", frame, err)
+	}
+}
+
+func TestRelayConnCarriesFramesAndText(t *testing.T) {
+	received := make(chan []interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var messages []interface{}
+		for len(messages) < 2 {
+			kind, data, err := conn.ReadMessage()
+			if err != nil {
+				break
+			}
+			if kind == websocket.BinaryMessage {
+				frame, err := ParseRelayFrame(data)
+				if err != nil {
+					messages = append(messages, err)
+					continue
+				}
+				messages = append(messages, frame)
+			} else {
+				messages = append(messages, string(data))
+			}
+		}
+		received <- messages
+	}))
+	defer server.Close()
+
+	relay, err := dialRelay(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"))
+	if err != nil {
+		t.Fatalf("dialRelay: %v", err)
+	}
+	defer relay.Close()
+
+	if _, err := relay.stream(2).WriteFrame(nil, time.Now()); err == nil {
+		t.Error("empty frame was sent")
+	}
+	captured := time.Now()
+	if _, err := relay.stream(2).WriteFrame([]byte("vp8"), captured); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if err := relay.SendText(`{"type":"monitors"}`); err != nil {
+		t.Fatalf("SendText: %v", err)
+	}
+
+	select {
+	case messages := <-received:
+		frame, ok := messages[0].(RelayFrame)
+		if !ok || frame.Stream != 2 || string(frame.Data) != "vp8" || frame.Captured.Before(captured.Add(-time.Second)) {
+			t.Errorf("first message = %+v, want the frame on stream 2", messages[0])
+		}
+		if text, _ := messages[1].(string); text != `{"type":"monitors"}` {
+			t.Errorf("second message = %v, want the control message", messages[1])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("relay server received nothing")
+	}
+}
+
+func TestRelayURL(t *testing.T) {
+	cases := map[string]string{
+		"https://app.example.com": "wss://app.example.com/api/rc/relay?sessionId=s-1&token=t&role=agent",
+		"http://127.0.0.1:9002":   "ws://127.0.0.1:9002/api/rc/relay?sessionId=s-1&token=t&role=agent",
+	}
+	for server, want := range cases {
+		if got := NewSignalClient(server, "s-1", "t").RelayURL(); got != want {
+			t.Errorf("RelayURL(%s) = %s, want %s", server, got, want)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"log"
 	"sync"
 	"time"
+
+	"github.com/pion/webrtc/v4"
 )
 
 // RemoteControlCapabilities describes what this agent can do
@@ -15,10 +17,42 @@ type RemoteControlCapabilities struct {
 	ScreenCapture     bool   `json:"screenCapture"`
 	InputInjection    bool   `json:"inputInjection"`
 	WebRTCSupported   bool   `json:"webrtcSupported"`
+	Terminal          bool   `json:"terminal"`
+	FileTransfer      bool   `json:"fileTransfer"`
+	PortForward       bool   `json:"portForward"`
+	WebSocketRelay    bool   `json:"websocketRelay"` // Falls back to the server relay when ICE fails
+	RFB               bool   `json:"rfb"`            // Built-in VNC server is listening (accepts one-time passwords)
+	Screenshot        bool   `json:"screenshot"`     // Takes one-off screenshots requested through rc/poll
+	CaptureMode       string `json:"captureMode"`    // "screen", or "console" when sessions stream the text console
+	ConsoleInput      bool   `json:"consoleInput"`   // Keystrokes can be typed into the text console (console capture mode)
+	VirtualDisplay    bool   `json:"virtualDisplay"` // Starts Xvfb/Xvnc displays for sessions that ask for one
+	GraphicalSessions bool   `json:"graphicalSessions"` // Discovers user desktop sessions and lets the operator pick one
+	Chat              bool   `json:"chat"`              // A local helper endpoint relays chat with the end user
+	UserPause         bool   `json:"userPause"`         // The end user can pause sessions through the helper endpoint
+	AccessPIN         bool   `json:"accessPin"`         // Operators must enter the unattended-access PIN set on this machine
+	PowerActions      bool   `json:"powerActions"`      // Carries out reboot, shutdown, logoff and lock requests from rc/poll
 	Platform          string `json:"platform"`
 	AgentVersion      string `json:"agentVersion"`
 }
 
+// SessionOptions carries per-session settings supplied by the server
+type SessionOptions struct {
+	ScalingMode      ScalingMode        // Frame scaling filter (auto, nearest, bilinear, area)
+	PerMonitorTracks bool               // Publish each monitor as its own video track (not on a virtual display or graphical session)
+	Redaction        *RedactionPolicy   // Regions that must never be streamed (nil = none)
+	Watermark        *WatermarkConfig   // Operator/ticket overlay (nil or disabled = none)
+	Permissions      SessionPermissions // Optional features granted by the server (terminal)
+	PortForward      *PortForwardPolicy // TCP targets the operator may reach through the agent (nil = none)
+	ICEServers       []ICEServer        // STUN/TURN servers from the server (nil = default STUN, empty = host candidates only)
+	VirtualDisplay   *VirtualDisplayOptions // Headless X display started for the session (nil = capture the existing display)
+	GraphicalSession string             // Graphical session ID or X display to attach to (empty = the foreground session)
+}
+
+// SessionPermissions lists optional features the server explicitly granted for a session
+type SessionPermissions struct {
+	Terminal bool `json:"terminal"` // Operator may open a shell on the agent
+}
+
 // Session represents an active remote control session
 type Session struct {
 	SessionID     string
@@ -27,6 +61,7 @@ type Session struct {
 	AssetID       string
 	OrgID         string
 	Status        string // pending, active, ended
+	Options       SessionOptions
 
 	// Internal state
 	ctx           context.Context
@@ -35,6 +70,15 @@ type Session struct {
 	inputHandler  *InputHandler
 	webrtcPeer    *WebRTCPeer
 	signalClient  *SignalClient
+	terminals     *terminalManager
+	files         *fileTransferManager
+	portForwards  *portForwardManager
+	console       *consoleSession // Text console streamed instead of the screen (console capture mode)
+	displays      VirtualDisplayConfig
+	virtual       *virtualDisplay // Display started for this session, torn down with it
+	graphical     *graphicalSessions // Discovered desktop sessions capture and input attach to (Linux)
+	chat          *chatSession    // Operator <-> end-user chat and its transcript
+	offerAt       time.Time // When the operator's offer arrived (ICE started)
 	mu            sync.RWMutex
 }
 
@@ -42,7 +86,17 @@ type Session struct {
 type Manager struct {
 	serverURL    string
 	capabilities RemoteControlCapabilities
+	terminal     TerminalConfig
+	files        FileTransferConfig
+	displays     VirtualDisplayConfig
+	synthetic    *SyntheticConfig
+	console      bool // Sessions stream the text console instead of the screen
+	rfb          *RFBServer
+	chat         *ChatServer // Helper endpoint for end-user chat (nil = notifications only)
+	accessPIN    *accessPINGuard // Unattended-access PIN, shared by all sessions (nil = none)
+	power        *powerManager   // Scheduled power actions and their reports (nil = disabled)
 	sessions     map[string]*Session
+	uploads      sync.Mutex // Serializes transcript upload retries
 	mu           sync.RWMutex
 }
 
@@ -53,6 +107,13 @@ func NewManager(serverURL string, platform string, version string) *Manager {
 		ScreenCapture:   isScreenCaptureSupported(),
 		InputInjection:  isInputInjectionSupported(),
 		WebRTCSupported: true,
+		Terminal:        isTerminalSupported(),
+		PortForward:     true,
+		WebSocketRelay:  true,
+		Screenshot:      isScreenCaptureSupported(),
+		CaptureMode:     captureModeScreen,
+		VirtualDisplay:  isVirtualDisplaySupported(VirtualDisplayConfig{}),
+		GraphicalSessions: isGraphicalSessionDiscoverySupported(),
 		Platform:        platform,
 		AgentVersion:    version,
 	}
@@ -66,11 +127,335 @@ func NewManager(serverURL string, platform string, version string) *Manager {
 
 // GetCapabilities returns the remote control capabilities of this agent
 func (m *Manager) GetCapabilities() RemoteControlCapabilities {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return m.capabilities
 }
 
+// SetTerminalConfig sets how operator terminals are spawned for sessions started afterwards
+func (m *Manager) SetTerminalConfig(config TerminalConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.terminal = config
+}
+
+// SetFileTransferConfig sets the roots and size limits of the files channel; no roots disables it
+func (m *Manager) SetFileTransferConfig(config FileTransferConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files = config
+	m.capabilities.FileTransfer = len(config.Roots) > 0
+}
+
+// SetVirtualDisplayConfig sets the X server and window manager used for virtual displays
+func (m *Manager) SetVirtualDisplayConfig(config VirtualDisplayConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.displays = config
+	m.capabilities.VirtualDisplay = isVirtualDisplaySupported(config)
+}
+
+// SetSyntheticCapture makes sessions started afterwards stream a synthetic source
+// instead of the display; nil restores display capture
+func (m *Manager) SetSyntheticCapture(config *SyntheticConfig) error {
+	if config != nil {
+		if _, err := config.normalized(); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.synthetic = config
+	if config != nil {
+		m.capabilities.ScreenCapture = true
+	} else {
+		m.capabilities.ScreenCapture = isScreenCaptureSupported()
+	}
+	m.capabilities.Screenshot = m.capabilities.ScreenCapture && m.accessPIN == nil
+	return nil
+}
+
+// SetConsoleCapture makes sessions started afterwards stream the text console
+// (the active Linux virtual console) instead of the screen
+func (m *Manager) SetConsoleCapture(enabled bool) error {
+	if enabled {
+		if err := ConsoleAvailable(); err != nil {
+			return err
+		}
+	}
+
+	// The console is still streamed when the kernel will not let the agent type into it
+	var inputErr error
+	if enabled {
+		if inputErr = consoleInputAvailable(); inputErr != nil {
+			log.Printf("[Console] Keystrokes will be refused: %v", inputErr)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.console = enabled
+	if enabled {
+		m.synthetic = nil
+		m.capabilities.CaptureMode = captureModeConsole
+		m.capabilities.ScreenCapture = false
+		m.capabilities.ConsoleInput = inputErr == nil
+	} else {
+		m.capabilities.CaptureMode = captureModeScreen
+		m.capabilities.ScreenCapture = isScreenCaptureSupported()
+		m.capabilities.ConsoleInput = false
+	}
+	m.capabilities.Screenshot = m.capabilities.ScreenCapture && m.accessPIN == nil
+	return nil
+}
+
+// TakeScreenshot captures a one-off screenshot (from the synthetic source when set)
+// and tells the user about it unless the organisation policy says otherwise. The
+// request cannot carry the access PIN, so screenshots are refused while one is set.
+func (m *Manager) TakeScreenshot(request ScreenshotRequest) (*Screenshot, error) {
+	m.mu.RLock()
+	synthetic := m.synthetic
+	console := m.console
+	pinSet := m.accessPIN != nil
+	m.mu.RUnlock()
+
+	if pinSet {
+		return nil, errScreenshotWithAccessPIN
+	}
+	if console {
+		return nil, fmt.Errorf("screenshots are unavailable in console capture mode")
+	}
+	if m.SessionState().Paused {
+		return nil, errPausedByUser
+	}
+	shot, err := CaptureScreenshot(request, synthetic)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.ShouldNotify() {
+		message := "A screenshot of your screen was taken by IT support"
+		if request.TicketID != "" {
+			message += " for ticket " + request.TicketID
+		}
+		if err := NotifyUser("Deskwise", message); err != nil {
+			log.Printf("[Screenshot] %v", err)
+		}
+	}
+	return shot, nil
+}
+
+// StartRFBServer starts the built-in RFB (VNC) server on the configured interface
+// until ctx ends; it captures the synthetic source when one is set. VNC clients
+// cannot enter the access PIN, so the server does not run while one is set.
+func (m *Manager) StartRFBServer(ctx context.Context, config RFBConfig) error {
+	m.mu.RLock()
+	synthetic := m.synthetic
+	console := m.console
+	pinSet := m.accessPIN != nil
+	m.mu.RUnlock()
+
+	if console {
+		return fmt.Errorf("the RFB server needs screen capture, not console capture")
+	}
+	if pinSet {
+		return errRFBWithAccessPIN
+	}
+	server := NewRFBServer(config, synthetic)
+	server.sessionPaused = func() bool { return m.GetActiveSession().sessionState().Paused }
+	if err := server.Start(ctx); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.accessPIN != nil {
+		// A PIN was set while the server was starting
+		server.Close()
+		return errRFBWithAccessPIN
+	}
+	m.rfb = server
+	m.capabilities.RFB = true
+	return nil
+}
+
+// SetAccessPIN requires the unattended-access PIN in every new session; it is
+// refused while the RFB server runs, whose clients could not enter it
+func (m *Manager) SetAccessPIN(config AccessPINConfig) error {
+	guard, err := newAccessPINGuard(config)
+	if err != nil {
+		return fmt.Errorf("invalid access PIN configuration: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rfb != nil {
+		return errRFBWithAccessPIN
+	}
+	m.accessPIN = guard
+	m.capabilities.AccessPIN = true
+	m.capabilities.Screenshot = false
+	return nil
+}
+
+// SetPowerConfig enables power actions and reports what became of one issued
+// before the agent (re)started
+func (m *Manager) SetPowerConfig(config PowerConfig) error {
+	power, err := newPowerManager(config, m.warnPowerAction)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.power = power
+	m.capabilities.PowerActions = true
+	m.mu.Unlock()
+
+	go power.flush()
+	return nil
+}
+
+// HandlePowerRequest schedules (or cancels) a power action delivered through rc/poll
+func (m *Manager) HandlePowerRequest(request PowerRequest) error {
+	m.mu.RLock()
+	power := m.power
+	m.mu.RUnlock()
+
+	if power == nil {
+		return fmt.Errorf("power actions are not enabled")
+	}
+	power.handle(request)
+	return nil
+}
+
+// FlushPowerReports retries power action reports the server has not accepted yet
+func (m *Manager) FlushPowerReports() {
+	m.mu.RLock()
+	power := m.power
+	m.mu.RUnlock()
+
+	if power != nil {
+		power.flush()
+	}
+}
+
+// consoleInputLost stops reporting console input once the kernel refused a keystroke
+func (m *Manager) consoleInputLost(err error) {
+	log.Printf("[Console] Console input is unavailable: %v", err)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.capabilities.ConsoleInput = false
+}
+
+// RetryTranscriptUploads uploads terminal and chat transcripts whose upload failed
+// when their session ended (including sessions from before the agent restarted),
+// authenticated with the agent's credential key
+func (m *Manager) RetryTranscriptUploads(credentialKey string) {
+	if !m.uploads.TryLock() {
+		return // A retry is already running
+	}
+	defer m.uploads.Unlock()
+
+	m.mu.RLock()
+	dir := m.terminal.TranscriptDir
+	m.mu.RUnlock()
+	retryTranscriptUploads(m.serverURL, credentialKey, dir)
+}
+
+// warnPowerAction tells logged-in users about a power action, any way it can
+func (m *Manager) warnPowerAction(request PowerRequest, text string) {
+	if err := NotifyUser("Deskwise", text); err != nil {
+		log.Printf("[Power] %v", err)
+	}
+	if err := warnLoggedInUsers(text); err != nil {
+		log.Printf("[Power] %v", err)
+	}
+
+	m.mu.RLock()
+	chat := m.chat
+	m.mu.RUnlock()
+	if chat != nil {
+		chat.broadcast(powerEvent{Type: "power-action", RequestID: request.RequestID, Action: request.Action, Text: text})
+	}
+}
+
+// StartChatServer starts the local endpoint chat helpers connect to, until ctx ends
+func (m *Manager) StartChatServer(ctx context.Context, config ChatConfig) error {
+	server := NewChatServer(config)
+	server.SetSessionControl(m)
+	if err := server.Start(ctx); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chat = server
+	m.capabilities.Chat = true
+	m.capabilities.UserPause = true
+	return nil
+}
+
+// SessionState reports the active session to the end user's pause control;
+// connected VNC clients count as an active session
+func (m *Manager) SessionState() SessionState {
+	state := m.GetActiveSession().sessionState()
+
+	m.mu.RLock()
+	rfb := m.rfb
+	m.mu.RUnlock()
+	if rfb != nil && rfb.HasClients() {
+		state.Active = true
+		state.Paused = state.Paused || rfb.Paused()
+	}
+	return state
+}
+
+// SetSessionPaused pauses or resumes the active session and the connected VNC
+// clients at the end user's request and tells the helpers
+func (m *Manager) SetSessionPaused(paused bool) (SessionState, error) {
+	session := m.GetActiveSession()
+	m.mu.RLock()
+	rfb := m.rfb
+	chat := m.chat
+	m.mu.RUnlock()
+
+	if session == nil && (rfb == nil || !rfb.HasClients()) {
+		return SessionState{Type: "session-state"}, errNoActiveSession
+	}
+	changed := false
+	if session != nil && session.setPaused(paused) {
+		changed = true
+	}
+	if rfb != nil && rfb.SetPaused(paused) {
+		changed = true
+	}
+
+	state := m.SessionState()
+	if changed && chat != nil {
+		chat.broadcast(state)
+	}
+	return state, nil
+}
+
+// AddRFBPassword hands a one-time password issued by the server to the RFB server
+func (m *Manager) AddRFBPassword(grant RFBPassword) error {
+	m.mu.RLock()
+	server := m.rfb
+	pinSet := m.accessPIN != nil
+	m.mu.RUnlock()
+
+	if pinSet {
+		return errRFBWithAccessPIN
+	}
+	if server == nil {
+		return fmt.Errorf("RFB server is not enabled")
+	}
+	return server.AddOneTimePassword(grant)
+}
+
 // StartSession initiates a new remote control session
-func (m *Manager) StartSession(sessionID, token, assetID, orgID string) error {
+func (m *Manager) StartSession(sessionID, token, assetID, orgID string, opts SessionOptions) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -79,6 +464,29 @@ func (m *Manager) StartSession(sessionID, token, assetID, orgID string) error {
 		return fmt.Errorf("session %s already exists", sessionID)
 	}
 
+	// The server asked for attribution on every frame: no stream without it
+	var watermark *Watermark
+	if opts.Watermark != nil && opts.Watermark.Enabled {
+		var err error
+		if watermark, err = NewWatermark(*opts.Watermark); err != nil {
+			return fmt.Errorf("failed to create the required watermark: %w", err)
+		}
+	}
+
+	// A session that asks for a virtual display wants a GUI even in console mode
+	var console *consoleSession
+	if m.console && opts.VirtualDisplay == nil {
+		device, err := openConsoleDevice()
+		if err != nil {
+			return fmt.Errorf("failed to open console: %w", err)
+		}
+		console = newConsoleSession(device)
+		if !m.capabilities.ConsoleInput {
+			console.inputErr = errConsoleInputUnavailable
+		}
+		console.inputLost = m.consoleInputLost
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	session := &Session{
@@ -88,13 +496,21 @@ func (m *Manager) StartSession(sessionID, token, assetID, orgID string) error {
 		AssetID:    assetID,
 		OrgID:      orgID,
 		Status:     "pending",
+		Options:    opts,
 		ctx:        ctx,
 		cancel:     cancel,
+		console:    console,
+		displays:   m.displays,
 	}
 
 	// Initialize components
 	session.signalClient = NewSignalClient(m.serverURL, sessionID, token)
 	session.screenCapture = NewScreenCapture()
+	session.screenCapture.SetSyntheticSource(m.synthetic)
+	// Virtual display sessions create their redactor once the display is up
+	if opts.Redaction != nil && len(opts.Redaction.Rules) > 0 && opts.VirtualDisplay == nil {
+		session.screenCapture.SetRedactor(NewRedactor(*opts.Redaction))
+	}
 	session.inputHandler = NewInputHandler()
 
 	// Initialize input handler
@@ -103,9 +519,60 @@ func (m *Manager) StartSession(sessionID, token, assetID, orgID string) error {
 	}
 
 	session.webrtcPeer = NewWebRTCPeer(session.screenCapture, session.inputHandler)
+	if opts.ScalingMode != "" {
+		session.webrtcPeer.SetScalingMode(opts.ScalingMode)
+	}
+	session.webrtcPeer.SetPerMonitorTracks(opts.PerMonitorTracks)
+	if m.accessPIN != nil {
+		session.webrtcPeer.SetAccessPIN(m.accessPIN)
+	}
+	session.webrtcPeer.SetConsole(console)
+	// Multi-user Linux hosts: find the desktop to control instead of relying on $DISPLAY
+	if console == nil && opts.VirtualDisplay == nil && m.synthetic == nil && isGraphicalSessionDiscoverySupported() {
+		session.graphical = newGraphicalSessions(session.screenCapture, session.inputHandler, opts.Redaction)
+		session.webrtcPeer.SetGraphicalSessions(session.graphical)
+	}
+	if watermark != nil {
+		session.webrtcPeer.SetWatermark(watermark)
+	}
+	if opts.Permissions.Terminal {
+		session.terminals = newTerminalManager(sessionID, m.terminal)
+		session.webrtcPeer.RegisterDataChannelHandler("terminal", session.terminals.HandleChannel)
+	} else {
+		session.webrtcPeer.RegisterDataChannelHandler("terminal", func(dc *webrtc.DataChannel) {
+			rejectDataChannel(dc, "terminal access was not granted for this session")
+		})
+	}
+	if len(m.files.Roots) > 0 {
+		session.files = newFileTransferManager(m.files)
+		session.webrtcPeer.RegisterDataChannelHandler("files", session.files.HandleChannel)
+	} else {
+		session.webrtcPeer.RegisterDataChannelHandler("files", func(dc *webrtc.DataChannel) {
+			rejectDataChannel(dc, "file transfer is not enabled on this agent")
+		})
+	}
+	if opts.PortForward != nil && len(opts.PortForward.Allow) > 0 {
+		session.portForwards = newPortForwardManager(*opts.PortForward)
+		session.webrtcPeer.RegisterDataChannelHandler("port-forward", session.portForwards.HandleChannel)
+		session.webrtcPeer.RegisterStatsProvider("portForward", func() interface{} {
+			return session.portForwards.Stats()
+		})
+	} else {
+		session.webrtcPeer.RegisterDataChannelHandler("port-forward", func(dc *webrtc.DataChannel) {
+			rejectDataChannel(dc, "port forwarding is not allowed by policy")
+		})
+	}
+
+	session.chat = newChatSession(sessionID, m.terminal.TranscriptDir, m.chat)
+	session.webrtcPeer.SetChat(session.chat)
 
 	m.sessions[sessionID] = session
 
+	// A session that starts while the user has paused the VNC clients starts paused
+	if m.rfb != nil && m.rfb.Paused() {
+		session.setPaused(true)
+	}
+
 	// Start session in background
 	go session.run()
 
@@ -162,18 +629,31 @@ func (s *Session) run() {
 
 	log.Printf("[RemoteControl] Session %s is now active", s.SessionID)
 
-	// Step 3: Initialize screen capture
-	if err := s.screenCapture.Start(); err != nil {
-		log.Printf("[RemoteControl] Failed to start screen capture: %v", err)
-		return
+	// Step 2.5: Start the virtual display the session asked for
+	if s.Options.VirtualDisplay != nil {
+		if err := s.startVirtualDisplay(); err != nil {
+			log.Printf("[RemoteControl] Failed to start virtual display: %v", err)
+			return
+		}
+	} else if s.graphical != nil {
+		s.attachGraphicalSession()
+		go s.graphical.watch(s.ctx)
 	}
-	defer s.screenCapture.Stop()
 
-	// Step 3.5: Update input handler with monitor info for coordinate mapping
-	monitors := s.screenCapture.GetMonitors()
-	monitorIndex := s.screenCapture.GetMonitorIndex()
-	if err := s.inputHandler.SetMonitorInfo(monitorIndex, monitors); err != nil {
-		log.Printf("[RemoteControl] Warning: Failed to set monitor info: %v", err)
+	// Step 3: Initialize screen capture (console sessions stream text instead)
+	if s.console == nil {
+		if err := s.screenCapture.Start(); err != nil {
+			log.Printf("[RemoteControl] Failed to start screen capture: %v", err)
+			return
+		}
+		defer s.screenCapture.Stop()
+
+		// Step 3.5: Update input handler with monitor info for coordinate mapping
+		monitors := s.screenCapture.GetMonitors()
+		monitorIndex := s.screenCapture.GetMonitorIndex()
+		if err := s.inputHandler.SetMonitorInfo(monitorIndex, monitors); err != nil {
+			log.Printf("[RemoteControl] Warning: Failed to set monitor info: %v", err)
+		}
 	}
 
 	// Step 4: Setup WebRTC connection
@@ -189,25 +669,98 @@ func (s *Session) run() {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
+	iceFailed := s.webrtcPeer.ICEFailed()
 	for {
 		select {
 		case <-s.ctx.Done():
 			log.Printf("[RemoteControl] Session %s context cancelled", s.SessionID)
 			return
+		case <-iceFailed:
+			iceFailed = nil
+			s.fallBackToRelay("ICE failed", true)
 		case <-ticker.C:
 			// Poll for signalling messages
 			if err := s.handleSignalling(); err != nil {
 				log.Printf("[RemoteControl] Signalling error: %v", err)
 			}
+
+			// Networks that block UDP and TURN never finish ICE
+			s.mu.RLock()
+			offerAt := s.offerAt
+			s.mu.RUnlock()
+			if !offerAt.IsZero() && !s.webrtcPeer.IsConnected() && time.Since(offerAt) > relayFallbackTimeout {
+				s.fallBackToRelay(fmt.Sprintf("no WebRTC connection %v after the offer", relayFallbackTimeout), true)
+			}
 		}
 	}
 }
 
+// startVirtualDisplay starts the session's X display and points capture, input and
+// window redaction at it
+func (s *Session) startVirtualDisplay() error {
+	vd, err := startVirtualDisplay(s.displays, *s.Options.VirtualDisplay)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.virtual = vd
+	s.mu.Unlock()
+
+	display := vd.Display()
+	s.screenCapture.SetX11Display(&display)
+	if s.Options.Redaction != nil && len(s.Options.Redaction.Rules) > 0 {
+		s.screenCapture.SetRedactor(newRedactorOnDisplay(*s.Options.Redaction, display))
+	}
+	if err := s.inputHandler.SetX11Display(display); err != nil {
+		log.Printf("[RemoteControl] Warning: Failed to set up input on %s: %v", display.Display, err)
+	}
+	return nil
+}
+
+// attachGraphicalSession attaches capture and input to the requested graphical
+// session, or the foreground one; without any the default display is captured
+func (s *Session) attachGraphicalSession() {
+	selector := s.Options.GraphicalSession
+	err := s.graphical.Attach(selector)
+	if err != nil && selector != "" {
+		log.Printf("[RemoteControl] Warning: Failed to attach to graphical session %s, using the foreground session: %v", selector, err)
+		err = s.graphical.Attach("")
+	}
+	if err != nil {
+		log.Printf("[RemoteControl] Warning: %v (capturing the default display)", err)
+	}
+}
+
+// fallBackToRelay moves the session onto the server's WebSocket relay; failures are
+// retried from the next signalling tick
+func (s *Session) fallBackToRelay(reason string, tellOperator bool) {
+	if s.webrtcPeer.Transport() == transportRelay {
+		return
+	}
+
+	log.Printf("[RemoteControl] Session %s falling back to the WebSocket relay: %s", s.SessionID, reason)
+	if err := s.webrtcPeer.StartRelay(s.signalClient.RelayURL()); err != nil {
+		log.Printf("[RemoteControl] Failed to start relay: %v", err)
+		return
+	}
+
+	// Tell the operator to switch too, in case its own ICE has not given up yet
+	if !tellOperator {
+		return
+	}
+	if err := s.signalClient.SendSignal("relay", map[string]interface{}{"reason": reason}); err != nil {
+		log.Printf("[RemoteControl] Failed to send relay signal: %v", err)
+	}
+}
+
 // setupWebRTC initializes the WebRTC peer connection
 func (s *Session) setupWebRTC() error {
-	// Get ICE servers from session creation response
-	iceServers := []ICEServer{
-		{URLs: []string{"stun:stun.l.google.com:19302"}},
+	// ICE servers come from the session info; fall back to public STUN when none were sent
+	iceServers := s.Options.ICEServers
+	if iceServers == nil {
+		iceServers = []ICEServer{
+			{URLs: []string{"stun:stun.l.google.com:19302"}},
+		}
 	}
 
 	// Initialize peer connection
@@ -245,6 +798,10 @@ func (s *Session) handleSignalling() error {
 			}
 			log.Printf("[RemoteControl] Received and set operator's offer")
 
+			s.mu.Lock()
+			s.offerAt = time.Now()
+			s.mu.Unlock()
+
 			// Create answer in response to the offer
 			answer, err := s.webrtcPeer.CreateAnswer()
 			if err != nil {
@@ -259,6 +816,17 @@ func (s *Session) handleSignalling() error {
 			}
 			log.Printf("[RemoteControl] Sent answer to operator")
 
+		case "answer":
+			// The operator's answer to a renegotiation offer (monitor tracks changed)
+			var answer map[string]interface{}
+			if err := json.Unmarshal(msg.Data, &answer); err != nil {
+				log.Printf("[RemoteControl] Invalid answer format: %v", err)
+				continue
+			}
+			if err := s.webrtcPeer.SetRemoteDescription(answer); err != nil {
+				log.Printf("[RemoteControl] Failed to set operator's answer: %v", err)
+			}
+
 		case "ice-candidate":
 			var candidate map[string]interface{}
 			if err := json.Unmarshal(msg.Data, &candidate); err != nil {
@@ -269,6 +837,10 @@ func (s *Session) handleSignalling() error {
 			if err := s.webrtcPeer.AddICECandidate(candidate); err != nil {
 				log.Printf("[RemoteControl] Failed to add ICE candidate: %v", err)
 			}
+
+		case "relay":
+			// The operator could not reach us over WebRTC and asks for the relay
+			s.fallBackToRelay("requested by the operator", false)
 		}
 	}
 
@@ -284,15 +856,61 @@ func (s *Session) cleanup() {
 
 	if s.webrtcPeer != nil {
 		s.webrtcPeer.Close()
+		log.Printf("[RemoteControl] Session %s latency: %s", s.SessionID, s.webrtcPeer.LatencySummary())
+	}
+
+	if s.files != nil {
+		s.files.Close()
+	}
+
+	if s.portForwards != nil {
+		s.portForwards.Close()
+	}
+
+	if s.terminals != nil {
+		if path := s.terminals.Close(); path != "" {
+			if err := uploadTranscript(s.signalClient, "terminal-transcript", path); err != nil {
+				log.Printf("[RemoteControl] Failed to upload terminal transcript (kept at %s for retry): %v", path, err)
+			}
+		}
+	}
+
+	if s.chat != nil {
+		if path := s.chat.Close(); path != "" {
+			if err := uploadTranscript(s.signalClient, "chat-transcript", path); err != nil {
+				log.Printf("[RemoteControl] Failed to upload chat transcript (kept at %s for retry): %v", path, err)
+			}
+		}
+	}
+
+	if s.console != nil {
+		s.console.Close()
 	}
 
 	if s.screenCapture != nil {
 		s.screenCapture.Stop()
+		if redactor := s.screenCapture.GetRedactor(); redactor != nil {
+			redactor.Close()
+		}
+	}
+
+	// The display goes last: capture and input are connected to it until now
+	if s.virtual != nil {
+		s.inputHandler.Close()
+		s.virtual.Close()
+	} else if s.graphical != nil {
+		s.inputHandler.Close() // Drops the XTEST connection to the session's display
 	}
 
 	log.Printf("[RemoteControl] Session %s cleaned up", s.SessionID)
 }
 
+// Capture modes reported in the capabilities
+const (
+	captureModeScreen  = "screen"
+	captureModeConsole = "console"
+)
+
 // Platform-specific capability detection
 func isScreenCaptureSupported() bool {
 	// Windows: DXGI Desktop Duplication API
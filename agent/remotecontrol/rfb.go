@@ -0,0 +1,1182 @@
+package remotecontrol
+
+import (
+	"bufio"
+	"context"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"math/bits"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RFBConfig configures the built-in RFB (VNC) server. It is off unless an
+// interface is configured and never listens on all interfaces.
+type RFBConfig struct {
+	Interface string // Interface name (e.g. eth0) or one of its IP addresses
+	Port      int    // TCP port (0 = 5900)
+	Monitor   int    // Monitor to serve (-1 = all monitors)
+	MaxFPS    int    // Capture rate while clients are connected (0 = 15)
+}
+
+// RFBPassword is a one-time password the server issues for the RFB server. The
+// redaction policy and watermark apply to the client that logs in with it, the
+// same way session options apply to a WebRTC session.
+type RFBPassword struct {
+	Password  string           `json:"password"`
+	ExpiresAt time.Time        `json:"expiresAt,omitempty"` // Zero = rfbPasswordTTL from now
+	Redaction *RedactionPolicy `json:"redaction,omitempty"` // Regions masked before frames are sent
+	Watermark *WatermarkConfig `json:"watermark,omitempty"` // Operator/ticket overlay (nil or disabled = none)
+}
+
+const (
+	rfbDefaultPort = 5900
+	rfbDefaultFPS  = 15
+
+	// rfbPasswordTTL applies to passwords issued without an expiry
+	rfbPasswordTTL = 10 * time.Minute
+
+	// VNC authentication only uses the first 8 bytes of a password
+	rfbPasswordLength = 8
+
+	// Consecutive failed logins from one address before it is locked out
+	rfbMaxAuthFailures = 5
+	rfbAuthLockout     = 5 * time.Minute
+
+	rfbHandshakeTimeout = 30 * time.Second
+	rfbFirstFrameWait   = 5 * time.Second
+
+	// rfbMaxCutText bounds clipboard text accepted from a client (it is discarded)
+	rfbMaxCutText = 1 << 20
+)
+
+// RFB security types and client message types
+const (
+	rfbSecurityInvalid = 0
+	rfbSecurityVNCAuth = 2
+
+	rfbSetPixelFormat           = 0
+	rfbSetEncodings             = 2
+	rfbFramebufferUpdateRequest = 3
+	rfbKeyEvent                 = 4
+	rfbPointerEvent             = 5
+	rfbClientCutText            = 6
+)
+
+// RFBServer serves the screen to VNC clients. It reuses the agent's ScreenCapture
+// and InputHandler: capture runs while at least one client is connected and all
+// clients share its frames. Clients log in with one-time passwords issued by
+// the Deskwise server; each password works once and only until it expires.
+type RFBServer struct {
+	config    RFBConfig
+	synthetic *SyntheticConfig
+	input     *InputHandler // nil when input injection is unavailable (view-only)
+	inputMu   sync.Mutex
+
+	// The end user's pause: clients get the placeholder frame and their input is
+	// dropped while the server itself or the WebRTC session is paused
+	pause         pauseGate   // Paused while clients are connected; cleared after the last one
+	sessionPaused func() bool // Reports the WebRTC session's pause (nil = no sessions)
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	passwords map[string]RFBPassword // Pending one-time passwords -> grant
+	used      map[string]time.Time   // Consumed passwords, kept until expiry so a re-sent grant is not reusable
+	failures  map[string]*rfbAuthFailures
+	clients   map[*rfbClient]struct{}
+	source    *rfbFrameSource
+	closed    bool
+}
+
+type rfbAuthFailures struct {
+	count       int
+	lockedUntil time.Time
+}
+
+// NewRFBServer creates an RFB server; synthetic replaces the display when set
+func NewRFBServer(config RFBConfig, synthetic *SyntheticConfig) *RFBServer {
+	if config.Port == 0 {
+		config.Port = rfbDefaultPort
+	}
+	if config.MaxFPS <= 0 {
+		config.MaxFPS = rfbDefaultFPS
+	}
+
+	return &RFBServer{
+		config:    config,
+		synthetic: synthetic,
+		passwords: make(map[string]RFBPassword),
+		used:      make(map[string]time.Time),
+		failures:  make(map[string]*rfbAuthFailures),
+		clients:   make(map[*rfbClient]struct{}),
+	}
+}
+
+// Start listens on the configured interface until ctx ends
+func (s *RFBServer) Start(ctx context.Context) error {
+	addresses, err := rfbListenAddresses(s.config.Interface)
+	if err != nil {
+		return err
+	}
+
+	var listeners []net.Listener
+	for _, ip := range addresses {
+		listener, err := net.Listen("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(s.config.Port)))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("failed to listen for RFB clients: %w", err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	input := NewInputHandler()
+	if err := input.Initialize(); err != nil {
+		log.Printf("[RFB] Input injection unavailable, clients are view-only: %v", err)
+		input = nil
+	}
+
+	s.mu.Lock()
+	s.listeners = listeners
+	s.input = input
+	s.mu.Unlock()
+
+	for _, listener := range listeners {
+		log.Printf("[RFB] Listening on %s", listener.Addr())
+		go s.acceptLoop(listener)
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+	return nil
+}
+
+// Close stops listening and disconnects every client
+func (s *RFBServer) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	listeners := s.listeners
+	clients := make([]*rfbClient, 0, len(s.clients))
+	for client := range s.clients {
+		clients = append(clients, client)
+	}
+	s.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener.Close()
+	}
+	for _, client := range clients {
+		client.close()
+	}
+	if s.input != nil {
+		s.input.Close()
+	}
+	log.Println("[RFB] Server stopped")
+}
+
+// AddOneTimePassword accepts a password issued by the server. A password that
+// was already used is not accepted again while it would still be valid.
+func (s *RFBServer) AddOneTimePassword(grant RFBPassword) error {
+	if grant.Password == "" {
+		return fmt.Errorf("empty RFB password")
+	}
+	if grant.ExpiresAt.IsZero() {
+		grant.ExpiresAt = time.Now().Add(rfbPasswordTTL)
+	}
+	if !grant.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("RFB password already expired")
+	}
+
+	password := grant.Password
+	if len(password) > rfbPasswordLength {
+		log.Printf("[RFB] One-time password is longer than %d characters; VNC authentication only checks the first %d",
+			rfbPasswordLength, rfbPasswordLength)
+		password = password[:rfbPasswordLength]
+	}
+	grant.Password = password
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked(time.Now())
+	if _, used := s.used[password]; used {
+		return nil
+	}
+	if _, pending := s.passwords[password]; !pending {
+		log.Printf("[RFB] One-time password issued, valid until %s", grant.ExpiresAt.Format(time.RFC3339))
+	}
+	s.passwords[password] = grant
+	return nil
+}
+
+// pruneLocked forgets expired passwords
+func (s *RFBServer) pruneLocked(now time.Time) {
+	for password, grant := range s.passwords {
+		if !grant.ExpiresAt.After(now) {
+			delete(s.passwords, password)
+		}
+	}
+	for password, expires := range s.used {
+		if !expires.After(now) {
+			delete(s.used, password)
+		}
+	}
+}
+
+// rfbListenAddresses resolves the configured interface (a name or one of its
+// addresses) to the addresses to listen on; unspecified addresses are refused
+func rfbListenAddresses(name string) ([]net.IP, error) {
+	if name == "" {
+		return nil, fmt.Errorf("no RFB interface configured")
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		if ip.IsUnspecified() {
+			return nil, fmt.Errorf("refusing to serve RFB on all interfaces (%s); configure a single interface", name)
+		}
+		return []net.IP{ip}, nil
+	}
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find RFB interface %q: %w", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read addresses of %q: %w", name, err)
+	}
+
+	var ips []net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		// Link-local IPv6 addresses need a zone and are of little use to operators
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		ips = append(ips, ipNet.IP)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("RFB interface %q has no usable addresses", name)
+	}
+	return ips, nil
+}
+
+func (s *RFBServer) acceptLoop(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *RFBServer) serveConn(conn net.Conn) {
+	remote := conn.RemoteAddr().String()
+	host, _, _ := net.SplitHostPort(remote)
+
+	client := &rfbClient{
+		server:    s,
+		conn:      conn,
+		reader:    bufio.NewReader(conn),
+		writer:    bufio.NewWriter(conn),
+		requested: make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	defer client.close()
+
+	conn.SetDeadline(time.Now().Add(rfbHandshakeTimeout))
+	shared, err := client.handshake(host)
+	if err != nil {
+		log.Printf("[RFB] Handshake with %s failed: %v", remote, err)
+		return
+	}
+	if client.redactor != nil {
+		defer client.redactor.Close()
+	}
+
+	source, err := s.acquireSource()
+	if err != nil {
+		log.Printf("[RFB] Failed to start capture for %s: %v", remote, err)
+		return
+	}
+	defer s.releaseSource()
+
+	if !s.addClient(client, shared) {
+		return
+	}
+	defer s.removeClient(client)
+
+	frame, _, _ := source.latest()
+	if err := client.serverInit(frame.Bounds().Size()); err != nil {
+		log.Printf("[RFB] Failed to initialise %s: %v", remote, err)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	log.Printf("[RFB] Client %s connected (%dx%d)", remote, frame.Bounds().Dx(), frame.Bounds().Dy())
+	go client.serveUpdates(source)
+	err = client.readMessages(source)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		log.Printf("[RFB] Client %s disconnected: %v", remote, err)
+		return
+	}
+	log.Printf("[RFB] Client %s disconnected", remote)
+}
+
+// addClient registers a client; a client that does not want a shared desktop
+// disconnects everyone else
+func (s *RFBServer) addClient(client *rfbClient, shared bool) bool {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return false
+	}
+	var others []*rfbClient
+	if !shared {
+		for other := range s.clients {
+			others = append(others, other)
+		}
+	}
+	s.clients[client] = struct{}{}
+	s.mu.Unlock()
+
+	for _, other := range others {
+		log.Printf("[RFB] Disconnecting %s for an exclusive client", other.conn.RemoteAddr())
+		other.close()
+	}
+	return true
+}
+
+func (s *RFBServer) removeClient(client *rfbClient) {
+	s.mu.Lock()
+	delete(s.clients, client)
+	last := len(s.clients) == 0
+	s.mu.Unlock()
+
+	if last && s.pause.set(false) {
+		log.Println("[RFB] Last client disconnected, pause cleared")
+	}
+}
+
+// HasClients reports whether any VNC client is connected
+func (s *RFBServer) HasClients() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients) > 0
+}
+
+// SetPaused pauses or resumes the connected clients for the end user; it returns
+// false when nothing changed (pausing without clients does nothing)
+func (s *RFBServer) SetPaused(paused bool) bool {
+	if paused && !s.HasClients() {
+		return false
+	}
+	if !s.pause.set(paused) {
+		return false
+	}
+
+	s.mu.Lock()
+	source := s.source
+	s.mu.Unlock()
+	if source != nil && source.startErr == nil {
+		source.capture.SetPaused(s.isPaused())
+	}
+
+	if paused {
+		log.Println("[RFB] Paused by the user")
+	} else {
+		log.Println("[RFB] Resumed by the user")
+	}
+	return true
+}
+
+// Paused reports whether the end user paused the connected clients
+func (s *RFBServer) Paused() bool {
+	return s.pause.isPaused()
+}
+
+// isPaused reports whether frames and input are held back, for the server's own
+// pause or the WebRTC session's
+func (s *RFBServer) isPaused() bool {
+	return s.pause.isPaused() || (s.sessionPaused != nil && s.sessionPaused())
+}
+
+// checkPassword verifies a VNC authentication response against the pending
+// one-time passwords and consumes the one that matches, returning its grant
+func (s *RFBServer) checkPassword(challenge, response []byte) (RFBPassword, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked(time.Now())
+	for password, grant := range s.passwords {
+		expected, err := rfbEncryptChallenge(password, challenge)
+		if err != nil {
+			continue
+		}
+		if subtle.ConstantTimeCompare(expected, response) == 1 {
+			delete(s.passwords, password)
+			s.used[password] = grant.ExpiresAt
+			return grant, true
+		}
+	}
+	return RFBPassword{}, false
+}
+
+// hasPasswords reports whether any one-time password is pending
+func (s *RFBServer) hasPasswords() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(time.Now())
+	return len(s.passwords) > 0
+}
+
+// lockedOut reports whether an address has failed to log in too often
+func (s *RFBServer) lockedOut(host string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failures := s.failures[host]
+	return failures != nil && time.Now().Before(failures.lockedUntil)
+}
+
+// recordLogin counts failed logins per address and locks repeat offenders out
+func (s *RFBServer) recordLogin(host string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ok {
+		delete(s.failures, host)
+		return
+	}
+	failures := s.failures[host]
+	if failures == nil {
+		failures = &rfbAuthFailures{}
+		s.failures[host] = failures
+	}
+	failures.count++
+	if failures.count >= rfbMaxAuthFailures {
+		failures.count = 0
+		failures.lockedUntil = time.Now().Add(rfbAuthLockout)
+		log.Printf("[RFB] Locking out %s for %v after %d failed logins", host, rfbAuthLockout, rfbMaxAuthFailures)
+	}
+}
+
+// rfbEncryptChallenge computes the VNC authentication response: the challenge
+// DES-encrypted with the password (padded to 8 bytes, each byte bit-reversed)
+func rfbEncryptChallenge(password string, challenge []byte) ([]byte, error) {
+	key := make([]byte, rfbPasswordLength)
+	copy(key, password)
+	for i, b := range key {
+		key[i] = bits.Reverse8(b)
+	}
+
+	cipher, err := des.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	response := make([]byte, len(challenge))
+	for i := 0; i+des.BlockSize <= len(challenge); i += des.BlockSize {
+		cipher.Encrypt(response[i:], challenge[i:])
+	}
+	return response, nil
+}
+
+// acquireSource starts the shared capture for the first client and waits for a frame
+func (s *RFBServer) acquireSource() (*rfbFrameSource, error) {
+	s.mu.Lock()
+	source := s.source
+	if source == nil {
+		source = newRFBFrameSource(s.config, s.synthetic, s.isPaused)
+		s.source = source
+	}
+	source.users++
+	s.mu.Unlock()
+
+	if err := source.waitReady(); err != nil {
+		s.releaseSource()
+		return nil, err
+	}
+
+	if s.input != nil {
+		s.inputMu.Lock()
+		if err := s.input.SetMonitorInfo(source.capture.GetMonitorIndex(), source.capture.GetMonitors()); err != nil {
+			log.Printf("[RFB] Failed to set monitor info for input: %v", err)
+		}
+		s.inputMu.Unlock()
+	}
+	return source, nil
+}
+
+// releaseSource stops the shared capture after the last client
+func (s *RFBServer) releaseSource() {
+	s.mu.Lock()
+	source := s.source
+	source.users--
+	if source.users > 0 {
+		s.mu.Unlock()
+		return
+	}
+	s.source = nil
+	s.mu.Unlock()
+
+	source.stop()
+}
+
+// injectPointer moves the pointer in framebuffer coordinates
+func (s *RFBServer) injectPointer(size image.Point, events []MouseEvent) {
+	if s.input == nil || s.isPaused() {
+		return
+	}
+	s.inputMu.Lock()
+	defer s.inputMu.Unlock()
+
+	s.input.SetEncodedResolution(size.X, size.Y)
+	for _, event := range events {
+		if err := s.input.HandleMouseEvent(event); err != nil {
+			log.Printf("[RFB] Failed to inject %s event: %v", event.Type, err)
+		}
+	}
+}
+
+func (s *RFBServer) injectKey(event KeyboardEvent) {
+	if s.input == nil || s.isPaused() {
+		return
+	}
+	s.inputMu.Lock()
+	defer s.inputMu.Unlock()
+
+	if err := s.input.HandleKeyboardEvent(event); err != nil {
+		log.Printf("[RFB] Failed to inject key %q: %v", event.Key, err)
+	}
+}
+
+// rfbFrameSource runs one screen capture for all RFB clients and keeps the latest frame
+type rfbFrameSource struct {
+	capture *ScreenCapture
+	paused  func() bool // The placeholder replaces the display while this reports true
+	users   int         // Guarded by RFBServer.mu
+
+	ready    chan struct{} // Closed with the first frame
+	startErr error
+
+	mu      sync.Mutex
+	frame   *image.RGBA
+	seq     uint64
+	changed chan struct{} // Closed and replaced on every new frame
+}
+
+func newRFBFrameSource(config RFBConfig, synthetic *SyntheticConfig, paused func() bool) *rfbFrameSource {
+	capture := NewScreenCaptureWithMonitor(config.Monitor)
+	capture.SetSyntheticSource(synthetic)
+	capture.SetTargetFPS(config.MaxFPS)
+
+	source := &rfbFrameSource{
+		capture: capture,
+		paused:  paused,
+		ready:   make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+	if err := capture.Start(); err != nil {
+		source.startErr = err
+		close(source.ready)
+		return source
+	}
+	go source.run()
+	return source
+}
+
+func (fs *rfbFrameSource) run() {
+	readyOnce := sync.Once{}
+	for frame := range fs.capture.GetFrameChannel() {
+		// Checked per frame: the WebRTC session's pause only reaches the RFB server through fs.paused
+		paused := fs.paused()
+		fs.capture.SetPaused(paused)
+		if frame.Paused != paused {
+			continue // Captured before the pause (or resume) took effect
+		}
+
+		fs.mu.Lock()
+		fs.frame = frame.Image
+		fs.seq++
+		close(fs.changed)
+		fs.changed = make(chan struct{})
+		fs.mu.Unlock()
+
+		readyOnce.Do(func() { close(fs.ready) })
+	}
+}
+
+// waitReady waits for the first frame
+func (fs *rfbFrameSource) waitReady() error {
+	select {
+	case <-fs.ready:
+		return fs.startErr
+	case <-time.After(rfbFirstFrameWait):
+		return fmt.Errorf("no frame captured within %v", rfbFirstFrameWait)
+	}
+}
+
+// latest returns the newest frame, its sequence number and a channel closed when it is replaced
+func (fs *rfbFrameSource) latest() (*image.RGBA, uint64, <-chan struct{}) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.frame, fs.seq, fs.changed
+}
+
+func (fs *rfbFrameSource) stop() {
+	if fs.startErr == nil {
+		fs.capture.Stop()
+	}
+}
+
+// rfbClient is one RFB connection. The reader goroutine handles client messages;
+// the update goroutine is the only writer once the handshake is done.
+type rfbClient struct {
+	server    *RFBServer
+	conn      net.Conn
+	reader    *bufio.Reader
+	writer    *bufio.Writer
+	requested chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	redactor  *Redactor  // From the password grant (nil = no redaction)
+	watermark *Watermark // From the password grant (nil = no overlay)
+
+	mu          sync.Mutex
+	format      rfbPixelFormat
+	encoding    int32 // Preferred rectangle encoding (Raw or ZRLE)
+	copyRect    bool
+	desktopSize bool
+	request     *rfbUpdateRequest // Pending update request, merged until served
+	buttons     uint8
+	size        image.Point // Framebuffer size the client knows about
+}
+
+// rfbUpdateRequest is a FramebufferUpdateRequest
+type rfbUpdateRequest struct {
+	incremental bool
+	area        image.Rectangle
+}
+
+func (c *rfbClient) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// applyGrant sets up the redaction and watermark of the password the client logged in
+// with; a required watermark that cannot be drawn refuses the login
+func (c *rfbClient) applyGrant(grant RFBPassword) error {
+	if grant.Watermark != nil && grant.Watermark.Enabled {
+		watermark, err := NewWatermark(*grant.Watermark)
+		if err != nil {
+			return fmt.Errorf("failed to create watermark: %w", err)
+		}
+		c.watermark = watermark
+	}
+	if grant.Redaction != nil && len(grant.Redaction.Rules) > 0 {
+		c.redactor = NewRedactor(*grant.Redaction)
+	}
+	return nil
+}
+
+// render returns the frame as this client may see it: redacted and watermarked
+// on a copy, since all clients share the source's frames
+func (c *rfbClient) render(capture *ScreenCapture, frame *image.RGBA) *image.RGBA {
+	if c.redactor == nil && c.watermark == nil {
+		return frame
+	}
+	frame = copyRGBA(frame)
+	capture.redactWith(c.redactor, frame)
+	if c.watermark != nil {
+		c.watermark.Apply(frame, time.Now())
+	}
+	return frame
+}
+
+// handshake negotiates the protocol version, authenticates the client with a
+// one-time password and reads ClientInit; it returns the client's shared flag
+func (c *rfbClient) handshake(host string) (bool, error) {
+	if _, err := c.conn.Write([]byte("RFB 003.008\n")); err != nil {
+		return false, err
+	}
+	version := make([]byte, 12)
+	if _, err := io.ReadFull(c.reader, version); err != nil {
+		return false, err
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(string(version), "RFB %03d.%03d\n", &major, &minor); err != nil || major != 3 {
+		return false, fmt.Errorf("unsupported protocol version %q", version)
+	}
+	// Unknown minor versions are treated as 3.3 (3.889 is Apple's 3.8)
+	switch {
+	case minor >= 8:
+		minor = 8
+	case minor != 7:
+		minor = 3
+	}
+
+	refuse := ""
+	switch {
+	case c.server.lockedOut(host):
+		refuse = "too many failed logins, try again later"
+	case !c.server.hasPasswords():
+		refuse = "no one-time password has been issued for this computer"
+	}
+
+	if refuse != "" {
+		if minor == 3 {
+			c.writeUint32(rfbSecurityInvalid)
+		} else {
+			c.writer.WriteByte(0)
+		}
+		c.writeReason(refuse)
+		c.writer.Flush()
+		return false, errors.New(refuse)
+	}
+
+	if minor == 3 {
+		c.writeUint32(rfbSecurityVNCAuth)
+	} else {
+		c.writer.Write([]byte{1, rfbSecurityVNCAuth})
+		if err := c.writer.Flush(); err != nil {
+			return false, err
+		}
+		chosen, err := c.reader.ReadByte()
+		if err != nil {
+			return false, err
+		}
+		if chosen != rfbSecurityVNCAuth {
+			return false, fmt.Errorf("client chose unsupported security type %d", chosen)
+		}
+	}
+
+	challenge := make([]byte, 16)
+	if _, err := rand.Read(challenge); err != nil {
+		return false, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	c.writer.Write(challenge)
+	if err := c.writer.Flush(); err != nil {
+		return false, err
+	}
+	response := make([]byte, 16)
+	if _, err := io.ReadFull(c.reader, response); err != nil {
+		return false, err
+	}
+
+	grant, ok := c.server.checkPassword(challenge, response)
+	c.server.recordLogin(host, ok)
+	if !ok {
+		// Slow down guessing; the lockout handles persistent attempts
+		time.Sleep(time.Second)
+		c.writeUint32(1)
+		if minor == 8 {
+			c.writeReason("authentication failed")
+		}
+		c.writer.Flush()
+		return false, fmt.Errorf("authentication failed")
+	}
+	if err := c.applyGrant(grant); err != nil {
+		c.writeUint32(1)
+		if minor == 8 {
+			c.writeReason("the session watermark could not be created")
+		}
+		c.writer.Flush()
+		return false, err
+	}
+	c.writeUint32(0)
+	if err := c.writer.Flush(); err != nil {
+		return false, err
+	}
+	log.Printf("[RFB] %s authenticated with a one-time password", c.conn.RemoteAddr())
+
+	shared, err := c.reader.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	return shared != 0, nil
+}
+
+// serverInit announces the framebuffer size, pixel format and desktop name
+func (c *rfbClient) serverInit(size image.Point) error {
+	c.mu.Lock()
+	c.format = rfbDefaultPixelFormat
+	c.encoding = rfbEncodingRaw
+	c.size = size
+	c.mu.Unlock()
+
+	hostname, _ := os.Hostname()
+	name := "Deskwise " + hostname
+
+	binary.Write(c.writer, binary.BigEndian, uint16(size.X))
+	binary.Write(c.writer, binary.BigEndian, uint16(size.Y))
+	c.writer.Write(rfbDefaultPixelFormat.marshal())
+	c.writeReason(name)
+	return c.writer.Flush()
+}
+
+func (c *rfbClient) writeUint32(v uint32) {
+	binary.Write(c.writer, binary.BigEndian, v)
+}
+
+// writeReason writes a length-prefixed string
+func (c *rfbClient) writeReason(reason string) {
+	c.writeUint32(uint32(len(reason)))
+	c.writer.WriteString(reason)
+}
+
+// readMessages handles client messages until the connection ends
+func (c *rfbClient) readMessages(source *rfbFrameSource) error {
+	header := make([]byte, 20)
+	for {
+		messageType, err := c.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		switch messageType {
+		case rfbSetPixelFormat:
+			if _, err := io.ReadFull(c.reader, header[:19]); err != nil {
+				return err
+			}
+			format, err := parseRFBPixelFormat(header[3:19])
+			if err != nil {
+				return err
+			}
+			c.mu.Lock()
+			c.format = format
+			c.mu.Unlock()
+
+		case rfbSetEncodings:
+			if _, err := io.ReadFull(c.reader, header[:3]); err != nil {
+				return err
+			}
+			count := int(binary.BigEndian.Uint16(header[1:3]))
+			encodings := make([]int32, count)
+			if err := binary.Read(c.reader, binary.BigEndian, encodings); err != nil {
+				return err
+			}
+			c.setEncodings(encodings)
+
+		case rfbFramebufferUpdateRequest:
+			if _, err := io.ReadFull(c.reader, header[:9]); err != nil {
+				return err
+			}
+			x := int(binary.BigEndian.Uint16(header[1:]))
+			y := int(binary.BigEndian.Uint16(header[3:]))
+			w := int(binary.BigEndian.Uint16(header[5:]))
+			h := int(binary.BigEndian.Uint16(header[7:]))
+			c.requestUpdate(rfbUpdateRequest{
+				incremental: header[0] != 0,
+				area:        image.Rect(x, y, x+w, y+h),
+			})
+
+		case rfbKeyEvent:
+			if _, err := io.ReadFull(c.reader, header[:7]); err != nil {
+				return err
+			}
+			keysym := binary.BigEndian.Uint32(header[3:7])
+			if key, ok := rfbKeysymToKey(keysym); ok {
+				c.server.injectKey(KeyboardEvent{Key: key, Down: header[0] != 0})
+			}
+
+		case rfbPointerEvent:
+			if _, err := io.ReadFull(c.reader, header[:5]); err != nil {
+				return err
+			}
+			c.handlePointer(header[0], int(binary.BigEndian.Uint16(header[1:])), int(binary.BigEndian.Uint16(header[3:])))
+
+		case rfbClientCutText:
+			if _, err := io.ReadFull(c.reader, header[:7]); err != nil {
+				return err
+			}
+			length := binary.BigEndian.Uint32(header[3:7])
+			if length > rfbMaxCutText {
+				return fmt.Errorf("clipboard text too large (%d bytes)", length)
+			}
+			// Clipboard sharing is not offered over RFB
+			if _, err := io.CopyN(io.Discard, c.reader, int64(length)); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("unknown client message type %d", messageType)
+		}
+	}
+}
+
+// setEncodings records the client's encodings; the first supported rectangle
+// encoding in the client's order of preference is used
+func (c *rfbClient) setEncodings(encodings []int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.encoding = rfbEncodingRaw
+	c.copyRect = false
+	c.desktopSize = false
+	preferred := false
+	for _, encoding := range encodings {
+		switch encoding {
+		case rfbEncodingRaw, rfbEncodingZRLE:
+			if !preferred {
+				c.encoding = encoding
+				preferred = true
+			}
+		case rfbEncodingCopyRect:
+			c.copyRect = true
+		case rfbEncodingDesktopSize:
+			c.desktopSize = true
+		}
+	}
+}
+
+// requestUpdate merges a request into the pending one and wakes the update goroutine
+func (c *rfbClient) requestUpdate(request rfbUpdateRequest) {
+	c.mu.Lock()
+	if c.request != nil {
+		request.incremental = request.incremental && c.request.incremental
+		request.area = request.area.Union(c.request.area)
+	}
+	c.request = &request
+	c.mu.Unlock()
+
+	select {
+	case c.requested <- struct{}{}:
+	default:
+	}
+}
+
+// handlePointer turns a PointerEvent into a move plus button and wheel changes
+func (c *rfbClient) handlePointer(mask uint8, x, y int) {
+	c.mu.Lock()
+	previous := c.buttons
+	c.buttons = mask
+	size := c.size
+	c.mu.Unlock()
+
+	events := []MouseEvent{{Type: "move", X: x, Y: y}}
+	for bit, button := range []string{"left", "middle", "right"} {
+		pressed := mask&(1<<bit) != 0
+		if pressed != (previous&(1<<bit) != 0) {
+			events = append(events, MouseEvent{Type: "button", X: x, Y: y, Button: button, Down: pressed})
+		}
+	}
+	// Buttons 4 and 5 are the wheel; each press is one notch
+	if mask&8 != 0 && previous&8 == 0 {
+		events = append(events, MouseEvent{Type: "scroll", X: x, Y: y, DeltaY: -120})
+	}
+	if mask&16 != 0 && previous&16 == 0 {
+		events = append(events, MouseEvent{Type: "scroll", X: x, Y: y, DeltaY: 120})
+	}
+	c.server.injectPointer(size, events)
+}
+
+// serveUpdates answers update requests: full requests at once, incremental ones
+// as soon as the frame differs from what the client has
+func (c *rfbClient) serveUpdates(source *rfbFrameSource) {
+	defer c.close()
+
+	var (
+		sent        *image.RGBA // The client's framebuffer as of the last update
+		sentSeq     uint64
+		rendered    *image.RGBA // The source frame after redaction and watermark
+		renderedSeq uint64
+		zrle        = newZRLEEncoder()
+		buf         []byte
+		request     *rfbUpdateRequest
+	)
+	for {
+		c.mu.Lock()
+		if c.request != nil {
+			if request != nil {
+				c.request.incremental = c.request.incremental && request.incremental
+				c.request.area = c.request.area.Union(request.area)
+			}
+			request, c.request = c.request, nil
+		}
+		format, encoding, copyRect, desktopSize := c.format, c.encoding, c.copyRect, c.desktopSize
+		size := c.size
+		c.mu.Unlock()
+
+		frame, seq, changed := source.latest()
+		if request == nil || (request.incremental && sent != nil && seq == sentSeq) {
+			select {
+			case <-c.requested:
+			case <-changed:
+			case <-c.done:
+				return
+			}
+			continue
+		}
+		if rendered == nil || renderedSeq != seq {
+			rendered, renderedSeq = c.render(source.capture, frame), seq
+		}
+		frame = rendered
+
+		buf = buf[:0]
+		bounds := frame.Bounds()
+		switch {
+		case bounds.Size() != size:
+			if !desktopSize {
+				log.Printf("[RFB] Screen resized to %dx%d; %s cannot follow, disconnecting",
+					bounds.Dx(), bounds.Dy(), c.conn.RemoteAddr())
+				return
+			}
+			buf = append(buf, 0, 0, 0, 1)
+			buf = appendRFBRectHeader(buf, image.Rectangle{Max: bounds.Size()}, rfbEncodingDesktopSize)
+			c.mu.Lock()
+			c.size = bounds.Size()
+			c.mu.Unlock()
+			sent = nil
+			request = nil
+
+		default:
+			area := request.area.Intersect(bounds)
+			if sent == nil {
+				sent = image.NewRGBA(bounds)
+				request.incremental = false
+			}
+
+			var rects []image.Rectangle
+			var scroll rfbScroll
+			scrolled := false
+			if request.incremental {
+				if copyRect {
+					if scroll, scrolled = rfbDetectScroll(sent, frame, area); scrolled {
+						scroll.apply(sent)
+					}
+				}
+				rects = rfbDirtyRects(sent, frame, area)
+			} else if !area.Empty() {
+				rects = []image.Rectangle{area}
+			}
+			sentSeq = seq
+
+			count := len(rects)
+			if scrolled {
+				count++
+			}
+			if count == 0 {
+				// Nothing changed inside the requested area: wait for the next frame,
+				// or drop a full request for an area outside the screen
+				if !request.incremental {
+					request = nil
+				}
+				continue
+			}
+
+			pw := newRFBPixelWriter(format)
+			buf = append(buf, 0, 0, byte(count>>8), byte(count))
+			if scrolled {
+				buf = appendRFBRectHeader(buf, scroll.dst, rfbEncodingCopyRect)
+				buf = binary.BigEndian.AppendUint16(buf, uint16(scroll.dst.Min.X))
+				buf = binary.BigEndian.AppendUint16(buf, uint16(scroll.srcY))
+			}
+			for _, rect := range rects {
+				buf = appendRFBRectHeader(buf, rect, encoding)
+				if encoding == rfbEncodingZRLE {
+					var err error
+					if buf, err = zrle.appendRect(buf, pw, frame, rect); err != nil {
+						log.Printf("[RFB] %v", err)
+						return
+					}
+				} else {
+					buf = pw.appendRaw(buf, frame, rect)
+				}
+				rfbCopyRect(sent, frame, rect)
+			}
+			request = nil
+		}
+
+		if _, err := c.writer.Write(buf); err != nil {
+			return
+		}
+		if err := c.writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func appendRFBRectHeader(dst []byte, r image.Rectangle, encoding int32) []byte {
+	dst = binary.BigEndian.AppendUint16(dst, uint16(r.Min.X))
+	dst = binary.BigEndian.AppendUint16(dst, uint16(r.Min.Y))
+	dst = binary.BigEndian.AppendUint16(dst, uint16(r.Dx()))
+	dst = binary.BigEndian.AppendUint16(dst, uint16(r.Dy()))
+	return binary.BigEndian.AppendUint32(dst, uint32(encoding))
+}
+
+// rfbCopyRect copies a rectangle of src into dst (same geometry)
+func rfbCopyRect(dst, src *image.RGBA, r image.Rectangle) {
+	width := r.Dx() * 4
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		copy(dst.Pix[dst.PixOffset(r.Min.X, y):][:width], src.Pix[src.PixOffset(r.Min.X, y):][:width])
+	}
+}
+
+// rfbKeysyms maps X11 keysyms to the key names InputHandler understands
+var rfbKeysyms = map[uint32]string{
+	0xff08: "Backspace",
+	0xff09: "Tab",
+	0xff0d: "Enter",
+	0xff8d: "Enter", // KP_Enter
+	0xff1b: "Escape",
+	0xffff: "Delete",
+	0xff50: "Home",
+	0xff51: "ArrowLeft",
+	0xff52: "ArrowUp",
+	0xff53: "ArrowRight",
+	0xff54: "ArrowDown",
+	0xff55: "PageUp",
+	0xff56: "PageDown",
+	0xff57: "End",
+	0xff63: "Insert",
+	0xffe1: "ShiftLeft",
+	0xffe2: "ShiftRight",
+	0xffe3: "ControlLeft",
+	0xffe4: "ControlRight",
+	0xffe7: "MetaLeft", // Meta_L, sent for the Windows key by some clients
+	0xffe8: "MetaRight",
+	0xffe9: "AltLeft",
+	0xffea: "AltRight",
+	0xffeb: "MetaLeft", // Super_L
+	0xffec: "MetaRight",
+}
+
+// rfbKeysymToKey converts an X11 keysym to an InputHandler key name
+func rfbKeysymToKey(keysym uint32) (string, bool) {
+	if key, ok := rfbKeysyms[keysym]; ok {
+		return key, true
+	}
+	switch {
+	case keysym == 0x20:
+		return "Space", true
+	case keysym > 0x20 && keysym < 0x7f:
+		return string(rune(keysym)), true
+	case keysym >= 0xffbe && keysym <= 0xffc9: // F1-F12
+		return "F" + strconv.Itoa(int(keysym-0xffbe)+1), true
+	case keysym >= 0xffb0 && keysym <= 0xffb9: // Keypad digits
+		return string(rune('0' + keysym - 0xffb0)), true
+	}
+	return "", false
+}
@@ -0,0 +1,533 @@
+package remotecontrol
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/maphash"
+	"image"
+)
+
+// RFB encodings (RFC 6143 section 7.7)
+const (
+	rfbEncodingRaw         int32 = 0
+	rfbEncodingCopyRect    int32 = 1
+	rfbEncodingZRLE        int32 = 16
+	rfbEncodingDesktopSize int32 = -223 // Pseudo-encoding: the framebuffer was resized
+)
+
+const (
+	// rfbTileSize is both the dirty-rectangle granularity and the ZRLE tile size
+	rfbTileSize = 64
+
+	// rfbMinScrollRows is the smallest band that is sent as a CopyRect scroll
+	rfbMinScrollRows = 32
+)
+
+// rfbPixelFormat is the PIXEL_FORMAT structure a client asks for with SetPixelFormat
+type rfbPixelFormat struct {
+	BitsPerPixel uint8
+	Depth        uint8
+	BigEndian    bool
+	TrueColour   bool
+	RedMax       uint16
+	GreenMax     uint16
+	BlueMax      uint16
+	RedShift     uint8
+	GreenShift   uint8
+	BlueShift    uint8
+}
+
+// rfbDefaultPixelFormat is announced in ServerInit: 32bpp little-endian XRGB
+var rfbDefaultPixelFormat = rfbPixelFormat{
+	BitsPerPixel: 32,
+	Depth:        24,
+	TrueColour:   true,
+	RedMax:       255,
+	GreenMax:     255,
+	BlueMax:      255,
+	RedShift:     16,
+	GreenShift:   8,
+	BlueShift:    0,
+}
+
+// marshal encodes the 16-byte PIXEL_FORMAT structure
+func (pf rfbPixelFormat) marshal() []byte {
+	b := make([]byte, 16)
+	b[0] = pf.BitsPerPixel
+	b[1] = pf.Depth
+	if pf.BigEndian {
+		b[2] = 1
+	}
+	if pf.TrueColour {
+		b[3] = 1
+	}
+	binary.BigEndian.PutUint16(b[4:], pf.RedMax)
+	binary.BigEndian.PutUint16(b[6:], pf.GreenMax)
+	binary.BigEndian.PutUint16(b[8:], pf.BlueMax)
+	b[10] = pf.RedShift
+	b[11] = pf.GreenShift
+	b[12] = pf.BlueShift
+	return b
+}
+
+// parseRFBPixelFormat decodes a PIXEL_FORMAT structure and rejects formats the server cannot produce
+func parseRFBPixelFormat(b []byte) (rfbPixelFormat, error) {
+	pf := rfbPixelFormat{
+		BitsPerPixel: b[0],
+		Depth:        b[1],
+		BigEndian:    b[2] != 0,
+		TrueColour:   b[3] != 0,
+		RedMax:       binary.BigEndian.Uint16(b[4:]),
+		GreenMax:     binary.BigEndian.Uint16(b[6:]),
+		BlueMax:      binary.BigEndian.Uint16(b[8:]),
+		RedShift:     b[10],
+		GreenShift:   b[11],
+		BlueShift:    b[12],
+	}
+
+	switch pf.BitsPerPixel {
+	case 8, 16, 32:
+	default:
+		return pf, fmt.Errorf("unsupported bits per pixel %d", pf.BitsPerPixel)
+	}
+	if !pf.TrueColour {
+		return pf, fmt.Errorf("colour-map pixel formats are not supported")
+	}
+	if pf.RedShift >= 32 || pf.GreenShift >= 32 || pf.BlueShift >= 32 {
+		return pf, fmt.Errorf("invalid colour shift")
+	}
+	return pf, nil
+}
+
+// rfbPixelWriter converts RGBA pixels to a client's pixel format
+type rfbPixelWriter struct {
+	format      rfbPixelFormat
+	bytesPP     int
+	red         [256]uint32
+	green       [256]uint32
+	blue        [256]uint32
+	cpixelSize  int  // ZRLE compressed pixel size (3 for 32bpp formats with 24 bits of colour)
+	cpixelShift uint // Which 3 bytes a 3-byte CPIXEL keeps
+}
+
+func newRFBPixelWriter(pf rfbPixelFormat) *rfbPixelWriter {
+	pw := &rfbPixelWriter{format: pf, bytesPP: int(pf.BitsPerPixel) / 8}
+	for i := 0; i < 256; i++ {
+		pw.red[i] = (uint32(i) * uint32(pf.RedMax) / 255) << pf.RedShift
+		pw.green[i] = (uint32(i) * uint32(pf.GreenMax) / 255) << pf.GreenShift
+		pw.blue[i] = (uint32(i) * uint32(pf.BlueMax) / 255) << pf.BlueShift
+	}
+
+	// ZRLE drops the unused byte of 32bpp pixels when all colour bits fit in
+	// the least (or most) significant three bytes
+	pw.cpixelSize = pw.bytesPP
+	if pf.BitsPerPixel == 32 && pf.Depth <= 24 {
+		used := pw.red[255] | pw.green[255] | pw.blue[255]
+		switch {
+		case used&0xff000000 == 0:
+			pw.cpixelSize, pw.cpixelShift = 3, 0
+		case used&0x000000ff == 0:
+			pw.cpixelSize, pw.cpixelShift = 3, 8
+		}
+	}
+	return pw
+}
+
+// pixel returns the client pixel value of an RGBA pixel
+func (pw *rfbPixelWriter) pixel(pix []byte) uint32 {
+	return pw.red[pix[0]] | pw.green[pix[1]] | pw.blue[pix[2]]
+}
+
+// appendPixel appends a full-size pixel in the client's byte order
+func (pw *rfbPixelWriter) appendPixel(dst []byte, p uint32) []byte {
+	switch pw.bytesPP {
+	case 1:
+		return append(dst, byte(p))
+	case 2:
+		if pw.format.BigEndian {
+			return binary.BigEndian.AppendUint16(dst, uint16(p))
+		}
+		return binary.LittleEndian.AppendUint16(dst, uint16(p))
+	default:
+		if pw.format.BigEndian {
+			return binary.BigEndian.AppendUint32(dst, p)
+		}
+		return binary.LittleEndian.AppendUint32(dst, p)
+	}
+}
+
+// appendCPixel appends a ZRLE compressed pixel
+func (pw *rfbPixelWriter) appendCPixel(dst []byte, p uint32) []byte {
+	if pw.cpixelSize != 3 {
+		return pw.appendPixel(dst, p)
+	}
+	p >>= pw.cpixelShift
+	if pw.format.BigEndian {
+		return append(dst, byte(p>>16), byte(p>>8), byte(p))
+	}
+	return append(dst, byte(p), byte(p>>8), byte(p>>16))
+}
+
+// appendRaw appends a rectangle in the Raw encoding
+func (pw *rfbPixelWriter) appendRaw(dst []byte, img *image.RGBA, r image.Rectangle) []byte {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(r.Min.X, y):]
+		for x := 0; x < r.Dx(); x++ {
+			dst = pw.appendPixel(dst, pw.pixel(row[x*4:]))
+		}
+	}
+	return dst
+}
+
+// zrleEncoder holds a connection's ZRLE state; the zlib stream spans every
+// ZRLE rectangle sent on the connection, as the protocol requires
+type zrleEncoder struct {
+	compressed bytes.Buffer
+	zw         *zlib.Writer
+	tiles      []byte
+
+	// Per-tile scratch
+	pixels  []uint32
+	runs    []zrleRun
+	palette []uint32
+	index   map[uint32]byte
+}
+
+type zrleRun struct {
+	pixel  uint32
+	length int
+}
+
+// zrleMaxPalette is the largest palette a ZRLE tile can use
+const zrleMaxPalette = 127
+
+func newZRLEEncoder() *zrleEncoder {
+	z := &zrleEncoder{index: make(map[uint32]byte)}
+	z.zw, _ = zlib.NewWriterLevel(&z.compressed, zlib.BestSpeed)
+	return z
+}
+
+// appendRect appends a rectangle in the ZRLE encoding: a length-prefixed zlib
+// chunk of 64x64 tiles, each solid, packed-palette, RLE or raw, whichever is smallest
+func (z *zrleEncoder) appendRect(dst []byte, pw *rfbPixelWriter, img *image.RGBA, r image.Rectangle) ([]byte, error) {
+	z.tiles = z.tiles[:0]
+	for y := r.Min.Y; y < r.Max.Y; y += rfbTileSize {
+		for x := r.Min.X; x < r.Max.X; x += rfbTileSize {
+			tile := image.Rect(x, y, min(x+rfbTileSize, r.Max.X), min(y+rfbTileSize, r.Max.Y))
+			z.tiles = z.appendTile(z.tiles, pw, img, tile)
+		}
+	}
+
+	z.compressed.Reset()
+	if _, err := z.zw.Write(z.tiles); err != nil {
+		return dst, fmt.Errorf("failed to compress ZRLE data: %w", err)
+	}
+	if err := z.zw.Flush(); err != nil {
+		return dst, fmt.Errorf("failed to compress ZRLE data: %w", err)
+	}
+
+	dst = binary.BigEndian.AppendUint32(dst, uint32(z.compressed.Len()))
+	return append(dst, z.compressed.Bytes()...), nil
+}
+
+// zrleRunLength is the number of bytes a run length takes
+func zrleRunLength(length int) int {
+	return (length-1)/255 + 1
+}
+
+func appendZRLERunLength(dst []byte, length int) []byte {
+	v := length - 1
+	for ; v >= 255; v -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(v))
+}
+
+func (z *zrleEncoder) appendTile(dst []byte, pw *rfbPixelWriter, img *image.RGBA, tile image.Rectangle) []byte {
+	z.pixels = z.pixels[:0]
+	z.runs = z.runs[:0]
+	z.palette = z.palette[:0]
+	clear(z.index)
+
+	paletteFull := false
+	for y := tile.Min.Y; y < tile.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(tile.Min.X, y):]
+		for x := 0; x < tile.Dx(); x++ {
+			p := pw.pixel(row[x*4:])
+			z.pixels = append(z.pixels, p)
+
+			// Runs continue across rows
+			if n := len(z.runs); n > 0 && z.runs[n-1].pixel == p {
+				z.runs[n-1].length++
+			} else {
+				z.runs = append(z.runs, zrleRun{pixel: p, length: 1})
+			}
+
+			if !paletteFull {
+				if _, ok := z.index[p]; !ok {
+					if len(z.palette) == zrleMaxPalette {
+						paletteFull = true
+					} else {
+						z.index[p] = byte(len(z.palette))
+						z.palette = append(z.palette, p)
+					}
+				}
+			}
+		}
+	}
+
+	if !paletteFull && len(z.palette) == 1 {
+		dst = append(dst, 1)
+		return pw.appendCPixel(dst, z.palette[0])
+	}
+
+	cp := pw.cpixelSize
+	w, h := tile.Dx(), tile.Dy()
+
+	// Size every applicable subencoding and use the smallest
+	const (
+		subRaw = iota
+		subPacked
+		subPlainRLE
+		subPaletteRLE
+	)
+	best, bestSize := subRaw, w*h*cp
+
+	plainRLE := 0
+	paletteRLE := len(z.palette) * cp
+	for _, run := range z.runs {
+		plainRLE += cp + zrleRunLength(run.length)
+		paletteRLE++
+		if run.length > 1 {
+			paletteRLE += zrleRunLength(run.length)
+		}
+	}
+	if plainRLE < bestSize {
+		best, bestSize = subPlainRLE, plainRLE
+	}
+
+	bits := 0
+	if !paletteFull {
+		switch n := len(z.palette); {
+		case n <= 2:
+			bits = 1
+		case n <= 4:
+			bits = 2
+		case n <= 16:
+			bits = 4
+		}
+		if bits > 0 {
+			if packed := len(z.palette)*cp + h*((w*bits+7)/8); packed < bestSize {
+				best, bestSize = subPacked, packed
+			}
+		}
+		if paletteRLE < bestSize {
+			best = subPaletteRLE
+		}
+	}
+
+	switch best {
+	case subPacked:
+		dst = append(dst, byte(len(z.palette)))
+		for _, p := range z.palette {
+			dst = pw.appendCPixel(dst, p)
+		}
+		for y := 0; y < h; y++ {
+			var current byte
+			filled := 0
+			for _, p := range z.pixels[y*w : (y+1)*w] {
+				current = current<<bits | z.index[p]
+				filled += bits
+				if filled == 8 {
+					dst = append(dst, current)
+					current, filled = 0, 0
+				}
+			}
+			// Rows are padded to a byte boundary
+			if filled > 0 {
+				dst = append(dst, current<<(8-filled))
+			}
+		}
+
+	case subPlainRLE:
+		dst = append(dst, 128)
+		for _, run := range z.runs {
+			dst = pw.appendCPixel(dst, run.pixel)
+			dst = appendZRLERunLength(dst, run.length)
+		}
+
+	case subPaletteRLE:
+		dst = append(dst, byte(128+len(z.palette)))
+		for _, p := range z.palette {
+			dst = pw.appendCPixel(dst, p)
+		}
+		for _, run := range z.runs {
+			if run.length == 1 {
+				dst = append(dst, z.index[run.pixel])
+				continue
+			}
+			dst = append(dst, z.index[run.pixel]|128)
+			dst = appendZRLERunLength(dst, run.length)
+		}
+
+	default:
+		dst = append(dst, 0)
+		for _, p := range z.pixels {
+			dst = pw.appendCPixel(dst, p)
+		}
+	}
+	return dst
+}
+
+// rfbDirtyRects compares the client's framebuffer with the current frame inside
+// area in 64x64 tiles and returns the changed tiles merged into rectangles
+func rfbDirtyRects(prev, cur *image.RGBA, area image.Rectangle) []image.Rectangle {
+	var rects []image.Rectangle
+	for y := area.Min.Y; y < area.Max.Y; y += rfbTileSize {
+		y1 := min(y+rfbTileSize, area.Max.Y)
+
+		// Changed tiles in this row, joined horizontally
+		var row []image.Rectangle
+		for x := area.Min.X; x < area.Max.X; x += rfbTileSize {
+			tile := image.Rect(x, y, min(x+rfbTileSize, area.Max.X), y1)
+			if !rfbTileChanged(prev, cur, tile) {
+				continue
+			}
+			if n := len(row); n > 0 && row[n-1].Max.X == tile.Min.X {
+				row[n-1].Max.X = tile.Max.X
+			} else {
+				row = append(row, tile)
+			}
+		}
+
+		// Extend rectangles from the row above that span the same columns
+	next:
+		for _, r := range row {
+			for i := range rects {
+				if rects[i].Max.Y == r.Min.Y && rects[i].Min.X == r.Min.X && rects[i].Max.X == r.Max.X {
+					rects[i].Max.Y = r.Max.Y
+					continue next
+				}
+			}
+			rects = append(rects, r)
+		}
+	}
+	return rects
+}
+
+func rfbTileChanged(prev, cur *image.RGBA, tile image.Rectangle) bool {
+	width := tile.Dx() * 4
+	for y := tile.Min.Y; y < tile.Max.Y; y++ {
+		a := prev.Pix[prev.PixOffset(tile.Min.X, y):]
+		b := cur.Pix[cur.PixOffset(tile.Min.X, y):]
+		if !bytes.Equal(a[:width], b[:width]) {
+			return true
+		}
+	}
+	return false
+}
+
+// rfbScroll is a band of rows that moved vertically between two frames
+type rfbScroll struct {
+	dst  image.Rectangle // Where the rows are now
+	srcY int             // Where the band started in the previous frame
+}
+
+var rfbRowSeed = maphash.MakeSeed()
+
+// rfbDetectScroll looks for a vertical scroll inside area: the most common
+// offset between rows of the current frame and identical, unique rows of the
+// previous frame, extended to the longest band of rows that moved by it
+func rfbDetectScroll(prev, cur *image.RGBA, area image.Rectangle) (rfbScroll, bool) {
+	height := area.Dy()
+	if height < rfbMinScrollRows*2 {
+		return rfbScroll{}, false
+	}
+
+	rowHash := func(img *image.RGBA, y int) uint64 {
+		offset := img.PixOffset(area.Min.X, y)
+		return maphash.Bytes(rfbRowSeed, img.Pix[offset:offset+area.Dx()*4])
+	}
+	prevHashes := make([]uint64, height)
+	curHashes := make([]uint64, height)
+	prevRows := make(map[uint64]int, height)
+	for i := 0; i < height; i++ {
+		prevHashes[i] = rowHash(prev, area.Min.Y+i)
+		curHashes[i] = rowHash(cur, area.Min.Y+i)
+
+		// Blank rows and other repeats say nothing about movement
+		if _, seen := prevRows[prevHashes[i]]; seen {
+			prevRows[prevHashes[i]] = -1
+		} else {
+			prevRows[prevHashes[i]] = i
+		}
+	}
+
+	votes := make(map[int]int)
+	for i, hash := range curHashes {
+		if hash == prevHashes[i] {
+			continue
+		}
+		if j, ok := prevRows[hash]; ok && j >= 0 {
+			votes[j-i]++
+		}
+	}
+	dy, best := 0, 0
+	for offset, count := range votes {
+		if count > best {
+			dy, best = offset, count
+		}
+	}
+	if best < rfbMinScrollRows {
+		return rfbScroll{}, false
+	}
+
+	// Longest band of rows that match the previous frame shifted by dy
+	rowsEqual := func(i int) bool {
+		j := i + dy
+		if j < 0 || j >= height || curHashes[i] != prevHashes[j] {
+			return false
+		}
+		a := cur.Pix[cur.PixOffset(area.Min.X, area.Min.Y+i):]
+		b := prev.Pix[prev.PixOffset(area.Min.X, area.Min.Y+j):]
+		return bytes.Equal(a[:area.Dx()*4], b[:area.Dx()*4])
+	}
+	start, length := 0, 0
+	for i := 0; i < height; {
+		if !rowsEqual(i) {
+			i++
+			continue
+		}
+		j := i
+		for j < height && rowsEqual(j) {
+			j++
+		}
+		if j-i > length {
+			start, length = i, j-i
+		}
+		i = j
+	}
+	if length < rfbMinScrollRows {
+		return rfbScroll{}, false
+	}
+
+	return rfbScroll{
+		dst:  image.Rect(area.Min.X, area.Min.Y+start, area.Max.X, area.Min.Y+start+length),
+		srcY: area.Min.Y + start + dy,
+	}, true
+}
+
+// apply moves the scrolled rows within img, as the client does for a CopyRect
+func (s rfbScroll) apply(img *image.RGBA) {
+	width := s.dst.Dx() * 4
+	rows := make([]byte, 0, width*s.dst.Dy())
+	for y := 0; y < s.dst.Dy(); y++ {
+		offset := img.PixOffset(s.dst.Min.X, s.srcY+y)
+		rows = append(rows, img.Pix[offset:offset+width]...)
+	}
+	for y := 0; y < s.dst.Dy(); y++ {
+		copy(img.Pix[img.PixOffset(s.dst.Min.X, s.dst.Min.Y+y):], rows[y*width:(y+1)*width])
+	}
+}
@@ -0,0 +1,144 @@
+package remotecontrol
+
+import (
+	"bytes"
+	"crypto/des"
+	"image"
+	"testing"
+	"time"
+)
+
+func TestRFBEncryptChallenge(t *testing.T) {
+	challenge := []byte("0123456789abcdef")
+
+	cases := []struct {
+		password string
+		key      []byte // "k3y5ecr7" with each byte bit-reversed, as VNC clients build the DES key
+	}{
+		{"k3y5ecr7", []byte{0xd6, 0xcc, 0x9e, 0xac, 0xa6, 0xc6, 0x4e, 0xec}},
+		{"k3y5ecr7-ignored", []byte{0xd6, 0xcc, 0x9e, 0xac, 0xa6, 0xc6, 0x4e, 0xec}},
+		{"k3y", []byte{0xd6, 0xcc, 0x9e, 0, 0, 0, 0, 0}},
+	}
+
+	for _, tc := range cases {
+		response, err := rfbEncryptChallenge(tc.password, challenge)
+		if err != nil {
+			t.Fatalf("rfbEncryptChallenge(%q): %v", tc.password, err)
+		}
+		cipher, err := des.NewCipher(tc.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted := make([]byte, len(response))
+		for i := 0; i < len(response); i += des.BlockSize {
+			cipher.Decrypt(decrypted[i:], response[i:])
+		}
+		if !bytes.Equal(decrypted, challenge) {
+			t.Errorf("rfbEncryptChallenge(%q) does not decrypt with the bit-reversed key", tc.password)
+		}
+	}
+}
+
+func TestRFBOneTimePasswords(t *testing.T) {
+	s := NewRFBServer(RFBConfig{}, nil)
+	challenge := []byte("fedcba9876543210")
+	respond := func(password string) []byte {
+		response, err := rfbEncryptChallenge(password, challenge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	if err := s.AddOneTimePassword(RFBPassword{}); err == nil {
+		t.Error("empty password accepted")
+	}
+	if err := s.AddOneTimePassword(RFBPassword{Password: "stale", ExpiresAt: time.Now().Add(-time.Minute)}); err == nil {
+		t.Error("expired password accepted")
+	}
+
+	policy := &RedactionPolicy{Rules: []RedactionRule{{Monitor: -1, Width: 10, Height: 10}}}
+	if err := s.AddOneTimePassword(RFBPassword{Password: "k3y5ecr7-long", Redaction: policy}); err != nil {
+		t.Fatalf("AddOneTimePassword: %v", err)
+	}
+	if !s.hasPasswords() {
+		t.Fatal("no password pending after AddOneTimePassword")
+	}
+
+	if _, ok := s.checkPassword(challenge, respond("wrong")); ok {
+		t.Error("wrong password accepted")
+	}
+	grant, ok := s.checkPassword(challenge, respond("k3y5ecr7"))
+	if !ok {
+		t.Fatal("issued password refused")
+	}
+	if grant.Redaction != policy {
+		t.Error("grant lost its redaction policy")
+	}
+	if _, ok := s.checkPassword(challenge, respond("k3y5ecr7")); ok {
+		t.Error("one-time password accepted twice")
+	}
+
+	// A re-sent grant must not make a used password valid again
+	if err := s.AddOneTimePassword(RFBPassword{Password: "k3y5ecr7"}); err != nil {
+		t.Fatalf("re-sent grant: %v", err)
+	}
+	if s.hasPasswords() {
+		t.Error("used password pending again after a re-sent grant")
+	}
+}
+
+func TestRFBLoginLockout(t *testing.T) {
+	s := NewRFBServer(RFBConfig{}, nil)
+
+	for i := 0; i < rfbMaxAuthFailures-1; i++ {
+		s.recordLogin("192.0.2.7", false)
+	}
+	if s.lockedOut("192.0.2.7") {
+		t.Fatalf("locked out after %d failures, want %d", rfbMaxAuthFailures-1, rfbMaxAuthFailures)
+	}
+	s.recordLogin("192.0.2.7", false)
+	if !s.lockedOut("192.0.2.7") {
+		t.Fatalf("not locked out after %d failures", rfbMaxAuthFailures)
+	}
+	if s.lockedOut("192.0.2.8") {
+		t.Error("lockout applies to other addresses")
+	}
+
+	s.recordLogin("192.0.2.9", false)
+	s.recordLogin("192.0.2.9", true)
+	for i := 0; i < rfbMaxAuthFailures-1; i++ {
+		s.recordLogin("192.0.2.9", false)
+	}
+	if s.lockedOut("192.0.2.9") {
+		t.Error("a successful login did not reset the failure count")
+	}
+}
+
+func TestRFBClientRender(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 320, 200))
+	capture := NewScreenCapture()
+
+	plain := &rfbClient{}
+	if got := plain.render(capture, frame); got != frame {
+		t.Error("client without a policy got a copy of the shared frame")
+	}
+
+	client := &rfbClient{}
+	if err := client.applyGrant(RFBPassword{Watermark: &WatermarkConfig{Enabled: true, Operator: "alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	if client.watermark == nil {
+		t.Fatal("watermark from the grant was not set up")
+	}
+	rendered := client.render(capture, frame)
+	if rendered == frame {
+		t.Fatal("watermark drawn on the shared frame")
+	}
+	if bytes.Equal(rendered.Pix, frame.Pix) {
+		t.Error("rendered frame has no watermark")
+	}
+	if !bytes.Equal(frame.Pix, image.NewRGBA(frame.Rect).Pix) {
+		t.Error("shared frame was modified")
+	}
+}
@@ -0,0 +1,302 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"image"
+)
+
+// ScalingMode selects the resampling filter used to fit captured frames to the encoder size
+type ScalingMode string
+
+const (
+	ScalingAuto     ScalingMode = "auto"     // Pick a filter from the scale factor
+	ScalingNearest  ScalingMode = "nearest"  // Fastest, but text shimmers when downscaling
+	ScalingBilinear ScalingMode = "bilinear" // Smooth, good for small scale factors and upscaling
+	ScalingArea     ScalingMode = "area"     // Box filter / area averaging, best for text at large factors
+)
+
+// areaScaleThreshold is the downscale factor above which auto mode switches from bilinear to area
+const areaScaleThreshold = 1.5
+
+// ParseScalingMode validates a scaling mode name (empty selects auto)
+func ParseScalingMode(name string) (ScalingMode, error) {
+	switch mode := ScalingMode(name); mode {
+	case "":
+		return ScalingAuto, nil
+	case ScalingAuto, ScalingNearest, ScalingBilinear, ScalingArea:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown scaling mode: %s", name)
+	}
+}
+
+// resolveScalingMode turns auto into a concrete filter for the given source and target sizes
+func resolveScalingMode(mode ScalingMode, srcWidth, srcHeight, targetWidth, targetHeight int) ScalingMode {
+	if mode != ScalingAuto && mode != "" {
+		return mode
+	}
+
+	factorX := float64(srcWidth) / float64(targetWidth)
+	factorY := float64(srcHeight) / float64(targetHeight)
+	factor := factorX
+	if factorY > factor {
+		factor = factorY
+	}
+
+	if factor >= areaScaleThreshold {
+		return ScalingArea
+	}
+	return ScalingBilinear
+}
+
+// scaleFrame resizes src to the target size using the requested filter
+func scaleFrame(src *image.RGBA, targetWidth, targetHeight int, mode ScalingMode) *image.RGBA {
+	srcBounds := src.Bounds()
+	srcWidth := srcBounds.Dx()
+	srcHeight := srcBounds.Dy()
+
+	// If already at target size, return as-is (zero-copy optimization)
+	if srcWidth == targetWidth && srcHeight == targetHeight {
+		return src
+	}
+
+	switch resolveScalingMode(mode, srcWidth, srcHeight, targetWidth, targetHeight) {
+	case ScalingNearest:
+		return scaleNearest(src, targetWidth, targetHeight)
+	case ScalingArea:
+		return scaleArea(src, targetWidth, targetHeight)
+	default:
+		return scaleBilinear(src, targetWidth, targetHeight)
+	}
+}
+
+// scaleNearest scales an image using optimized nearest neighbor with integer math
+func scaleNearest(src *image.RGBA, targetWidth, targetHeight int) *image.RGBA {
+	srcBounds := src.Bounds()
+	srcWidth := srcBounds.Dx()
+	srcHeight := srcBounds.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+
+	xRatio := (srcWidth << 16) / targetWidth
+	yRatio := (srcHeight << 16) / targetHeight
+
+	for y := 0; y < targetHeight; y++ {
+		srcY := (y * yRatio) >> 16
+		srcRowOffset := srcY * src.Stride
+		dstRowOffset := y * dst.Stride
+
+		for x := 0; x < targetWidth; x++ {
+			srcX := (x * xRatio) >> 16
+			srcOffset := srcRowOffset + srcX*4
+			dstOffset := dstRowOffset + x*4
+
+			// Copy 4 bytes (RGBA) at once
+			dst.Pix[dstOffset] = src.Pix[srcOffset]
+			dst.Pix[dstOffset+1] = src.Pix[srcOffset+1]
+			dst.Pix[dstOffset+2] = src.Pix[srcOffset+2]
+			dst.Pix[dstOffset+3] = src.Pix[srcOffset+3]
+		}
+	}
+
+	return dst
+}
+
+// bilinearTaps holds the two source samples and the 8-bit weight of the second one
+type bilinearTaps struct {
+	i0, i1 int
+	frac   uint32
+}
+
+// bilinearAxis precomputes sample positions for one axis using pixel-centre alignment
+func bilinearAxis(srcSize, dstSize int) []bilinearTaps {
+	taps := make([]bilinearTaps, dstSize)
+	for d := 0; d < dstSize; d++ {
+		// Centre of destination pixel d mapped into source space, in 1/256 pixel units
+		pos := ((2*d+1)*srcSize*256)/(2*dstSize) - 128
+		if pos < 0 {
+			pos = 0
+		}
+		i0 := pos >> 8
+		frac := uint32(pos & 0xff)
+		i1 := i0 + 1
+		if i0 >= srcSize-1 {
+			i0 = srcSize - 1
+			i1 = srcSize - 1
+			frac = 0
+		}
+		taps[d] = bilinearTaps{i0: i0, i1: i1, frac: frac}
+	}
+	return taps
+}
+
+// scaleBilinear scales an image by interpolating between the four nearest source pixels
+func scaleBilinear(src *image.RGBA, targetWidth, targetHeight int) *image.RGBA {
+	srcBounds := src.Bounds()
+	srcWidth := srcBounds.Dx()
+	srcHeight := srcBounds.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+
+	xTaps := bilinearAxis(srcWidth, targetWidth)
+	yTaps := bilinearAxis(srcHeight, targetHeight)
+
+	for y := 0; y < targetHeight; y++ {
+		ty := yTaps[y]
+		row0 := src.Pix[ty.i0*src.Stride:]
+		row1 := src.Pix[ty.i1*src.Stride:]
+		fy := ty.frac
+		dstRow := dst.Pix[y*dst.Stride:]
+
+		for x := 0; x < targetWidth; x++ {
+			tx := xTaps[x]
+			o0 := tx.i0 * 4
+			o1 := tx.i1 * 4
+			fx := tx.frac
+
+			for c := 0; c < 4; c++ {
+				top := uint32(row0[o0+c])*(256-fx) + uint32(row0[o1+c])*fx
+				bottom := uint32(row1[o0+c])*(256-fx) + uint32(row1[o1+c])*fx
+				dstRow[x*4+c] = uint8((top*(256-fy) + bottom*fy + 1<<15) >> 16)
+			}
+		}
+	}
+
+	return dst
+}
+
+// areaSpan lists the source pixels covered by one destination pixel and their 8-bit weights
+type areaSpan struct {
+	start   int
+	weights []uint32
+}
+
+// areaAxis precomputes box filter coverage for one axis; weights of each span sum to 256
+func areaAxis(srcSize, dstSize int) []areaSpan {
+	spans := make([]areaSpan, dstSize)
+	for d := 0; d < dstSize; d++ {
+		// Work in units of 1/dstSize source pixels so coverage is exact
+		lo := d * srcSize
+		hi := (d + 1) * srcSize
+		first := lo / dstSize
+		last := (hi - 1) / dstSize
+
+		weights := make([]uint32, 0, last-first+1)
+		assigned := 0
+		covered := 0
+		for s := first; s <= last; s++ {
+			segLo := s * dstSize
+			segHi := segLo + dstSize
+			if segLo < lo {
+				segLo = lo
+			}
+			if segHi > hi {
+				segHi = hi
+			}
+			covered += segHi - segLo
+
+			// Round the cumulative coverage so the weights always sum to exactly 256
+			next := (covered*256 + srcSize/2) / srcSize
+			weights = append(weights, uint32(next-assigned))
+			assigned = next
+		}
+		spans[d] = areaSpan{start: first, weights: weights}
+	}
+	return spans
+}
+
+// scaleArea scales an image by averaging every source pixel covered by each destination pixel
+func scaleArea(src *image.RGBA, targetWidth, targetHeight int) *image.RGBA {
+	srcBounds := src.Bounds()
+	srcWidth := srcBounds.Dx()
+
+	// Integer factors (e.g. 4K to 1080p) have no partial coverage, so sum whole blocks directly
+	if srcWidth%targetWidth == 0 && srcBounds.Dy()%targetHeight == 0 {
+		return scaleAreaInteger(src, srcWidth/targetWidth, srcBounds.Dy()/targetHeight)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+
+	xSpans := areaAxis(srcWidth, targetWidth)
+	ySpans := areaAxis(srcBounds.Dy(), targetHeight)
+
+	// Vertically weighted sum of the covered source rows for the current destination row
+	acc := make([]uint32, srcWidth*4)
+
+	for y := 0; y < targetHeight; y++ {
+		for i := range acc {
+			acc[i] = 0
+		}
+
+		span := ySpans[y]
+		for j, wy := range span.weights {
+			if wy == 0 {
+				continue
+			}
+			row := src.Pix[(span.start+j)*src.Stride : (span.start+j)*src.Stride+len(acc)]
+			for i, v := range row {
+				acc[i] += uint32(v) * wy
+			}
+		}
+
+		dstRow := dst.Pix[y*dst.Stride : y*dst.Stride+targetWidth*4]
+		for x := 0; x < targetWidth; x++ {
+			xs := xSpans[x]
+			var r, g, b, a uint32
+			px := acc[xs.start*4 : (xs.start+len(xs.weights))*4]
+			for i, wx := range xs.weights {
+				p := px[i*4 : i*4+4 : i*4+4]
+				r += p[0] * wx
+				g += p[1] * wx
+				b += p[2] * wx
+				a += p[3] * wx
+			}
+
+			d := dstRow[x*4 : x*4+4 : x*4+4]
+			d[0] = uint8((r + 1<<15) >> 16)
+			d[1] = uint8((g + 1<<15) >> 16)
+			d[2] = uint8((b + 1<<15) >> 16)
+			d[3] = uint8((a + 1<<15) >> 16)
+		}
+	}
+
+	return dst
+}
+
+// scaleAreaInteger averages non-overlapping factorX x factorY blocks of the source image
+func scaleAreaInteger(src *image.RGBA, factorX, factorY int) *image.RGBA {
+	srcBounds := src.Bounds()
+	targetWidth := srcBounds.Dx() / factorX
+	targetHeight := srcBounds.Dy() / factorY
+
+	dst := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+
+	count := uint32(factorX * factorY)
+	half := count / 2
+	blockBytes := factorX * 4
+
+	for y := 0; y < targetHeight; y++ {
+		dstRow := dst.Pix[y*dst.Stride : y*dst.Stride+targetWidth*4]
+		for x := 0; x < targetWidth; x++ {
+			var r, g, b, a uint32
+			for j := 0; j < factorY; j++ {
+				offset := (y*factorY+j)*src.Stride + x*blockBytes
+				block := src.Pix[offset : offset+blockBytes : offset+blockBytes]
+				for i := 0; i < blockBytes; i += 4 {
+					r += uint32(block[i])
+					g += uint32(block[i+1])
+					b += uint32(block[i+2])
+					a += uint32(block[i+3])
+				}
+			}
+
+			d := dstRow[x*4 : x*4+4 : x*4+4]
+			d[0] = uint8((r + half) / count)
+			d[1] = uint8((g + half) / count)
+			d[2] = uint8((b + half) / count)
+			d[3] = uint8((a + half) / count)
+		}
+	}
+
+	return dst
+}
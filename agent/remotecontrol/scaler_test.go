@@ -0,0 +1,220 @@
+package remotecontrol
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden images in testdata")
+
+// textPattern builds a deterministic frame with the features that break nearest-neighbour
+// scaling: one-pixel strokes, a fine checkerboard and a smooth gradient
+func textPattern(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var r, g, b uint8
+			switch {
+			case y < height/3:
+				// Vertical 1px strokes, like terminal glyph stems
+				if x%3 == 0 {
+					r, g, b = 0, 0, 0
+				} else {
+					r, g, b = 255, 255, 255
+				}
+			case y < 2*height/3:
+				// 1px checkerboard
+				if (x+y)%2 == 0 {
+					r, g, b = 30, 60, 200
+				} else {
+					r, g, b = 240, 220, 20
+				}
+			default:
+				r = uint8(x * 255 / (width - 1))
+				g = uint8(y * 255 / (height - 1))
+				b = 128
+			}
+			o := y*img.Stride + x*4
+			img.Pix[o], img.Pix[o+1], img.Pix[o+2], img.Pix[o+3] = r, g, b, 255
+		}
+	}
+	return img
+}
+
+func solidImage(width, height int, r, g, b uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = r, g, b, 255
+	}
+	return img
+}
+
+func TestScaleFrameGolden(t *testing.T) {
+	src := textPattern(96, 60)
+
+	cases := []struct {
+		mode          ScalingMode
+		width, height int
+	}{
+		{ScalingNearest, 40, 25},
+		{ScalingBilinear, 40, 25},
+		{ScalingArea, 40, 25},
+		{ScalingBilinear, 128, 80},
+		{ScalingArea, 48, 30},
+	}
+
+	for _, tc := range cases {
+		name := fmt.Sprintf("%s_%dx%d", tc.mode, tc.width, tc.height)
+		t.Run(name, func(t *testing.T) {
+			got := scaleFrame(src, tc.width, tc.height, tc.mode)
+			if got.Bounds().Dx() != tc.width || got.Bounds().Dy() != tc.height {
+				t.Fatalf("got size %v, want %dx%d", got.Bounds(), tc.width, tc.height)
+			}
+
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, got); err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+
+			path := filepath.Join("testdata", "scaler", name+".png")
+			if *updateGolden {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatalf("missing golden image (run with -update): %v", err)
+			}
+			defer f.Close()
+
+			want, err := png.Decode(f)
+			if err != nil {
+				t.Fatalf("decode golden: %v", err)
+			}
+
+			for y := 0; y < tc.height; y++ {
+				for x := 0; x < tc.width; x++ {
+					wr, wg, wb, wa := want.At(x, y).RGBA()
+					gr, gg, gb, ga := got.At(x, y).RGBA()
+					if wr != gr || wg != gg || wb != gb || wa != ga {
+						t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, got.At(x, y), want.At(x, y))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestScaleAreaAveragesBlocks(t *testing.T) {
+	// 4x2 source with two 2x2 blocks: black/white stripes and a solid colour
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	set := func(x, y int, v uint8) {
+		o := y*src.Stride + x*4
+		src.Pix[o], src.Pix[o+1], src.Pix[o+2], src.Pix[o+3] = v, v, v, 255
+	}
+	set(0, 0, 0)
+	set(1, 0, 255)
+	set(0, 1, 0)
+	set(1, 1, 255)
+	set(2, 0, 100)
+	set(3, 0, 100)
+	set(2, 1, 100)
+	set(3, 1, 100)
+
+	dst := scaleArea(src, 2, 1)
+
+	if got := dst.Pix[0]; got != 128 {
+		t.Errorf("striped block averaged to %d, want 128", got)
+	}
+	if got := dst.Pix[4]; got != 100 {
+		t.Errorf("solid block averaged to %d, want 100", got)
+	}
+}
+
+func TestScalersPreserveSolidColour(t *testing.T) {
+	src := solidImage(37, 23, 12, 200, 77)
+
+	for _, mode := range []ScalingMode{ScalingNearest, ScalingBilinear, ScalingArea} {
+		for _, size := range [][2]int{{10, 7}, {37, 11}, {80, 50}} {
+			dst := scaleFrame(src, size[0], size[1], mode)
+			for i := 0; i < len(dst.Pix); i += 4 {
+				if dst.Pix[i] != 12 || dst.Pix[i+1] != 200 || dst.Pix[i+2] != 77 || dst.Pix[i+3] != 255 {
+					t.Fatalf("%s %dx%d: pixel %d = %v", mode, size[0], size[1], i/4, dst.Pix[i:i+4])
+				}
+			}
+		}
+	}
+}
+
+func TestAreaAxisWeightsSumToOne(t *testing.T) {
+	for _, sizes := range [][2]int{{3840, 1920}, {2560, 1920}, {1366, 1280}, {7, 3}, {5, 5}} {
+		for d, span := range areaAxis(sizes[0], sizes[1]) {
+			var sum uint32
+			for _, w := range span.weights {
+				sum += w
+			}
+			if sum != 256 {
+				t.Fatalf("%d->%d: span %d weights sum to %d", sizes[0], sizes[1], d, sum)
+			}
+		}
+	}
+}
+
+func TestResolveScalingMode(t *testing.T) {
+	cases := []struct {
+		mode       ScalingMode
+		srcW, srcH int
+		dstW, dstH int
+		want       ScalingMode
+	}{
+		{ScalingAuto, 3840, 2160, 1920, 1080, ScalingArea},
+		{ScalingAuto, 2560, 1440, 1920, 1080, ScalingBilinear},
+		{ScalingAuto, 1280, 720, 1920, 1080, ScalingBilinear},
+		{"", 3840, 2160, 1920, 1080, ScalingArea},
+		{ScalingNearest, 3840, 2160, 1920, 1080, ScalingNearest},
+	}
+
+	for _, tc := range cases {
+		if got := resolveScalingMode(tc.mode, tc.srcW, tc.srcH, tc.dstW, tc.dstH); got != tc.want {
+			t.Errorf("resolveScalingMode(%q, %dx%d -> %dx%d) = %s, want %s",
+				tc.mode, tc.srcW, tc.srcH, tc.dstW, tc.dstH, got, tc.want)
+		}
+	}
+}
+
+func TestParseScalingMode(t *testing.T) {
+	if mode, err := ParseScalingMode(""); err != nil || mode != ScalingAuto {
+		t.Errorf("empty mode = %q, %v; want auto", mode, err)
+	}
+	if mode, err := ParseScalingMode("area"); err != nil || mode != ScalingArea {
+		t.Errorf("area mode = %q, %v", mode, err)
+	}
+	if _, err := ParseScalingMode("lanczos"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func benchmarkScaler(b *testing.B, mode ScalingMode) {
+	src := textPattern(3840, 2160)
+	b.SetBytes(int64(len(src.Pix)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scaleFrame(src, 1920, 1080, mode)
+	}
+}
+
+func BenchmarkScaleNearest4K(b *testing.B)  { benchmarkScaler(b, ScalingNearest) }
+func BenchmarkScaleBilinear4K(b *testing.B) { benchmarkScaler(b, ScalingBilinear) }
+func BenchmarkScaleArea4K(b *testing.B)     { benchmarkScaler(b, ScalingArea) }
@@ -14,20 +14,46 @@ import (
 // ScreenCapture handles screen capturing and encoding
 type ScreenCapture struct {
 	running      bool
-	frameChan    chan *image.RGBA
+	frameChan    chan *CapturedFrame
 	targetFPS    int
 	mu           sync.RWMutex
+	captureMu    sync.Mutex // Held while a frame is grabbed and redacted and while the capturer is replaced; taken before mu
 	capturer     PlatformCapturer
 	monitorIndex int  // Which monitor to capture (-1 for all monitors/virtual desktop)
 	monitors     MultiMonitorInfo
+
+	fixedMonitor      bool // Per-monitor track capture: never remapped on layout changes
+	framesDisabled    bool // Frames are not consumed (per-monitor mode), skip capturing them
+	onMonitorsChanged func(monitors MultiMonitorInfo, monitorIndex int)
+	redactor          *Redactor // Policy regions masked before frames leave the capture loop
+	synthetic         *SyntheticConfig // Render test frames instead of capturing the display
+	x11Display        *X11Display      // Capture this X display (virtual or session display) instead of the default
+	paused            *image.RGBA      // Placeholder sent instead of the display while the user has paused
+	window            *CapturedWindow  // Shared top-level window captured instead of the monitor (nil = monitor)
+	onWindowChanged   func(window *CapturedWindow)
 }
 
 // PlatformCapturer is the platform-specific screen capture interface
 type PlatformCapturer interface {
 	Initialize() error
 	CaptureFrame() (*image.RGBA, error)
+	CaptureCursor() (*CursorState, error) // Cursor in absolute desktop coordinates
 	Close() error
 	GetDisplayInfo() DisplayInfo
+
+	// SelectWindow makes CaptureFrame return a single top-level window instead of the
+	// monitor (nil = the monitor); errWindowCaptureUnsupported where that is not possible
+	SelectWindow(target *WindowTarget) (*CapturedWindow, error)
+	// CapturedWindow reports the selected window as of the last frame (nil = none)
+	CapturedWindow() *CapturedWindow
+}
+
+// CapturedFrame is a captured (and redacted) frame with its capture timing
+type CapturedFrame struct {
+	Image    *image.RGBA
+	Started  time.Time // When the capture of this frame began
+	Captured time.Time // When it was ready for the consumer (after redaction)
+	Paused   bool      // The "Paused by user" placeholder, not the display
 }
 
 // DisplayInfo contains information about the display
@@ -39,13 +65,13 @@ type DisplayInfo struct {
 
 // MonitorInfo contains information about a single monitor
 type MonitorInfo struct {
-	Index  int
-	Name   string
-	X      int
-	Y      int
-	Width  int
-	Height int
-	Primary bool
+	Index  int    `json:"index"`
+	Name   string `json:"name"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Primary bool  `json:"primary"`
 }
 
 // MultiMonitorInfo contains information about all monitors
@@ -73,7 +99,7 @@ func NewScreenCapture() *ScreenCapture {
 	}
 
 	return &ScreenCapture{
-		frameChan:    make(chan *image.RGBA, 2), // Buffer only 2 frames for low latency
+		frameChan:    make(chan *CapturedFrame, 2), // Buffer only 2 frames for low latency
 		targetFPS:    30,
 		monitorIndex: defaultMonitorIndex,
 	}
@@ -82,7 +108,7 @@ func NewScreenCapture() *ScreenCapture {
 // NewScreenCaptureWithMonitor creates a screen capture instance for a specific monitor
 func NewScreenCaptureWithMonitor(monitorIndex int) *ScreenCapture {
 	return &ScreenCapture{
-		frameChan:    make(chan *image.RGBA, 2),
+		frameChan:    make(chan *CapturedFrame, 2),
 		targetFPS:    30,
 		monitorIndex: monitorIndex,
 	}
@@ -135,11 +161,14 @@ func DetectMonitors() MultiMonitorInfo {
 
 // SetMonitor sets which monitor to capture (-1 for all monitors)
 func (sc *ScreenCapture) SetMonitor(index int) {
+	sc.captureMu.Lock()
+	defer sc.captureMu.Unlock()
 	sc.mu.Lock()
 	defer sc.mu.Unlock()
 
 	log.Printf("[ScreenCapture] Switching to monitor %d", index)
 	sc.monitorIndex = index
+	sc.clearWindowLocked() // The caller resets input confinement
 
 	// If screen capture is running, reinitialize the capturer with the new monitor
 	if sc.running && sc.capturer != nil {
@@ -149,7 +178,7 @@ func (sc *ScreenCapture) SetMonitor(index int) {
 		}
 
 		// Create new capturer with updated monitor index
-		sc.capturer = newPlatformCapturerWithMonitor(sc.monitorIndex, sc.monitors)
+		sc.capturer = sc.newCapturerLocked()
 		if err := sc.capturer.Initialize(); err != nil {
 			log.Printf("[ScreenCapture] Error reinitializing capturer: %v", err)
 			return
@@ -164,8 +193,30 @@ func (sc *ScreenCapture) SetMonitor(index int) {
 	}
 }
 
+// SetTargetFPS changes the capture rate; a running capture loop picks it up on its next tick
+func (sc *ScreenCapture) SetTargetFPS(fps int) {
+	if fps <= 0 {
+		return
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.targetFPS = fps
+	log.Printf("[ScreenCapture] Target FPS set to %d", fps)
+}
+
+// GetTargetFPS returns the current capture rate
+func (sc *ScreenCapture) GetTargetFPS() int {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.targetFPS
+}
+
 // GetMonitors returns information about all detected monitors
 func (sc *ScreenCapture) GetMonitors() MultiMonitorInfo {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
 	return sc.monitors
 }
 
@@ -186,7 +237,7 @@ func (sc *ScreenCapture) Start() error {
 	}
 
 	// Detect all monitors
-	sc.monitors = DetectMonitors()
+	sc.monitors = sc.detectLayoutLocked()
 	log.Printf("[ScreenCapture] Detected %d monitor(s)", len(sc.monitors.Monitors))
 	for _, mon := range sc.monitors.Monitors {
 		log.Printf("[ScreenCapture]   Monitor %d: %dx%d at (%d,%d) %s",
@@ -195,7 +246,7 @@ func (sc *ScreenCapture) Start() error {
 	}
 
 	// Initialize platform-specific capturer
-	sc.capturer = newPlatformCapturerWithMonitor(sc.monitorIndex, sc.monitors)
+	sc.capturer = sc.newCapturerLocked()
 	if err := sc.capturer.Initialize(); err != nil {
 		return fmt.Errorf("failed to initialize capturer: %w", err)
 	}
@@ -205,6 +256,11 @@ func (sc *ScreenCapture) Start() error {
 	// Start capture loop
 	go sc.captureLoop()
 
+	// Watch for docking/undocking and other display layout changes
+	if !sc.fixedMonitor && sc.synthetic == nil && sc.x11Display == nil {
+		go sc.watchMonitorLayout()
+	}
+
 	if sc.monitorIndex == -1 {
 		log.Printf("[ScreenCapture] Started capturing ALL monitors (Virtual Desktop: %dx%d) at %d FPS",
 			sc.monitors.VirtualWidth, sc.monitors.VirtualHeight, sc.targetFPS)
@@ -217,6 +273,8 @@ func (sc *ScreenCapture) Start() error {
 
 // Stop stops screen capture
 func (sc *ScreenCapture) Stop() {
+	sc.captureMu.Lock()
+	defer sc.captureMu.Unlock()
 	sc.mu.Lock()
 	defer sc.mu.Unlock()
 
@@ -235,7 +293,7 @@ func (sc *ScreenCapture) Stop() {
 }
 
 // GetFrameChannel returns the channel for receiving captured frames
-func (sc *ScreenCapture) GetFrameChannel() <-chan *image.RGBA {
+func (sc *ScreenCapture) GetFrameChannel() <-chan *CapturedFrame {
 	return sc.frameChan
 }
 
@@ -249,36 +307,315 @@ func (sc *ScreenCapture) GetDisplayInfo() DisplayInfo {
 
 // captureLoop continuously captures frames at the target FPS
 func (sc *ScreenCapture) captureLoop() {
-	interval := time.Second / time.Duration(sc.targetFPS)
-	ticker := time.NewTicker(interval)
+	sc.mu.RLock()
+	currentFPS := sc.targetFPS
+	sc.mu.RUnlock()
+
+	pacer := newFramePacer(currentFPS)
+	ticker := time.NewTicker(pacer.interval)
 	defer ticker.Stop()
 
+	consecutiveErrors := 0
+	var lastPaused time.Time
+
 	for {
 		sc.mu.RLock()
 		running := sc.running
+		targetFPS := sc.targetFPS
+		framesDisabled := sc.framesDisabled
+		paused := sc.paused
 		sc.mu.RUnlock()
 
 		if !running {
 			break
 		}
 
+		// Apply frame rate changes requested during the session
+		if targetFPS != currentFPS {
+			currentFPS = targetFPS
+			pacer.setTarget(currentFPS)
+			ticker.Reset(pacer.interval)
+		}
+
 		<-ticker.C
 
-		frame, err := sc.capturer.CaptureFrame()
-		if err != nil {
-			log.Printf("[ScreenCapture] Failed to capture frame: %v", err)
+		if framesDisabled {
 			continue
 		}
 
-		// Send frame to channel (non-blocking)
+		started := time.Now()
+		var frame *image.RGBA
+		if paused != nil {
+			// The display is not read while paused; the placeholder is repeated now and
+			// then so a viewer that joins late still gets a frame
+			if started.Sub(lastPaused) < pausedFrameInterval {
+				continue
+			}
+			lastPaused = started
+			frame = copyRGBA(paused) // Consumers draw on frames (watermark, frame IDs)
+		} else {
+			lastPaused = time.Time{}
+
+			// The capturer cannot be closed or replaced (monitor switch, layout change,
+			// window sharing) until this frame is redacted for the area it shows
+			sc.captureMu.Lock()
+			sc.mu.RLock()
+			capturer := sc.capturer
+			sc.mu.RUnlock()
+			if capturer == nil {
+				sc.captureMu.Unlock()
+				break
+			}
+
+			var err error
+			frame, err = capturer.CaptureFrame()
+			if err != nil {
+				sc.captureMu.Unlock()
+				consecutiveErrors++
+				if consecutiveErrors == 1 || consecutiveErrors%100 == 0 {
+					log.Printf("[ScreenCapture] Failed to capture frame (%d in a row): %v", consecutiveErrors, err)
+				}
+
+				// Repeated failures usually mean the captured display went away
+				if consecutiveErrors%captureErrorsBeforeLayoutCheck == 0 && !sc.fixedMonitor {
+					sc.refreshMonitorLayout()
+				}
+				continue
+			}
+			consecutiveErrors = 0
+
+			// A shared window may have moved; redaction and input follow its new geometry
+			windowChanged := sc.updateWindow(capturer)
+
+			// Redaction happens here so no consumer (and no encoder) ever sees the raw frame
+			sc.redactFrame(frame)
+			sc.captureMu.Unlock()
+
+			if windowChanged != nil {
+				windowChanged()
+			}
+		}
+
+		// Send frame to channel (non-blocking); holding the lock keeps Stop from
+		// closing the channel mid-send
+		captured := &CapturedFrame{Image: frame, Started: started, Captured: time.Now(), Paused: paused != nil}
+		sc.mu.RLock()
+		if !sc.running {
+			sc.mu.RUnlock()
+			break
+		}
+		queued := true
 		select {
-		case sc.frameChan <- frame:
+		case sc.frameChan <- captured:
 		default:
-			// Channel full, drop frame
+			// The encoder fell behind: swap the oldest queued frame for this one so it
+			// always gets the freshest frame, and capture less often until it catches up
+			queued = false
+			select {
+			case <-sc.frameChan:
+			default:
+			}
+			select {
+			case sc.frameChan <- captured:
+			default:
+			}
+		}
+		sc.mu.RUnlock()
+
+		if queued && pacer.keptUp() || !queued && pacer.fellBehind() {
+			ticker.Reset(pacer.interval)
 		}
 	}
 }
 
+// maxCaptureInterval bounds how far the pacer slows capture (5 FPS)
+const maxCaptureInterval = time.Second / 5
+
+// framePacer adapts the capture interval to how fast frames are consumed: it backs
+// off while the frame channel is full and steps back towards the target rate
+// after every quarter second of frames consumed without back-pressure
+type framePacer struct {
+	target   time.Duration
+	interval time.Duration
+	streak   int // Frames consumed without back-pressure since the last change
+}
+
+func newFramePacer(fps int) *framePacer {
+	p := &framePacer{}
+	p.setTarget(fps)
+	return p
+}
+
+// setTarget changes the target frame rate and resets any back-off
+func (p *framePacer) setTarget(fps int) {
+	if fps <= 0 {
+		fps = 1
+	}
+	p.target = time.Second / time.Duration(fps)
+	p.interval = p.target
+	p.streak = 0
+}
+
+// fellBehind slows capture by a quarter; it reports whether the interval changed
+func (p *framePacer) fellBehind() bool {
+	p.streak = 0
+	if p.interval >= maxCaptureInterval {
+		return false
+	}
+
+	if p.interval == p.target {
+		log.Printf("[ScreenCapture] Encoder falling behind, reducing capture rate below %.0f FPS", float64(time.Second)/float64(p.target))
+	}
+	p.interval += p.interval / 4
+	if p.interval > maxCaptureInterval {
+		p.interval = maxCaptureInterval
+	}
+	return true
+}
+
+// keptUp speeds capture back up towards the target; it reports whether the interval changed
+func (p *framePacer) keptUp() bool {
+	if p.interval == p.target {
+		return false
+	}
+
+	p.streak++
+	if time.Duration(p.streak)*p.interval < time.Second/4 {
+		return false
+	}
+
+	p.streak = 0
+	p.interval -= p.interval / 4
+	if p.interval <= p.target {
+		p.interval = p.target
+		log.Printf("[ScreenCapture] Encoder caught up, capturing at %.0f FPS", float64(time.Second)/float64(p.target))
+	}
+	return true
+}
+
+// SetSyntheticSource replaces the display with a synthetic source (nil captures the display);
+// it must be called before Start
+func (sc *ScreenCapture) SetSyntheticSource(config *SyntheticConfig) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.synthetic = config
+}
+
+// GetSyntheticSource returns the synthetic source configuration (nil when capturing the display)
+func (sc *ScreenCapture) GetSyntheticSource() *SyntheticConfig {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.synthetic
+}
+
+// SetX11Display captures an explicit X display instead of the default one (nil
+// restores it); it must be called before Start
+func (sc *ScreenCapture) SetX11Display(display *X11Display) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.x11Display = display
+}
+
+// GetX11Display returns the explicit X display being captured (nil = the default display)
+func (sc *ScreenCapture) GetX11Display() *X11Display {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.x11Display
+}
+
+// SwitchX11Display moves capture to another X display, also while running; the new
+// layout goes to the monitors-changed handler. The old display is kept on failure.
+func (sc *ScreenCapture) SwitchX11Display(display X11Display) error {
+	sc.captureMu.Lock()
+	sc.mu.Lock()
+	if !sc.running {
+		sc.x11Display = &display
+		sc.mu.Unlock()
+		sc.captureMu.Unlock()
+		return nil
+	}
+
+	previous := sc.x11Display
+	sc.x11Display = &display
+	capturer := sc.newCapturerLocked()
+	if err := capturer.Initialize(); err != nil {
+		sc.x11Display = previous
+		sc.mu.Unlock()
+		sc.captureMu.Unlock()
+		return fmt.Errorf("failed to capture X display %s: %w", display.Display, err)
+	}
+	if sc.capturer != nil {
+		if err := sc.capturer.Close(); err != nil {
+			log.Printf("[ScreenCapture] Error closing capturer: %v", err)
+		}
+	}
+	sc.capturer = capturer
+	sc.monitors = sc.detectLayoutLocked()
+	if sc.monitorIndex != -1 {
+		sc.monitorIndex = 0 // An X display is captured as one screen
+	}
+	windowShared := sc.clearWindowLocked() // Windows of the old display are gone
+	monitors, monitorIndex := sc.monitors, sc.monitorIndex
+	handler, windowHandler := sc.onMonitorsChanged, sc.onWindowChanged
+	sc.mu.Unlock()
+	sc.captureMu.Unlock()
+
+	log.Printf("[ScreenCapture] Switched to X display %s", display.Display)
+	if windowShared && windowHandler != nil {
+		windowHandler(nil)
+	}
+	if handler != nil {
+		handler(monitors, monitorIndex)
+	}
+	return nil
+}
+
+// detectLayoutLocked returns the layout of whatever is being captured; sc.mu must be held
+func (sc *ScreenCapture) detectLayoutLocked() MultiMonitorInfo {
+	if sc.x11Display == nil {
+		return detectLayout(sc.synthetic)
+	}
+
+	source, err := newX11FrameSource(*sc.x11Display)
+	if err != nil {
+		log.Printf("[ScreenCapture] Failed to detect X display %s: %v", sc.x11Display.Display, err)
+		return MultiMonitorInfo{}
+	}
+	defer source.Close()
+	return source.Monitors()
+}
+
+// detectLayout returns the display layout, or the synthetic one when a synthetic source is set
+func detectLayout(synthetic *SyntheticConfig) MultiMonitorInfo {
+	if synthetic == nil {
+		return DetectMonitors()
+	}
+
+	config, err := synthetic.normalized()
+	if err == nil && config.Width == 0 && config.Replay != "" {
+		// The size comes from the replay frames
+		probe := NewSyntheticCapturer(config, -1)
+		if probe.Initialize() == nil {
+			return probe.Monitors()
+		}
+	}
+	if config.Width == 0 {
+		config.Width, config.Height = 1280, 720
+	}
+	return syntheticMonitors(config)
+}
+
+// newCapturerLocked creates the capturer for the current monitor; sc.mu must be held
+func (sc *ScreenCapture) newCapturerLocked() PlatformCapturer {
+	if sc.x11Display != nil {
+		return &LinuxCapturer{display: sc.x11Display}
+	}
+	if sc.synthetic != nil {
+		return NewSyntheticCapturer(*sc.synthetic, sc.monitorIndex)
+	}
+	return newPlatformCapturerWithMonitor(sc.monitorIndex, sc.monitors)
+}
+
 // newPlatformCapturerWithMonitor creates the appropriate capturer for the current platform
 func newPlatformCapturerWithMonitor(monitorIndex int, monitors MultiMonitorInfo) PlatformCapturer {
 	switch runtime.GOOS {
@@ -383,6 +720,22 @@ func (wc *WindowsCapturer) captureVirtualDesktop() (*image.RGBA, error) {
 	return canvas, nil
 }
 
+func (wc *WindowsCapturer) CaptureCursor() (*CursorState, error) {
+	return captureWindowsCursor()
+}
+
+// SelectWindow is not implemented on Windows yet
+func (wc *WindowsCapturer) SelectWindow(target *WindowTarget) (*CapturedWindow, error) {
+	if target == nil {
+		return nil, nil
+	}
+	return nil, errWindowCaptureUnsupported
+}
+
+func (wc *WindowsCapturer) CapturedWindow() *CapturedWindow {
+	return nil
+}
+
 func (wc *WindowsCapturer) Close() error {
 	log.Println("[WindowsCapturer] Closed")
 	return nil
@@ -395,22 +748,104 @@ func (wc *WindowsCapturer) GetDisplayInfo() DisplayInfo {
 // LinuxCapturer implements screen capture for Linux using X11/Wayland
 type LinuxCapturer struct {
 	displayInfo DisplayInfo
+	display     *X11Display     // Explicit X display, grabbed with GetImage (nil = default display)
+	frames      *x11FrameSource // Frame source for display
+	cursor      *x11CursorSource
+	window      *x11WindowSource // Shared window captured instead of the display (nil = display)
 }
 
 func (lc *LinuxCapturer) Initialize() error {
-	// TODO: Implement X11 XShm or Wayland capture
-	log.Println("[LinuxCapturer] Initialized (TODO: Implement X11/Wayland)")
-	lc.displayInfo = DisplayInfo{Width: 1920, Height: 1080, DPI: 96}
+	var display X11Display
+	if lc.display != nil {
+		display = *lc.display
+		frames, err := newX11FrameSource(display)
+		if err != nil {
+			return err
+		}
+		lc.frames = frames
+		lc.displayInfo = DisplayInfo{Width: frames.width, Height: frames.height, DPI: 96}
+		log.Printf("[LinuxCapturer] Initialized - X display %s: %dx%d", display.Display, frames.width, frames.height)
+	} else {
+		// TODO: Implement X11 XShm or Wayland capture
+		log.Println("[LinuxCapturer] Initialized (TODO: Implement X11/Wayland)")
+		lc.displayInfo = DisplayInfo{Width: 1920, Height: 1080, DPI: 96}
+	}
+
+	// Cursor capture is optional: without X11/XFixes the stream simply has no cursor
+	cursor, err := newX11CursorSource(display)
+	if err != nil {
+		log.Printf("[LinuxCapturer] Cursor capture unavailable: %v", err)
+	} else {
+		lc.cursor = cursor
+	}
 	return nil
 }
 
 func (lc *LinuxCapturer) CaptureFrame() (*image.RGBA, error) {
+	if lc.window != nil {
+		return lc.window.Capture()
+	}
+	if lc.frames != nil {
+		return lc.frames.Capture()
+	}
+
 	// TODO: Implement actual frame capture
 	img := image.NewRGBA(image.Rect(0, 0, lc.displayInfo.Width, lc.displayInfo.Height))
 	return img, nil
 }
 
+func (lc *LinuxCapturer) CaptureCursor() (*CursorState, error) {
+	if lc.cursor == nil {
+		return nil, errCursorUnsupported
+	}
+	return lc.cursor.Capture()
+}
+
+// SelectWindow shares one top-level window of the display (the default display when
+// none was set)
+func (lc *LinuxCapturer) SelectWindow(target *WindowTarget) (*CapturedWindow, error) {
+	if lc.window != nil {
+		lc.window.Close()
+		lc.window = nil
+	}
+	if target == nil {
+		return nil, nil
+	}
+
+	var display X11Display
+	if lc.display != nil {
+		display = *lc.display
+	}
+	source, err := newX11WindowSource(display, *target)
+	if err != nil {
+		return nil, err
+	}
+	lc.window = source
+	window := source.Window()
+	return &window, nil
+}
+
+func (lc *LinuxCapturer) CapturedWindow() *CapturedWindow {
+	if lc.window == nil {
+		return nil
+	}
+	window := lc.window.Window()
+	return &window
+}
+
 func (lc *LinuxCapturer) Close() error {
+	if lc.window != nil {
+		lc.window.Close()
+		lc.window = nil
+	}
+	if lc.cursor != nil {
+		lc.cursor.Close()
+		lc.cursor = nil
+	}
+	if lc.frames != nil {
+		lc.frames.Close()
+		lc.frames = nil
+	}
 	log.Println("[LinuxCapturer] Closed")
 	return nil
 }
@@ -437,6 +872,22 @@ func (mc *MacOSCapturer) CaptureFrame() (*image.RGBA, error) {
 	return img, nil
 }
 
+func (mc *MacOSCapturer) CaptureCursor() (*CursorState, error) {
+	// TODO: Implement with CGEventGetLocation / NSCursor
+	return nil, errCursorUnsupported
+}
+
+func (mc *MacOSCapturer) SelectWindow(target *WindowTarget) (*CapturedWindow, error) {
+	if target == nil {
+		return nil, nil
+	}
+	return nil, errWindowCaptureUnsupported
+}
+
+func (mc *MacOSCapturer) CapturedWindow() *CapturedWindow {
+	return nil
+}
+
 func (mc *MacOSCapturer) Close() error {
 	log.Println("[MacOSCapturer] Closed")
 	return nil
@@ -446,26 +897,16 @@ func (mc *MacOSCapturer) GetDisplayInfo() DisplayInfo {
 	return mc.displayInfo
 }
 
-// DummyCapturer is a fallback capturer for unsupported platforms
+// DummyCapturer is a fallback capturer for unsupported platforms; it shows the
+// synthetic colour bars with a frame counter instead of a black screen
 type DummyCapturer struct {
-	displayInfo DisplayInfo
+	SyntheticCapturer
 }
 
 func (dc *DummyCapturer) Initialize() error {
 	log.Println("[DummyCapturer] Initialized")
-	dc.displayInfo = DisplayInfo{Width: 1920, Height: 1080, DPI: 96}
-	return nil
-}
-
-func (dc *DummyCapturer) CaptureFrame() (*image.RGBA, error) {
-	img := image.NewRGBA(image.Rect(0, 0, dc.displayInfo.Width, dc.displayInfo.Height))
-	return img, nil
-}
-
-func (dc *DummyCapturer) Close() error {
-	return nil
-}
-
-func (dc *DummyCapturer) GetDisplayInfo() DisplayInfo {
-	return dc.displayInfo
+	dc.SyntheticCapturer = SyntheticCapturer{
+		config: SyntheticConfig{Width: 1920, Height: 1080, Counter: true},
+	}
+	return dc.SyntheticCapturer.Initialize()
 }
@@ -0,0 +1,158 @@
+package remotecontrol
+
+import (
+	"image"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFramePacerBacksOffAndRecovers(t *testing.T) {
+	pacer := newFramePacer(30)
+	target := time.Second / 30
+	if pacer.interval != target {
+		t.Fatalf("initial interval = %v, want %v", pacer.interval, target)
+	}
+	if pacer.keptUp() {
+		t.Error("keptUp changed the interval at the target rate")
+	}
+
+	// Back-pressure slows capture by a quarter each time, down to 5 FPS
+	if !pacer.fellBehind() || pacer.interval != target+target/4 {
+		t.Fatalf("interval after falling behind = %v, want %v", pacer.interval, target+target/4)
+	}
+	for i := 0; i < 20; i++ {
+		pacer.fellBehind()
+	}
+	if pacer.interval != maxCaptureInterval {
+		t.Fatalf("interval after sustained back-pressure = %v, want %v", pacer.interval, maxCaptureInterval)
+	}
+	if pacer.fellBehind() {
+		t.Error("fellBehind changed the interval at the slowest rate")
+	}
+
+	// Speeding up waits for a quarter second of frames kept up with
+	frames := 0
+	for !pacer.keptUp() {
+		frames++
+		if frames > 100 {
+			t.Fatal("pacer never sped up")
+		}
+	}
+	if got := time.Duration(frames+1) * maxCaptureInterval; got < time.Second/4 {
+		t.Errorf("sped up after %v of frames, want at least 250ms", got)
+	}
+	if pacer.interval != maxCaptureInterval-maxCaptureInterval/4 {
+		t.Errorf("interval after keeping up = %v, want %v", pacer.interval, maxCaptureInterval-maxCaptureInterval/4)
+	}
+
+	// A hiccup restarts the streak
+	pacer.fellBehind()
+	slowed := pacer.interval
+	if pacer.keptUp() {
+		t.Error("sped up right after falling behind")
+	}
+	if pacer.interval != slowed {
+		t.Errorf("interval = %v, want %v", pacer.interval, slowed)
+	}
+
+	// And it settles on the target, never above it
+	for i := 0; i < 1000 && pacer.interval != target; i++ {
+		pacer.keptUp()
+	}
+	if pacer.interval != target {
+		t.Errorf("interval after recovering = %v, want %v", pacer.interval, target)
+	}
+}
+
+func TestFramePacerSetTarget(t *testing.T) {
+	pacer := newFramePacer(30)
+	pacer.fellBehind()
+	pacer.setTarget(15)
+	if pacer.interval != time.Second/15 || pacer.streak != 0 {
+		t.Errorf("after setTarget(15) interval = %v streak = %d, want %v and 0", pacer.interval, pacer.streak, time.Second/15)
+	}
+	pacer.setTarget(0)
+	if pacer.target != time.Second {
+		t.Errorf("target for 0 FPS = %v, want 1s", pacer.target)
+	}
+}
+
+// slowCapturer takes a while over each frame and records being closed in the middle of one
+type slowCapturer struct {
+	SyntheticCapturer
+	capturing      chan struct{}
+	captured       chan struct{}
+	closed         atomic.Bool
+	usedAfterClose atomic.Bool
+}
+
+func (c *slowCapturer) CaptureFrame() (*image.RGBA, error) {
+	select {
+	case c.capturing <- struct{}{}:
+	default:
+	}
+	time.Sleep(20 * time.Millisecond)
+	if c.closed.Load() {
+		c.usedAfterClose.Store(true)
+	}
+	select {
+	case c.captured <- struct{}{}:
+	default:
+	}
+	return c.SyntheticCapturer.CaptureFrame()
+}
+
+func (c *slowCapturer) Close() error {
+	c.closed.Store(true)
+	return c.SyntheticCapturer.Close()
+}
+
+func TestCapturerNotClosedMidFrame(t *testing.T) {
+	sc := NewScreenCaptureWithMonitor(0)
+	sc.SetSyntheticSource(&SyntheticConfig{Width: 64, Height: 64, Monitors: 2})
+	sc.SetTargetFPS(200)
+
+	slow := &slowCapturer{
+		SyntheticCapturer: *NewSyntheticCapturer(SyntheticConfig{Width: 64, Height: 64, Monitors: 2}, 0),
+		capturing:         make(chan struct{}),
+		captured:          make(chan struct{}, 1),
+	}
+	if err := slow.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Stop()
+	sc.captureMu.Lock()
+	sc.mu.Lock()
+	sc.capturer.Close()
+	sc.capturer = slow
+	sc.mu.Unlock()
+	sc.captureMu.Unlock()
+
+	go func() {
+		for range sc.GetFrameChannel() {
+		}
+	}()
+
+	select {
+	case <-slow.capturing:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no frame captured")
+	}
+	// Switching monitors replaces the capturer while it is grabbing a frame
+	sc.SetMonitor(1)
+	if !slow.closed.Load() {
+		t.Fatal("old capturer not closed")
+	}
+	select {
+	case <-slow.captured:
+	case <-time.After(2 * time.Second):
+		t.Fatal("frame never finished")
+	}
+	if slow.usedAfterClose.Load() {
+		t.Error("capturer closed while a frame was being captured")
+	}
+}
@@ -0,0 +1,97 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// x11FrameSource grabs the root window of an X display with GetImage
+type x11FrameSource struct {
+	conn   *xgb.Conn
+	root   xproto.Window
+	width  int
+	height int
+	bgr    bool // Pixels are stored blue first (LSBFirst 24/32-bit TrueColor)
+}
+
+// newX11FrameSource connects to display and checks that its pixels can be converted
+func newX11FrameSource(display X11Display) (*x11FrameSource, error) {
+	conn, err := dialX11(display)
+	if err != nil {
+		return nil, err
+	}
+
+	setup := xproto.Setup(conn)
+	screen := setup.DefaultScreen(conn)
+
+	bitsPerPixel := 0
+	for _, format := range setup.PixmapFormats {
+		if format.Depth == screen.RootDepth {
+			bitsPerPixel = int(format.BitsPerPixel)
+		}
+	}
+	if screen.RootDepth < 24 || bitsPerPixel != 32 {
+		conn.Close()
+		return nil, fmt.Errorf("unsupported X11 pixel format (depth %d, %d bits per pixel)", screen.RootDepth, bitsPerPixel)
+	}
+
+	return &x11FrameSource{
+		conn:   conn,
+		root:   screen.Root,
+		width:  int(screen.WidthInPixels),
+		height: int(screen.HeightInPixels),
+		bgr:    setup.ImageByteOrder == xproto.ImageOrderLSBFirst,
+	}, nil
+}
+
+// Capture returns the whole root window
+func (s *x11FrameSource) Capture() (*image.RGBA, error) {
+	return s.captureRect(image.Rect(0, 0, s.width, s.height))
+}
+
+// captureRect returns part of the root window; rect must lie on the screen
+func (s *x11FrameSource) captureRect(rect image.Rectangle) (*image.RGBA, error) {
+	width, height := rect.Dx(), rect.Dy()
+	reply, err := xproto.GetImage(s.conn, xproto.ImageFormatZPixmap, xproto.Drawable(s.root),
+		int16(rect.Min.X), int16(rect.Min.Y), uint16(width), uint16(height), 0xffffffff).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get X11 image: %w", err)
+	}
+	if len(reply.Data) < width*height*4 {
+		return nil, fmt.Errorf("short X11 image (%d bytes for %dx%d)", len(reply.Data), width, height)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	src, dst := reply.Data, img.Pix
+	for i := 0; i < len(dst); i += 4 {
+		if s.bgr {
+			dst[i], dst[i+1], dst[i+2] = src[i+2], src[i+1], src[i]
+		} else {
+			dst[i], dst[i+1], dst[i+2] = src[i+1], src[i+2], src[i+3]
+		}
+		dst[i+3] = 0xff
+	}
+	return img, nil
+}
+
+// Monitors describes the display as a single monitor
+func (s *x11FrameSource) Monitors() MultiMonitorInfo {
+	return MultiMonitorInfo{
+		Monitors: []MonitorInfo{{
+			Index:   0,
+			Name:    "X11 display",
+			Width:   s.width,
+			Height:  s.height,
+			Primary: true,
+		}},
+		VirtualWidth:  s.width,
+		VirtualHeight: s.height,
+	}
+}
+
+func (s *x11FrameSource) Close() {
+	s.conn.Close()
+}
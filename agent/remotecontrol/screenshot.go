@@ -0,0 +1,191 @@
+package remotecontrol
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"math"
+	"runtime"
+	"time"
+)
+
+// ScreenshotRequest is a one-off screenshot command delivered through rc/poll,
+// for ticket triage without a remote control session
+type ScreenshotRequest struct {
+	RequestID  string           `json:"requestId"`
+	TicketID   string           `json:"ticketId"`
+	Monitor    int              `json:"monitor"`              // Monitor index, -1 for all monitors
+	Format     string           `json:"format,omitempty"`     // png (default) or jpeg
+	Scale      float64          `json:"scale,omitempty"`      // 0 < scale <= 1 (default 1)
+	Quality    int              `json:"quality,omitempty"`    // JPEG quality 1-100 (default 85)
+	NotifyUser *bool            `json:"notifyUser,omitempty"` // Organisation policy; unset notifies the user
+	Redaction  *RedactionPolicy `json:"redaction,omitempty"`  // Regions masked as in sessions
+}
+
+// Screenshot is an encoded screenshot ready for upload
+type Screenshot struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+	Captured    time.Time
+}
+
+const (
+	screenshotPNG  = "png"
+	screenshotJPEG = "jpeg"
+
+	defaultScreenshotQuality = 85
+)
+
+// normalized fills in defaults and validates the request
+func (r ScreenshotRequest) normalized() (ScreenshotRequest, error) {
+	if r.RequestID == "" {
+		return r, fmt.Errorf("screenshot request has no ID")
+	}
+
+	switch r.Format {
+	case "", screenshotPNG:
+		r.Format = screenshotPNG
+	case "jpg", screenshotJPEG:
+		r.Format = screenshotJPEG
+	default:
+		return r, fmt.Errorf("unsupported screenshot format %q (use png or jpeg)", r.Format)
+	}
+
+	if r.Scale == 0 {
+		r.Scale = 1
+	}
+	if r.Scale < 0 || r.Scale > 1 {
+		return r, fmt.Errorf("screenshot scale %.2f outside (0, 1]", r.Scale)
+	}
+
+	if r.Quality == 0 {
+		r.Quality = defaultScreenshotQuality
+	}
+	if r.Quality < 1 || r.Quality > 100 {
+		return r, fmt.Errorf("JPEG quality %d outside 1-100", r.Quality)
+	}
+	return r, nil
+}
+
+// ShouldNotify reports whether the organisation policy wants the user told about the screenshot
+func (r ScreenshotRequest) ShouldNotify() bool {
+	return r.NotifyUser == nil || *r.NotifyUser
+}
+
+// CaptureScreenshot captures one monitor (or all of them) once, applies redaction
+// and scaling and encodes the image. On Linux the foreground graphical session is
+// captured as in sessions; platforms without a real capturer return an error
+// rather than a blank image.
+func CaptureScreenshot(request ScreenshotRequest, synthetic *SyntheticConfig) (*Screenshot, error) {
+	request, err := request.normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	source := &ScreenCapture{synthetic: synthetic, monitorIndex: request.Monitor}
+	if synthetic == nil {
+		if source.x11Display, err = screenshotDisplay(); err != nil {
+			return nil, err
+		}
+	}
+
+	// The capture is not shared, so its lock is not needed
+	monitors := source.detectLayoutLocked()
+	if len(monitors.Monitors) == 0 {
+		return nil, fmt.Errorf("no display to capture")
+	}
+	area := image.Rect(monitors.VirtualMinX, monitors.VirtualMinY,
+		monitors.VirtualMinX+monitors.VirtualWidth, monitors.VirtualMinY+monitors.VirtualHeight)
+	switch {
+	case request.Monitor == -1:
+	case request.Monitor >= 0 && request.Monitor < len(monitors.Monitors):
+		mon := monitors.Monitors[request.Monitor]
+		area = image.Rect(mon.X, mon.Y, mon.X+mon.Width, mon.Y+mon.Height)
+	default:
+		return nil, fmt.Errorf("monitor %d does not exist (%d detected)", request.Monitor, len(monitors.Monitors))
+	}
+	source.monitors = monitors
+
+	capturer := source.newCapturerLocked()
+	if err := capturer.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to initialize capturer: %w", err)
+	}
+	defer capturer.Close()
+
+	frame, err := capturer.CaptureFrame()
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture screenshot: %w", err)
+	}
+	captured := time.Now()
+
+	// Redaction is placed for the area; a frame of any other size was not taken from it
+	if frame.Bounds().Dx() != area.Dx() || frame.Bounds().Dy() != area.Dy() {
+		return nil, fmt.Errorf("captured %dx%d for a %dx%d area", frame.Bounds().Dx(), frame.Bounds().Dy(), area.Dx(), area.Dy())
+	}
+	if request.Redaction != nil && len(request.Redaction.Rules) > 0 {
+		redactor := NewRedactor(*request.Redaction)
+		if source.x11Display != nil {
+			redactor = newRedactorOnDisplay(*request.Redaction, *source.x11Display)
+		}
+		redactor.Apply(frame, area, monitors)
+		redactor.Close()
+	}
+
+	if request.Scale < 1 {
+		bounds := frame.Bounds()
+		width := max(1, int(math.Round(float64(bounds.Dx())*request.Scale)))
+		height := max(1, int(math.Round(float64(bounds.Dy())*request.Scale)))
+		frame = scaleFrame(frame, width, height, ScalingAuto)
+	}
+
+	var buf bytes.Buffer
+	shot := &Screenshot{
+		Width:    frame.Bounds().Dx(),
+		Height:   frame.Bounds().Dy(),
+		Captured: captured,
+	}
+	switch request.Format {
+	case screenshotJPEG:
+		shot.ContentType = "image/jpeg"
+		err = jpeg.Encode(&buf, frame, &jpeg.Options{Quality: request.Quality})
+	default:
+		shot.ContentType = "image/png"
+		err = png.Encode(&buf, frame)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode screenshot: %w", err)
+	}
+	shot.Data = buf.Bytes()
+
+	log.Printf("[Screenshot] Captured %dx%d %s (%d bytes) for ticket %s",
+		shot.Width, shot.Height, request.Format, len(shot.Data), request.TicketID)
+	return shot, nil
+}
+
+// screenshotDisplay finds the display to capture: the foreground graphical session
+// where sessions are discovered (nil = the platform capturer)
+func screenshotDisplay() (*X11Display, error) {
+	if !isGraphicalSessionDiscoverySupported() {
+		if runtime.GOOS != "windows" {
+			// The other platform capturers only produce placeholder frames so far
+			return nil, fmt.Errorf("screenshots are not supported on %s", runtime.GOOS)
+		}
+		return nil, nil
+	}
+
+	sessions, err := discoverGraphicalSessions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover graphical sessions: %w", err)
+	}
+	gs, ok := defaultGraphicalSession(sessions)
+	if !ok {
+		return nil, fmt.Errorf("no graphical session to capture (%d found)", len(sessions))
+	}
+	display := gs.x11Display()
+	return &display, nil
+}
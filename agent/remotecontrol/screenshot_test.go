@@ -0,0 +1,129 @@
+package remotecontrol
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestScreenshotRequestNormalized(t *testing.T) {
+	tests := []struct {
+		name    string
+		request ScreenshotRequest
+		format  string
+		scale   float64
+		quality int
+		ok      bool
+	}{
+		{"defaults", ScreenshotRequest{RequestID: "r1"}, screenshotPNG, 1, defaultScreenshotQuality, true},
+		{"jpg alias", ScreenshotRequest{RequestID: "r1", Format: "jpg", Quality: 40}, screenshotJPEG, 1, 40, true},
+		{"jpeg at half size", ScreenshotRequest{RequestID: "r1", Format: "jpeg", Scale: 0.5}, screenshotJPEG, 0.5, defaultScreenshotQuality, true},
+		{"full scale", ScreenshotRequest{RequestID: "r1", Scale: 1}, screenshotPNG, 1, defaultScreenshotQuality, true},
+		{"no ID", ScreenshotRequest{}, "", 0, 0, false},
+		{"unknown format", ScreenshotRequest{RequestID: "r1", Format: "gif"}, "", 0, 0, false},
+		{"upscaling", ScreenshotRequest{RequestID: "r1", Scale: 1.5}, "", 0, 0, false},
+		{"negative scale", ScreenshotRequest{RequestID: "r1", Scale: -0.5}, "", 0, 0, false},
+		{"quality too high", ScreenshotRequest{RequestID: "r1", Format: "jpeg", Quality: 101}, "", 0, 0, false},
+		{"negative quality", ScreenshotRequest{RequestID: "r1", Quality: -1}, "", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.request.normalized()
+			if (err == nil) != tt.ok {
+				t.Fatalf("normalized() error = %v, want ok %t", err, tt.ok)
+			}
+			if tt.ok && (got.Format != tt.format || got.Scale != tt.scale || got.Quality != tt.quality) {
+				t.Errorf("normalized() = %s at %.2f quality %d, want %s at %.2f quality %d",
+					got.Format, got.Scale, got.Quality, tt.format, tt.scale, tt.quality)
+			}
+		})
+	}
+}
+
+func TestCaptureScreenshot(t *testing.T) {
+	synthetic := &SyntheticConfig{Pattern: SyntheticStatic, Width: 320, Height: 200, Monitors: 2}
+	tests := []struct {
+		name          string
+		request       ScreenshotRequest
+		contentType   string
+		width, height int
+	}{
+		{"one monitor", ScreenshotRequest{RequestID: "r1", Monitor: 1}, "image/png", 320, 200},
+		{"all monitors", ScreenshotRequest{RequestID: "r1", Monitor: -1}, "image/png", 640, 200},
+		{"scaled jpeg", ScreenshotRequest{RequestID: "r1", Monitor: -1, Format: "jpeg", Scale: 0.5}, "image/jpeg", 320, 100},
+		{"rounded scale", ScreenshotRequest{RequestID: "r1", Monitor: 0, Scale: 0.333}, "image/png", 107, 67},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shot, err := CaptureScreenshot(tt.request, synthetic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if shot.ContentType != tt.contentType || shot.Width != tt.width || shot.Height != tt.height {
+				t.Errorf("screenshot = %s %dx%d, want %s %dx%d", shot.ContentType, shot.Width, shot.Height, tt.contentType, tt.width, tt.height)
+			}
+
+			decode := png.Decode
+			if tt.contentType == "image/jpeg" {
+				decode = jpeg.Decode
+			}
+			img, err := decode(bytes.NewReader(shot.Data))
+			if err != nil {
+				t.Fatalf("screenshot does not decode as %s: %v", tt.contentType, err)
+			}
+			if size := img.Bounds().Size(); size != image.Pt(tt.width, tt.height) {
+				t.Errorf("encoded size = %v, want %dx%d", size, tt.width, tt.height)
+			}
+		})
+	}
+
+	if _, err := CaptureScreenshot(ScreenshotRequest{RequestID: "r1", Monitor: 2}, synthetic); err == nil {
+		t.Error("screenshot of a missing monitor succeeded")
+	}
+	if _, err := CaptureScreenshot(ScreenshotRequest{RequestID: "r1", Format: "bmp"}, synthetic); err == nil {
+		t.Error("screenshot in an unsupported format succeeded")
+	}
+}
+
+func TestCaptureScreenshotRedaction(t *testing.T) {
+	synthetic := &SyntheticConfig{Pattern: SyntheticStatic, Width: 320, Height: 200, Monitors: 2}
+	policy := &RedactionPolicy{Style: RedactionSolid, Rules: []RedactionRule{{Monitor: 1, X: 10, Y: 10, Width: 40, Height: 30}}}
+	black := color.RGBA{A: 255}
+
+	capture := func(monitor int) image.Image {
+		t.Helper()
+		shot, err := CaptureScreenshot(ScreenshotRequest{RequestID: "r1", Monitor: monitor, Redaction: policy}, synthetic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(bytes.NewReader(shot.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+	rgba := func(img image.Image, x, y int) color.RGBA {
+		return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+	}
+
+	// The rule is relative to monitor 1, which starts at x=320 of the desktop
+	if got := rgba(capture(1), 20, 20); got != black {
+		t.Errorf("monitor 1 (20,20) = %v, want redacted", got)
+	}
+	if got := rgba(capture(1), 100, 100); got == black {
+		t.Error("monitor 1 (100,100) redacted outside the rule")
+	}
+	if got := rgba(capture(0), 20, 20); got == black {
+		t.Error("monitor 0 redacted by a rule for monitor 1")
+	}
+	all := capture(-1)
+	if got := rgba(all, 340, 20); got != black {
+		t.Errorf("desktop (340,20) = %v, want redacted", got)
+	}
+	if got := rgba(all, 20, 20); got == black {
+		t.Error("desktop (20,20) redacted by a rule for monitor 1")
+	}
+}
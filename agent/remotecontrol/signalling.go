@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -15,6 +17,7 @@ type SignalClient struct {
 	serverURL      string
 	sessionID      string
 	token          string
+	role           string // "agent" or "operator"
 	lastPollTime   int64
 	httpClient     *http.Client
 }
@@ -28,10 +31,17 @@ type SignalMessage struct {
 
 // NewSignalClient creates a new signalling client
 func NewSignalClient(serverURL, sessionID, token string) *SignalClient {
+	return NewSignalClientForRole(serverURL, sessionID, token, "agent")
+}
+
+// NewSignalClientForRole creates a signalling client for the given side of the session.
+// The operator role is used by test viewers that play the browser's part.
+func NewSignalClientForRole(serverURL, sessionID, token, role string) *SignalClient {
 	return &SignalClient{
 		serverURL:    serverURL,
 		sessionID:    sessionID,
 		token:        token,
+		role:         role,
 		lastPollTime: 0,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
@@ -53,7 +63,7 @@ func (sc *SignalClient) SendSignal(signalType string, data interface{}) error {
 		"token":     sc.token,
 		"type":      signalType,
 		"data":      json.RawMessage(dataJSON),
-		"sender":    "agent",
+		"sender":    sc.role,
 	}
 
 	payloadJSON, err := json.Marshal(payload)
@@ -85,8 +95,8 @@ func (sc *SignalClient) SendSignal(signalType string, data interface{}) error {
 
 // PollSignals polls for new signalling messages from the server
 func (sc *SignalClient) PollSignals() ([]SignalMessage, error) {
-	url := fmt.Sprintf("%s/api/rc/signalling?sessionId=%s&token=%s&since=%d&role=agent",
-		sc.serverURL, sc.sessionID, sc.token, sc.lastPollTime)
+	url := fmt.Sprintf("%s/api/rc/signalling?sessionId=%s&token=%s&since=%d&role=%s",
+		sc.serverURL, sc.sessionID, sc.token, sc.lastPollTime, sc.role)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -153,3 +163,59 @@ func (sc *SignalClient) ClearSignals() error {
 	log.Printf("[SignalClient] Cleared signals for session %s", sc.sessionID)
 	return nil
 }
+
+// UploadArtifact attaches a session artifact (e.g. a terminal transcript) to the session record
+func (sc *SignalClient) UploadArtifact(kind, contentType string, body io.Reader) error {
+	url := fmt.Sprintf("%s/api/rc/artifacts?sessionId=%s&token=%s&kind=%s",
+		sc.serverURL, sc.sessionID, sc.token, kind)
+
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := sc.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", kind, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("upload request failed: %s - %s", resp.Status, string(body))
+	}
+
+	log.Printf("[SignalClient] Uploaded %s for session %s", kind, sc.sessionID)
+	return nil
+}
+
+// uploadAgentArtifact attaches an artifact to a session with the agent's own
+// credential, for uploads retried after the session (and its token) ended
+func uploadAgentArtifact(serverURL, credentialKey, sessionID, kind, contentType string, body io.Reader) error {
+	query := url.Values{}
+	query.Set("sessionId", sessionID)
+	query.Set("kind", kind)
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/agent/rc/artifacts?%s", serverURL, query.Encode()), body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", credentialKey))
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", kind, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("upload request failed: %s - %s", resp.Status, string(data))
+	}
+
+	log.Printf("[SignalClient] Uploaded %s for session %s", kind, sessionID)
+	return nil
+}
@@ -0,0 +1,514 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Synthetic test patterns
+const (
+	SyntheticBars    = "bars"    // colour bars with a moving box and sweep line
+	SyntheticChecker = "checker" // scrolling checkerboard
+	SyntheticNoise   = "noise"   // new random pixels every frame (worst case for the encoder)
+	SyntheticStatic  = "static"  // colour bars without motion (idle encoder)
+)
+
+const (
+	// syntheticCounterBits is the width of the frame counter barcode (two rows of 16 blocks)
+	syntheticCounterBits = 32
+
+	// syntheticBlocksPerWidth sizes counter blocks relative to the monitor width so
+	// the barcode survives uniform downscaling (1280px -> 20px blocks)
+	syntheticBlocksPerWidth = 64
+
+	syntheticMinBlock = 4
+)
+
+// SyntheticConfig describes a synthetic capture source that replaces the real display,
+// for testing frame delivery, latency and encoder behaviour without a screen
+type SyntheticConfig struct {
+	Pattern  string // bars (default), checker, noise or static
+	Width    int    // Size of each synthetic monitor (default 1280x720, or the first replay frame)
+	Height   int
+	Monitors int    // Number of side-by-side monitors (default 1)
+	Counter  bool   // Burn the frame counter (barcode and text) into every frame
+	Replay   string // Directory of PNG/JPEG frames replayed in name order instead of a pattern
+}
+
+// normalized fills in defaults and validates the configuration
+func (c SyntheticConfig) normalized() (SyntheticConfig, error) {
+	switch c.Pattern {
+	case "":
+		c.Pattern = SyntheticBars
+	case SyntheticBars, SyntheticChecker, SyntheticNoise, SyntheticStatic:
+	default:
+		return c, fmt.Errorf("unknown synthetic pattern %q", c.Pattern)
+	}
+	if c.Monitors < 1 {
+		c.Monitors = 1
+	}
+	if c.Width < 0 || c.Height < 0 || (c.Width == 0) != (c.Height == 0) {
+		return c, fmt.Errorf("invalid synthetic size %dx%d", c.Width, c.Height)
+	}
+	return c, nil
+}
+
+// ParseSyntheticSize parses a WIDTHxHEIGHT size such as 1280x720
+func ParseSyntheticSize(value string) (int, int, error) {
+	var width, height int
+	if _, err := fmt.Sscanf(strings.ToLower(value), "%dx%d", &width, &height); err != nil {
+		return 0, 0, fmt.Errorf("invalid size %q (expected WIDTHxHEIGHT)", value)
+	}
+	if width < 64 || height < 64 || width > 8192 || height > 8192 {
+		return 0, 0, fmt.Errorf("size %dx%d out of range", width, height)
+	}
+	return width, height, nil
+}
+
+// syntheticMonitors lays the synthetic monitors out left to right
+func syntheticMonitors(config SyntheticConfig) MultiMonitorInfo {
+	layout := MultiMonitorInfo{}
+	for i := 0; i < config.Monitors; i++ {
+		layout.Monitors = append(layout.Monitors, MonitorInfo{
+			Index:   i,
+			Name:    fmt.Sprintf("Synthetic %d", i+1),
+			X:       i * config.Width,
+			Width:   config.Width,
+			Height:  config.Height,
+			Primary: i == 0,
+		})
+	}
+	layout.VirtualWidth = config.Width * config.Monitors
+	layout.VirtualHeight = config.Height
+	return layout
+}
+
+// SyntheticCapturer renders test frames instead of capturing a display
+type SyntheticCapturer struct {
+	config       SyntheticConfig
+	monitorIndex int
+	layout       MultiMonitorInfo
+	area         image.Rectangle // Captured desktop area
+
+	displayInfo DisplayInfo
+	started     time.Time
+	frame       uint32
+	background  *image.RGBA // Pre-rendered bars for the captured area
+	replay      []string
+	face        font.Face
+	faceSize    int
+	noise       uint64
+}
+
+// NewSyntheticCapturer creates a synthetic capturer for one monitor (-1 for the whole virtual desktop)
+func NewSyntheticCapturer(config SyntheticConfig, monitorIndex int) *SyntheticCapturer {
+	return &SyntheticCapturer{config: config, monitorIndex: monitorIndex}
+}
+
+func (sc *SyntheticCapturer) Initialize() error {
+	config, err := sc.config.normalized()
+	if err != nil {
+		return err
+	}
+
+	if config.Replay != "" {
+		if sc.replay, err = listReplayFrames(config.Replay); err != nil {
+			return err
+		}
+		if config.Width == 0 {
+			first, err := loadReplayFrame(sc.replay[0])
+			if err != nil {
+				return err
+			}
+			config.Width, config.Height = first.Bounds().Dx(), first.Bounds().Dy()
+		}
+	}
+	if config.Width == 0 {
+		config.Width, config.Height = 1280, 720
+	}
+	sc.config = config
+
+	sc.layout = syntheticMonitors(config)
+	sc.area = image.Rect(0, 0, sc.layout.VirtualWidth, sc.layout.VirtualHeight)
+	if sc.monitorIndex >= 0 && sc.monitorIndex < len(sc.layout.Monitors) {
+		mon := sc.layout.Monitors[sc.monitorIndex]
+		sc.area = image.Rect(mon.X, mon.Y, mon.X+mon.Width, mon.Y+mon.Height)
+	}
+	sc.displayInfo = DisplayInfo{Width: sc.area.Dx(), Height: sc.area.Dy(), DPI: 96}
+	sc.started = time.Now()
+	sc.noise = uint64(sc.started.UnixNano()) | 1
+
+	source := config.Pattern
+	if len(sc.replay) > 0 {
+		source = fmt.Sprintf("replay of %d frames from %s", len(sc.replay), config.Replay)
+	}
+	log.Printf("[SyntheticCapturer] Initialized %dx%d (%s, monitor %d of %d)",
+		sc.area.Dx(), sc.area.Dy(), source, sc.monitorIndex, config.Monitors)
+	return nil
+}
+
+func (sc *SyntheticCapturer) CaptureFrame() (*image.RGBA, error) {
+	frameNumber := sc.frame
+	sc.frame++
+
+	img := image.NewRGBA(image.Rect(0, 0, sc.area.Dx(), sc.area.Dy()))
+	if len(sc.replay) > 0 {
+		path := sc.replay[int(frameNumber)%len(sc.replay)]
+		frame, err := loadReplayFrame(path)
+		if err != nil {
+			return nil, err
+		}
+		sc.drawReplay(img, frame)
+	} else {
+		sc.drawPattern(img, int(frameNumber))
+	}
+
+	if sc.config.Counter {
+		now := time.Now()
+		for _, mon := range sc.layout.Monitors {
+			rect := image.Rect(mon.X, mon.Y, mon.X+mon.Width, mon.Y+mon.Height)
+			if !rect.Overlaps(sc.area) {
+				continue
+			}
+			sc.drawCounter(img, rect.Sub(sc.area.Min), frameNumber, mon.Index, now)
+		}
+	}
+
+	return img, nil
+}
+
+// CaptureCursor moves the cursor in a circle around the primary monitor's centre
+func (sc *SyntheticCapturer) CaptureCursor() (*CursorState, error) {
+	if len(sc.layout.Monitors) == 0 {
+		return nil, errCursorUnsupported
+	}
+
+	mon := sc.layout.Monitors[0]
+	angle := time.Since(sc.started).Seconds() * math.Pi / 2
+	radius := float64(min(mon.Width, mon.Height)) / 4
+	return &CursorState{
+		X:       mon.X + mon.Width/2 + int(radius*math.Cos(angle)),
+		Y:       mon.Y + mon.Height/2 + int(radius*math.Sin(angle)),
+		Visible: true,
+		Shape:   "default",
+		Serial:  1,
+	}, nil
+}
+
+// SelectWindow is not supported: synthetic frames have no windows
+func (sc *SyntheticCapturer) SelectWindow(target *WindowTarget) (*CapturedWindow, error) {
+	if target == nil {
+		return nil, nil
+	}
+	return nil, errWindowCaptureUnsupported
+}
+
+func (sc *SyntheticCapturer) CapturedWindow() *CapturedWindow {
+	return nil
+}
+
+func (sc *SyntheticCapturer) Close() error {
+	if sc.face != nil {
+		sc.face.Close()
+		sc.face = nil
+	}
+	return nil
+}
+
+func (sc *SyntheticCapturer) GetDisplayInfo() DisplayInfo {
+	return sc.displayInfo
+}
+
+// Monitors returns the synthetic monitor layout
+func (sc *SyntheticCapturer) Monitors() MultiMonitorInfo {
+	return sc.layout
+}
+
+// drawPattern renders the configured pattern in desktop coordinates, so a
+// monitor looks the same in its own track and in the virtual desktop
+func (sc *SyntheticCapturer) drawPattern(img *image.RGBA, frame int) {
+	switch sc.config.Pattern {
+	case SyntheticChecker:
+		sc.drawChecker(img, frame)
+	case SyntheticNoise:
+		sc.drawNoise(img)
+	default:
+		sc.drawBars(img)
+		if sc.config.Pattern == SyntheticBars {
+			sc.drawMotion(img, frame)
+		}
+	}
+}
+
+var syntheticBarColors = []color.RGBA{
+	{235, 235, 235, 255}, {235, 235, 16, 255}, {16, 235, 235, 255}, {16, 235, 16, 255},
+	{235, 16, 235, 255}, {235, 16, 16, 255}, {16, 16, 235, 255}, {16, 16, 16, 255},
+}
+
+func (sc *SyntheticCapturer) drawBars(img *image.RGBA) {
+	if sc.background == nil {
+		sc.background = image.NewRGBA(img.Bounds())
+		for x := 0; x < sc.area.Dx(); x++ {
+			desktopX := sc.area.Min.X + x
+			monitorX := desktopX % sc.config.Width
+			c := syntheticBarColors[monitorX*len(syntheticBarColors)/sc.config.Width]
+			for y := 0; y < sc.area.Dy(); y++ {
+				offset := sc.background.PixOffset(x, y)
+				sc.background.Pix[offset+0] = c.R
+				sc.background.Pix[offset+1] = c.G
+				sc.background.Pix[offset+2] = c.B
+				sc.background.Pix[offset+3] = 255
+			}
+		}
+	}
+	copy(img.Pix, sc.background.Pix)
+}
+
+// drawMotion bounces a box across each monitor and sweeps a vertical line over it
+func (sc *SyntheticCapturer) drawMotion(img *image.RGBA, frame int) {
+	width, height := sc.config.Width, sc.config.Height
+	box := max(height/8, 8)
+
+	travel := max(width-box, 1)
+	position := (frame * 8) % (2 * travel)
+	if position > travel {
+		position = 2*travel - position
+	}
+	sweep := (frame * 4) % width
+
+	for _, mon := range sc.layout.Monitors {
+		origin := image.Pt(mon.X, mon.Y).Sub(sc.area.Min)
+		boxRect := image.Rect(position, height/2-box/2, position+box, height/2+box/2).Add(origin)
+		draw.Draw(img, boxRect, image.NewUniform(color.RGBA{255, 255, 255, 255}), image.Point{}, draw.Src)
+
+		lineRect := image.Rect(sweep, 0, sweep+2, height).Add(origin)
+		draw.Draw(img, lineRect, image.NewUniform(color.RGBA{255, 128, 0, 255}), image.Point{}, draw.Src)
+	}
+}
+
+func (sc *SyntheticCapturer) drawChecker(img *image.RGBA, frame int) {
+	check := max(sc.config.Width/32, 8)
+	offset := frame * 2 % (check * 2)
+
+	for y := 0; y < sc.area.Dy(); y++ {
+		cy := (sc.area.Min.Y + y + offset) / check
+		for x := 0; x < sc.area.Dx(); x++ {
+			cx := (sc.area.Min.X + x + offset) / check
+
+			value := uint8(16)
+			if (cx+cy)%2 == 0 {
+				value = 235
+			}
+			i := img.PixOffset(x, y)
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = value, value, value, 255
+		}
+	}
+}
+
+// drawNoise fills the frame with xorshift noise
+func (sc *SyntheticCapturer) drawNoise(img *image.RGBA) {
+	state := sc.noise
+	for i := 0; i+8 <= len(img.Pix); i += 8 {
+		state ^= state << 13
+		state ^= state >> 7
+		state ^= state << 17
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = uint8(state), uint8(state>>8), uint8(state>>16), 255
+		img.Pix[i+4], img.Pix[i+5], img.Pix[i+6], img.Pix[i+7] = uint8(state>>24), uint8(state>>32), uint8(state>>40), 255
+	}
+	sc.noise = state
+}
+
+// drawReplay centres a recorded frame on each monitor of the captured area
+func (sc *SyntheticCapturer) drawReplay(img *image.RGBA, frame image.Image) {
+	size := frame.Bounds().Size()
+	for _, mon := range sc.layout.Monitors {
+		origin := image.Pt(mon.X, mon.Y).Sub(sc.area.Min)
+		origin = origin.Add(image.Pt((mon.Width-size.X)/2, (mon.Height-size.Y)/2))
+		draw.Draw(img, image.Rectangle{Min: origin, Max: origin.Add(size)}, frame, frame.Bounds().Min, draw.Src)
+	}
+}
+
+// syntheticCounterBlock returns the barcode block size for a monitor width
+func syntheticCounterBlock(monitorWidth int) int {
+	return max(monitorWidth/syntheticBlocksPerWidth, syntheticMinBlock)
+}
+
+// drawCounter burns the frame number into the top-left corner of a monitor:
+// the counter barcode and a text line with the frame number and time
+func (sc *SyntheticCapturer) drawCounter(img *image.RGBA, monitor image.Rectangle, frameNumber uint32, monitorIndex int, now time.Time) {
+	drawCounterBarcode(img, monitor, frameNumber)
+
+	block := syntheticCounterBlock(monitor.Dx())
+	origin := monitor.Min.Add(image.Pt(block, block))
+	white := image.NewUniform(color.RGBA{255, 255, 255, 255})
+	black := image.NewUniform(color.RGBA{0, 0, 0, 255})
+
+	if err := sc.ensureFace(block); err != nil {
+		return
+	}
+	label := fmt.Sprintf("#%06d  monitor %d  %s", frameNumber, monitorIndex+1, now.Format("15:04:05.000"))
+	textOrigin := origin.Add(image.Pt(0, 2*block+block/2))
+	labelWidth := font.MeasureString(sc.face, label).Ceil()
+	metrics := sc.face.Metrics()
+	draw.Draw(img, image.Rect(-block/2, 0, labelWidth+block/2, metrics.Height.Ceil()+block/2).Add(textOrigin), black, image.Point{}, draw.Src)
+
+	drawer := &font.Drawer{Dst: img, Src: white, Face: sc.face}
+	drawer.Dot = fixed.P(textOrigin.X, textOrigin.Y+metrics.Ascent.Ceil())
+	drawer.DrawString(label)
+}
+
+// drawCounterBarcode draws a 32-bit value into the top-left corner of area as two
+// rows of blocks: a white (first row) or black (second row) guard block followed
+// by 16 bits each, most significant first. ReadFrameCounter decodes it.
+func drawCounterBarcode(img *image.RGBA, area image.Rectangle, value uint32) {
+	block := syntheticCounterBlock(area.Dx())
+	origin := area.Min.Add(image.Pt(block, block))
+
+	white := image.NewUniform(color.RGBA{255, 255, 255, 255})
+	black := image.NewUniform(color.RGBA{0, 0, 0, 255})
+
+	// Quiet zone so the barcode reads the same on any background
+	quiet := image.Rect(-block/2, -block/2, 17*block+block/2, 2*block+block/2).Add(origin)
+	draw.Draw(img, quiet, image.NewUniform(color.RGBA{128, 128, 128, 255}), image.Point{}, draw.Src)
+
+	for row := 0; row < 2; row++ {
+		guard := white
+		if row == 1 {
+			guard = black
+		}
+		rect := image.Rect(0, row*block, block, (row+1)*block).Add(origin)
+		draw.Draw(img, rect, guard, image.Point{}, draw.Src)
+
+		for bit := 0; bit < 16; bit++ {
+			fill := black
+			if value>>(syntheticCounterBits-1-(row*16+bit))&1 == 1 {
+				fill = white
+			}
+			rect := image.Rect((bit+1)*block, row*block, (bit+2)*block, (row+1)*block).Add(origin)
+			draw.Draw(img, rect, fill, image.Point{}, draw.Src)
+		}
+	}
+}
+
+// ensureFace loads the monospace font at the size of a counter block
+func (sc *SyntheticCapturer) ensureFace(size int) error {
+	if sc.face != nil && sc.faceSize == size {
+		return nil
+	}
+
+	parsed, err := opentype.Parse(gomono.TTF)
+	if err != nil {
+		return err
+	}
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: float64(size), DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return err
+	}
+
+	if sc.face != nil {
+		sc.face.Close()
+	}
+	sc.face = face
+	sc.faceSize = size
+	return nil
+}
+
+// ReadFrameCounter decodes the counter barcode (a synthetic frame number or a
+// latency frame ID) from the top-left corner of a received frame, or of one
+// monitor cropped out of the virtual desktop. The frame may be scaled, as long
+// as it was scaled uniformly.
+func ReadFrameCounter(img image.Image) (uint32, bool) {
+	bounds := img.Bounds()
+	block := float64(bounds.Dx()) / syntheticBlocksPerWidth
+	if block < syntheticMinBlock {
+		return 0, false
+	}
+
+	sample := func(col, row int) float64 {
+		cx := bounds.Min.X + int(block*(float64(col)+1.5))
+		cy := bounds.Min.Y + int(block*(float64(row)+1.5))
+		radius := max(int(block/4), 1)
+
+		var total float64
+		var count int
+		for y := cy - radius; y <= cy+radius; y++ {
+			for x := cx - radius; x <= cx+radius; x++ {
+				r, g, b, _ := img.At(x, y).RGBA()
+				total += 0.299*float64(r>>8) + 0.587*float64(g>>8) + 0.114*float64(b>>8)
+				count++
+			}
+		}
+		return total / float64(count)
+	}
+
+	white, black := sample(0, 0), sample(0, 1)
+	if white-black < 64 {
+		return 0, false
+	}
+	threshold := (white + black) / 2
+
+	var value uint32
+	for row := 0; row < 2; row++ {
+		for bit := 0; bit < 16; bit++ {
+			value <<= 1
+			if sample(bit+1, row) > threshold {
+				value |= 1
+			}
+		}
+	}
+	return value, true
+}
+
+// listReplayFrames returns the PNG and JPEG files of a directory in name order
+func listReplayFrames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replay directory: %w", err)
+	}
+
+	var frames []string
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".png", ".jpg", ".jpeg":
+			if !entry.IsDir() {
+				frames = append(frames, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no PNG or JPEG frames in %s", dir)
+	}
+
+	sort.Strings(frames)
+	return frames, nil
+}
+
+func loadReplayFrame(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay frame: %w", err)
+	}
+	defer file.Close()
+
+	frame, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode replay frame %s: %w", filepath.Base(path), err)
+	}
+	return frame, nil
+}
@@ -0,0 +1,152 @@
+package remotecontrol
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestSyntheticCapturer(t *testing.T, config SyntheticConfig, monitorIndex int) *SyntheticCapturer {
+	t.Helper()
+	capturer := NewSyntheticCapturer(config, monitorIndex)
+	if err := capturer.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { capturer.Close() })
+	return capturer
+}
+
+func TestFrameCounterSurvivesScaling(t *testing.T) {
+	capturer := newTestSyntheticCapturer(t, SyntheticConfig{Width: 1280, Height: 720, Counter: true}, 0)
+	for want := uint32(0); want < 4; want++ {
+		frame, err := capturer.CaptureFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, size := range []image.Point{{1280, 720}, {960, 540}, {640, 360}, {320, 180}} {
+			scaled := scaleFrame(frame, size.X, size.Y, ScalingAuto)
+			if got, ok := ReadFrameCounter(scaled); !ok || got != want {
+				t.Errorf("frame %d at %v read as %d, %t", want, size, got, ok)
+			}
+		}
+	}
+
+	// Every bit position, e.g. a latency frame ID drawn over a real desktop
+	for _, value := range []uint32{1, 0x80000000, 0xA5C3F00F, 0xFFFFFFFF} {
+		img := image.NewRGBA(image.Rect(0, 0, 1920, 1080))
+		for i := range img.Pix {
+			img.Pix[i] = byte(i * 7)
+		}
+		drawCounterBarcode(img, img.Bounds(), value)
+		for _, size := range []image.Point{{1920, 1080}, {1280, 720}, {400, 225}} {
+			if got, ok := ReadFrameCounter(scaleFrame(img, size.X, size.Y, ScalingAuto)); !ok || got != value {
+				t.Errorf("0x%08x at %v read as 0x%08x, %t", value, size, got, ok)
+			}
+		}
+	}
+
+	// Too small to hold the barcode, or no barcode at all
+	if _, ok := ReadFrameCounter(image.NewRGBA(image.Rect(0, 0, 200, 100))); ok {
+		t.Error("counter read from a frame too small for it")
+	}
+	if _, ok := ReadFrameCounter(image.NewRGBA(image.Rect(0, 0, 1280, 720))); ok {
+		t.Error("counter read from a black frame")
+	}
+}
+
+func TestSyntheticMonitorOffsets(t *testing.T) {
+	config := SyntheticConfig{Pattern: SyntheticStatic, Width: 320, Height: 200, Monitors: 3}
+
+	desktop := newTestSyntheticCapturer(t, config, -1)
+	if info := desktop.GetDisplayInfo(); info.Width != 960 || info.Height != 200 {
+		t.Errorf("desktop is %dx%d, want 960x200", info.Width, info.Height)
+	}
+	for i, mon := range desktop.Monitors().Monitors {
+		if mon.X != i*320 || mon.Y != 0 || mon.Width != 320 || mon.Height != 200 || mon.Primary != (i == 0) {
+			t.Errorf("monitor %d = %+v", i, mon)
+		}
+	}
+	whole, err := desktop.CaptureFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Patterns are drawn in desktop coordinates: a monitor's own frame is its part of the desktop
+	for index := 0; index < 3; index++ {
+		capturer := newTestSyntheticCapturer(t, config, index)
+		if info := capturer.GetDisplayInfo(); info.Width != 320 || info.Height != 200 {
+			t.Errorf("monitor %d is %dx%d, want 320x200", index, info.Width, info.Height)
+		}
+		frame, err := capturer.CaptureFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		part := whole.SubImage(image.Rect(index*320, 0, (index+1)*320, 200)).(*image.RGBA)
+		for y := 0; y < 200; y += 7 {
+			for x := 0; x < 320; x += 7 {
+				if frame.RGBAAt(x, y) != part.RGBAAt(index*320+x, y) {
+					t.Fatalf("monitor %d (%d,%d) = %v, desktop has %v", index, x, y, frame.RGBAAt(x, y), part.RGBAAt(index*320+x, y))
+				}
+			}
+		}
+	}
+
+	// Each monitor of the desktop carries its own counter in its top-left corner
+	config.Counter = true
+	config.Width, config.Height = 640, 360
+	desktop = newTestSyntheticCapturer(t, config, -1)
+	desktop.CaptureFrame()
+	whole, _ = desktop.CaptureFrame()
+	for index := 0; index < 3; index++ {
+		part := whole.SubImage(image.Rect(index*640, 0, (index+1)*640, 360))
+		if got, ok := ReadFrameCounter(part); !ok || got != 1 {
+			t.Errorf("monitor %d of the desktop read as %d, %t; want frame 1", index, got, ok)
+		}
+	}
+}
+
+func TestSyntheticReplayOrder(t *testing.T) {
+	dir := t.TempDir()
+	colors := map[string]color.RGBA{
+		"002.png": {0, 255, 0, 255},
+		"010.png": {0, 0, 255, 255},
+		"001.png": {255, 0, 0, 255},
+	}
+	for name, c := range colors {
+		img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		png.Encode(file, img)
+		file.Close()
+	}
+	// Neither other files nor directories are frames
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a frame"), 0o644)
+	os.Mkdir(filepath.Join(dir, "000.png"), 0o755)
+
+	capturer := newTestSyntheticCapturer(t, SyntheticConfig{Replay: dir}, 0)
+	if info := capturer.GetDisplayInfo(); info.Width != 64 || info.Height != 48 {
+		t.Errorf("replay is %dx%d, want the first frame's 64x48", info.Width, info.Height)
+	}
+	want := []string{"001.png", "002.png", "010.png", "001.png", "002.png"}
+	for i, name := range want {
+		frame, err := capturer.CaptureFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := frame.RGBAAt(32, 24); got != colors[name] {
+			t.Errorf("frame %d = %v, want %s", i, got, name)
+		}
+	}
+
+	if _, err := listReplayFrames(t.TempDir()); err == nil {
+		t.Error("empty replay directory accepted")
+	}
+}
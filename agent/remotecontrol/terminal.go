@@ -0,0 +1,472 @@
+package remotecontrol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// TerminalConfig is the agent-side configuration for operator terminals
+type TerminalConfig struct {
+	User          string // Account the shell runs as (empty = the agent's own account)
+	Shell         string // Shell binary (empty = platform default)
+	TranscriptDir string // Where transcripts are kept until uploaded (empty = system temp dir)
+}
+
+const (
+	terminalDefaultCols = 80
+	terminalDefaultRows = 24
+	terminalMaxSize     = 1000
+	terminalReadBuffer  = 32 << 10
+
+	// terminalMaxPerSession limits concurrently open terminal channels
+	terminalMaxPerSession = 8
+
+	transcriptContentType = "application/x-ndjson"
+
+	// pendingUploadSuffix marks a transcript whose upload failed; it is retried
+	// on later polls until transcriptRetryMaxAge has passed
+	pendingUploadSuffix   = ".upload.json"
+	transcriptRetryMaxAge = 7 * 24 * time.Hour
+)
+
+// terminalProcess is a shell attached to a pseudo-terminal
+type terminalProcess interface {
+	io.ReadWriter
+	Resize(cols, rows int) error
+	Wait() (int, error) // Blocks until the shell exits and returns its exit code
+	Close() error       // Hangs up the terminal and releases the PTY
+}
+
+// terminalMessage is a JSON control message on a terminal channel.
+// Keystrokes arrive as binary messages (or "input" messages), output is sent as binary.
+type terminalMessage struct {
+	Type  string `json:"type"` // resize, input (viewer); ready, exit, error (agent)
+	Cols  int    `json:"cols,omitempty"`
+	Rows  int    `json:"rows,omitempty"`
+	Data  string `json:"data,omitempty"`
+	Shell string `json:"shell,omitempty"`
+	User  string `json:"user,omitempty"`
+	Code  *int   `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// terminalManager owns the terminals and the transcript of one session
+type terminalManager struct {
+	sessionID string
+	config    TerminalConfig
+	pause     pauseGate     // Output is held back and input dropped while paused
+	done      chan struct{} // Closed when the session ends
+
+	mu         sync.Mutex
+	nextID     int
+	terminals  map[int]terminalProcess
+	transcript *terminalTranscript
+	closed     bool
+}
+
+func newTerminalManager(sessionID string, config TerminalConfig) *terminalManager {
+	if config.Shell == "" {
+		config.Shell = defaultTerminalShell()
+	}
+	return &terminalManager{
+		sessionID: sessionID,
+		config:    config,
+		done:      make(chan struct{}),
+		terminals: make(map[int]terminalProcess),
+	}
+}
+
+// SetPaused holds terminal output back and drops keystrokes while the user has paused the session
+func (tm *terminalManager) SetPaused(paused bool) {
+	tm.pause.set(paused)
+}
+
+// HandleChannel spawns a shell for a newly opened terminal data channel
+func (tm *terminalManager) HandleChannel(dc *webrtc.DataChannel) {
+	id, proc, err := tm.open()
+	if err != nil {
+		log.Printf("[Terminal] Failed to start terminal: %v", err)
+		rejectDataChannel(dc, err.Error())
+		return
+	}
+
+	sender := newDataChannelSender(dc)
+
+	dc.OnOpen(func() {
+		log.Printf("[Terminal] Terminal %d open for session %s", id, tm.sessionID)
+
+		if err := sender.SendJSON(terminalMessage{
+			Type:  "ready",
+			Cols:  terminalDefaultCols,
+			Rows:  terminalDefaultRows,
+			Shell: tm.config.Shell,
+			User:  tm.config.User,
+		}); err != nil {
+			log.Printf("[Terminal] Failed to send ready message: %v", err)
+		}
+
+		go tm.pumpOutput(dc, sender, id, proc)
+	})
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if !msg.IsString {
+			tm.writeInput(id, proc, msg.Data)
+			return
+		}
+
+		var control terminalMessage
+		if err := json.Unmarshal(msg.Data, &control); err != nil {
+			log.Printf("[Terminal] Invalid control message: %v", err)
+			return
+		}
+
+		switch control.Type {
+		case "input":
+			tm.writeInput(id, proc, []byte(control.Data))
+		case "resize":
+			if control.Cols <= 0 || control.Rows <= 0 || control.Cols > terminalMaxSize || control.Rows > terminalMaxSize {
+				log.Printf("[Terminal] Ignoring invalid size %dx%d", control.Cols, control.Rows)
+				return
+			}
+			if err := proc.Resize(control.Cols, control.Rows); err != nil {
+				log.Printf("[Terminal] Failed to resize terminal %d: %v", id, err)
+				return
+			}
+			tm.record(transcriptEvent{Terminal: id, Event: "resize", Cols: control.Cols, Rows: control.Rows})
+		default:
+			log.Printf("[Terminal] Unknown control message type: %s", control.Type)
+		}
+	})
+
+	dc.OnClose(func() {
+		log.Printf("[Terminal] Terminal %d channel closed", id)
+		tm.closeTerminal(id)
+	})
+}
+
+// open starts a shell and registers it with the session
+func (tm *terminalManager) open() (int, terminalProcess, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.closed {
+		return 0, nil, fmt.Errorf("session is ending")
+	}
+	if tm.pause.isPaused() {
+		return 0, nil, errPausedByUser
+	}
+	if len(tm.terminals) >= terminalMaxPerSession {
+		return 0, nil, fmt.Errorf("too many open terminals (max %d)", terminalMaxPerSession)
+	}
+
+	if tm.transcript == nil {
+		transcript, err := newTerminalTranscript(tm.config.TranscriptDir, tm.sessionID)
+		if err != nil {
+			// Terminal access is audited; refuse rather than run unrecorded
+			return 0, nil, err
+		}
+		tm.transcript = transcript
+	}
+
+	proc, err := startTerminalProcess(tm.config, terminalDefaultCols, terminalDefaultRows)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	tm.nextID++
+	id := tm.nextID
+	tm.terminals[id] = proc
+	tm.transcript.Record(transcriptEvent{
+		Terminal: id,
+		Event:    "open",
+		Data:     tm.config.User,
+		Cols:     terminalDefaultCols,
+		Rows:     terminalDefaultRows,
+	})
+
+	return id, proc, nil
+}
+
+// writeInput forwards viewer keystrokes to the shell (nothing while paused)
+func (tm *terminalManager) writeInput(id int, proc terminalProcess, data []byte) {
+	if len(data) == 0 || tm.pause.isPaused() {
+		return
+	}
+	tm.record(transcriptEvent{Terminal: id, Event: "input", Data: string(data)})
+	if _, err := proc.Write(data); err != nil {
+		log.Printf("[Terminal] Failed to write to terminal %d: %v", id, err)
+	}
+}
+
+// pumpOutput streams shell output to the viewer until the shell exits
+func (tm *terminalManager) pumpOutput(dc *webrtc.DataChannel, sender *dataChannelSender, id int, proc terminalProcess) {
+	buf := make([]byte, terminalReadBuffer)
+	for {
+		n, err := proc.Read(buf)
+		if n > 0 {
+			tm.record(transcriptEvent{Terminal: id, Event: "output", Data: string(buf[:n])})
+			// Not reading on while paused stalls the shell instead of buffering its output
+			if !tm.pause.wait(tm.done) {
+				break
+			}
+			if sendErr := sender.Send(append([]byte(nil), buf[:n]...)); sendErr != nil {
+				log.Printf("[Terminal] Failed to send output of terminal %d: %v", id, sendErr)
+				break
+			}
+		}
+		if err != nil {
+			// The PTY read fails with EIO once the shell has exited
+			break
+		}
+	}
+
+	code, err := proc.Wait()
+	if err != nil {
+		log.Printf("[Terminal] Terminal %d wait error: %v", id, err)
+	}
+	log.Printf("[Terminal] Terminal %d exited with code %d", id, code)
+
+	tm.record(transcriptEvent{Terminal: id, Event: "exit", Code: &code})
+	if err := sender.SendJSON(terminalMessage{Type: "exit", Code: &code}); err != nil {
+		log.Printf("[Terminal] Failed to send exit message: %v", err)
+	}
+
+	tm.closeTerminal(id)
+	dc.Close()
+}
+
+// closeTerminal hangs up a terminal; safe to call more than once
+func (tm *terminalManager) closeTerminal(id int) {
+	tm.mu.Lock()
+	proc, ok := tm.terminals[id]
+	delete(tm.terminals, id)
+	tm.mu.Unlock()
+
+	if ok {
+		if err := proc.Close(); err != nil {
+			log.Printf("[Terminal] Error closing terminal %d: %v", id, err)
+		}
+	}
+}
+
+// record appends an event to the session transcript
+func (tm *terminalManager) record(event transcriptEvent) {
+	tm.mu.Lock()
+	transcript := tm.transcript
+	tm.mu.Unlock()
+
+	if transcript != nil {
+		transcript.Record(event)
+	}
+}
+
+// Close hangs up all terminals and finalizes the transcript.
+// Returns the transcript path, or "" if no terminal was opened.
+func (tm *terminalManager) Close() string {
+	tm.mu.Lock()
+	if !tm.closed {
+		close(tm.done)
+	}
+	tm.closed = true
+	terminals := tm.terminals
+	tm.terminals = make(map[int]terminalProcess)
+	transcript := tm.transcript
+	tm.mu.Unlock()
+
+	for id, proc := range terminals {
+		if err := proc.Close(); err != nil {
+			log.Printf("[Terminal] Error closing terminal %d: %v", id, err)
+		}
+	}
+
+	if transcript == nil {
+		return ""
+	}
+	if err := transcript.Close(); err != nil {
+		log.Printf("[Terminal] Error closing transcript: %v", err)
+	}
+	return transcript.path
+}
+
+// transcriptEvent is one line of a terminal transcript (newline-delimited JSON)
+type transcriptEvent struct {
+	Time     float64 `json:"t"` // Seconds since the transcript started
+	Terminal int     `json:"terminal"`
+	Event    string  `json:"event"` // open, input, output, resize, exit
+	Data     string  `json:"data,omitempty"`
+	Cols     int     `json:"cols,omitempty"`
+	Rows     int     `json:"rows,omitempty"`
+	Code     *int    `json:"code,omitempty"`
+}
+
+// terminalTranscript records all terminal I/O of a session to a local file
+type terminalTranscript struct {
+	path  string
+	start time.Time
+
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func newTerminalTranscript(dir, sessionID string) (*terminalTranscript, error) {
+	file, err := createTranscriptFile(dir, sessionID+"-terminal.jsonl")
+	if err != nil {
+		return nil, err
+	}
+
+	return &terminalTranscript{
+		path:    file.Name(),
+		start:   time.Now(),
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// createTranscriptFile opens (appending) a session transcript in dir, the system
+// temp dir when empty
+func createTranscriptFile(dir, name string) (*os.File, error) {
+	dir = transcriptDir(dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create transcript directory: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcript: %w", err)
+	}
+	return file, nil
+}
+
+// Record appends one event
+func (t *terminalTranscript) Record(event transcriptEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file == nil {
+		return
+	}
+
+	event.Time = time.Since(t.start).Seconds()
+	if err := t.encoder.Encode(event); err != nil {
+		log.Printf("[Terminal] Failed to write transcript: %v", err)
+	}
+}
+
+// Close flushes and closes the transcript file
+func (t *terminalTranscript) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+// transcriptDir is where transcripts are kept, the system temp dir when unset
+func transcriptDir(dir string) string {
+	if dir == "" {
+		return filepath.Join(os.TempDir(), "deskwise-transcripts")
+	}
+	return dir
+}
+
+// pendingUpload is written next to a transcript whose upload failed, with what is
+// needed to attach it to its session later. The session token is not kept: it
+// stops working when the session ends, and retries use the agent's credential.
+type pendingUpload struct {
+	SessionID string    `json:"sessionId"`
+	Kind      string    `json:"kind"`
+	FailedAt  time.Time `json:"failedAt"`
+}
+
+// uploadTranscript sends a finished transcript (terminal-transcript, chat-transcript)
+// to the server and removes the local copy; a failed upload is kept and queued for
+// retryTranscriptUploads
+func uploadTranscript(client *SignalClient, kind, path string) error {
+	if err := sendTranscript(client, kind, path); err != nil {
+		pending := pendingUpload{SessionID: client.sessionID, Kind: kind, FailedAt: time.Now()}
+		data, _ := json.Marshal(pending)
+		if writeErr := os.WriteFile(path+pendingUploadSuffix, data, 0600); writeErr != nil {
+			log.Printf("[Terminal] Failed to queue transcript upload: %v", writeErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func sendTranscript(client *SignalClient, kind, path string) error {
+	return sendTranscriptWith(path, func(file io.Reader) error {
+		return client.UploadArtifact(kind, transcriptContentType, file)
+	})
+}
+
+// sendTranscriptWith uploads the transcript at path and removes it once the upload succeeded
+func sendTranscriptWith(path string, upload func(io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open transcript: %w", err)
+	}
+
+	err = upload(file)
+	file.Close()
+	if err != nil {
+		// Keep the file so the transcript is not lost
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// retryTranscriptUploads uploads the transcripts queued in dir after a failed
+// upload, authenticated with the agent's credential. Transcripts that still fail
+// after transcriptRetryMaxAge stay on disk but are no longer retried.
+func retryTranscriptUploads(serverURL, credentialKey, dir string) {
+	markers, err := filepath.Glob(filepath.Join(transcriptDir(dir), "*"+pendingUploadSuffix))
+	if err != nil {
+		return
+	}
+
+	for _, marker := range markers {
+		path := strings.TrimSuffix(marker, pendingUploadSuffix)
+		var pending pendingUpload
+		data, err := os.ReadFile(marker)
+		if err == nil {
+			err = json.Unmarshal(data, &pending)
+		}
+		if err != nil {
+			log.Printf("[Terminal] Dropping unreadable upload marker %s: %v", marker, err)
+			os.Remove(marker)
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			os.Remove(marker)
+			continue
+		}
+
+		err = sendTranscriptWith(path, func(file io.Reader) error {
+			return uploadAgentArtifact(serverURL, credentialKey, pending.SessionID, pending.Kind, transcriptContentType, file)
+		})
+		if err != nil {
+			if time.Since(pending.FailedAt) > transcriptRetryMaxAge {
+				log.Printf("[Terminal] Giving up on uploading %s (kept at %s): %v", pending.Kind, path, err)
+				os.Remove(marker)
+			}
+			continue
+		}
+		os.Remove(marker)
+		log.Printf("[Terminal] Uploaded %s of session %s after an earlier failure", pending.Kind, pending.SessionID)
+	}
+}
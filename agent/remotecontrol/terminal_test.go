@@ -0,0 +1,77 @@
+package remotecontrol
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTranscriptUploadRetry(t *testing.T) {
+	var fail atomic.Bool
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		// Retries attach the transcript with the agent's credential, not the session token
+		query := r.URL.Query()
+		if r.URL.Path != "/api/agent/rc/artifacts" || r.Header.Get("Authorization") != "Bearer agent-key" ||
+			query.Get("token") != "" || query.Get("sessionId") != "s-1" || query.Get("kind") != "chat-transcript" {
+			http.Error(w, "wrong session", http.StatusBadRequest)
+			return
+		}
+		if body, _ := io.ReadAll(r.Body); string(body) != "{}\n" {
+			http.Error(w, "wrong body", http.StatusBadRequest)
+			return
+		}
+		uploads.Add(1)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "s-1-chat.jsonl")
+	if err := os.WriteFile(path, []byte("{}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fail.Store(true)
+	if err := uploadTranscript(NewSignalClient(server.URL, "s-1", "secret"), "chat-transcript", path); err == nil {
+		t.Fatal("upload succeeded against a failing server")
+	}
+	marker, err := os.ReadFile(path + pendingUploadSuffix)
+	if err != nil {
+		t.Fatalf("failed upload was not queued: %v", err)
+	}
+	if strings.Contains(string(marker), "secret") {
+		t.Errorf("upload marker keeps the session token: %s", marker)
+	}
+
+	// Still failing: both files stay
+	retryTranscriptUploads(server.URL, "agent-key", dir)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("transcript removed after a failed retry: %v", err)
+	}
+
+	fail.Store(false)
+	retryTranscriptUploads(server.URL, "agent-key", dir)
+	if uploads.Load() != 1 {
+		t.Fatalf("uploads = %d, want 1", uploads.Load())
+	}
+	for _, name := range []string{path, path + pendingUploadSuffix} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after the upload", filepath.Base(name))
+		}
+	}
+
+	// Nothing queued any more
+	retryTranscriptUploads(server.URL, "agent-key", dir)
+	if uploads.Load() != 1 {
+		t.Errorf("uploads = %d after an empty retry, want 1", uploads.Load())
+	}
+}
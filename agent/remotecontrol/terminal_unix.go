@@ -0,0 +1,150 @@
+//go:build !windows
+// +build !windows
+
+package remotecontrol
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/creack/pty"
+)
+
+// terminalPath is the PATH given to shells started for another user
+const terminalPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// isTerminalSupported reports whether operator terminals can be spawned on this platform
+func isTerminalSupported() bool {
+	return true
+}
+
+// defaultTerminalShell picks the login shell used when none is configured
+func defaultTerminalShell() string {
+	for _, shell := range []string{"/bin/bash", "/bin/zsh", "/bin/sh"} {
+		if _, err := os.Stat(shell); err == nil {
+			return shell
+		}
+	}
+	return "/bin/sh"
+}
+
+// ptyProcess is a login shell running on a Unix pseudo-terminal
+type ptyProcess struct {
+	cmd *exec.Cmd
+	pty *os.File
+
+	waitOnce sync.Once
+	exitCode int
+	waitErr  error
+}
+
+// startTerminalProcess spawns the configured shell on a new PTY, switching to config.User when set
+func startTerminalProcess(config TerminalConfig, cols, rows int) (terminalProcess, error) {
+	cmd := exec.Command(config.Shell, "-l")
+
+	if config.User != "" {
+		account, err := user.Lookup(config.User)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up terminal user %s: %w", config.User, err)
+		}
+
+		credential, err := terminalCredential(account)
+		if err != nil {
+			return nil, err
+		}
+
+		// Setsid/Setctty are added by pty.StartWithSize
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: credential}
+		cmd.Dir = "/"
+		if info, err := os.Stat(account.HomeDir); err == nil && info.IsDir() {
+			cmd.Dir = account.HomeDir
+		}
+		cmd.Env = []string{
+			"HOME=" + account.HomeDir,
+			"USER=" + account.Username,
+			"LOGNAME=" + account.Username,
+			"SHELL=" + config.Shell,
+			"PATH=" + terminalPath,
+			"TERM=xterm-256color",
+		}
+	} else {
+		if home, err := os.UserHomeDir(); err == nil {
+			cmd.Dir = home
+		}
+		cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	}
+
+	f, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start shell %s: %w", config.Shell, err)
+	}
+
+	return &ptyProcess{cmd: cmd, pty: f}, nil
+}
+
+// terminalCredential builds the uid/gid (and supplementary groups) for running as account
+func terminalCredential(account *user.User) (*syscall.Credential, error) {
+	uid, err := strconv.ParseUint(account.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid %q for %s: %w", account.Uid, account.Username, err)
+	}
+	gid, err := strconv.ParseUint(account.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid %q for %s: %w", account.Gid, account.Username, err)
+	}
+
+	credential := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	if groupIDs, err := account.GroupIds(); err == nil {
+		for _, id := range groupIDs {
+			if group, err := strconv.ParseUint(id, 10, 32); err == nil {
+				credential.Groups = append(credential.Groups, uint32(group))
+			}
+		}
+	}
+	return credential, nil
+}
+
+func (p *ptyProcess) Read(b []byte) (int, error) {
+	return p.pty.Read(b)
+}
+
+func (p *ptyProcess) Write(b []byte) (int, error) {
+	return p.pty.Write(b)
+}
+
+// Resize updates the PTY window size; the shell receives SIGWINCH
+func (p *ptyProcess) Resize(cols, rows int) error {
+	return pty.Setsize(p.pty, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+}
+
+// Wait reaps the shell and returns its exit code
+func (p *ptyProcess) Wait() (int, error) {
+	p.waitOnce.Do(func() {
+		err := p.cmd.Wait()
+		p.exitCode = p.cmd.ProcessState.ExitCode()
+
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			p.waitErr = err
+		}
+	})
+	return p.exitCode, p.waitErr
+}
+
+// Close hangs up the shell's session and releases the PTY
+func (p *ptyProcess) Close() error {
+	// The shell is a session leader (Setsid), so its pid is also the process group
+	if p.cmd.Process != nil {
+		syscall.Kill(-p.cmd.Process.Pid, syscall.SIGHUP)
+	}
+	err := p.pty.Close()
+
+	go p.Wait()
+	return err
+}
@@ -0,0 +1,22 @@
+//go:build windows
+// +build windows
+
+package remotecontrol
+
+import "fmt"
+
+// isTerminalSupported reports whether operator terminals can be spawned on this platform
+func isTerminalSupported() bool {
+	// ConPTY support is not implemented yet
+	return false
+}
+
+// defaultTerminalShell picks the shell used when none is configured
+func defaultTerminalShell() string {
+	return "cmd.exe"
+}
+
+// startTerminalProcess is not available on Windows
+func startTerminalProcess(config TerminalConfig, cols, rows int) (terminalProcess, error) {
+	return nil, fmt.Errorf("remote terminal is not supported on Windows")
+}
@@ -0,0 +1,72 @@
+package remotecontrol
+
+import (
+	"math"
+	"time"
+)
+
+// frameSink receives the encoded frames of one video stream, whichever transport carries them
+type frameSink interface {
+	// WriteFrame sends a frame stamped with its capture time and returns its duration
+	WriteFrame(frame []byte, captured time.Time) (time.Duration, error)
+	// FrameRate returns the frame rate measured from capture timestamps
+	FrameRate() float64
+}
+
+// messageChannel carries control-channel JSON messages to the operator
+type messageChannel interface {
+	SendText(text string) error
+	Close() error
+}
+
+// Session transports
+const (
+	transportWebRTC = "webrtc"
+	transportRelay  = "relay"
+)
+
+// frameClock turns capture times into strictly increasing frame timestamps and
+// measures the real spacing between frames
+type frameClock struct {
+	origin   time.Time     // Capture time of the first frame
+	last     time.Time     // Capture time of the last frame
+	interval time.Duration // Smoothed spacing between frames
+	frames   uint64
+}
+
+// next records a frame and returns the time to stamp it with and its duration
+// (the delta to the previous frame; 0 for the first)
+func (c *frameClock) next(captured time.Time) (time.Time, time.Duration) {
+	if captured.IsZero() {
+		captured = time.Now()
+	}
+
+	c.frames++
+	if c.frames == 1 {
+		c.origin = captured
+		c.last = captured
+		return captured, 0
+	}
+
+	// Frames are stamped in order; a frame captured no later than the previous
+	// one still needs a distinct timestamp
+	if !captured.After(c.last) {
+		captured = c.last.Add(time.Second / videoClockRate)
+	}
+	duration := captured.Sub(c.last)
+	if c.interval == 0 {
+		c.interval = duration
+	} else {
+		c.interval += (duration - c.interval) / 8
+	}
+	c.last = captured
+	return captured, duration
+}
+
+// frameRate returns the smoothed frame rate (0 before two frames)
+func (c *frameClock) frameRate() float64 {
+	if c.interval <= 0 {
+		return 0
+	}
+	return math.Round(float64(time.Second)/float64(c.interval)*10) / 10
+}
@@ -0,0 +1,89 @@
+package remotecontrol
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFrameClockOrdering(t *testing.T) {
+	var clock frameClock
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	stamp, duration := clock.next(start)
+	if !stamp.Equal(start) || duration != 0 {
+		t.Fatalf("first frame = %v, %v; want its capture time and no duration", stamp, duration)
+	}
+	stamp, duration = clock.next(start.Add(40 * time.Millisecond))
+	if !stamp.Equal(start.Add(40*time.Millisecond)) || duration != 40*time.Millisecond {
+		t.Errorf("second frame = %v, %v; want +40ms", stamp.Sub(start), duration)
+	}
+
+	// A duplicate, then an earlier capture time: both still move forward by one tick
+	tick := time.Second / videoClockRate
+	last := stamp
+	for _, captured := range []time.Time{last, start} {
+		stamp, duration = clock.next(captured)
+		if !stamp.After(last) || duration != tick {
+			t.Errorf("frame captured at %v = %v, %v; want one tick after %v", captured.Sub(start), stamp.Sub(start), duration, last.Sub(start))
+		}
+		last = stamp
+	}
+	if clock.frames != 4 || !clock.origin.Equal(start) {
+		t.Errorf("frames = %d, origin = %v; want 4 frames from the first capture", clock.frames, clock.origin)
+	}
+}
+
+func TestFrameClockRateSmoothing(t *testing.T) {
+	var clock frameClock
+	if rate := clock.frameRate(); rate != 0 {
+		t.Fatalf("rate before any frame = %v, want 0", rate)
+	}
+
+	captured := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock.next(captured)
+	for i := 0; i < 30; i++ {
+		captured = captured.Add(time.Second / 30)
+		clock.next(captured)
+	}
+	if rate := clock.frameRate(); rate != 30 {
+		t.Fatalf("rate at 30 FPS = %v, want 30", rate)
+	}
+
+	// One late frame moves the rate an eighth of the way, not all the way
+	captured = captured.Add(time.Second / 10)
+	clock.next(captured)
+	if rate := clock.frameRate(); rate < 20 || rate >= 30 {
+		t.Errorf("rate after one 100ms gap = %v, want between 20 and 30", rate)
+	}
+
+	// A sustained slower rate is reached
+	for i := 0; i < 100; i++ {
+		captured = captured.Add(time.Second / 10)
+		clock.next(captured)
+	}
+	if rate := clock.frameRate(); rate != 10 {
+		t.Errorf("rate at 10 FPS = %v, want 10", rate)
+	}
+}
+
+func TestVideoClockTicks(t *testing.T) {
+	cases := []struct {
+		elapsed time.Duration
+		want    uint64
+	}{
+		{0, 0},
+		{-time.Second, 0},
+		{40 * time.Millisecond, 3600},
+		{time.Second / 30, 2999}, // Truncated, never rounded up
+		{time.Second, videoClockRate},
+		{1500 * time.Millisecond, 135000},
+		// Past the point where multiplying nanoseconds by the clock rate overflows
+		{60 * time.Hour, 60 * 3600 * videoClockRate},
+		{1000*time.Hour + 100*time.Microsecond, 1000*3600*videoClockRate + 9},
+	}
+	for _, tc := range cases {
+		if got := videoClockTicks(tc.elapsed); got != tc.want {
+			t.Errorf("videoClockTicks(%v) = %d, want %d", tc.elapsed, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	videoClockRate = 90000 // VP8 RTP clock
+	videoRTPMTU    = 1200  // Matches pion's outbound MTU for sample tracks
+)
+
+// videoTrack is a VP8 track whose RTP timestamps follow the capture clock.
+// pion's sample tracks advance the timestamp by a sample's declared duration,
+// which is only known once the next frame exists; stamping every frame with its
+// own capture time gives the viewer's jitter buffer the real frame spacing even
+// when capture slows down or frames are skipped.
+type videoTrack struct {
+	*webrtc.TrackLocalStaticRTP
+
+	mu         sync.Mutex
+	packetizer rtp.Packetizer
+	clock      frameClock
+	ticks      uint64 // RTP clock ticks from the first frame to the last
+}
+
+func newVideoTrack(id, streamID string) (*videoTrack, error) {
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, id, streamID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &videoTrack{
+		TrackLocalStaticRTP: track,
+		// SSRC and payload type are rewritten per binding by the RTP track
+		packetizer: rtp.NewPacketizer(videoRTPMTU, 0, 0, &codecs.VP8Payloader{EnablePictureID: true},
+			rtp.NewRandomSequencer(), videoClockRate),
+	}, nil
+}
+
+// WriteFrame packetizes an encoded frame stamped with its capture time and returns
+// the frame's duration (the real delta to the previous frame)
+func (t *videoTrack) WriteFrame(frame []byte, captured time.Time) (time.Duration, error) {
+	if len(frame) == 0 {
+		return 0, fmt.Errorf("empty frame data")
+	}
+
+	t.mu.Lock()
+	captured, duration := t.clock.next(captured)
+
+	// Derive ticks from the first frame so rounding never accumulates into drift
+	ticks := videoClockTicks(captured.Sub(t.clock.origin))
+	if ticks <= t.ticks && t.clock.frames > 1 {
+		ticks = t.ticks + 1
+	}
+	t.packetizer.SkipSamples(uint32(ticks - t.ticks))
+	packets := t.packetizer.Packetize(frame, 0)
+	t.ticks = ticks
+	t.mu.Unlock()
+
+	for _, packet := range packets {
+		if err := t.WriteRTP(packet); err != nil {
+			return duration, fmt.Errorf("failed to write RTP packet: %w", err)
+		}
+	}
+	return duration, nil
+}
+
+// videoClockTicks converts time since the first frame to RTP clock ticks; whole
+// seconds and the remainder are scaled apart so long sessions cannot overflow
+func videoClockTicks(d time.Duration) uint64 {
+	if d <= 0 {
+		return 0
+	}
+	return uint64(d/time.Second)*videoClockRate + uint64(d%time.Second)*videoClockRate/uint64(time.Second)
+}
+
+// FrameRate returns the frame rate measured from capture timestamps (0 before two frames)
+func (t *videoTrack) FrameRate() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.clock.frameRate()
+}
@@ -0,0 +1,49 @@
+package remotecontrol
+
+import "fmt"
+
+// VirtualDisplayOptions asks for a headless X display (Xvfb or Xvnc with a window
+// manager) for a session, on Linux hosts without a graphical session
+type VirtualDisplayOptions struct {
+	Display    int    `json:"display,omitempty"`    // X display number (0 = first free from 99)
+	Resolution string `json:"resolution,omitempty"` // WIDTHxHEIGHT (default 1920x1080)
+	User       string `json:"user"`                 // Account the display and window manager run as; must be in VirtualDisplayConfig.Users
+}
+
+// VirtualDisplayConfig is the agent's setup for virtual displays. They are off
+// unless enabled locally, and only run as the listed accounts, never as root.
+type VirtualDisplayConfig struct {
+	Enabled       bool     // Start virtual displays sessions ask for
+	Users         []string // Accounts a virtual display may run as
+	Server        string   // X server binary, Xvfb or Xvnc (empty = first one found)
+	WindowManager string   // Window manager command line (empty = first one found)
+}
+
+const (
+	defaultVirtualDisplayResolution = "1920x1080"
+	firstVirtualDisplay             = 99
+	lastVirtualDisplay              = 199
+)
+
+// virtualDisplayServers and virtualDisplayWindowManagers are tried in order when not configured
+var (
+	virtualDisplayServers        = []string{"Xvfb", "Xvnc"}
+	virtualDisplayWindowManagers = []string{"openbox", "fluxbox", "icewm", "xfwm4", "matchbox-window-manager", "twm"}
+)
+
+// checkVirtualDisplayUser refuses a display the agent is not configured to start
+// for the user the server asked for
+func checkVirtualDisplayUser(config VirtualDisplayConfig, username string) error {
+	if !config.Enabled {
+		return fmt.Errorf("virtual displays are not enabled on this agent")
+	}
+	if username == "" {
+		return fmt.Errorf("virtual display needs a user")
+	}
+	for _, allowed := range config.Users {
+		if allowed == username {
+			return nil
+		}
+	}
+	return fmt.Errorf("virtual displays may not run as %s", username)
+}
@@ -0,0 +1,347 @@
+//go:build linux
+// +build linux
+
+package remotecontrol
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	virtualDisplayStartTimeout = 10 * time.Second
+	virtualDisplayStopTimeout  = 5 * time.Second
+
+	// serverLogReadLimit bounds how much of the end of the X server's log is read to explain a failed start
+	serverLogReadLimit = 1 << 20
+)
+
+// virtualDisplay is a running X server and window manager owned by one session
+type virtualDisplay struct {
+	display    X11Display
+	dir        string // Holds the Xauthority file
+	server     *exec.Cmd
+	serverDone chan struct{}
+	wm         *exec.Cmd
+	wmDone     chan struct{}
+	closeOnce  sync.Once
+}
+
+// isVirtualDisplaySupported reports whether virtual displays are enabled for some
+// account and an X server for them is installed
+func isVirtualDisplaySupported(config VirtualDisplayConfig) bool {
+	if !config.Enabled || len(config.Users) == 0 {
+		return false
+	}
+	_, err := virtualDisplayServer(config)
+	return err == nil
+}
+
+// virtualDisplayServer returns the X server binary to run
+func virtualDisplayServer(config VirtualDisplayConfig) (string, error) {
+	candidates := virtualDisplayServers
+	if config.Server != "" {
+		candidates = []string{config.Server}
+	}
+	for _, name := range candidates {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no X server for virtual displays found (tried %s)", strings.Join(candidates, ", "))
+}
+
+// freeDisplayNumber finds a display number with no socket or lock file
+func freeDisplayNumber() (int, error) {
+	for number := firstVirtualDisplay; number <= lastVirtualDisplay; number++ {
+		if !displayInUse(number) {
+			return number, nil
+		}
+	}
+	return 0, fmt.Errorf("no free X display between :%d and :%d", firstVirtualDisplay, lastVirtualDisplay)
+}
+
+func displayInUse(number int) bool {
+	for _, path := range []string{x11SocketPath(number), fmt.Sprintf("/tmp/.X%d-lock", number)} {
+		if _, err := os.Lstat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// startVirtualDisplay starts an X server and window manager as the requested user
+// and waits until the display accepts connections
+func startVirtualDisplay(config VirtualDisplayConfig, options VirtualDisplayOptions) (*virtualDisplay, error) {
+	if err := checkVirtualDisplayUser(config, options.User); err != nil {
+		return nil, err
+	}
+	account, err := user.Lookup(options.User)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up virtual display user %s: %w", options.User, err)
+	}
+	// An allowlisted name could still map to uid 0
+	if account.Uid == "0" {
+		return nil, fmt.Errorf("virtual displays may not run as root")
+	}
+	if options.Resolution == "" {
+		options.Resolution = defaultVirtualDisplayResolution
+	}
+	width, height, err := ParseSyntheticSize(options.Resolution)
+	if err != nil {
+		return nil, fmt.Errorf("invalid virtual display resolution: %w", err)
+	}
+
+	server, err := virtualDisplayServer(config)
+	if err != nil {
+		return nil, err
+	}
+
+	number := options.Display
+	if number == 0 {
+		if number, err = freeDisplayNumber(); err != nil {
+			return nil, err
+		}
+	} else if number < 0 || displayInUse(number) {
+		return nil, fmt.Errorf("X display :%d is not available", number)
+	}
+
+	credential, err := virtualDisplayCredential(account)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cookie file lives in a private directory owned by the user
+	dir, err := os.MkdirTemp("", "deskwise-display-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create display directory: %w", err)
+	}
+	vd := &virtualDisplay{
+		display: X11Display{Display: ":" + strconv.Itoa(number), XAuthority: filepath.Join(dir, "Xauthority")},
+		dir:     dir,
+	}
+	cookie := make([]byte, xauthCookieSize)
+	if _, err := rand.Read(cookie); err != nil {
+		vd.Close()
+		return nil, fmt.Errorf("failed to generate X cookie: %w", err)
+	}
+	if err := writeXAuthority(vd.display.XAuthority, number, cookie); err != nil {
+		vd.Close()
+		return nil, err
+	}
+	if credential != nil {
+		for _, path := range []string{dir, vd.display.XAuthority} {
+			if err := os.Chown(path, int(credential.Uid), int(credential.Gid)); err != nil {
+				vd.Close()
+				return nil, fmt.Errorf("failed to hand display files to %s: %w", account.Username, err)
+			}
+		}
+	}
+
+	var args []string
+	if strings.Contains(filepath.Base(server), "Xvnc") {
+		// Xvnc's own VNC listener is disabled; the session is the only way in
+		args = []string{vd.display.Display, "-geometry", fmt.Sprintf("%dx%d", width, height), "-depth", "24", "-rfbport", "-1"}
+	} else {
+		args = []string{vd.display.Display, "-screen", "0", fmt.Sprintf("%dx%dx24", width, height)}
+	}
+	args = append(args, "-nolisten", "tcp", "-auth", vd.display.XAuthority)
+
+	// The server's output is kept next to the cookie, to explain a failed start
+	serverLog, err := createServerLog(dir)
+	if err != nil {
+		vd.Close()
+		return nil, fmt.Errorf("failed to create X server log: %w", err)
+	}
+	defer serverLog.Close()
+
+	vd.server = exec.Command(server, args...)
+	vd.server.Env = virtualDisplayEnv(account, X11Display{})
+	vd.server.Dir = "/"
+	vd.server.Stdout = serverLog
+	vd.server.Stderr = serverLog
+	vd.server.SysProcAttr = &syscall.SysProcAttr{Credential: credential, Setpgid: true}
+	if err := vd.server.Start(); err != nil {
+		vd.Close()
+		return nil, fmt.Errorf("failed to start %s: %w", server, err)
+	}
+	vd.serverDone = make(chan struct{})
+	go func() {
+		vd.server.Wait()
+		close(vd.serverDone)
+	}()
+
+	if err := vd.waitReady(); err != nil {
+		if output := serverLogTail(serverLog); output != "" {
+			err = fmt.Errorf("%w: %s", err, output)
+		}
+		vd.Close()
+		return nil, err
+	}
+	log.Printf("[VirtualDisplay] %s started on %s (%dx%d) for %s", filepath.Base(server), vd.display.Display, width, height, account.Username)
+
+	// A missing window manager leaves a usable, if bare, display
+	if err := vd.startWindowManager(config, account, credential); err != nil {
+		log.Printf("[VirtualDisplay] Warning: %v", err)
+	}
+	return vd, nil
+}
+
+// waitReady waits until the X server accepts connections with the session cookie
+func (vd *virtualDisplay) waitReady() error {
+	deadline := time.Now().Add(virtualDisplayStartTimeout)
+	for {
+		select {
+		case <-vd.serverDone:
+			return fmt.Errorf("X server on %s exited during startup", vd.display.Display)
+		default:
+		}
+
+		conn, err := dialX11(vd.display)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("X server on %s not ready after %v: %w", vd.display.Display, virtualDisplayStartTimeout, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// startWindowManager runs the configured (or first installed) window manager on the display
+func (vd *virtualDisplay) startWindowManager(config VirtualDisplayConfig, account *user.User, credential *syscall.Credential) error {
+	var command []string
+	if config.WindowManager != "" {
+		command = strings.Fields(config.WindowManager)
+	} else {
+		for _, name := range virtualDisplayWindowManagers {
+			if path, err := exec.LookPath(name); err == nil {
+				command = []string{path}
+				break
+			}
+		}
+	}
+	if len(command) == 0 {
+		return fmt.Errorf("no window manager found (tried %s)", strings.Join(virtualDisplayWindowManagers, ", "))
+	}
+
+	vd.wm = exec.Command(command[0], command[1:]...)
+	vd.wm.Env = virtualDisplayEnv(account, vd.display)
+	vd.wm.Dir = "/"
+	if info, err := os.Stat(account.HomeDir); err == nil && info.IsDir() {
+		vd.wm.Dir = account.HomeDir
+	}
+	// Its own process group, so applications started from it are stopped with it
+	vd.wm.SysProcAttr = &syscall.SysProcAttr{Credential: credential, Setpgid: true}
+	if err := vd.wm.Start(); err != nil {
+		vd.wm = nil
+		return fmt.Errorf("failed to start window manager %s: %w", command[0], err)
+	}
+	vd.wmDone = make(chan struct{})
+	go func() {
+		vd.wm.Wait()
+		close(vd.wmDone)
+	}()
+
+	log.Printf("[VirtualDisplay] Window manager %s started on %s", filepath.Base(command[0]), vd.display.Display)
+	return nil
+}
+
+// Display returns the display and cookie file to capture
+func (vd *virtualDisplay) Display() X11Display {
+	return vd.display
+}
+
+// Close stops the window manager (with everything started from it) and the X
+// server, and removes the cookie file
+func (vd *virtualDisplay) Close() {
+	vd.closeOnce.Do(func() {
+		if vd.wm != nil {
+			stopProcessGroup(vd.wm, vd.wmDone)
+		}
+		if vd.server != nil && vd.serverDone != nil {
+			stopProcessGroup(vd.server, vd.serverDone)
+		}
+		if vd.dir != "" {
+			os.RemoveAll(vd.dir)
+		}
+		log.Printf("[VirtualDisplay] %s torn down", vd.display.Display)
+	})
+}
+
+// stopProcessGroup sends SIGTERM to a process group, then SIGKILL if it outlives the timeout
+func stopProcessGroup(cmd *exec.Cmd, done <-chan struct{}) {
+	pgid := cmd.Process.Pid
+	syscall.Kill(-pgid, syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(virtualDisplayStopTimeout):
+		log.Printf("[VirtualDisplay] %s did not exit, killing it", filepath.Base(cmd.Path))
+		syscall.Kill(-pgid, syscall.SIGKILL)
+		<-done
+	}
+}
+
+// virtualDisplayCredential is the credential processes run with, or nil when the
+// agent already runs as the user
+func virtualDisplayCredential(account *user.User) (*syscall.Credential, error) {
+	if account.Uid == strconv.Itoa(os.Getuid()) {
+		return nil, nil
+	}
+	return terminalCredential(account)
+}
+
+// virtualDisplayEnv is the environment of processes run for the user on display
+func virtualDisplayEnv(account *user.User, display X11Display) []string {
+	env := []string{
+		"HOME=" + account.HomeDir,
+		"USER=" + account.Username,
+		"LOGNAME=" + account.Username,
+		"PATH=" + terminalPath,
+	}
+	if display.Display != "" {
+		env = append(env, "DISPLAY="+display.Display, "XAUTHORITY="+display.XAuthority)
+	}
+	return env
+}
+
+// createServerLog creates the X server's log in the display directory. The directory
+// belongs to the session user, so an existing entry (such as a symlink planted
+// there) is refused rather than followed.
+func createServerLog(dir string) (*os.File, error) {
+	return os.OpenFile(filepath.Join(dir, "server.log"), os.O_RDWR|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, 0o600)
+}
+
+// serverLogTail returns the last lines of the server's log, read through the open
+// file since its name is under the session user's control
+func serverLogTail(serverLog *os.File) string {
+	info, err := serverLog.Stat()
+	if err != nil {
+		return ""
+	}
+	start := max(0, info.Size()-serverLogReadLimit)
+	output, _ := io.ReadAll(io.NewSectionReader(serverLog, start, info.Size()-start))
+	return lastLines(string(bytes.TrimSpace(output)), 5)
+}
+
+// lastLines returns the final n lines of output
+func lastLines(output string, n int) string {
+	lines := strings.Split(output, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
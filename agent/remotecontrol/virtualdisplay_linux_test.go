@@ -0,0 +1,54 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStartVirtualDisplayRefusesRoot(t *testing.T) {
+	config := VirtualDisplayConfig{Enabled: true, Users: []string{"root"}}
+	_, err := startVirtualDisplay(config, VirtualDisplayOptions{User: "root"})
+	if err == nil || !strings.Contains(err.Error(), "root") {
+		t.Fatalf("startVirtualDisplay as root = %v, want refused", err)
+	}
+}
+
+func TestServerLogIsNotFollowed(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(t.TempDir(), "shadow")
+	if err := os.WriteFile(secret, []byte("root:secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A link planted before the server starts is refused, not written through
+	if err := os.Symlink(secret, filepath.Join(dir, "server.log")); err != nil {
+		t.Fatal(err)
+	}
+	if serverLog, err := createServerLog(dir); err == nil {
+		serverLog.Close()
+		t.Fatal("server log created through a symlink")
+	}
+	os.Remove(filepath.Join(dir, "server.log"))
+
+	serverLog, err := createServerLog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverLog.Close()
+	fmt.Fprintf(serverLog, "line 1\nline 2\n(EE) no screens found\n\n")
+
+	// Swapping the file for a link while the server runs does not change what is read back
+	os.Remove(serverLog.Name())
+	if err := os.Symlink(secret, serverLog.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := serverLogTail(serverLog), "line 1\nline 2\n(EE) no screens found"; got != want {
+		t.Errorf("serverLogTail = %q, want %q", got, want)
+	}
+	if content, _ := os.ReadFile(secret); string(content) != "root:secret\n" {
+		t.Errorf("linked file changed to %q", content)
+	}
+}
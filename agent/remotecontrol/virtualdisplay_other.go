@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package remotecontrol
+
+import "fmt"
+
+// virtualDisplay is only available on Linux
+type virtualDisplay struct{}
+
+func isVirtualDisplaySupported(config VirtualDisplayConfig) bool {
+	return false
+}
+
+func startVirtualDisplay(config VirtualDisplayConfig, options VirtualDisplayOptions) (*virtualDisplay, error) {
+	return nil, fmt.Errorf("virtual displays are only supported on Linux")
+}
+
+func (vd *virtualDisplay) Display() X11Display {
+	return X11Display{}
+}
+
+func (vd *virtualDisplay) Close() {}
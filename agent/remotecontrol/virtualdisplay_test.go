@@ -0,0 +1,35 @@
+package remotecontrol
+
+import "testing"
+
+func TestCheckVirtualDisplayUser(t *testing.T) {
+	enabled := VirtualDisplayConfig{Enabled: true, Users: []string{"kiosk", "support"}}
+	cases := []struct {
+		name   string
+		config VirtualDisplayConfig
+		user   string
+		ok     bool
+	}{
+		{"allowed", enabled, "support", true},
+		{"not listed", enabled, "alice", false},
+		{"root not listed", enabled, "root", false},
+		{"no user", enabled, "", false},
+		{"disabled", VirtualDisplayConfig{Users: []string{"kiosk"}}, "kiosk", false},
+		{"no allowlist", VirtualDisplayConfig{Enabled: true}, "kiosk", false},
+	}
+	for _, tc := range cases {
+		err := checkVirtualDisplayUser(tc.config, tc.user)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: checkVirtualDisplayUser(%q) = %v, want ok=%v", tc.name, tc.user, err, tc.ok)
+		}
+	}
+}
+
+func TestVirtualDisplayOffByDefault(t *testing.T) {
+	if isVirtualDisplaySupported(VirtualDisplayConfig{}) {
+		t.Error("virtual displays advertised without being enabled")
+	}
+	if isVirtualDisplaySupported(VirtualDisplayConfig{Enabled: true}) {
+		t.Error("virtual displays advertised without any allowed account")
+	}
+}
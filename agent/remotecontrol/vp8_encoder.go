@@ -177,6 +177,15 @@ func (e *VP8Encoder) rgbaToI420(rgba []byte, img *C.vpx_image_t) {
 	}
 }
 
+// SetBitrate changes the target bitrate (in kbps) of a running encoder
+func (e *VP8Encoder) SetBitrate(bitrate int) error {
+	e.cfg.rc_target_bitrate = C.uint(bitrate)
+	if res := C.vpx_codec_enc_config_set(&e.ctx, &e.cfg); res != C.VPX_CODEC_OK {
+		return fmt.Errorf("failed to update encoder config: %d", res)
+	}
+	return nil
+}
+
 // Close releases encoder resources
 func (e *VP8Encoder) Close() error {
 	if res := C.vpx_codec_destroy(&e.ctx); res != C.VPX_CODEC_OK {
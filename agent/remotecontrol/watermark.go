@@ -0,0 +1,196 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// WatermarkConfig is the session-supplied attribution overlay.
+// Organisations disable it by sending Enabled=false (or no watermark at all).
+type WatermarkConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Operator string `json:"operator,omitempty"`
+	Ticket   string `json:"ticket,omitempty"`
+	Text     string `json:"text,omitempty"`     // Optional extra line, e.g. organisation name
+	Position string `json:"position,omitempty"` // top-left, top-right, bottom-left, bottom-right (default), center
+}
+
+const (
+	// watermarkLinesPerFrame sizes the font relative to the frame height (1080p -> 18px)
+	watermarkLinesPerFrame = 60
+	watermarkMinFontSize   = 10
+	watermarkMargin        = 12
+	watermarkPadding       = 6
+)
+
+// watermarkFont is the TrueType font watermarks are drawn in
+var watermarkFont = goregular.TTF
+
+// Watermark renders operator, ticket and timestamp into outgoing frames
+type Watermark struct {
+	config WatermarkConfig
+	font   *opentype.Font
+
+	mu          sync.Mutex
+	face        font.Face
+	faceHeight  int // Frame height the face was sized for
+	overlay     *image.RGBA
+	overlayText string
+}
+
+// NewWatermark prepares the rasteriser for a watermark configuration
+func NewWatermark(config WatermarkConfig) (*Watermark, error) {
+	parsed, err := opentype.Parse(watermarkFont)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load watermark font: %w", err)
+	}
+
+	return &Watermark{config: config, font: parsed}, nil
+}
+
+// lines builds the watermark text for the given time
+func (w *Watermark) lines(now time.Time) []string {
+	var parts []string
+	if w.config.Operator != "" {
+		parts = append(parts, "Operator: "+w.config.Operator)
+	}
+	if w.config.Ticket != "" {
+		parts = append(parts, "Ticket: "+w.config.Ticket)
+	}
+	parts = append(parts, now.UTC().Format("2006-01-02 15:04:05 UTC"))
+
+	lines := []string{strings.Join(parts, "  |  ")}
+	if w.config.Text != "" {
+		lines = append(lines, w.config.Text)
+	}
+	return lines
+}
+
+// Apply draws the watermark onto frame in place
+func (w *Watermark) Apply(frame *image.RGBA, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	bounds := frame.Bounds()
+	if err := w.ensureFace(bounds.Dy()); err != nil {
+		return
+	}
+
+	// The text only changes once per second, so the rendered overlay is reused between frames
+	lines := w.lines(now)
+	text := strings.Join(lines, "\n")
+	if w.overlay == nil || text != w.overlayText {
+		w.overlay = w.renderOverlay(lines)
+		w.overlayText = text
+	}
+
+	size := w.overlay.Bounds().Size()
+	origin := watermarkOrigin(w.config.Position, bounds, size)
+	draw.Draw(frame, image.Rectangle{Min: origin, Max: origin.Add(size)}, w.overlay, image.Point{}, draw.Over)
+}
+
+// ensureFace (re)creates the font face when the frame height changes
+func (w *Watermark) ensureFace(frameHeight int) error {
+	if w.face != nil && w.faceHeight == frameHeight {
+		return nil
+	}
+
+	size := float64(frameHeight) / watermarkLinesPerFrame
+	if size < watermarkMinFontSize {
+		size = watermarkMinFontSize
+	}
+
+	face, err := opentype.NewFace(w.font, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return err
+	}
+
+	if w.face != nil {
+		w.face.Close()
+	}
+	w.face = face
+	w.faceHeight = frameHeight
+	w.overlay = nil
+	return nil
+}
+
+// renderOverlay rasterises the text lines on a translucent dark box
+func (w *Watermark) renderOverlay(lines []string) *image.RGBA {
+	metrics := w.face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+
+	width := 0
+	for _, line := range lines {
+		if advance := font.MeasureString(w.face, line).Ceil(); advance > width {
+			width = advance
+		}
+	}
+
+	overlay := image.NewRGBA(image.Rect(0, 0, width+2*watermarkPadding, lineHeight*len(lines)+2*watermarkPadding))
+	draw.Draw(overlay, overlay.Bounds(), image.NewUniform(color.RGBA{0, 0, 0, 140}), image.Point{}, draw.Src)
+
+	drawer := &font.Drawer{
+		Dst:  overlay,
+		Src:  image.NewUniform(color.RGBA{255, 255, 255, 230}),
+		Face: w.face,
+	}
+	for i, line := range lines {
+		drawer.Dot = fixed.P(watermarkPadding, watermarkPadding+i*lineHeight+metrics.Ascent.Ceil())
+		drawer.DrawString(line)
+	}
+
+	return overlay
+}
+
+// watermarkOrigin places an overlay of the given size inside bounds
+func watermarkOrigin(position string, bounds image.Rectangle, size image.Point) image.Point {
+	left := bounds.Min.X + watermarkMargin
+	right := bounds.Max.X - watermarkMargin - size.X
+	top := bounds.Min.Y + watermarkMargin
+	bottom := bounds.Max.Y - watermarkMargin - size.Y
+
+	switch position {
+	case "top-left":
+		return image.Pt(left, top)
+	case "top-right":
+		return image.Pt(right, top)
+	case "bottom-left":
+		return image.Pt(left, bottom)
+	case "center":
+		return image.Pt(bounds.Min.X+(bounds.Dx()-size.X)/2, bounds.Min.Y+(bounds.Dy()-size.Y)/2)
+	default:
+		return image.Pt(right, bottom)
+	}
+}
+
+// SetWatermark installs the attribution overlay drawn into every outgoing frame (nil disables it)
+func (wp *WebRTCPeer) SetWatermark(watermark *Watermark) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	wp.watermark = watermark
+}
+
+// applyWatermark draws the session watermark, if any, onto a scaled frame
+func (wp *WebRTCPeer) applyWatermark(frame *image.RGBA) {
+	wp.mu.RLock()
+	watermark := wp.watermark
+	wp.mu.RUnlock()
+
+	if watermark != nil {
+		watermark.Apply(frame, time.Now())
+	}
+}
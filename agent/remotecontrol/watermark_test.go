@@ -0,0 +1,40 @@
+package remotecontrol
+
+import (
+	"runtime"
+	"testing"
+)
+
+// TestRequiredWatermarkUnavailable checks that sessions and VNC logins whose
+// watermark cannot be drawn are refused rather than streamed without it
+func TestRequiredWatermarkUnavailable(t *testing.T) {
+	font := watermarkFont
+	watermarkFont = []byte("not a font")
+	defer func() { watermarkFont = font }()
+
+	config := &WatermarkConfig{Enabled: true, Operator: "alice", Ticket: "T-1"}
+	if _, err := NewWatermark(*config); err == nil {
+		t.Fatal("NewWatermark succeeded without a font")
+	}
+
+	m := NewManager("http://127.0.0.1:1", runtime.GOOS, "test")
+	if err := m.StartSession("s1", "token", "asset", "org", SessionOptions{Watermark: config}); err == nil {
+		t.Fatal("session started without its required watermark")
+	}
+	if session := m.GetActiveSession(); session != nil {
+		t.Errorf("refused session %s was registered", session.SessionID)
+	}
+
+	client := &rfbClient{}
+	if err := client.applyGrant(RFBPassword{Watermark: config}); err == nil {
+		t.Error("VNC login accepted without its required watermark")
+	}
+	if client.watermark != nil {
+		t.Error("client has a watermark")
+	}
+
+	// A disabled watermark needs no font
+	if err := client.applyGrant(RFBPassword{Watermark: &WatermarkConfig{Enabled: false}}); err != nil {
+		t.Errorf("disabled watermark: %v", err)
+	}
+}
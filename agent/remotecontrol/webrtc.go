@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"github.com/pion/webrtc/v4"
-	"github.com/pion/webrtc/v4/pkg/media"
 )
 
 // ICEServer represents a STUN/TURN server configuration
@@ -27,10 +26,28 @@ type WebRTCPeer struct {
 	connected        bool
 	iceServers       []ICEServer
 	peerConnection   *webrtc.PeerConnection
-	videoTrack       *webrtc.TrackLocalStaticSample
-	dataChannel      *webrtc.DataChannel
+	video            frameSink      // Screen stream: the RTP track, or the relay after a fallback
+	control          messageChannel // Control channel: the data channel, or the relay after a fallback
 	signalClient     *SignalClient
 	vp8Encoder       *VP8Encoder
+	encoderMu        sync.Mutex // Serializes encoding with live encoder reconfiguration
+	quality          QualitySettings
+	perMonitorTracks bool            // Publish each monitor as its own video track
+	monitorTracks    []*monitorTrack // Tracks used in per-monitor mode
+	watermark        *Watermark      // Attribution overlay drawn before encoding
+	console          *consoleSession // Text console streamed instead of video (nil = screen)
+	graphical        *graphicalSessions // Graphical sessions the viewer can switch between (nil = not offered)
+	chat             *chatSession       // Chat with the end user (nil = off)
+	paused           bool               // The end user paused the session: placeholder frames, no input
+	accessPIN        *accessPINGuard    // Unattended-access PIN the operator must enter first (nil = none)
+	pinAccepted      bool
+	channelHandlers  map[string]DataChannelHandler // Viewer-opened channels routed by label
+	statsProviders   map[string]func() interface{} // Extra sections reported by GetStats
+	latency          *latencyTracker                 // Per-stage frame timing, ping/pong and frame echoes
+	transport        string                          // "webrtc", or "relay" once StartRelay succeeded
+	streaming        bool                            // Frame and cursor senders are running
+	iceFailed        chan struct{}                   // Closed when ICE fails
+	iceFailedOnce    sync.Once
 	ctx              context.Context
 	cancel           context.CancelFunc
 	mu               sync.RWMutex
@@ -43,6 +60,10 @@ func NewWebRTCPeer(screenCapture *ScreenCapture, inputHandler *InputHandler) *We
 		screenCapture: screenCapture,
 		inputHandler:  inputHandler,
 		connected:     false,
+		quality:       DefaultQualitySettings(),
+		latency:       newLatencyTracker(),
+		transport:     transportWebRTC,
+		iceFailed:     make(chan struct{}),
 		ctx:           ctx,
 		cancel:        cancel,
 	}
@@ -55,6 +76,12 @@ func (wp *WebRTCPeer) Init(iceServers []ICEServer) error {
 
 	wp.iceServers = iceServers
 
+	// Mouse coordinates refer to the encoded video size from the first frame on,
+	// not only once the viewer changes the quality
+	if wp.inputHandler != nil {
+		wp.inputHandler.SetEncodedResolution(wp.quality.Width, wp.quality.Height)
+	}
+
 	// Convert ICEServer to pion format
 	pionICEServers := []webrtc.ICEServer{}
 	for _, server := range iceServers {
@@ -96,6 +123,11 @@ func (wp *WebRTCPeer) Init(iceServers []ICEServer) error {
 	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		log.Printf("[WebRTCPeer] Connection state changed: %s", state.String())
 
+		// After a relay fallback the peer connection no longer decides the session state
+		if wp.Transport() != transportWebRTC {
+			return
+		}
+
 		switch state {
 		case webrtc.PeerConnectionStateConnected:
 			wp.mu.Lock()
@@ -103,8 +135,7 @@ func (wp *WebRTCPeer) Init(iceServers []ICEServer) error {
 			wp.mu.Unlock()
 			log.Println("[WebRTCPeer] Successfully connected!")
 
-			// Start sending screen capture frames
-			go wp.sendScreenCaptureFrames()
+			wp.startStreaming()
 
 		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateDisconnected, webrtc.PeerConnectionStateClosed:
 			wp.mu.Lock()
@@ -117,6 +148,9 @@ func (wp *WebRTCPeer) Init(iceServers []ICEServer) error {
 	// Setup ICE connection state change handler
 	pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
 		log.Printf("[WebRTCPeer] ICE connection state changed: %s", state.String())
+		if state == webrtc.ICEConnectionStateFailed {
+			wp.iceFailedOnce.Do(func() { close(wp.iceFailed) })
+		}
 	})
 
 	// Setup ICE candidate handler
@@ -146,7 +180,18 @@ func (wp *WebRTCPeer) Init(iceServers []ICEServer) error {
 	// Setup data channel handler (for receiving input events from browser)
 	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
 		log.Printf("[WebRTCPeer] Data channel opened: %s", dc.Label())
-		wp.dataChannel = dc
+		if handler, ok := wp.dataChannelHandler(dc.Label()); ok {
+			if !wp.accessGranted() {
+				rejectDataChannel(dc, errAccessPINRequired.Error())
+				return
+			}
+			handler(dc)
+			return
+		}
+
+		wp.mu.Lock()
+		wp.control = dc
+		wp.mu.Unlock()
 
 		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
 			if err := wp.HandleDataChannel(msg.Data); err != nil {
@@ -156,6 +201,18 @@ func (wp *WebRTCPeer) Init(iceServers []ICEServer) error {
 
 		dc.OnOpen(func() {
 			log.Println("[WebRTCPeer] Data channel is open")
+
+			// Tell the viewer which monitors exist (and their tracks in per-monitor mode),
+			// once it has entered the access PIN
+			if !wp.requestAccessPIN() {
+				if err := wp.sendMonitorsMessage(); err != nil {
+					log.Printf("[WebRTCPeer] Failed to send monitors message: %v", err)
+				}
+				wp.sendGraphicalSessions()
+				wp.sendPauseState()
+			}
+
+			go wp.startLatencyPings()
 		})
 
 		dc.OnClose(func() {
@@ -163,17 +220,33 @@ func (wp *WebRTCPeer) Init(iceServers []ICEServer) error {
 		})
 	})
 
+	// Keep capture and input mapping in sync with monitor hotplug
+	wp.screenCapture.SetMonitorsChangedHandler(wp.handleMonitorsChanged)
+	wp.screenCapture.SetWindowChangedHandler(wp.handleWindowChanged)
+
+	// An explicit X display (virtual display or discovered session) is captured as one
+	// screen and can be switched under the session; per-monitor captures would not follow it
+	if wp.perMonitorTracks && (wp.graphical != nil || wp.screenCapture.GetX11Display() != nil) {
+		log.Printf("[WebRTCPeer] Per-monitor tracks are not available on an explicit X display, publishing a single track")
+		wp.perMonitorTracks = false
+	}
+
+	if wp.perMonitorTracks {
+		if err := wp.addMonitorTracks(pc); err != nil {
+			return err
+		}
+
+		log.Printf("[WebRTCPeer] Initialized with %d ICE servers in per-monitor mode", len(iceServers))
+		return nil
+	}
+
 	// Create video track for screen streaming
-	videoTrack, err := webrtc.NewTrackLocalStaticSample(
-		webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8},
-		"video",
-		"screen-capture",
-	)
+	videoTrack, err := newVideoTrack("video", "screen-capture")
 	if err != nil {
 		return fmt.Errorf("failed to create video track: %w", err)
 	}
 
-	wp.videoTrack = videoTrack
+	wp.video = videoTrack
 
 	// Add video track to peer connection
 	_, err = pc.AddTrack(videoTrack)
@@ -181,9 +254,9 @@ func (wp *WebRTCPeer) Init(iceServers []ICEServer) error {
 		return fmt.Errorf("failed to add video track: %w", err)
 	}
 
-	// Initialize VP8 encoder
-	// 1920x1080 @ 30fps, 5000kbps bitrate (Full HD quality)
-	vp8Enc, err := NewVP8Encoder(1920, 1080, 30, 5000)
+	// Initialize VP8 encoder from the current quality settings
+	// (defaults to 1920x1080 @ 30fps, 5000kbps bitrate - Full HD quality)
+	vp8Enc, err := NewVP8Encoder(wp.quality.Width, wp.quality.Height, wp.quality.FPS, wp.quality.Bitrate)
 	if err != nil {
 		return fmt.Errorf("failed to create VP8 encoder: %w", err)
 	}
@@ -198,7 +271,91 @@ func (wp *WebRTCPeer) SetSignalClient(signalClient *SignalClient) {
 	wp.signalClient = signalClient
 }
 
-// CreateOffer creates a WebRTC offer (not used - agent creates answers instead)
+// SetScalingMode selects the filter used to fit captured frames to the encoder size
+func (wp *WebRTCPeer) SetScalingMode(mode ScalingMode) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	wp.quality.ScalingMode = mode
+	log.Printf("[WebRTCPeer] Scaling mode set to %s", mode)
+}
+
+// GetQualitySettings returns the current stream quality settings
+func (wp *WebRTCPeer) GetQualitySettings() QualitySettings {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+	return wp.quality
+}
+
+// ApplyQualitySettings reconfigures capture rate, scaler and encoder of a live stream.
+// The peer connection is not renegotiated: VP8 carries resolution changes in-band,
+// so a new encoder simply starts with a keyframe at the new size.
+func (wp *WebRTCPeer) ApplyQualitySettings(settings QualitySettings) error {
+	wp.encoderMu.Lock()
+	defer wp.encoderMu.Unlock()
+
+	wp.mu.RLock()
+	current := wp.quality
+	encoder := wp.vp8Encoder
+	wp.mu.RUnlock()
+
+	if encoder != nil {
+		if settings.Width != current.Width || settings.Height != current.Height || settings.FPS != current.FPS {
+			// Resolution and timebase changes need a fresh encoder
+			newEncoder, err := NewVP8Encoder(settings.Width, settings.Height, settings.FPS, settings.Bitrate)
+			if err != nil {
+				return fmt.Errorf("failed to recreate VP8 encoder: %w", err)
+			}
+			if err := encoder.Close(); err != nil {
+				log.Printf("[WebRTCPeer] Error closing previous VP8 encoder: %v", err)
+			}
+			encoder = newEncoder
+		} else if settings.Bitrate != current.Bitrate {
+			if err := encoder.SetBitrate(settings.Bitrate); err != nil {
+				return fmt.Errorf("failed to update bitrate: %w", err)
+			}
+		}
+	}
+
+	wp.mu.Lock()
+	wp.quality = settings
+	wp.vp8Encoder = encoder
+	wp.mu.Unlock()
+
+	if wp.screenCapture != nil {
+		wp.screenCapture.SetTargetFPS(settings.FPS)
+	}
+
+	// Mouse coordinates from the viewer are relative to the encoded video size
+	if wp.inputHandler != nil && (settings.Width != current.Width || settings.Height != current.Height) {
+		wp.inputHandler.SetEncodedResolution(settings.Width, settings.Height)
+	}
+
+	log.Printf("[WebRTCPeer] Applied quality settings: preset=%q %dx%d @ %d FPS, %d kbps, scaling=%s, grayscale=%t",
+		settings.Preset, settings.Width, settings.Height, settings.FPS, settings.Bitrate, settings.ScalingMode, settings.Grayscale)
+	return nil
+}
+
+// sendDataChannelMessage sends a JSON message to the operator over the data channel
+func (wp *WebRTCPeer) sendDataChannelMessage(message interface{}) error {
+	wp.mu.RLock()
+	control := wp.control
+	wp.mu.RUnlock()
+
+	if control == nil {
+		return fmt.Errorf("data channel not open")
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data channel message: %w", err)
+	}
+
+	return control.SendText(string(data))
+}
+
+// CreateOffer creates a WebRTC offer (the operator offers first; the agent only
+// offers to renegotiate per-monitor tracks)
 func (wp *WebRTCPeer) CreateOffer() (map[string]interface{}, error) {
 	wp.mu.Lock()
 	defer wp.mu.Unlock()
@@ -364,13 +521,45 @@ func (wp *WebRTCPeer) HandleDataChannel(data []byte) error {
 		return fmt.Errorf("missing message type")
 	}
 
+	// Until the access PIN is accepted only the PIN and pings are answered
+	if !wp.accessGranted() {
+		switch msgType {
+		case "pin":
+			return wp.handleAccessPIN(message)
+		case "ping", "pong":
+			return wp.handleLatencyMessage(msgType, message)
+		default:
+			return fmt.Errorf("%w, ignoring %s message", errAccessPINRequired, msgType)
+		}
+	}
+
 	switch msgType {
+	case "pin":
+		return wp.handleAccessPIN(message)
 	case "mouse":
+		if wp.getConsole() != nil || wp.isPaused() {
+			return nil // A text console has no pointer; nothing is injected while paused
+		}
 		return wp.handleMouseInput(message)
 	case "keyboard":
+		if wp.isPaused() {
+			return nil
+		}
 		return wp.handleKeyboardInput(message)
+	case "console":
+		return wp.handleConsoleMessage(message)
 	case "monitor":
 		return wp.handleMonitorChange(message)
+	case "windows":
+		return wp.handleWindowsRequest()
+	case "quality":
+		return wp.handleQualityChange(message)
+	case "chat":
+		return wp.handleChatMessage(message)
+	case "graphical-sessions", "graphical-session":
+		return wp.handleGraphicalSessionMessage(msgType, message)
+	case "ping", "pong", "latency", "frame-rendered":
+		return wp.handleLatencyMessage(msgType, message)
 	default:
 		return fmt.Errorf("unknown message type: %s", msgType)
 	}
@@ -430,35 +619,92 @@ func (wp *WebRTCPeer) handleKeyboardInput(message map[string]interface{}) error
 	}
 	log.Printf("[WebRTC] Keyboard key '%s' %s", key, action)
 
+	// Console sessions type into the TTY instead of injecting key events
+	if console := wp.getConsole(); console != nil {
+		return console.HandleKey(key, down)
+	}
+
 	return wp.inputHandler.HandleKeyboardEvent(KeyboardEvent{
 		Key:  key,
 		Down: down,
 	})
 }
 
+// handleConsoleMessage answers a viewer's request for a full console frame
+func (wp *WebRTCPeer) handleConsoleMessage(message map[string]interface{}) error {
+	console := wp.getConsole()
+	if console == nil {
+		return fmt.Errorf("session is not in console capture mode")
+	}
+	if refresh, _ := message["refresh"].(bool); refresh {
+		console.Refresh()
+	}
+	return nil
+}
+
 // handleMonitorChange processes monitor selection changes
 func (wp *WebRTCPeer) handleMonitorChange(message map[string]interface{}) error {
+	if selection, ok := message["window"].(map[string]interface{}); ok {
+		return wp.handleWindowSelection(selection)
+	}
+
 	monitorIndex, ok := message["monitorIndex"].(float64)
 	if !ok {
 		return fmt.Errorf("missing or invalid monitorIndex")
 	}
 
 	index := int(monitorIndex)
+	monitors := wp.screenCapture.GetMonitors()
+	if index < -1 || index >= len(monitors.Monitors) {
+		return fmt.Errorf("monitor %d does not exist (%d monitors)", index, len(monitors.Monitors))
+	}
 	log.Printf("[WebRTC] Changing monitor selection to: %d", index)
 
-	// Update screen capture monitor selection
+	// Update screen capture monitor selection (this also ends window sharing)
+	windowShared := wp.screenCapture.GetWindow() != nil
 	wp.screenCapture.SetMonitor(index)
 
 	// Update input handler monitor info
-	monitors := wp.screenCapture.GetMonitors()
+	if windowShared {
+		wp.inputHandler.SetWindow(nil)
+	}
 	if err := wp.inputHandler.SetMonitorInfo(index, monitors); err != nil {
 		return fmt.Errorf("failed to update input handler monitor info: %w", err)
 	}
+	if windowShared {
+		if err := wp.sendMonitorsMessage(); err != nil {
+			log.Printf("[WebRTCPeer] Failed to send monitors message: %v", err)
+		}
+	}
 
 	log.Printf("[WebRTC] Successfully changed to monitor %d", index)
 	return nil
 }
 
+// handleQualityChange processes stream quality changes (preset and/or explicit overrides)
+func (wp *WebRTCPeer) handleQualityChange(message map[string]interface{}) error {
+	settings, err := applyQualityMessage(wp.GetQualitySettings(), message)
+	if err != nil {
+		if sendErr := wp.sendDataChannelMessage(map[string]interface{}{
+			"type":  "quality",
+			"error": err.Error(),
+		}); sendErr != nil {
+			log.Printf("[WebRTCPeer] Failed to report invalid quality settings to the viewer: %v", sendErr)
+		}
+		return fmt.Errorf("invalid quality settings: %w", err)
+	}
+
+	if err := wp.ApplyQualitySettings(settings); err != nil {
+		return err
+	}
+
+	// Confirm the settings actually in effect so the viewer can update its controls
+	return wp.sendDataChannelMessage(map[string]interface{}{
+		"type":     "quality",
+		"settings": settings,
+	})
+}
+
 // sendScreenCaptureFrames sends real screen capture frames
 func (wp *WebRTCPeer) sendScreenCaptureFrames() {
 	log.Println("[WebRTCPeer] Starting screen capture frame sender")
@@ -478,131 +724,110 @@ func (wp *WebRTCPeer) sendScreenCaptureFrames() {
 				return
 			}
 
-			if !wp.IsConnected() {
+			// Frames captured before a pause (or resume) took effect are dropped
+			if !wp.IsConnected() || capturedFrame.Paused != wp.isPaused() {
 				continue
 			}
 
-			// Downscale captured frame to 1920x1080 for encoding (Full HD quality)
-			scaledFrame := wp.downscaleFrame(capturedFrame, 1920, 1080)
+			timing := wp.latency.beginFrame(capturedFrame)
+			quality := wp.GetQualitySettings()
+
+			// Downscale captured frame to the encoder resolution (1920x1080 by default)
+			scaledFrame := wp.downscaleFrame(capturedFrame.Image, quality.Width, quality.Height)
+			scaledFrame = wp.drawableFrame(scaledFrame, capturedFrame.Image, quality)
+
+			// Attribution overlay goes into the pixels so recordings stay attributable
+			wp.applyWatermark(scaledFrame)
+
+			if quality.Grayscale {
+				convertToGrayscale(scaledFrame)
+			}
+
+			wp.latency.embedFrameID(scaledFrame, timing)
+			timing.processed = time.Now()
 
 			// Convert to raw RGBA bytes
 			rgbaData := scaledFrame.Pix
 
-			// Encode with VP8
+			// Encode with VP8 (the encoder may be swapped by a quality change)
+			wp.encoderMu.Lock()
+			if wp.vp8Encoder == nil {
+				wp.encoderMu.Unlock()
+				return
+			}
 			encoded, err := wp.vp8Encoder.Encode(rgbaData, frameCount)
+			wp.encoderMu.Unlock()
 			if err != nil {
 				log.Printf("[WebRTCPeer] Failed to encode frame: %v", err)
 				continue
 			}
 
 			frameCount++
+			timing.encoded = time.Now()
 
 			// Send encoded frame
-			if err := wp.SendFrame(encoded); err != nil {
+			if err := wp.SendFrame(encoded, capturedFrame.Started); err != nil {
 				log.Printf("[WebRTCPeer] Failed to send frame: %v", err)
+				continue
 			}
+			timing.sent = time.Now()
+			wp.latency.finishFrame(timing)
 		}
 	}
 }
 
-// downscaleFrame downscales an image to the target width and height using optimized nearest neighbor
-func (wp *WebRTCPeer) downscaleFrame(src *image.RGBA, targetWidth, targetHeight int) *image.RGBA {
-	srcBounds := src.Bounds()
-	srcWidth := srcBounds.Dx()
-	srcHeight := srcBounds.Dy()
-
-	// If already at target size, return as-is (zero-copy optimization)
-	if srcWidth == targetWidth && srcHeight == targetHeight {
-		return src
-	}
-
-	dst := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
-
-	// Optimized nearest neighbor scaling with integer math
-	xRatio := (srcWidth << 16) / targetWidth
-	yRatio := (srcHeight << 16) / targetHeight
-
-	for y := 0; y < targetHeight; y++ {
-		srcY := (y * yRatio) >> 16
-		srcRowOffset := srcY * src.Stride
-		dstRowOffset := y * dst.Stride
-
-		for x := 0; x < targetWidth; x++ {
-			srcX := (x * xRatio) >> 16
-			srcOffset := srcRowOffset + srcX*4
-			dstOffset := dstRowOffset + x*4
-
-			// Copy 4 bytes (RGBA) at once
-			dst.Pix[dstOffset] = src.Pix[srcOffset]
-			dst.Pix[dstOffset+1] = src.Pix[srcOffset+1]
-			dst.Pix[dstOffset+2] = src.Pix[srcOffset+2]
-			dst.Pix[dstOffset+3] = src.Pix[srcOffset+3]
+// startStreaming starts the frame and cursor senders once the operator is reachable
+func (wp *WebRTCPeer) startStreaming() {
+	wp.mu.Lock()
+	if wp.streaming {
+		wp.mu.Unlock()
+		return
+	}
+	if wp.accessPIN != nil && !wp.pinAccepted {
+		wp.mu.Unlock()
+		log.Println("[WebRTCPeer] Waiting for the access PIN before streaming")
+		return
+	}
+	wp.streaming = true
+	monitorTracks := append([]*monitorTrack(nil), wp.monitorTracks...)
+	console := wp.console
+	wp.mu.Unlock()
+
+	// Console sessions send text grids over the control channel instead of video
+	// (nothing is read while paused; the full screen is sent again on resume)
+	if console != nil {
+		go console.stream(wp.ctx, func() bool { return wp.IsConnected() && !wp.isPaused() }, wp.sendDataChannelMessage)
+		return
+	}
+
+	// Start sending screen capture frames
+	if len(monitorTracks) > 0 {
+		for _, mt := range monitorTracks {
+			go wp.sendMonitorTrackFrames(mt)
 		}
+	} else {
+		go wp.sendScreenCaptureFrames()
 	}
 
-	return dst
+	// Stream the cursor separately so the viewer can draw it without waiting for frames
+	go wp.sendCursorUpdates()
 }
 
-// generateTestPattern creates a VP8 encoded test pattern frame
-func (wp *WebRTCPeer) generateTestPattern(frameCount int) []byte {
-	width := 320
-	height := 240
-
-	// Create RGBA image
-	rgbaData := make([]byte, width*height*4)
-
-	// Create animated checkerboard pattern
-	checkSize := 40
-	offset := (frameCount / 10) % (checkSize * 2)
-
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			cx := (x + offset) / checkSize
-			cy := (y + offset) / checkSize
-
-			idx := (y*width + x) * 4
-			if (cx+cy)%2 == 0 {
-				// White
-				rgbaData[idx] = 255
-				rgbaData[idx+1] = 255
-				rgbaData[idx+2] = 255
-				rgbaData[idx+3] = 255
-			} else {
-				// Black
-				rgbaData[idx] = 0
-				rgbaData[idx+1] = 0
-				rgbaData[idx+2] = 0
-				rgbaData[idx+3] = 255
-			}
-		}
-	}
-
-	// Encode with VP8
-	encoded, err := wp.vp8Encoder.Encode(rgbaData, frameCount)
-	if err != nil {
-		log.Printf("[WebRTCPeer] Failed to encode frame: %v", err)
-		return nil
-	}
-
-	if len(encoded) == 0 {
-		log.Printf("[WebRTCPeer] Warning: Encoder returned empty frame")
-		return nil
-	}
-
-	// Log first frame successfully encoded
-	if frameCount == 0 {
-		log.Printf("[WebRTCPeer] Successfully encoded first frame: %d bytes", len(encoded))
-	}
+// downscaleFrame scales an image to the target width and height using the session's scaling mode
+func (wp *WebRTCPeer) downscaleFrame(src *image.RGBA, targetWidth, targetHeight int) *image.RGBA {
+	wp.mu.RLock()
+	mode := wp.quality.ScalingMode
+	wp.mu.RUnlock()
 
-	return encoded
+	return scaleFrame(src, targetWidth, targetHeight, mode)
 }
 
 var frameSendCounter uint64 = 0
 
-// SendFrame sends a video frame to the remote peer
-func (wp *WebRTCPeer) SendFrame(frame []byte) error {
+// SendFrame sends a video frame to the remote peer, timestamped with its capture time
+func (wp *WebRTCPeer) SendFrame(frame []byte, captured time.Time) error {
 	wp.mu.RLock()
-	videoTrack := wp.videoTrack
+	video := wp.video
 	connected := wp.connected
 	wp.mu.RUnlock()
 
@@ -610,7 +835,7 @@ func (wp *WebRTCPeer) SendFrame(frame []byte) error {
 		return fmt.Errorf("peer not connected")
 	}
 
-	if videoTrack == nil {
+	if video == nil {
 		return fmt.Errorf("video track not initialized")
 	}
 
@@ -618,19 +843,17 @@ func (wp *WebRTCPeer) SendFrame(frame []byte) error {
 		return fmt.Errorf("empty frame data")
 	}
 
-	// Send frame via video track
-	if err := videoTrack.WriteSample(media.Sample{
-		Data:     frame,
-		Duration: time.Second / 30, // 30 FPS
-	}); err != nil {
-		log.Printf("[WebRTCPeer] WriteSample error: %v", err)
-		return fmt.Errorf("failed to write sample: %w", err)
+	// Send frame via video track; its duration is the real delta to the previous frame
+	duration, err := video.WriteFrame(frame, captured)
+	if err != nil {
+		log.Printf("[WebRTCPeer] WriteFrame error: %v", err)
+		return fmt.Errorf("failed to write frame: %w", err)
 	}
 
 	// Log every 30 frames (once per second at 30fps)
 	frameSendCounter++
 	if frameSendCounter%30 == 1 {
-		log.Printf("[WebRTCPeer] Sent frame #%d (%d bytes)", frameSendCounter, len(frame))
+		log.Printf("[WebRTCPeer] Sent frame #%d (%d bytes, %v since previous)", frameSendCounter, len(frame), duration.Round(time.Millisecond))
 	}
 
 	return nil
@@ -638,14 +861,18 @@ func (wp *WebRTCPeer) SendFrame(frame []byte) error {
 
 // Close closes the WebRTC peer connection
 func (wp *WebRTCPeer) Close() error {
+	// Lock order matches ApplyQualitySettings: encoder first, then peer state
+	wp.encoderMu.Lock()
+	defer wp.encoderMu.Unlock()
+
 	wp.mu.Lock()
 	defer wp.mu.Unlock()
 
 	wp.connected = false
 	wp.cancel() // Stop test pattern sender
 
-	if wp.dataChannel != nil {
-		if err := wp.dataChannel.Close(); err != nil {
+	if wp.control != nil {
+		if err := wp.control.Close(); err != nil {
 			log.Printf("[WebRTCPeer] Error closing data channel: %v", err)
 		}
 	}
@@ -654,6 +881,7 @@ func (wp *WebRTCPeer) Close() error {
 		if err := wp.vp8Encoder.Close(); err != nil {
 			log.Printf("[WebRTCPeer] Error closing VP8 encoder: %v", err)
 		}
+		wp.vp8Encoder = nil
 	}
 
 	if wp.peerConnection != nil {
@@ -686,11 +914,32 @@ func (wp *WebRTCPeer) GetStats() map[string]interface{} {
 	}
 
 	// TODO: Get actual stats from peerConnection.GetStats()
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"connected":   wp.connected,
-		"fps":         30,
-		"latency":     50,
+		"fps":         wp.quality.FPS,
+		"latency":     wp.latency.estimate(), // ms, glass-to-glass when the viewer echoes frames
 		"packetsLost": 0,
-		"bandwidth":   5000000, // 5 Mbps
+		"bandwidth":   wp.quality.Bitrate * 1000, // target bitrate in bps
+		"quality":     wp.quality,
+	}
+	stats["latencyStages"] = wp.latency.Snapshot()
+	stats["transport"] = wp.transport
+	if wp.video != nil {
+		stats["actualFps"] = wp.video.FrameRate() // Measured from capture timestamps
+	}
+	for name, provider := range wp.statsProviders {
+		stats[name] = provider()
+	}
+	return stats
+}
+
+// RegisterStatsProvider adds a named section to GetStats (e.g. port forwarding accounting)
+func (wp *WebRTCPeer) RegisterStatsProvider(name string, provider func() interface{}) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	if wp.statsProviders == nil {
+		wp.statsProviders = make(map[string]func() interface{})
 	}
+	wp.statsProviders[name] = provider
 }
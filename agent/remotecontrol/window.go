@@ -0,0 +1,317 @@
+package remotecontrol
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// Application sharing.
+//
+// Instead of a monitor the viewer can ask for a single top-level window (X11 only):
+//
+//	{"type":"monitor","window":{"id":4194311}}
+//	{"type":"monitor","window":{"title":"LibreOffice Calc"}}
+//	{"type":"monitor","window":{"class":"firefox"}}
+//
+// A monitorIndex goes back to a monitor, and {"type":"windows"} lists the windows
+// that can be shared. Frames then show only that window and follow it as it moves;
+// parts covered by other windows are blacked out, and a placeholder is sent while
+// it is minimised. Mouse input is accepted only on the visible part of the window
+// and keys only while it has the input focus when they are injected; Alt and Super,
+// which open window manager shortcuts, are dropped. The monitors message reports the shared
+// window (with its current geometry) whenever it changes.
+
+// windowHiddenText is drawn on frames while the shared window is not on screen
+const windowHiddenText = "Shared window is not visible"
+
+// errWindowCaptureUnsupported is returned by capturers that cannot share a single window
+var errWindowCaptureUnsupported = errors.New("window capture is only supported on X11")
+
+// errInputOutsideWindow is returned for input that would reach something other than the shared window
+var errInputOutsideWindow = errors.New("input outside the shared window was rejected")
+
+// WindowTarget selects the top-level window to share
+type WindowTarget struct {
+	ID    uint32 `json:"id,omitempty"`    // X11 window ID
+	Title string `json:"title,omitempty"` // Case-insensitive substring of the window title
+	Class string `json:"class,omitempty"` // Case-insensitive WM_CLASS instance or class name
+}
+
+func (t WindowTarget) String() string {
+	var parts []string
+	if t.ID != 0 {
+		parts = append(parts, fmt.Sprintf("id 0x%x", t.ID))
+	}
+	if t.Title != "" {
+		parts = append(parts, fmt.Sprintf("title %q", t.Title))
+	}
+	if t.Class != "" {
+		parts = append(parts, fmt.Sprintf("class %q", t.Class))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CapturedWindow is the shared window as of the last captured frame
+type CapturedWindow struct {
+	ID      uint32   `json:"id"`
+	Title   string   `json:"title"`
+	Class   []string `json:"class,omitempty"`
+	X       int      `json:"x"` // Position and size on the desktop
+	Y       int      `json:"y"`
+	Width   int      `json:"width"`
+	Height  int      `json:"height"`
+	Visible bool     `json:"visible"` // On screen (not minimised or closed)
+	Focused bool     `json:"focused"` // Has the keyboard focus
+
+	obscured []image.Rectangle // Parts covered by windows stacked above, in desktop coordinates
+}
+
+func (w CapturedWindow) bounds() image.Rectangle {
+	return image.Rect(w.X, w.Y, w.X+w.Width, w.Y+w.Height)
+}
+
+// accepts reports whether a desktop point lies on the visible part of the window
+func (w CapturedWindow) accepts(p image.Point) bool {
+	if !w.Visible || !p.In(w.bounds()) {
+		return false
+	}
+	for _, rect := range w.obscured {
+		if p.In(rect) {
+			return false
+		}
+	}
+	return true
+}
+
+// findTargetWindow returns the index of the topmost window matching target in a
+// bottom-to-top stacking list
+func findTargetWindow(windows []redactionWindow, target WindowTarget) (int, error) {
+	if target.ID == 0 && target.Title == "" && target.Class == "" {
+		return -1, fmt.Errorf("a window id, title or class is required")
+	}
+	rule := RedactionRule{WindowTitle: target.Title, WindowClass: target.Class}
+	for i := len(windows) - 1; i >= 0; i-- {
+		window := windows[i]
+		if target.ID != 0 && window.ID != target.ID {
+			continue
+		}
+		if windowMatchesRule(window, rule) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("no window matches %s", target)
+}
+
+// newCapturedWindow describes a viewable window
+func newCapturedWindow(window redactionWindow) CapturedWindow {
+	return CapturedWindow{
+		ID:      window.ID,
+		Title:   window.Title,
+		Class:   window.Class,
+		X:       window.Bounds.Min.X,
+		Y:       window.Bounds.Min.Y,
+		Width:   window.Bounds.Dx(),
+		Height:  window.Bounds.Dy(),
+		Visible: true,
+	}
+}
+
+// capturedWindowAt describes windows[index] of a bottom-to-top stacking list, with
+// the parts windows above it cover
+func capturedWindowAt(windows []redactionWindow, index int) CapturedWindow {
+	window := windows[index]
+	captured := newCapturedWindow(window)
+	for _, above := range windows[index+1:] {
+		if covered := above.Bounds.Intersect(window.Bounds); !covered.Empty() {
+			captured.obscured = append(captured.obscured, covered)
+		}
+	}
+	return captured
+}
+
+// windowsMessage lists the windows the viewer can share
+type windowsMessage struct {
+	Type    string           `json:"type"`
+	Windows []CapturedWindow `json:"windows"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// SetWindowChangedHandler registers a callback for when the shared window moves,
+// changes focus or visibility, or sharing ends (nil window)
+func (sc *ScreenCapture) SetWindowChangedHandler(handler func(window *CapturedWindow)) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.onWindowChanged = handler
+}
+
+// SetWindow captures a single top-level window instead of the monitor (nil goes back
+// to the monitor); the current capture is kept when the window cannot be shared
+func (sc *ScreenCapture) SetWindow(target *WindowTarget) (*CapturedWindow, error) {
+	sc.captureMu.Lock()
+	sc.mu.Lock()
+	if !sc.running {
+		sc.mu.Unlock()
+		sc.captureMu.Unlock()
+		return nil, fmt.Errorf("screen capture not running")
+	}
+
+	capturer := sc.newCapturerLocked()
+	if err := capturer.Initialize(); err != nil {
+		sc.mu.Unlock()
+		sc.captureMu.Unlock()
+		return nil, fmt.Errorf("failed to initialize capturer: %w", err)
+	}
+	window, err := capturer.SelectWindow(target)
+	if err != nil {
+		capturer.Close()
+		sc.mu.Unlock()
+		sc.captureMu.Unlock()
+		return nil, err
+	}
+	if sc.capturer != nil {
+		if err := sc.capturer.Close(); err != nil {
+			log.Printf("[ScreenCapture] Error closing capturer: %v", err)
+		}
+	}
+	sc.capturer = capturer
+	sc.window = window
+	handler := sc.onWindowChanged
+	sc.mu.Unlock()
+	sc.captureMu.Unlock()
+
+	if window != nil {
+		log.Printf("[ScreenCapture] Sharing window 0x%x %q (%dx%d at %d,%d)",
+			window.ID, window.Title, window.Width, window.Height, window.X, window.Y)
+	} else {
+		log.Printf("[ScreenCapture] Stopped sharing a single window")
+	}
+	if handler != nil {
+		handler(window)
+	}
+	return window, nil
+}
+
+// GetWindow returns the shared window (nil when a monitor is captured)
+func (sc *ScreenCapture) GetWindow() *CapturedWindow {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	if sc.window == nil {
+		return nil
+	}
+	window := *sc.window
+	return &window
+}
+
+// clearWindowLocked ends window sharing when the capturer is replaced for another
+// monitor or display; it returns whether a window was shared. sc.mu must be held
+func (sc *ScreenCapture) clearWindowLocked() bool {
+	shared := sc.window != nil
+	sc.window = nil
+	return shared
+}
+
+// updateWindow records the shared window's state after a frame; it returns the call
+// that reports a change (nil = unchanged), made once sc.captureMu is released
+func (sc *ScreenCapture) updateWindow(capturer PlatformCapturer) func() {
+	window := capturer.CapturedWindow()
+	if window == nil {
+		return nil
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.capturer != capturer || sc.window == nil || reflect.DeepEqual(*sc.window, *window) {
+		return nil
+	}
+	sc.window = window
+	handler := sc.onWindowChanged
+	if handler == nil {
+		return nil
+	}
+	return func() { handler(window) }
+}
+
+// ListWindows returns the top-level windows that can be shared
+func (sc *ScreenCapture) ListWindows() ([]CapturedWindow, error) {
+	sc.mu.RLock()
+	display := X11Display{}
+	if sc.x11Display != nil {
+		display = *sc.x11Display
+	}
+	synthetic := sc.synthetic != nil
+	sc.mu.RUnlock()
+
+	if synthetic {
+		return nil, errWindowCaptureUnsupported
+	}
+	lister, err := newPlatformWindowLister(display)
+	if err != nil {
+		return nil, err
+	}
+	defer lister.Close()
+
+	windows, err := lister.ListWindows()
+	if err != nil {
+		return nil, err
+	}
+	listed := make([]CapturedWindow, 0, len(windows))
+	for _, window := range windows {
+		listed = append(listed, newCapturedWindow(window))
+	}
+	return listed, nil
+}
+
+// handleWindowChanged keeps input confined to the shared window and tells the viewer
+// where it is
+func (wp *WebRTCPeer) handleWindowChanged(window *CapturedWindow) {
+	if wp.inputHandler != nil {
+		// The window's frames are scaled to the encoder size like the monitor's
+		quality := wp.GetQualitySettings()
+		wp.inputHandler.SetEncodedResolution(quality.Width, quality.Height)
+		if err := wp.inputHandler.SetWindow(window); err != nil {
+			log.Printf("[WebRTCPeer] Failed to confine input to the shared window: %v", err)
+		}
+	}
+	if err := wp.sendMonitorsMessage(); err != nil {
+		log.Printf("[WebRTCPeer] Failed to send monitors message: %v", err)
+	}
+}
+
+// handleWindowSelection shares the window a monitor message asks for
+func (wp *WebRTCPeer) handleWindowSelection(selection map[string]interface{}) error {
+	wp.mu.RLock()
+	perMonitor := wp.perMonitorTracks
+	wp.mu.RUnlock()
+	if perMonitor {
+		return fmt.Errorf("window sharing is not available with per-monitor tracks")
+	}
+
+	var target WindowTarget
+	if id, ok := selection["id"].(float64); ok {
+		target.ID = uint32(id)
+	}
+	target.Title, _ = selection["title"].(string)
+	target.Class, _ = selection["class"].(string)
+
+	log.Printf("[WebRTC] Changing capture to window %s", target)
+	if _, err := wp.screenCapture.SetWindow(&target); err != nil {
+		return fmt.Errorf("failed to share window %s: %w", target, err)
+	}
+	return nil
+}
+
+// handleWindowsRequest lists the windows the viewer can share
+func (wp *WebRTCPeer) handleWindowsRequest() error {
+	message := windowsMessage{Type: "windows", Windows: []CapturedWindow{}}
+	windows, err := wp.screenCapture.ListWindows()
+	if err != nil {
+		message.Error = err.Error()
+	} else {
+		message.Windows = windows
+	}
+	return wp.sendDataChannelMessage(message)
+}
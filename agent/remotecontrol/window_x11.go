@@ -0,0 +1,145 @@
+package remotecontrol
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// x11WindowSource captures one top-level window of an X display: the window's
+// rectangle is grabbed from the screen and whatever other windows cover is blacked out
+type x11WindowSource struct {
+	frames  *x11FrameSource
+	windows *x11WindowLister
+	id      uint32
+	last    CapturedWindow // State as of the last frame
+	hidden  *image.RGBA    // Placeholder while the window is not on screen
+}
+
+// newX11WindowSource finds the topmost window matching target on display
+func newX11WindowSource(display X11Display, target WindowTarget) (*x11WindowSource, error) {
+	frames, err := newX11FrameSource(display)
+	if err != nil {
+		return nil, err
+	}
+	windows, err := newX11WindowLister(display)
+	if err != nil {
+		frames.Close()
+		return nil, err
+	}
+	s := &x11WindowSource{frames: frames, windows: windows}
+
+	stacked, err := windows.StackedWindows()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	index, err := findTargetWindow(stacked, target)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.id = stacked[index].ID
+	s.last = s.describe(stacked, index)
+	return s, nil
+}
+
+// refresh reads the window's current geometry, stacking and focus
+func (s *x11WindowSource) refresh() (CapturedWindow, error) {
+	stacked, err := s.windows.StackedWindows()
+	if err != nil {
+		return CapturedWindow{}, err
+	}
+	for i, window := range stacked {
+		if window.ID == s.id {
+			return s.describe(stacked, i), nil
+		}
+	}
+
+	// Minimised, withdrawn or closed: keep the last geometry so the stream stays put
+	hidden := s.last
+	hidden.Visible = false
+	hidden.Focused = false
+	hidden.obscured = nil
+	return hidden, nil
+}
+
+// describe builds the window's state from a stacking list
+func (s *x11WindowSource) describe(stacked []redactionWindow, index int) CapturedWindow {
+	window := capturedWindowAt(stacked, index)
+	if focus, err := s.windows.focusedWindow(); err == nil {
+		window.Focused = s.windows.isInside(focus, xproto.Window(s.id))
+	}
+	return window
+}
+
+// Capture returns the window's pixels at its current geometry
+func (s *x11WindowSource) Capture() (*image.RGBA, error) {
+	window, err := s.refresh()
+	if err != nil {
+		return nil, err
+	}
+	s.last = window
+
+	if !window.Visible {
+		if s.hidden == nil || s.hidden.Bounds().Dx() != window.Width || s.hidden.Bounds().Dy() != window.Height {
+			s.hidden = renderPlaceholderFrame(window.Width, window.Height, windowHiddenText)
+		}
+		return copyRGBA(s.hidden), nil
+	}
+
+	bounds := window.bounds()
+	frame := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	fillRect(frame, frame.Bounds(), 0, 0, 0)
+
+	// Parts of the window off the edge of the screen stay black
+	onScreen := bounds.Intersect(image.Rect(0, 0, s.frames.width, s.frames.height))
+	if !onScreen.Empty() {
+		grab, err := s.frames.captureRect(onScreen)
+		if err != nil {
+			return nil, err
+		}
+		draw.Draw(frame, onScreen.Sub(bounds.Min), grab, image.Point{}, draw.Src)
+	}
+	for _, covered := range window.obscured {
+		fillRect(frame, covered.Sub(bounds.Min).Intersect(frame.Bounds()), 0, 0, 0)
+	}
+	return frame, nil
+}
+
+// Window returns the window's state as of the last frame
+func (s *x11WindowSource) Window() CapturedWindow {
+	return s.last
+}
+
+func (s *x11WindowSource) Close() {
+	s.windows.Close()
+	s.frames.Close()
+}
+
+// x11InputFocusInside reports whether keys sent now reach window: the X input focus
+// is on it, on one of its children or on the frame the window manager put around it.
+// When the focus follows the pointer, the window under the pointer counts.
+func x11InputFocusInside(conn *xgb.Conn, root, window xproto.Window) (bool, error) {
+	focus, err := xproto.GetInputFocus(conn).Reply()
+	if err != nil {
+		return false, fmt.Errorf("failed to get input focus: %w", err)
+	}
+	target := focus.Focus
+	if target == xproto.InputFocusPointerRoot {
+		pointer, err := xproto.QueryPointer(conn, root).Reply()
+		if err != nil {
+			return false, fmt.Errorf("failed to query pointer: %w", err)
+		}
+		target = pointer.Child
+	}
+	if target == xproto.InputFocusNone || target == root {
+		return false, nil
+	}
+	// Window manager frames wrap the client in at most a couple of windows; a focused
+	// ancestor further up (a virtual root) would take keys for every window
+	return x11IsInside(conn, root, target, window, 32) || x11IsInside(conn, root, window, target, 2), nil
+}
@@ -0,0 +1,170 @@
+package remotecontrol
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jezek/xgb"
+)
+
+// X11Display names an X server and the Xauthority file holding its cookie; the
+// zero value is the agent's own $DISPLAY and $XAUTHORITY
+type X11Display struct {
+	Display    string `json:"display"`              // e.g. ":99"
+	XAuthority string `json:"xauthority,omitempty"` // Cookie file (empty = $XAUTHORITY)
+}
+
+const (
+	xauthCookieName = "MIT-MAGIC-COOKIE-1"
+	xauthCookieSize = 16
+
+	// Xauthority address families (Xauth.h)
+	xauthFamilyLocal = 256
+	xauthFamilyWild  = 65535
+)
+
+// dialX11 connects to an X display. xgb only reads the cookie from $XAUTHORITY,
+// which is process-wide, so local displays with their own Xauthority file are
+// dialled here and the cookie is written into the connection setup instead.
+func dialX11(display X11Display) (*xgb.Conn, error) {
+	number, local := localDisplayNumber(display.Display)
+	if !local || display.XAuthority == "" {
+		conn, err := xgb.NewConnDisplay(display.Display)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to X server: %w", err)
+		}
+		return conn, nil
+	}
+
+	cookie, err := readXAuthCookie(display.XAuthority, number)
+	if err != nil {
+		return nil, err
+	}
+
+	socket, err := net.Dial("unix", x11SocketPath(number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X display %s: %w", display.Display, err)
+	}
+	conn, err := xgb.NewConnNet(&x11AuthConn{Conn: socket, cookie: cookie})
+	if err != nil {
+		socket.Close()
+		return nil, fmt.Errorf("failed to set up X display %s: %w", display.Display, err)
+	}
+	return conn, nil
+}
+
+// localDisplayNumber parses a local display name (":1", ":1.0", "unix:1")
+func localDisplayNumber(display string) (int, bool) {
+	host, rest, ok := strings.Cut(display, ":")
+	if !ok || (host != "" && host != "unix") {
+		return 0, false
+	}
+	rest, _, _ = strings.Cut(rest, ".")
+	number, err := strconv.Atoi(rest)
+	if err != nil || number < 0 {
+		return 0, false
+	}
+	return number, true
+}
+
+// x11SocketPath is the Unix socket of a local display
+func x11SocketPath(number int) string {
+	return fmt.Sprintf("/tmp/.X11-unix/X%d", number)
+}
+
+// x11AuthConn puts a MIT-MAGIC-COOKIE-1 into the connection setup request,
+// the first thing xgb writes, replacing whatever authorization it found
+type x11AuthConn struct {
+	net.Conn
+	cookie []byte
+	once   sync.Once
+}
+
+func (c *x11AuthConn) Write(b []byte) (int, error) {
+	setup := false
+	c.once.Do(func() { setup = true })
+	if !setup || len(b) < 12 {
+		return c.Conn.Write(b)
+	}
+
+	// Setup request: byte order, pad, major, minor, name length, data length, pad
+	order := binary.ByteOrder(binary.LittleEndian)
+	if b[0] == 'B' {
+		order = binary.BigEndian
+	}
+	request := make([]byte, 12, 12+xgb.Pad(len(xauthCookieName))+xgb.Pad(len(c.cookie)))
+	copy(request, b[:6])
+	order.PutUint16(request[6:], uint16(len(xauthCookieName)))
+	order.PutUint16(request[8:], uint16(len(c.cookie)))
+	request = append(request, xauthCookieName...)
+	request = append(request, make([]byte, xgb.Pad(len(xauthCookieName))-len(xauthCookieName))...)
+	request = append(request, c.cookie...)
+	request = append(request, make([]byte, xgb.Pad(len(c.cookie))-len(c.cookie))...)
+
+	if _, err := c.Conn.Write(request); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// readXAuthCookie finds the MIT-MAGIC-COOKIE-1 for a local display in an Xauthority file
+func readXAuthCookie(path string, number int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Xauthority: %w", err)
+	}
+	defer file.Close()
+
+	display := strconv.Itoa(number)
+	r := bufio.NewReader(file)
+	for {
+		var family uint16
+		if err := binary.Read(r, binary.BigEndian, &family); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("no cookie for display :%d in %s", number, path)
+			}
+			return nil, fmt.Errorf("failed to read Xauthority: %w", err)
+		}
+
+		var fields [4][]byte // address, display number, name, data
+		for i := range fields {
+			var length uint16
+			if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+				return nil, fmt.Errorf("failed to read Xauthority: %w", err)
+			}
+			fields[i] = make([]byte, length)
+			if _, err := io.ReadFull(r, fields[i]); err != nil {
+				return nil, fmt.Errorf("failed to read Xauthority: %w", err)
+			}
+		}
+
+		if family != xauthFamilyLocal && family != xauthFamilyWild {
+			continue
+		}
+		if (len(fields[1]) == 0 || string(fields[1]) == display) &&
+			string(fields[2]) == xauthCookieName && len(fields[3]) == xauthCookieSize {
+			return fields[3], nil
+		}
+	}
+}
+
+// writeXAuthority writes an Xauthority file holding one cookie for a local display
+func writeXAuthority(path string, number int, cookie []byte) error {
+	var buf []byte
+	buf = binary.BigEndian.AppendUint16(buf, xauthFamilyWild)
+	for _, field := range [][]byte{nil, []byte(strconv.Itoa(number)), []byte(xauthCookieName), cookie} {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(field)))
+		buf = append(buf, field...)
+	}
+	if err := os.WriteFile(path, buf, 0600); err != nil {
+		return fmt.Errorf("failed to write Xauthority: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"deskwise-agent/remotecontrol"
+)
+
+// screenshotMemory is how long an uploaded screenshot's request ID is remembered,
+// so a command the server repeats before seeing the upload is not captured twice
+const screenshotMemory = 10 * time.Minute
+
+var (
+	screenshotsMu      sync.Mutex
+	handledScreenshots = make(map[string]time.Time) // Uploaded, by request ID
+	pendingScreenshots = make(map[string]bool)      // Being captured or uploaded
+)
+
+// handleScreenshotRequest captures and uploads a screenshot requested through rc/poll.
+// A request is only remembered once its upload succeeded; when the capture or upload
+// fails the server is told, and a repeated command is carried out again.
+func handleScreenshotRequest(config Config, request remotecontrol.ScreenshotRequest) {
+	now := time.Now()
+	screenshotsMu.Lock()
+	for id, handled := range handledScreenshots {
+		if now.Sub(handled) > screenshotMemory {
+			delete(handledScreenshots, id)
+		}
+	}
+	_, seen := handledScreenshots[request.RequestID]
+	seen = seen || pendingScreenshots[request.RequestID]
+	if !seen {
+		pendingScreenshots[request.RequestID] = true
+	}
+	screenshotsMu.Unlock()
+	if seen {
+		return
+	}
+
+	uploaded := false
+	defer func() {
+		screenshotsMu.Lock()
+		delete(pendingScreenshots, request.RequestID)
+		if uploaded {
+			handledScreenshots[request.RequestID] = time.Now()
+		}
+		screenshotsMu.Unlock()
+	}()
+
+	log.Printf("[Screenshot] Request %s for ticket %s (monitor %d)", request.RequestID, request.TicketID, request.Monitor)
+	shot, err := rcManager.TakeScreenshot(request)
+	if err != nil {
+		log.Printf("[Screenshot] Failed to take screenshot: %v", err)
+		if err := reportScreenshotFailure(config, request, err); err != nil {
+			log.Printf("[Screenshot] Failed to report failure: %v", err)
+		}
+		return
+	}
+
+	if err := uploadScreenshot(config, request, shot); err != nil {
+		log.Printf("[Screenshot] Failed to upload screenshot: %v", err)
+		if err := reportScreenshotFailure(config, request, fmt.Errorf("upload failed: %w", err)); err != nil {
+			log.Printf("[Screenshot] Failed to report failure: %v", err)
+		}
+		return
+	}
+	uploaded = true
+	log.Printf("[Screenshot] Uploaded screenshot for ticket %s", request.TicketID)
+}
+
+// screenshotURL is the upload endpoint for one request, linked to its ticket
+func screenshotURL(config Config, request remotecontrol.ScreenshotRequest, query url.Values) string {
+	query.Set("requestId", request.RequestID)
+	query.Set("ticketId", request.TicketID)
+	return fmt.Sprintf("%s/api/agent/rc/screenshot?%s", config.ServerURL, query.Encode())
+}
+
+// uploadScreenshot sends the encoded image; its size and capture time travel in the query
+func uploadScreenshot(config Config, request remotecontrol.ScreenshotRequest, shot *remotecontrol.Screenshot) error {
+	query := url.Values{}
+	query.Set("monitor", strconv.Itoa(request.Monitor))
+	query.Set("width", strconv.Itoa(shot.Width))
+	query.Set("height", strconv.Itoa(shot.Height))
+	query.Set("capturedAt", shot.Captured.UTC().Format(time.RFC3339))
+
+	return postScreenshot(screenshotURL(config, request, query), config, shot.ContentType, bytes.NewReader(shot.Data))
+}
+
+// reportScreenshotFailure tells the server why no screenshot will arrive for a request
+func reportScreenshotFailure(config Config, request remotecontrol.ScreenshotRequest, failure error) error {
+	body, err := json.Marshal(map[string]string{"error": failure.Error()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return postScreenshot(screenshotURL(config, request, url.Values{}), config, "application/json", bytes.NewReader(body))
+}
+
+func postScreenshot(url string, config Config, contentType string, body io.Reader) error {
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Use credential key for authentication
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", config.CredentialKey))
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(data))
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"deskwise-agent/internal/simserver"
+	"deskwise-agent/remotecontrol"
+)
+
+// TestAgentAgainstSimulator runs the agent's enroll, poll and performance calls
+// against the simulator, with one failed performance post
+func TestAgentAgainstSimulator(t *testing.T) {
+	sim, err := simserver.New(simserver.Options{EnrollmentToken: "enroll-me", RequireEnrollment: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	server := httptest.NewServer(sim.Handler())
+	defer server.Close()
+
+	previous := rcManager
+	rcManager = remotecontrol.NewManager(server.URL, runtime.GOOS, "test")
+	defer func() { rcManager = previous }()
+
+	config := Config{
+		ServerURL:      server.URL,
+		AgentID:        "agent-sim-test",
+		CredentialFile: filepath.Join(t.TempDir(), "credential.json"),
+	}
+	if err := enrollAgent(&config, "wrong-token"); err == nil {
+		t.Fatal("enrollment with the wrong token succeeded")
+	}
+	if err := enrollAgent(&config, "enroll-me"); err != nil {
+		t.Fatalf("enrollment failed: %v", err)
+	}
+	if config.CredentialKey == "" || config.AssetID == "" {
+		t.Fatalf("enrollment left credential %q, asset %q", config.CredentialKey, config.AssetID)
+	}
+	saved := Config{CredentialFile: config.CredentialFile}
+	if err := loadCredential(&saved); err != nil || saved.CredentialKey != config.CredentialKey || saved.AssetID != config.AssetID {
+		t.Errorf("saved credential = %+v, %v", saved, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	checkForRemoteControlSession(config)
+	poll, err := sim.WaitForRequest(ctx, http.MethodGet, "/api/agent/rc/poll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poll.Status != http.StatusOK || poll.AgentID != config.AgentID {
+		t.Errorf("poll answered %d for agent %q", poll.Status, poll.AgentID)
+	}
+
+	if _, err := sim.AddFault(simserver.Fault{Method: http.MethodPost, Path: "/api/agent/performance", Status: http.StatusServiceUnavailable, Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+	capabilities := rcManager.GetCapabilities()
+	snapshot := PerformanceSnapshot{
+		AgentID:      config.AgentID,
+		AssetID:      config.AssetID,
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		TimeWindow:   "realtime",
+		Capabilities: &capabilities,
+	}
+	if err := sendPerformanceData(config, snapshot); err == nil {
+		t.Fatal("performance post succeeded through the injected fault")
+	}
+	if err := sendPerformanceData(config, snapshot); err != nil {
+		t.Fatalf("performance post after the fault: %v", err)
+	}
+
+	var posts []simserver.Request
+	for _, request := range sim.Requests() {
+		if request.Path == "/api/agent/performance" {
+			posts = append(posts, request)
+		}
+	}
+	if len(posts) != 2 || posts[0].Fault == "" || posts[0].Status != http.StatusServiceUnavailable ||
+		posts[1].Fault != "" || posts[1].Status != http.StatusOK {
+		t.Fatalf("performance posts = %+v", posts)
+	}
+
+	agents := sim.Agents()
+	if len(agents) != 1 || agents[0].AgentID != config.AgentID {
+		t.Fatalf("simulator agents = %+v", agents)
+	}
+	if agents[0].PerformanceReports != 1 || len(agents[0].Capabilities) == 0 {
+		t.Errorf("agent reported %d snapshots, capabilities %s", agents[0].PerformanceReports, agents[0].Capabilities)
+	}
+}